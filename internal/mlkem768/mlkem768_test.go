@@ -0,0 +1,151 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mlkem768
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+
+	"golang.org/x/crypto/sha3"
+)
+
+func TestRoundTrip(t *testing.T) {
+	dk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, Ke, err := Encapsulate(rand.Reader, dk.EncapsulationKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	Kd, err := Decapsulate(dk, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(Ke, Kd) {
+		t.Fail()
+	}
+
+	dk1, err := NewKeyFromSeed(dk.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dk.EncapsulationKey(), dk1.EncapsulationKey()) {
+		t.Error("NewKeyFromSeed(dk.Bytes()) produced a different key")
+	}
+
+	dk2, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(dk.EncapsulationKey(), dk2.EncapsulationKey()) {
+		t.Fail()
+	}
+	K2, err := Decapsulate(dk2, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(Ke, K2) {
+		t.Error("decapsulation with the wrong key returned the shared key")
+	}
+}
+
+func TestBadLengths(t *testing.T) {
+	dk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek := dk.EncapsulationKey()
+
+	for i := 0; i < len(ek)-1; i++ {
+		if _, _, err := Encapsulate(rand.Reader, ek[:i]); err == nil {
+			t.Errorf("expected error for ek length %d", i)
+		}
+	}
+	if _, _, err := Encapsulate(rand.Reader, append(ek, 0)); err == nil {
+		t.Errorf("expected error for ek length %d", len(ek)+1)
+	}
+
+	// An encapsulation key with an unreduced coefficient fails the modulus
+	// check.
+	bad := append([]byte(nil), ek...)
+	bad[0], bad[1] = 0xff, 0xff
+	if _, _, err := Encapsulate(rand.Reader, bad); err == nil {
+		t.Error("expected error for unreduced encapsulation key")
+	}
+
+	c, _, err := Encapsulate(rand.Reader, ek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(c)-1; i++ {
+		if _, err := Decapsulate(dk, c[:i]); err == nil {
+			t.Errorf("expected error for c length %d", i)
+		}
+	}
+	if _, err := Decapsulate(dk, append(c, 0)); err == nil {
+		t.Errorf("expected error for c length %d", len(c)+1)
+	}
+}
+
+// TestAccumulated accumulates 10k (or 100 in short mode) random vectors and
+// checks the hash of the result against the values published at
+// https://github.com/C2SP/CCTV/tree/main/ML-KEM, to avoid checking in 150MB
+// of test vectors.
+func TestAccumulated(t *testing.T) {
+	n := 10000
+	expected := "8a518cc63da366322a8e7a818c7a0d63483cb3528d34a4cf42f35d5ad73f22fc"
+	if testing.Short() {
+		n = 100
+		expected = "1114b1b6699ed191734fa339376afa7e285c9e6acf6ff0177d346696ce564415"
+	}
+
+	s := sha3.NewShake128()
+	o := sha3.NewShake128()
+	seed := make([]byte, SeedSize)
+	var msg [messageSize]byte
+	ct1 := make([]byte, CiphertextSize)
+
+	for i := 0; i < n; i++ {
+		s.Read(seed)
+		dk, err := NewKeyFromSeed(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ek := dk.EncapsulationKey()
+		o.Write(ek)
+
+		s.Read(msg[:])
+		ct, k, err := kemEncaps(ek, &msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.Write(ct)
+		o.Write(k)
+
+		kk, err := Decapsulate(dk, ct)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(kk, k) {
+			t.Errorf("k: got %x, expected %x", kk, k)
+		}
+
+		s.Read(ct1)
+		k1, err := Decapsulate(dk, ct1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.Write(k1)
+	}
+
+	got := make([]byte, 32)
+	o.Read(got)
+	if hex.EncodeToString(got) != expected {
+		t.Errorf("got %x, expected %s", got, expected)
+	}
+}
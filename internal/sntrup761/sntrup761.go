@@ -0,0 +1,610 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sntrup761 implements the Streamlined NTRU Prime key encapsulation
+// method with the sntrup761 parameter set, as submitted to round 3 of the NIST
+// post-quantum competition (https://ntruprime.cr.yp.to/).
+//
+// The implementation follows the reference implementation, which is also the
+// one used by OpenSSH, and produces the same outputs for the same randomness.
+package sntrup761
+
+import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"io"
+)
+
+const (
+	p   = 761
+	q   = 4591
+	w   = 286
+	q12 = (q - 1) / 2
+
+	hashBytes    = 32
+	smallBytes   = (p + 3) / 4
+	inputsBytes  = smallBytes
+	roundedBytes = 1007
+	rqBytes      = 1158
+	confirmBytes = 32
+
+	// PublicKeySize is the size of an encoded public key.
+	PublicKeySize = rqBytes
+	// PrivateKeySize is the size of an encoded private key. The private key
+	// embeds the public key.
+	PrivateKeySize = 2*smallBytes + PublicKeySize + inputsBytes + hashBytes
+	// CiphertextSize is the size of a ciphertext produced by Encapsulate.
+	CiphertextSize = roundedBytes + confirmBytes
+	// SharedKeySize is the size of a shared key produced by Encapsulate and
+	// Decapsulate.
+	SharedKeySize = 32
+)
+
+// small is an element of F3, represented as -1, 0 or 1.
+type small = int8
+
+// fq is an element of Fq, represented as -q12...q12.
+type fq = int16
+
+// f3Freeze reduces x modulo 3 into the range -1...1.
+func f3Freeze(x int32) small {
+	r := (x + 1) % 3
+	r += 3 & (r >> 31)
+	return small(r - 1)
+}
+
+// fqFreeze reduces x modulo q into the range -q12...q12.
+func fqFreeze(x int32) fq {
+	r := (x + q12) % q
+	r += q & (r >> 31)
+	return fq(r - q12)
+}
+
+// fqRecip returns the inverse of a1 modulo q, computed as a1^(q-2).
+func fqRecip(a1 fq) fq {
+	ai := a1
+	for i := 1; i < q-2; i++ {
+		ai = fqFreeze(int32(a1) * int32(ai))
+	}
+	return ai
+}
+
+// nonzeroMask returns -1 if x is non-zero and 0 otherwise.
+func nonzeroMask(x int32) int32 {
+	return -int32(uint32(-x|x) >> 31)
+}
+
+// negativeMask returns -1 if x is negative and 0 otherwise.
+func negativeMask(x int32) int32 {
+	return x >> 31
+}
+
+// weightwMask returns 0 if r has exactly w non-zero coefficients, and -1
+// otherwise.
+func weightwMask(r *[p]small) int32 {
+	var weight int32
+	for i := range r {
+		weight += int32(r[i] & 1)
+	}
+	return nonzeroMask(weight - w)
+}
+
+// r3FromRq reduces the coefficients of r modulo 3.
+func r3FromRq(out *[p]small, r *[p]fq) {
+	for i := range r {
+		out[i] = f3Freeze(int32(r[i]))
+	}
+}
+
+// r3Mult sets h = f*g in the ring R3 = F3[x]/(x^p-x-1).
+func r3Mult(h, f, g *[p]small) {
+	var fg [p + p - 1]int32
+	for i := 0; i < p; i++ {
+		for j := 0; j < p; j++ {
+			fg[i+j] += int32(f[i]) * int32(g[j])
+		}
+	}
+	for i := p + p - 2; i >= p; i-- {
+		fg[i-p] += fg[i]
+		fg[i-p+1] += fg[i]
+	}
+	for i := range h {
+		h[i] = f3Freeze(fg[i])
+	}
+}
+
+// r3Recip sets out = 1/in in R3, and returns 0 if in is invertible and -1
+// otherwise.
+func r3Recip(out, in *[p]small) int32 {
+	var f, g, v, r [p + 1]small
+	r[0] = 1
+	f[0] = 1
+	f[p-1], f[p] = -1, -1
+	for i := 0; i < p; i++ {
+		g[p-1-i] = in[i]
+	}
+
+	delta := int32(1)
+	for loop := 0; loop < 2*p-1; loop++ {
+		for i := p; i > 0; i-- {
+			v[i] = v[i-1]
+		}
+		v[0] = 0
+
+		sign := -g[0] * f[0]
+		swap := negativeMask(-delta) & nonzeroMask(int32(g[0]))
+		delta ^= swap & (delta ^ -delta)
+		delta++
+
+		s := small(swap)
+		for i := range f {
+			t := s & (f[i] ^ g[i])
+			f[i] ^= t
+			g[i] ^= t
+			t = s & (v[i] ^ r[i])
+			v[i] ^= t
+			r[i] ^= t
+		}
+
+		for i := range g {
+			g[i] = f3Freeze(int32(g[i]) + int32(sign)*int32(f[i]))
+		}
+		for i := range r {
+			r[i] = f3Freeze(int32(r[i]) + int32(sign)*int32(v[i]))
+		}
+
+		for i := 0; i < p; i++ {
+			g[i] = g[i+1]
+		}
+		g[p] = 0
+	}
+
+	sign := f[0]
+	for i := 0; i < p; i++ {
+		out[i] = sign * v[p-1-i]
+	}
+	return nonzeroMask(delta)
+}
+
+// rqMultSmall sets h = f*g in the ring Rq = Fq[x]/(x^p-x-1).
+func rqMultSmall(h, f *[p]fq, g *[p]small) {
+	// Each product is at most q12 in absolute value, so the sums fit in an
+	// int32 without intermediate reductions.
+	var fg [p + p - 1]int32
+	for i := 0; i < p; i++ {
+		for j := 0; j < p; j++ {
+			fg[i+j] += int32(f[i]) * int32(g[j])
+		}
+	}
+	for i := p + p - 2; i >= p; i-- {
+		fg[i-p] += fg[i]
+		fg[i-p+1] += fg[i]
+	}
+	for i := range h {
+		h[i] = fqFreeze(fg[i])
+	}
+}
+
+// rqMult3 sets h = 3f in Rq.
+func rqMult3(h, f *[p]fq) {
+	for i := range h {
+		h[i] = fqFreeze(3 * int32(f[i]))
+	}
+}
+
+// rqRecip3 sets out = 1/(3*in) in Rq, and returns 0 if in is invertible and
+// -1 otherwise.
+func rqRecip3(out *[p]fq, in *[p]small) int32 {
+	var f, g, v, r [p + 1]fq
+	r[0] = fqRecip(3)
+	f[0] = 1
+	f[p-1], f[p] = -1, -1
+	for i := 0; i < p; i++ {
+		g[p-1-i] = fq(in[i])
+	}
+
+	delta := int32(1)
+	for loop := 0; loop < 2*p-1; loop++ {
+		for i := p; i > 0; i-- {
+			v[i] = v[i-1]
+		}
+		v[0] = 0
+
+		swap := negativeMask(-delta) & nonzeroMask(int32(g[0]))
+		delta ^= swap & (delta ^ -delta)
+		delta++
+
+		s := fq(swap)
+		for i := range f {
+			t := s & (f[i] ^ g[i])
+			f[i] ^= t
+			g[i] ^= t
+			t = s & (v[i] ^ r[i])
+			v[i] ^= t
+			r[i] ^= t
+		}
+
+		f0, g0 := int32(f[0]), int32(g[0])
+		for i := range g {
+			g[i] = fqFreeze(f0*int32(g[i]) - g0*int32(f[i]))
+		}
+		for i := range r {
+			r[i] = fqFreeze(f0*int32(r[i]) - g0*int32(v[i]))
+		}
+
+		for i := 0; i < p; i++ {
+			g[i] = g[i+1]
+		}
+		g[p] = 0
+	}
+
+	scale := int32(fqRecip(f[0]))
+	for i := 0; i < p; i++ {
+		out[i] = fqFreeze(scale * int32(v[p-1-i]))
+	}
+	return nonzeroMask(delta)
+}
+
+// round rounds each coefficient of a to the nearest multiple of 3.
+func round(out, a *[p]fq) {
+	for i := range a {
+		out[i] = a[i] - fq(f3Freeze(int32(a[i])))
+	}
+}
+
+// shortFromList sets out to the polynomial with w coefficients in {-1,1} and
+// the rest 0, at positions determined by sorting in.
+func shortFromList(out *[p]small, in *[p]uint32) {
+	var L [p]uint32
+	for i := 0; i < w; i++ {
+		L[i] = in[i] & 0xfffffffe
+	}
+	for i := w; i < p; i++ {
+		L[i] = (in[i] & 0xfffffffd) | 1
+	}
+	sortUint32(L[:])
+	for i := range L {
+		out[i] = small(L[i]&3) - 1
+	}
+}
+
+// sortUint32 sorts x in place in constant time, using Batcher's merge
+// exchange sort (Knuth, TAOCP Vol. 3, Algorithm 5.2.2M).
+func sortUint32(x []uint32) {
+	n := len(x)
+	if n < 2 {
+		return
+	}
+	top := 1
+	for top < n-top {
+		top += top
+	}
+	for step := top; step > 0; step >>= 1 {
+		q, r, d := top, 0, step
+		for {
+			for i := 0; i < n-d; i++ {
+				if i&step == r {
+					minMax(&x[i], &x[i+d])
+				}
+			}
+			if q == step {
+				break
+			}
+			d, q, r = q-step, q>>1, step
+		}
+	}
+}
+
+// minMax sets a, b = min(a, b), max(a, b) in constant time.
+func minMax(a, b *uint32) {
+	mask := uint32(0 - (uint64(*b)-uint64(*a))>>63)
+	t := (*a ^ *b) & mask
+	*a ^= t
+	*b ^= t
+}
+
+// hashPrefix returns the first 32 bytes of SHA-512(b || in).
+func hashPrefix(b byte, in ...[]byte) []byte {
+	h := sha512.New()
+	h.Write([]byte{b})
+	for _, x := range in {
+		h.Write(x)
+	}
+	return h.Sum(nil)[:hashBytes]
+}
+
+// readUint32s reads len(out) little-endian uint32 values from rand. Like the
+// reference implementation, it reads each value separately, so that the
+// outputs match for deterministic generators that depend on the size of the
+// reads, such as the one used for the NIST known answer tests.
+func readUint32s(rand io.Reader, out []uint32) error {
+	var buf [4]byte
+	for i := range out {
+		if _, err := io.ReadFull(rand, buf[:]); err != nil {
+			return err
+		}
+		out[i] = uint32(buf[0]) | uint32(buf[1])<<8 | uint32(buf[2])<<16 | uint32(buf[3])<<24
+	}
+	return nil
+}
+
+// shortRandom sets out to a random polynomial of weight w.
+func shortRandom(rand io.Reader, out *[p]small) error {
+	var L [p]uint32
+	if err := readUint32s(rand, L[:]); err != nil {
+		return err
+	}
+	shortFromList(out, &L)
+	return nil
+}
+
+// smallRandom sets out to a random polynomial with coefficients in F3.
+func smallRandom(rand io.Reader, out *[p]small) error {
+	var L [p]uint32
+	if err := readUint32s(rand, L[:]); err != nil {
+		return err
+	}
+	for i := range out {
+		out[i] = small(((L[i]&0x3fffffff)*3)>>30) - 1
+	}
+	return nil
+}
+
+// encode appends to out the encoding of the values R[i], with 0 <= R[i] <
+// M[i] < 16384.
+func encode(out []byte, R, M []uint16) []byte {
+	if len(R) == 1 {
+		r, m := R[0], M[0]
+		for m > 1 {
+			out = append(out, byte(r))
+			r >>= 8
+			m = (m + 255) >> 8
+		}
+		return out
+	}
+	R2 := make([]uint16, (len(R)+1)/2)
+	M2 := make([]uint16, (len(R)+1)/2)
+	i := 0
+	for ; i < len(R)-1; i += 2 {
+		m0 := uint32(M[i])
+		r := uint32(R[i]) + uint32(R[i+1])*m0
+		m := uint32(M[i+1]) * m0
+		for m >= 16384 {
+			out = append(out, byte(r))
+			r >>= 8
+			m = (m + 255) >> 8
+		}
+		R2[i/2] = uint16(r)
+		M2[i/2] = uint16(m)
+	}
+	if i < len(R) {
+		R2[i/2] = R[i]
+		M2[i/2] = M[i]
+	}
+	return encode(out, R2, M2)
+}
+
+// decode sets out to the values encoded in S by encode, with 0 < M[i] <
+// 16384. It produces 0 <= out[i] < M[i] for any input.
+func decode(out []uint16, S []byte, M []uint16) {
+	if len(M) == 1 {
+		switch {
+		case M[0] == 1:
+			out[0] = 0
+		case M[0] <= 256:
+			out[0] = uint16(uint32(S[0]) % uint32(M[0]))
+		default:
+			out[0] = uint16((uint32(S[0]) + uint32(S[1])<<8) % uint32(M[0]))
+		}
+		return
+	}
+	half := len(M) / 2
+	R2 := make([]uint16, (len(M)+1)/2)
+	M2 := make([]uint16, (len(M)+1)/2)
+	bottomr := make([]uint16, half)
+	bottomt := make([]uint32, half)
+	i := 0
+	for ; i < len(M)-1; i += 2 {
+		m := uint32(M[i]) * uint32(M[i+1])
+		switch {
+		case m > 256*16383:
+			bottomt[i/2] = 256 * 256
+			bottomr[i/2] = uint16(S[0]) + 256*uint16(S[1])
+			S = S[2:]
+			M2[i/2] = uint16((((m + 255) >> 8) + 255) >> 8)
+		case m >= 16384:
+			bottomt[i/2] = 256
+			bottomr[i/2] = uint16(S[0])
+			S = S[1:]
+			M2[i/2] = uint16((m + 255) >> 8)
+		default:
+			bottomt[i/2] = 1
+			bottomr[i/2] = 0
+			M2[i/2] = uint16(m)
+		}
+	}
+	if i < len(M) {
+		M2[i/2] = M[i]
+	}
+	decode(R2, S, M2)
+	for i = 0; i < len(M)-1; i += 2 {
+		r := uint32(bottomr[i/2]) + bottomt[i/2]*uint32(R2[i/2])
+		r0 := r % uint32(M[i])
+		r1 := (r / uint32(M[i])) % uint32(M[i+1]) // only needed for invalid inputs
+		out[i] = uint16(r0)
+		out[i+1] = uint16(r1)
+	}
+	if i < len(M) {
+		out[i] = R2[i/2]
+	}
+}
+
+// smallEncode appends the encoding of f, four coefficients per byte.
+func smallEncode(s []byte, f *[p]small) []byte {
+	for i := 0; i < p/4; i++ {
+		x := f[4*i] + 1
+		x += (f[4*i+1] + 1) << 2
+		x += (f[4*i+2] + 1) << 4
+		x += (f[4*i+3] + 1) << 6
+		s = append(s, byte(x))
+	}
+	return append(s, byte(f[p-1]+1))
+}
+
+func smallDecode(f *[p]small, s []byte) {
+	for i := 0; i < p/4; i++ {
+		x := s[i]
+		f[4*i] = small(x&3) - 1
+		f[4*i+1] = small(x>>2&3) - 1
+		f[4*i+2] = small(x>>4&3) - 1
+		f[4*i+3] = small(x>>6&3) - 1
+	}
+	f[p-1] = small(s[p/4]&3) - 1
+}
+
+func rqEncode(s []byte, r *[p]fq) []byte {
+	var R, M [p]uint16
+	for i := range r {
+		R[i] = uint16(r[i] + q12)
+		M[i] = q
+	}
+	return encode(s, R[:], M[:])
+}
+
+func rqDecode(r *[p]fq, s []byte) {
+	var R, M [p]uint16
+	for i := range M {
+		M[i] = q
+	}
+	decode(R[:], s, M[:])
+	for i := range r {
+		r[i] = fq(R[i]) - q12
+	}
+}
+
+func roundedEncode(s []byte, r *[p]fq) []byte {
+	var R, M [p]uint16
+	for i := range r {
+		R[i] = uint16((int32(r[i]+q12) * 10923) >> 15)
+		M[i] = (q + 2) / 3
+	}
+	return encode(s, R[:], M[:])
+}
+
+func roundedDecode(r *[p]fq, s []byte) {
+	var R, M [p]uint16
+	for i := range M {
+		M[i] = (q + 2) / 3
+	}
+	decode(R[:], s, M[:])
+	for i := range r {
+		r[i] = fq(R[i])*3 - q12
+	}
+}
+
+// GenerateKey generates a public/private key pair, drawing random bytes from
+// rand.
+func GenerateKey(rand io.Reader) (publicKey, privateKey []byte, err error) {
+	var g, ginv, f [p]small
+	for {
+		if err := smallRandom(rand, &g); err != nil {
+			return nil, nil, err
+		}
+		if r3Recip(&ginv, &g) == 0 {
+			break
+		}
+	}
+	if err := shortRandom(rand, &f); err != nil {
+		return nil, nil, err
+	}
+	var finv, h [p]fq
+	rqRecip3(&finv, &f) // always works
+	rqMultSmall(&h, &finv, &g)
+
+	publicKey = rqEncode(make([]byte, 0, PublicKeySize), &h)
+
+	privateKey = make([]byte, 0, PrivateKeySize)
+	privateKey = smallEncode(privateKey, &f)
+	privateKey = smallEncode(privateKey, &ginv)
+	privateKey = append(privateKey, publicKey...)
+	rho := privateKey[len(privateKey) : len(privateKey)+inputsBytes]
+	if _, err := io.ReadFull(rand, rho); err != nil {
+		return nil, nil, err
+	}
+	privateKey = privateKey[:len(privateKey)+inputsBytes]
+	privateKey = append(privateKey, hashPrefix(4, publicKey)...)
+	return publicKey, privateKey, nil
+}
+
+// hide encrypts r to the public key pk, and returns the ciphertext with the
+// confirmation hash and the encoding of r. cache is hashPrefix(4, pk).
+func hide(r *[p]small, pk, cache []byte) (c, rEnc []byte) {
+	rEnc = smallEncode(make([]byte, 0, inputsBytes), r)
+
+	var h, hr, cr [p]fq
+	rqDecode(&h, pk)
+	rqMultSmall(&hr, &h, r)
+	round(&cr, &hr)
+	c = roundedEncode(make([]byte, 0, CiphertextSize), &cr)
+
+	c = append(c, hashPrefix(2, hashPrefix(3, rEnc), cache)...)
+	return c, rEnc
+}
+
+// Encapsulate generates a shared key and an associated ciphertext from a
+// public key, drawing random bytes from rand.
+func Encapsulate(rand io.Reader, publicKey []byte) (ciphertext, sharedKey []byte, err error) {
+	if len(publicKey) != PublicKeySize {
+		return nil, nil, errors.New("sntrup761: invalid public key length")
+	}
+	var r [p]small
+	if err := shortRandom(rand, &r); err != nil {
+		return nil, nil, err
+	}
+	c, rEnc := hide(&r, publicKey, hashPrefix(4, publicKey))
+	return c, hashPrefix(1, hashPrefix(3, rEnc), c), nil
+}
+
+// Decapsulate generates a shared key from a ciphertext and a private key. If
+// the ciphertext was not produced for this key, the shared key is a
+// pseudorandom value that the other side can't predict.
+func Decapsulate(privateKey, ciphertext []byte) (sharedKey []byte, err error) {
+	if len(privateKey) != PrivateKeySize {
+		return nil, errors.New("sntrup761: invalid private key length")
+	}
+	if len(ciphertext) != CiphertextSize {
+		return nil, errors.New("sntrup761: invalid ciphertext length")
+	}
+	sk := privateKey[:2*smallBytes]
+	pk := privateKey[2*smallBytes : 2*smallBytes+PublicKeySize]
+	rho := privateKey[2*smallBytes+PublicKeySize : 2*smallBytes+PublicKeySize+inputsBytes]
+	cache := privateKey[2*smallBytes+PublicKeySize+inputsBytes:]
+
+	var f, ginv [p]small
+	smallDecode(&f, sk[:smallBytes])
+	smallDecode(&ginv, sk[smallBytes:])
+	var c, cf, cf3 [p]fq
+	roundedDecode(&c, ciphertext[:roundedBytes])
+	rqMultSmall(&cf, &c, &f)
+	rqMult3(&cf3, &cf)
+	var e, ev, r [p]small
+	r3FromRq(&e, &cf3)
+	r3Mult(&ev, &e, &ginv)
+
+	// If ev doesn't have weight w, decryption failed and r is set to a
+	// fixed value of weight w, which will fail the check below.
+	mask := small(weightwMask(&ev))
+	for i := 0; i < w; i++ {
+		r[i] = ((ev[i] ^ 1) &^ mask) ^ 1
+	}
+	for i := w; i < p; i++ {
+		r[i] = ev[i] &^ mask
+	}
+
+	cnew, rEnc := hide(&r, pk, cache)
+	ok := subtle.ConstantTimeCompare(ciphertext, cnew)
+	subtle.ConstantTimeCopy(1-ok, rEnc, rho)
+	return hashPrefix(byte(ok), hashPrefix(3, rEnc), ciphertext), nil
+}
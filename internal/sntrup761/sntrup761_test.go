@@ -0,0 +1,157 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sntrup761
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	pk, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pk) != PublicKeySize || len(sk) != PrivateKeySize {
+		t.Fatalf("got key sizes %d, %d; want %d, %d", len(pk), len(sk), PublicKeySize, PrivateKeySize)
+	}
+	c, k, err := Encapsulate(rand.Reader, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c) != CiphertextSize || len(k) != SharedKeySize {
+		t.Fatalf("got sizes %d, %d; want %d, %d", len(c), len(k), CiphertextSize, SharedKeySize)
+	}
+	k1, err := Decapsulate(sk, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(k, k1) {
+		t.Errorf("shared keys differ: %x, %x", k, k1)
+	}
+
+	// A modified ciphertext yields an unrelated shared key.
+	c[0] ^= 1
+	k2, err := Decapsulate(sk, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(k, k2) {
+		t.Error("modified ciphertext decapsulated to the shared key")
+	}
+
+	if _, _, err := Encapsulate(rand.Reader, pk[1:]); err == nil {
+		t.Error("Encapsulate accepted a short public key")
+	}
+	if _, err := Decapsulate(sk, c[1:]); err == nil {
+		t.Error("Decapsulate accepted a short ciphertext")
+	}
+}
+
+// kat is the AES-256 CTR DRBG used by the NIST PQCgenKAT_kem tool to
+// generate known answer tests.
+type kat struct {
+	key [32]byte
+	v   [16]byte
+}
+
+func newKAT(seed []byte) *kat {
+	r := &kat{}
+	r.update(seed)
+	return r
+}
+
+func (r *kat) block(out []byte) {
+	for i := len(r.v) - 1; i >= 0; i-- {
+		r.v[i]++
+		if r.v[i] != 0 {
+			break
+		}
+	}
+	b, err := aes.NewCipher(r.key[:])
+	if err != nil {
+		panic(err)
+	}
+	b.Encrypt(out, r.v[:])
+}
+
+func (r *kat) update(data []byte) {
+	var temp [48]byte
+	for i := 0; i < 3; i++ {
+		r.block(temp[16*i:])
+	}
+	for i := range data {
+		temp[i] ^= data[i]
+	}
+	copy(r.key[:], temp[:32])
+	copy(r.v[:], temp[32:])
+}
+
+func (r *kat) Read(out []byte) (int, error) {
+	var block [16]byte
+	for n := 0; n < len(out); n += 16 {
+		r.block(block[:])
+		copy(out[n:], block[:])
+	}
+	r.update(nil)
+	return len(out), nil
+}
+
+func TestKAT(t *testing.T) {
+	// This is count = 0 of the procedure of PQCgenKAT_kem, which seeds the
+	// DRBG with the bytes 0, 1, ..., 47 and draws the seed of each entry.
+	// Encapsulation was checked against OpenSSH, which uses the reference
+	// implementation, with sntrup761x25519-sha512@openssh.com key exchanges.
+	var entropy [48]byte
+	for i := range entropy {
+		entropy[i] = byte(i)
+	}
+	seed := make([]byte, 48)
+	newKAT(entropy[:]).Read(seed)
+	if want := "061550234d158c5ec95595fe04ef7a25767f2e24cc2bc479d09d86dc9abcfde7056a8c266f9ef97ed08541dbd2e1ffa1"; hex.EncodeToString(seed) != want {
+		t.Fatalf("got seed %x, want %s", seed, want)
+	}
+
+	r := newKAT(seed)
+	pk, sk, err := GenerateKey(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, k, err := Encapsulate(r, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k1, err := Decapsulate(sk, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(k, k1) {
+		t.Errorf("shared keys differ: %x, %x", k, k1)
+	}
+
+	for _, tt := range []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		{"SHA-256(pk)", sha256Sum(pk), "d1736cf321592955c718fa191ef5b1137dd7593ff3b18d5ed733ac96e7d65ce9"},
+		{"SHA-256(sk)", sha256Sum(sk), "8f8f45cef184cc93e387edc54720102e7f95247ec052ad8440d65c932d4f973d"},
+		{"SHA-256(ct)", sha256Sum(c), "beec3df6e2d1d64eb7fa4c95605ff32aff38ab0e23ff79ff61bbc9832c31e885"},
+		{"ss", k, "344ca5e25f6da5ea95e4a695b1c5446eca9859334532e4a9537669f012c743a2"},
+	} {
+		if hex.EncodeToString(tt.got) != tt.want {
+			t.Errorf("%s: got %x, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func sha256Sum(b []byte) []byte {
+	h := sha256.Sum256(b)
+	return h[:]
+}
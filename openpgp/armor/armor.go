@@ -59,14 +59,60 @@ var armorStart = []byte("-----BEGIN ")
 var armorEnd = []byte("-----END ")
 var armorEndOfLine = []byte("-----")
 
+// DecodeOptions configures the parsing of armored blocks. The zero value
+// accepts blocks without a checksum, as does Decode.
+type DecodeOptions struct {
+	// RequireChecksum rejects blocks without a checksum line.
+	RequireChecksum bool
+	// IgnoreChecksum accepts blocks whose checksum doesn't match their
+	// contents.
+	IgnoreChecksum bool
+	// Lenient accepts blocks without the empty line after the headers,
+	// as written by some implementations when there are no headers, and
+	// lines longer than RFC 4880 allows.
+	Lenient bool
+}
+
 // lineReader wraps a line based reader. It watches for the end of an armor
 // block and records the expected CRC value.
 type lineReader struct {
-	in     *bufio.Reader
-	buf    []byte
-	eof    bool
-	crc    uint32
-	crcSet bool
+	in      *bufio.Reader
+	buf     []byte
+	eof     bool
+	crc     uint32
+	crcSet  bool
+	pending []byte // a line read by Decode that belongs to the body
+	opts    *DecodeOptions
+}
+
+// readLine returns the next line, without trailing whitespace and line
+// ending.
+func (l *lineReader) readLine() (line []byte, err error) {
+	if l.pending != nil {
+		line, l.pending = l.pending, nil
+		return line, nil
+	}
+	line, isPrefix, err := l.in.ReadLine()
+	if err != nil {
+		return
+	}
+	if isPrefix {
+		if !l.opts.Lenient {
+			return nil, ArmorCorrupt
+		}
+		// Copy the start of the line, since ReadLine reuses its
+		// buffer.
+		line = append([]byte(nil), line...)
+		for isPrefix {
+			var more []byte
+			more, isPrefix, err = l.in.ReadLine()
+			if err != nil {
+				return
+			}
+			line = append(line, more...)
+		}
+	}
+	return bytes.TrimRight(line, " \t\r"), nil
 }
 
 func (l *lineReader) Read(p []byte) (n int, err error) {
@@ -80,13 +126,10 @@ func (l *lineReader) Read(p []byte) (n int, err error) {
 		return
 	}
 
-	line, isPrefix, err := l.in.ReadLine()
+	line, err := l.readLine()
 	if err != nil {
 		return
 	}
-	if isPrefix {
-		return 0, ArmorCorrupt
-	}
 
 	if bytes.HasPrefix(line, armorEnd) {
 		l.eof = true
@@ -105,7 +148,7 @@ func (l *lineReader) Read(p []byte) (n int, err error) {
 			uint32(expectedBytes[1])<<8 |
 			uint32(expectedBytes[2])
 
-		line, _, err = l.in.ReadLine()
+		line, err = l.readLine()
 		if err != nil && err != io.EOF {
 			return
 		}
@@ -118,7 +161,7 @@ func (l *lineReader) Read(p []byte) (n int, err error) {
 		return 0, io.EOF
 	}
 
-	if len(line) > 96 {
+	if len(line) > 96 && !l.opts.Lenient {
 		return 0, ArmorCorrupt
 	}
 
@@ -148,8 +191,14 @@ func (r *openpgpReader) Read(p []byte) (n int, err error) {
 	n, err = r.b64Reader.Read(p)
 	r.currentCRC = crc24(r.currentCRC, p[:n])
 
-	if err == io.EOF && r.lReader.crcSet && r.lReader.crc != uint32(r.currentCRC&crc24Mask) {
-		return 0, ArmorCorrupt
+	if err == io.EOF {
+		opts := r.lReader.opts
+		if !r.lReader.crcSet && opts.RequireChecksum {
+			return 0, ArmorCorrupt
+		}
+		if r.lReader.crcSet && r.lReader.crc != uint32(r.currentCRC&crc24Mask) && !opts.IgnoreChecksum {
+			return 0, ArmorCorrupt
+		}
 	}
 
 	return
@@ -158,10 +207,58 @@ func (r *openpgpReader) Read(p []byte) (n int, err error) {
 // Decode reads a PGP armored block from the given Reader. It will ignore
 // leading garbage. If it doesn't find a block, it will return nil, io.EOF. The
 // given Reader is not usable after calling this function: an arbitrary amount
-// of data may have been read past the end of the block.
+// of data may have been read past the end of the block. Use a Decoder to read
+// several blocks.
 func Decode(in io.Reader) (p *Block, err error) {
-	r := bufio.NewReaderSize(in, 100)
+	return decode(bufio.NewReaderSize(in, 100), &DecodeOptions{})
+}
+
+// A Decoder reads a sequence of armored blocks, such as a file that contains
+// several keys and signatures.
+type Decoder struct {
+	r     *bufio.Reader
+	opts  DecodeOptions
+	block *Block
+}
+
+// NewDecoder returns a Decoder that reads blocks from r. If opts is nil, the
+// zero DecodeOptions are used.
+func NewDecoder(r io.Reader, opts *DecodeOptions) *Decoder {
+	d := &Decoder{r: bufio.NewReaderSize(r, 100)}
+	if opts != nil {
+		d.opts = *opts
+	}
+	return d
+}
+
+// Next returns the next block. The unread contents of the previous block are
+// skipped. Leading garbage and text between blocks are ignored. At the end of
+// the input, Next returns nil, io.EOF.
+func (d *Decoder) Next() (*Block, error) {
+	if d.block != nil {
+		// Skip the rest of the previous block without decoding it.
+		lr := &d.block.lReader
+		for !lr.eof {
+			lr.buf = nil
+			if _, err := lr.Read(nil); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		d.block = nil
+	}
+	block, err := decode(d.r, &d.opts)
+	if err != nil {
+		return nil, err
+	}
+	d.block = block
+	return block, nil
+}
+
+func decode(r *bufio.Reader, opts *DecodeOptions) (p *Block, err error) {
 	var line []byte
+	var body []byte
 	ignoreNext := false
 
 TryNextBlock:
@@ -208,6 +305,12 @@ TryNextBlock:
 
 		i := bytes.Index(line, []byte(": "))
 		if i == -1 {
+			if opts.Lenient && !nextIsContinuation {
+				// The headers weren't terminated by an empty
+				// line, so this line is part of the body.
+				body = append([]byte(nil), line...)
+				break
+			}
 			goto TryNextBlock
 		}
 		lastKey = string(line[:i])
@@ -215,6 +318,8 @@ TryNextBlock:
 	}
 
 	p.lReader.in = r
+	p.lReader.pending = body
+	p.lReader.opts = opts
 	p.oReader.currentCRC = crc24Init
 	p.oReader.lReader = &p.lReader
 	p.oReader.b64Reader = base64.NewDecoder(base64.StdEncoding, &p.lReader)
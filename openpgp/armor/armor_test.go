@@ -7,7 +7,9 @@ package armor
 import (
 	"bytes"
 	"hash/adler32"
+	"io"
 	"io/ioutil"
+	"strings"
 	"testing"
 )
 
@@ -70,6 +72,101 @@ func TestLongHeader(t *testing.T) {
 	}
 }
 
+func TestDecoderMultipleBlocks(t *testing.T) {
+	input := "garbage\n" + armorExample1 + "\ntext between blocks\n" + armorLongLine + "\n"
+	d := NewDecoder(strings.NewReader(input), nil)
+
+	first, err := d.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Read only part of the first block.
+	if _, err := first.Body.Read(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	second, err := d.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Header["Version"] != longValueExpected {
+		t.Errorf("second block has headers %v", second.Header)
+	}
+	if _, err := ioutil.ReadAll(second.Body); err != nil {
+		t.Error(err)
+	}
+	if _, err := d.Next(); err != io.EOF {
+		t.Errorf("got %v after the last block, want io.EOF", err)
+	}
+}
+
+func TestDecodeOptions(t *testing.T) {
+	withoutChecksum := strings.Replace(armorExample1, "=/teI\n", "", 1)
+	badChecksum := strings.Replace(armorExample1, "=/teI", "=AAAA", 1)
+	windows := strings.Replace(strings.Replace(armorExample1, "\n", " \r\n", -1), "=/teI", "=/teI\t", 1)
+	noBlankLine := strings.Replace(armorExample1, "Version: GnuPG v1.4.10 (GNU/Linux)\n\n", "", 1)
+
+	tests := []struct {
+		name  string
+		input string
+		opts  DecodeOptions
+		ok    bool
+	}{
+		{"default", armorExample1, DecodeOptions{}, true},
+		{"missing checksum", withoutChecksum, DecodeOptions{}, true},
+		{"missing required checksum", withoutChecksum, DecodeOptions{RequireChecksum: true}, false},
+		{"bad checksum", badChecksum, DecodeOptions{}, false},
+		{"ignored bad checksum", badChecksum, DecodeOptions{IgnoreChecksum: true}, true},
+		{"windows line endings", windows, DecodeOptions{RequireChecksum: true}, true},
+		{"no blank line", noBlankLine, DecodeOptions{}, false},
+		{"lenient no blank line", noBlankLine, DecodeOptions{Lenient: true}, true},
+	}
+	for _, test := range tests {
+		block, err := NewDecoder(strings.NewReader(test.input), &test.opts).Next()
+		if err != nil {
+			if test.ok {
+				t.Errorf("%s: %s", test.name, err)
+			}
+			continue
+		}
+		contents, err := ioutil.ReadAll(block.Body)
+		if test.ok {
+			if err != nil {
+				t.Errorf("%s: %s", test.name, err)
+			} else if adler32.Checksum(contents) != 0x27b144be {
+				t.Errorf("%s: wrong contents", test.name)
+			}
+		} else if err == nil {
+			t.Errorf("%s: decoding succeeded", test.name)
+		}
+	}
+}
+
+func TestEncodeWithConfig(t *testing.T) {
+	var buf bytes.Buffer
+	config := &Config{Version: "1.0", Comment: "first\nsecond", OmitChecksum: true}
+	w, err := EncodeWithConfig(&buf, "PGP MESSAGE", map[string]string{"Hash": "SHA256"}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("hello"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "-----BEGIN PGP MESSAGE-----\nVersion: 1.0\nComment: first\nComment: second\nHash: SHA256\n\naGVsbG8=\n-----END PGP MESSAGE-----"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	block, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contents, err := ioutil.ReadAll(block.Body); err != nil || string(contents) != "hello" {
+		t.Errorf("got %q, %v", contents, err)
+	}
+}
+
 const armorExample1 = `-----BEGIN PGP SIGNATURE-----
 Version: GnuPG v1.4.10 (GNU/Linux)
 
@@ -7,6 +7,8 @@ package armor
 import (
 	"encoding/base64"
 	"io"
+	"sort"
+	"strings"
 )
 
 var armorHeaderSep = []byte(": ")
@@ -98,11 +100,12 @@ func (l *lineBreaker) Close() (err error) {
 // It's built into a stack of io.Writers:
 //    encoding -> base64 encoder -> lineBreaker -> out
 type encoding struct {
-	out       io.Writer
-	breaker   *lineBreaker
-	b64       io.WriteCloser
-	crc       uint32
-	blockType []byte
+	out          io.Writer
+	breaker      *lineBreaker
+	b64          io.WriteCloser
+	crc          uint32
+	blockType    []byte
+	omitChecksum bool
 }
 
 func (e *encoding) Write(data []byte) (n int, err error) {
@@ -117,6 +120,10 @@ func (e *encoding) Close() (err error) {
 	}
 	e.breaker.Close()
 
+	if e.omitChecksum {
+		return writeSlices(e.out, newline, armorEnd, e.blockType, armorEndOfLine)
+	}
+
 	var checksumBytes [3]byte
 	checksumBytes[0] = byte(e.crc >> 16)
 	checksumBytes[1] = byte(e.crc >> 8)
@@ -128,18 +135,59 @@ func (e *encoding) Close() (err error) {
 	return writeSlices(e.out, blockEnd, b64ChecksumBytes[:], newline, armorEnd, e.blockType, armorEndOfLine)
 }
 
+// Config configures the output of EncodeWithConfig.
+type Config struct {
+	// Version, if not empty, is written as a Version header.
+	Version string
+	// Comment, if not empty, is written as Comment headers, one for each
+	// line.
+	Comment string
+	// OmitChecksum omits the CRC-24 checksum line. The checksum adds no
+	// security and the crypto-refresh recommends against emitting it.
+	OmitChecksum bool
+}
+
 // Encode returns a WriteCloser which will encode the data written to it in
 // OpenPGP armor.
 func Encode(out io.Writer, blockType string, headers map[string]string) (w io.WriteCloser, err error) {
+	return EncodeWithConfig(out, blockType, headers, nil)
+}
+
+// EncodeWithConfig is like Encode, but writes the headers and checksum
+// configured by config, which may be nil. The Version and Comment headers
+// precede the given headers, which are written in sorted order.
+func EncodeWithConfig(out io.Writer, blockType string, headers map[string]string, config *Config) (w io.WriteCloser, err error) {
+	if config == nil {
+		config = &Config{}
+	}
 	bType := []byte(blockType)
 	err = writeSlices(out, armorStart, bType, armorEndOfLineOut)
 	if err != nil {
 		return
 	}
 
-	for k, v := range headers {
-		err = writeSlices(out, []byte(k), armorHeaderSep, []byte(v), newline)
-		if err != nil {
+	writeHeader := func(k, v string) error {
+		return writeSlices(out, []byte(k), armorHeaderSep, []byte(v), newline)
+	}
+	if config.Version != "" {
+		if err = writeHeader("Version", config.Version); err != nil {
+			return
+		}
+	}
+	if config.Comment != "" {
+		for _, line := range strings.Split(config.Comment, "\n") {
+			if err = writeHeader("Comment", line); err != nil {
+				return
+			}
+		}
+	}
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err = writeHeader(k, headers[k]); err != nil {
 			return
 		}
 	}
@@ -150,10 +198,11 @@ func Encode(out io.Writer, blockType string, headers map[string]string) (w io.Wr
 	}
 
 	e := &encoding{
-		out:       out,
-		breaker:   newLineBreaker(out, 64),
-		crc:       crc24Init,
-		blockType: bType,
+		out:          out,
+		breaker:      newLineBreaker(out, 64),
+		crc:          crc24Init,
+		blockType:    bType,
+		omitChecksum: config.OmitChecksum,
 	}
 	e.b64 = base64.NewEncoder(base64.StdEncoding, e.breaker)
 	return e, nil
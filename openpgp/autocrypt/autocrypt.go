@@ -0,0 +1,222 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package autocrypt implements the key exchange mechanisms of Autocrypt Level
+// 1: the Autocrypt header, which carries a minimal version of the sender's
+// key in every outgoing mail, and the Autocrypt Setup Message, which
+// transfers a secret key between devices of the same user. See
+// https://autocrypt.org/level1.html.
+package autocrypt // import "golang.org/x/crypto/openpgp/autocrypt"
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// PreferEncrypt is the encryption preference of a peer.
+type PreferEncrypt int
+
+const (
+	// NoPreference means that the peer does not mind whether messages are
+	// encrypted or not.
+	NoPreference PreferEncrypt = iota
+	// Mutual means that the peer prefers encrypted messages, provided
+	// that the recipients agree.
+	Mutual
+)
+
+func (p PreferEncrypt) String() string {
+	if p == Mutual {
+		return "mutual"
+	}
+	return "nopreference"
+}
+
+// parsePreferEncrypt parses the value of a prefer-encrypt attribute. Any
+// value other than "mutual" means no preference.
+func parsePreferEncrypt(s string) PreferEncrypt {
+	if s == "mutual" {
+		return Mutual
+	}
+	return NoPreference
+}
+
+// keyDataLineLength is the number of base64 characters per line of a folded
+// keydata attribute.
+const keyDataLineLength = 76
+
+// A Header is the content of an Autocrypt header, see section 2.1 of the
+// specification.
+type Header struct {
+	Addr          string
+	PreferEncrypt PreferEncrypt
+	// Entity is the key of the sender. When parsed, it holds the
+	// binary key carried in the keydata attribute.
+	Entity *openpgp.Entity
+}
+
+// NewHeader returns a Header that advertises the minimal key of e for addr.
+// See MinimalKey for the rules used to select its components.
+// If config is nil, sensible defaults will be used.
+func NewHeader(addr string, e *openpgp.Entity, prefer PreferEncrypt, config *packet.Config) (*Header, error) {
+	minimal, err := MinimalKey(e, addr, config.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &Header{Addr: addr, PreferEncrypt: prefer, Entity: minimal}, nil
+}
+
+// KeyData returns the binary serialization of the key carried by h.
+func (h *Header) KeyData() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := h.Entity.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Value returns the value of the Autocrypt header for h. The keydata
+// attribute is folded over several lines, so the result is suitable to be
+// written verbatim after "Autocrypt: ".
+func (h *Header) Value() (string, error) {
+	keyData, err := h.KeyData()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("addr=")
+	b.WriteString(h.Addr)
+	b.WriteString("; ")
+	if h.PreferEncrypt == Mutual {
+		b.WriteString("prefer-encrypt=mutual; ")
+	}
+	b.WriteString("keydata=")
+	encoded := base64.StdEncoding.EncodeToString(keyData)
+	for len(encoded) > keyDataLineLength {
+		b.WriteString("\r\n ")
+		b.WriteString(encoded[:keyDataLineLength])
+		encoded = encoded[keyDataLineLength:]
+	}
+	b.WriteString("\r\n ")
+	b.WriteString(encoded)
+	return b.String(), nil
+}
+
+// ParseHeader parses the value of an Autocrypt header. Attributes whose name
+// starts with an underscore are ignored; any other unknown attribute makes
+// the whole header invalid, as required by section 2.1 of the
+// specification.
+func ParseHeader(value string) (*Header, error) {
+	h := new(Header)
+	var keyData string
+	seen := make(map[string]bool)
+	for _, attr := range strings.Split(value, ";") {
+		attr = strings.TrimSpace(attr)
+		if attr == "" {
+			continue
+		}
+		i := strings.IndexByte(attr, '=')
+		if i < 0 {
+			return nil, errors.StructuralError("autocrypt attribute without value: " + attr)
+		}
+		name, val := strings.TrimSpace(attr[:i]), strings.TrimSpace(attr[i+1:])
+		if strings.HasPrefix(name, "_") {
+			continue
+		}
+		if seen[name] {
+			return nil, errors.StructuralError("duplicate autocrypt attribute " + name)
+		}
+		seen[name] = true
+		switch name {
+		case "addr":
+			h.Addr = val
+		case "prefer-encrypt":
+			h.PreferEncrypt = parsePreferEncrypt(val)
+		case "keydata":
+			keyData = val
+		default:
+			return nil, errors.UnsupportedError("critical autocrypt attribute " + name)
+		}
+	}
+	if h.Addr == "" {
+		return nil, errors.StructuralError("autocrypt header without addr")
+	}
+	if keyData == "" {
+		return nil, errors.StructuralError("autocrypt header without keydata")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(removeWhitespace(keyData))
+	if err != nil {
+		return nil, errors.StructuralError("invalid keydata: " + err.Error())
+	}
+	h.Entity, err = openpgp.ReadEntity(packet.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// removeWhitespace strips the folding whitespace from a keydata attribute.
+func removeWhitespace(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// MinimalKey returns a copy of e that only contains the components to be
+// exported in an Autocrypt header, see section 2.1.1 of the specification:
+// the primary key, the user ID matching addr with its self-signature, and the
+// subkey that would be used to encrypt to e at the given time, with its
+// binding signature. Certifications from other keys are dropped. The
+// returned Entity shares its packets with e.
+func MinimalKey(e *openpgp.Entity, addr string, now time.Time) (*openpgp.Entity, error) {
+	var identity *openpgp.Identity
+	primary := e.PrimaryIdentity()
+	for _, ident := range e.Identities {
+		if !strings.EqualFold(ident.UserId.Email, addr) {
+			continue
+		}
+		if identity == nil || ident == primary {
+			identity = ident
+		}
+	}
+	if identity == nil {
+		return nil, errors.InvalidArgumentError("no user ID for " + addr)
+	}
+
+	minimal := &openpgp.Entity{
+		PrimaryKey: e.PrimaryKey,
+		Identities: map[string]*openpgp.Identity{
+			identity.Name: {
+				Name:          identity.Name,
+				UserId:        identity.UserId,
+				SelfSignature: identity.SelfSignature,
+				Signatures:    []*packet.Signature{identity.SelfSignature},
+			},
+		},
+		Revocations: e.Revocations,
+	}
+
+	encryptionKey, ok := e.EncryptionKey(now)
+	if !ok {
+		return nil, errors.InvalidArgumentError("no valid encryption key")
+	}
+	if encryptionKey.PublicKey != e.PrimaryKey {
+		minimal.Subkeys = []openpgp.Subkey{{
+			PublicKey: encryptionKey.PublicKey,
+			Sig:       encryptionKey.SelfSignature,
+		}}
+	}
+	return minimal, nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocrypt
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+var testConfig = &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+
+func newTestEntity(t *testing.T) *openpgp.Entity {
+	e, err := openpgp.NewEntity("Alice", "", "alice@example.org", testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A second identity and a certification from another key must not
+	// end up in the minimal key.
+	other, err := openpgp.NewEntity("Alice", "work", "alice@work.example", testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, ident := range other.Identities {
+		e.Identities[name] = ident
+	}
+	if err := e.SignIdentity("Alice <alice@example.org>", other, testConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddSigningSubkey(testConfig); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestMinimalKey(t *testing.T) {
+	e := newTestEntity(t)
+	minimal, err := MinimalKey(e, "ALICE@example.org", testConfig.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if minimal.PrimaryKey != e.PrimaryKey {
+		t.Error("primary key not kept")
+	}
+	if len(minimal.Identities) != 1 {
+		t.Fatalf("got %d identities, want 1", len(minimal.Identities))
+	}
+	ident, ok := minimal.Identities["Alice <alice@example.org>"]
+	if !ok {
+		t.Fatal("wrong identity selected")
+	}
+	if len(ident.Signatures) != 1 || ident.Signatures[0] != ident.SelfSignature {
+		t.Error("third-party certifications not dropped")
+	}
+	if len(minimal.Subkeys) != 1 || !minimal.Subkeys[0].Sig.FlagEncryptCommunications {
+		t.Error("expected a single encryption subkey")
+	}
+	if minimal.PrivateKey != nil || minimal.Subkeys[0].PrivateKey != nil {
+		t.Error("minimal key contains private key material")
+	}
+
+	if _, err := MinimalKey(e, "bob@example.org", testConfig.Now()); err == nil {
+		t.Error("MinimalKey accepted an address without user ID")
+	}
+}
+
+func TestHeaderRoundTrip(t *testing.T) {
+	e := newTestEntity(t)
+	h, err := NewHeader("alice@example.org", e, Mutual, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := h.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(value, "\r\n") {
+		if len(line) > 78 {
+			t.Errorf("header line too long: %d", len(line))
+		}
+	}
+
+	parsed, err := ParseHeader(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Addr != "alice@example.org" || parsed.PreferEncrypt != Mutual {
+		t.Errorf("got addr=%s prefer-encrypt=%s", parsed.Addr, parsed.PreferEncrypt)
+	}
+	if parsed.Entity.PrimaryKey.KeyId != e.PrimaryKey.KeyId {
+		t.Error("wrong key parsed")
+	}
+	if len(parsed.Entity.Identities) != 1 || len(parsed.Entity.Subkeys) != 1 {
+		t.Errorf("parsed key is not minimal: %d identities, %d subkeys", len(parsed.Entity.Identities), len(parsed.Entity.Subkeys))
+	}
+	if _, ok := parsed.Entity.EncryptionKey(testConfig.Now()); !ok {
+		t.Error("parsed key cannot be encrypted to")
+	}
+}
+
+func TestParseHeaderAttributes(t *testing.T) {
+	e := newTestEntity(t)
+	h, err := NewHeader("alice@example.org", e, NoPreference, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := h.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(value, "prefer-encrypt") {
+		t.Error("prefer-encrypt written without preference")
+	}
+
+	if parsed, err := ParseHeader("_comment=hello; " + value); err != nil {
+		t.Errorf("non-critical attribute rejected: %s", err)
+	} else if parsed.PreferEncrypt != NoPreference {
+		t.Error("wrong preference")
+	}
+	if _, err := ParseHeader("unknown=1; " + value); err == nil {
+		t.Error("unknown critical attribute accepted")
+	}
+	if _, err := ParseHeader("addr=alice@example.org; " + value); err == nil {
+		t.Error("duplicate attribute accepted")
+	}
+	if _, err := ParseHeader("addr=alice@example.org"); err == nil {
+		t.Error("header without keydata accepted")
+	}
+}
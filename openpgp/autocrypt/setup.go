@@ -0,0 +1,248 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocrypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+const (
+	// setupCodeDigits is the number of decimal digits in a setup code.
+	setupCodeDigits = 36
+	// setupCodeGroup is the number of digits per dash-separated group.
+	setupCodeGroup = 4
+
+	// PassphraseFormat is the value of the Passphrase-Format armor
+	// header of a setup message.
+	PassphraseFormat = "numeric9x4"
+
+	preferEncryptHeader = "Autocrypt-Prefer-Encrypt"
+)
+
+const setupDescription = "This message contains all information to transfer your Autocrypt\r\n" +
+	"settings along with your secret key securely from your original\r\n" +
+	"device.\r\n" +
+	"\r\n" +
+	"To set up your new device for Autocrypt, please follow the\r\n" +
+	"instructions that should be presented by your new device.\r\n" +
+	"\r\n" +
+	"You can keep this message and use it as a backup for your secret\r\n" +
+	"key. If you want to do this, you should write down the Setup Code\r\n" +
+	"and store it securely.\r\n"
+
+const setupAttachmentStart = "<html><body>\r\n" +
+	"<p>\r\n" +
+	"This is the Autocrypt setup file used to transfer settings and\r\n" +
+	"keys between clients. You can decrypt it using the setup code\r\n" +
+	"presented on your old device, and then import it into your\r\n" +
+	"keyring.\r\n" +
+	"</p>\r\n" +
+	"\r\n" +
+	"<pre>\r\n"
+
+const setupAttachmentEnd = "\r\n</pre></body></html>\r\n"
+
+// NewSetupCode returns a fresh setup code: 36 random decimal digits, written
+// in nine dash-separated groups of four, see section 4.4.3 of the
+// specification. If rand is nil, the crypto/rand Reader is used.
+func NewSetupCode(rand io.Reader) (string, error) {
+	config := &packet.Config{Rand: rand}
+	digits := make([]byte, 0, setupCodeDigits)
+	var buf [1]byte
+	for len(digits) < setupCodeDigits {
+		if _, err := io.ReadFull(config.Random(), buf[:]); err != nil {
+			return "", err
+		}
+		// Reject the values that would bias the digits.
+		if buf[0] >= 250 {
+			continue
+		}
+		digits = append(digits, '0'+buf[0]%10)
+	}
+	return formatSetupCode(string(digits)), nil
+}
+
+// formatSetupCode splits a string of digits into dash-separated groups.
+func formatSetupCode(digits string) string {
+	groups := make([]string, 0, len(digits)/setupCodeGroup)
+	for len(digits) > 0 {
+		n := setupCodeGroup
+		if n > len(digits) {
+			n = len(digits)
+		}
+		groups = append(groups, digits[:n])
+		digits = digits[n:]
+	}
+	return strings.Join(groups, "-")
+}
+
+// normalizeSetupCode accepts a setup code typed by a user, with or without
+// separators, and returns it in canonical form.
+func normalizeSetupCode(code string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, code)
+	if len(digits) != setupCodeDigits {
+		return "", errors.InvalidArgumentError("setup code must have 36 digits")
+	}
+	return formatSetupCode(digits), nil
+}
+
+// WriteSetupMessage writes an Autocrypt Setup Message transferring e, which
+// must contain its private keys, to w. The secret key is armored, together
+// with the given preference, and then symmetrically encrypted with code,
+// which should have been returned by NewSetupCode. The message starts with
+// its Autocrypt-Setup-Message and Content-Type headers; other headers, such
+// as From, To and Subject, may be written to w beforehand.
+// If config is nil, sensible defaults will be used.
+func WriteSetupMessage(w io.Writer, e *openpgp.Entity, code string, prefer PreferEncrypt, config *packet.Config) error {
+	code, err := normalizeSetupCode(code)
+	if err != nil {
+		return err
+	}
+	if e.PrivateKey == nil {
+		return errors.InvalidArgumentError("entity has no private key")
+	}
+	for _, subkey := range e.Subkeys {
+		if subkey.PrivateKey == nil {
+			return errors.InvalidArgumentError("subkey " + subkey.PublicKey.KeyIdString() + " has no private key")
+		}
+	}
+
+	var secret bytes.Buffer
+	keyWriter, err := armor.Encode(&secret, openpgp.PrivateKeyType, map[string]string{
+		preferEncryptHeader: prefer.String(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := e.SerializePrivateWithoutSigning(keyWriter, config); err != nil {
+		return err
+	}
+	if err := keyWriter.Close(); err != nil {
+		return err
+	}
+
+	var encrypted bytes.Buffer
+	armored, err := armor.Encode(&encrypted, openpgp.MessageType, map[string]string{
+		"Passphrase-Format": PassphraseFormat,
+		"Passphrase-Begin":  code[:2],
+	})
+	if err != nil {
+		return err
+	}
+	plaintext, err := openpgp.SymmetricallyEncrypt(armored, []byte(code), nil, config)
+	if err != nil {
+		return err
+	}
+	if _, err := plaintext.Write(secret.Bytes()); err != nil {
+		return err
+	}
+	if err := plaintext.Close(); err != nil {
+		return err
+	}
+	if err := armored.Close(); err != nil {
+		return err
+	}
+
+	var boundary [16]byte
+	if _, err := io.ReadFull(config.Random(), boundary[:]); err != nil {
+		return err
+	}
+	b := hex.EncodeToString(boundary[:])
+	pre := strings.Replace(encrypted.String(), "\n", "\r\n", -1)
+	return writeStrings(w,
+		"Autocrypt-Setup-Message: v1\r\n",
+		"Content-Type: multipart/mixed; boundary=\"", b, "\"\r\n\r\n",
+		"--", b, "\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n",
+		setupDescription,
+		"\r\n--", b, "\r\n",
+		"Content-Type: application/autocrypt-setup\r\n",
+		"Content-Disposition: attachment; filename=\"autocrypt-setup-message.html\"\r\n\r\n",
+		setupAttachmentStart, pre, setupAttachmentEnd,
+		"\r\n--", b, "--\r\n")
+}
+
+// ReadSetupMessage reads an Autocrypt Setup Message from r, decrypts it with
+// code and returns the transferred secret key, together with the preference
+// recorded with it. The message is searched for the first armored PGP
+// MESSAGE block, so r may hold the whole mail, the setup attachment or only
+// the armored block.
+// If config is nil, sensible defaults will be used.
+func ReadSetupMessage(r io.Reader, code string, config *packet.Config) (*openpgp.Entity, PreferEncrypt, error) {
+	code, err := normalizeSetupCode(code)
+	if err != nil {
+		return nil, NoPreference, err
+	}
+	block, err := armor.Decode(r)
+	if err == io.EOF {
+		return nil, NoPreference, errors.InvalidArgumentError("no armored setup message found")
+	}
+	if err != nil {
+		return nil, NoPreference, err
+	}
+	if block.Type != openpgp.MessageType {
+		return nil, NoPreference, errors.InvalidArgumentError("expected '" + openpgp.MessageType + "', got: " + block.Type)
+	}
+	if format, ok := block.Header["Passphrase-Format"]; ok && format != PassphraseFormat {
+		return nil, NoPreference, errors.UnsupportedError("passphrase format " + format)
+	}
+
+	tried := false
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if tried || !symmetric {
+			return nil, errors.ErrKeyIncorrect
+		}
+		tried = true
+		return []byte(code), nil
+	}
+	md, err := openpgp.ReadMessage(block.Body, openpgp.EntityList{}, prompt, config)
+	if err != nil {
+		return nil, NoPreference, err
+	}
+	secret, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return nil, NoPreference, err
+	}
+
+	keyBlock, err := armor.Decode(bytes.NewReader(secret))
+	if err != nil {
+		return nil, NoPreference, err
+	}
+	if keyBlock.Type != openpgp.PrivateKeyType {
+		return nil, NoPreference, errors.StructuralError("expected '" + openpgp.PrivateKeyType + "', got: " + keyBlock.Type)
+	}
+	e, err := openpgp.ReadEntity(packet.NewReader(keyBlock.Body))
+	if err != nil {
+		return nil, NoPreference, err
+	}
+	if e.PrivateKey == nil {
+		return nil, NoPreference, errors.StructuralError("setup message does not contain a secret key")
+	}
+	return e, parsePreferEncrypt(keyBlock.Header[preferEncryptHeader]), nil
+}
+
+// writeStrings writes its arguments to the given Writer.
+func writeStrings(w io.Writer, strs ...string) error {
+	for _, s := range strs {
+		if _, err := io.WriteString(w, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocrypt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNewSetupCode(t *testing.T) {
+	code, err := NewSetupCode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := strings.Split(code, "-")
+	if len(groups) != 9 {
+		t.Fatalf("got %d groups in %q, want 9", len(groups), code)
+	}
+	for _, g := range groups {
+		if len(g) != 4 || strings.Trim(g, "0123456789") != "" {
+			t.Errorf("bad group %q", g)
+		}
+	}
+
+	normalized, err := normalizeSetupCode(strings.Replace(code, "-", " ", -1))
+	if err != nil || normalized != code {
+		t.Errorf("normalizeSetupCode = %q, %v; want %q", normalized, err, code)
+	}
+	if _, err := normalizeSetupCode("1234-5678"); err == nil {
+		t.Error("short setup code accepted")
+	}
+}
+
+func TestSetupMessageRoundTrip(t *testing.T) {
+	e := newTestEntity(t)
+	code, err := NewSetupCode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSetupMessage(&buf, e, code, Mutual, testConfig); err != nil {
+		t.Fatal(err)
+	}
+	msg := buf.String()
+	if !strings.HasPrefix(msg, "Autocrypt-Setup-Message: v1\r\n") {
+		t.Error("missing Autocrypt-Setup-Message header")
+	}
+	if !strings.Contains(msg, "Passphrase-Format: numeric9x4") || !strings.Contains(msg, "Passphrase-Begin: "+code[:2]) {
+		t.Error("missing passphrase armor headers")
+	}
+
+	got, prefer, err := ReadSetupMessage(strings.NewReader("From: alice@example.org\r\n"+msg), strings.Replace(code, "-", "", -1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefer != Mutual {
+		t.Errorf("prefer-encrypt = %s, want mutual", prefer)
+	}
+	if got.PrimaryKey.KeyId != e.PrimaryKey.KeyId || got.PrivateKey == nil || got.PrivateKey.Encrypted {
+		t.Error("secret key not recovered")
+	}
+	if len(got.Subkeys) != len(e.Subkeys) {
+		t.Errorf("got %d subkeys, want %d", len(got.Subkeys), len(e.Subkeys))
+	}
+
+	wrong := []byte(code)
+	wrong[0] = '0' + (wrong[0]-'0'+1)%10
+	if _, _, err := ReadSetupMessage(strings.NewReader(msg), string(wrong), nil); err == nil {
+		t.Error("wrong setup code accepted")
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gnupg reads the keys that GnuPG 2.1 and later keep in their home
+// directory: the public keys in the pubring.kbx keybox and the private keys
+// in the private-keys-v1.d directory, which gpg-agent manages.
+package gnupg // import "golang.org/x/crypto/openpgp/gnupg"
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// ReadHome reads the public keys of a GnuPG home directory, such as
+// ~/.gnupg, and attaches their private keys as ReadPrivateKeys does.
+func ReadHome(dir string, prompt openpgp.PromptFunction) (openpgp.EntityList, error) {
+	f, err := os.Open(filepath.Join(dir, "pubring.kbx"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	el, err := ReadKeybox(f)
+	if err != nil {
+		return nil, err
+	}
+	if err := ReadPrivateKeys(el, filepath.Join(dir, "private-keys-v1.d"), prompt); err != nil {
+		return nil, err
+	}
+	return el, nil
+}
+
+// ReadPrivateKeys attaches private keys from dir, a private-keys-v1.d
+// directory, to the primary keys and subkeys of entities. The key files are
+// named after the keygrips of the keys. Keys without a key file, keys stored
+// on smart cards, keys in unsupported formats and key files that don't match
+// their public key are left without a private key.
+//
+// prompt is called to get the passphrase of a protected key, with the key as
+// its only element. If the passphrase is wrong, prompt is called again. Any
+// error it returns is passed up. If prompt is nil, protected keys are left
+// without a private key.
+func ReadPrivateKeys(entities openpgp.EntityList, dir string, prompt openpgp.PromptFunction) error {
+	for _, e := range entities {
+		if e.PrivateKey == nil {
+			key := openpgp.Key{Entity: e, PublicKey: e.PrimaryKey}
+			priv, err := readPrivateKey(dir, key, prompt)
+			if err != nil {
+				return err
+			}
+			e.PrivateKey = priv
+		}
+		for i := range e.Subkeys {
+			subkey := &e.Subkeys[i]
+			if subkey.PrivateKey != nil {
+				continue
+			}
+			key := openpgp.Key{Entity: e, PublicKey: subkey.PublicKey, SelfSignature: subkey.Sig}
+			priv, err := readPrivateKey(dir, key, prompt)
+			if err != nil {
+				return err
+			}
+			subkey.PrivateKey = priv
+		}
+	}
+	return nil
+}
+
+// readPrivateKey returns the private key of key from dir, or nil if there is
+// none.
+func readPrivateKey(dir string, key openpgp.Key, prompt openpgp.PromptFunction) (*packet.PrivateKey, error) {
+	grip, err := key.PublicKey.Keygrip()
+	if err != nil {
+		return nil, skipUnusable(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, strings.ToUpper(hex.EncodeToString(grip))+".key"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	protected, err := IsProtected(data)
+	if err != nil {
+		return nil, skipUnusable(err)
+	}
+	if !protected {
+		priv, err := ParsePrivateKey(data, key.PublicKey, nil)
+		return priv, skipUnusable(err)
+	}
+	if prompt == nil {
+		return nil, nil
+	}
+	for {
+		passphrase, err := prompt([]openpgp.Key{key}, false)
+		if err != nil {
+			return nil, err
+		}
+		priv, err := ParsePrivateKey(data, key.PublicKey, passphrase)
+		if err != errors.ErrKeyIncorrect {
+			return priv, skipUnusable(err)
+		}
+	}
+}
+
+// skipUnusable returns nil for errors.UnsupportedError and
+// errors.KeyInvalidError, so that keys this package can't read, and key files
+// that don't match their public key, are left without a private key.
+func skipUnusable(err error) error {
+	switch err.(type) {
+	case errors.UnsupportedError, errors.KeyInvalidError:
+		return nil
+	}
+	return err
+}
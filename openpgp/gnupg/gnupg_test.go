@@ -0,0 +1,260 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gnupg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// The test data was created by GnuPG 2.2 with the passphrase "test" for
+// Alice and Bob and no passphrase for Carol. Alice's keys are protected in
+// OCB mode and stored in the extended key format, Bob's keys are protected
+// in CBC mode and stored as S-expressions.
+var testKeygrips = map[string][]string{
+	"Alice <alice@example.org>": {"7D577852A966851FC412112FAF500CB08869B0DB", "CFC7ECB725186286620AA7096B73B2A8F9E5548F"},
+	"Bob <bob@example.org>":     {"B9DCFB2D237A086B8897DE17CA3F98DA9A6E350D", "10CC614CC0B3B2404A6970A341CA5968DC00CC7D"},
+	"Carol <carol@example.org>": {"5FF121883EDBE9E90B40CB5761EF80F49C632A69", "02585EB040E30632CDFEF1D5F3E7373230DF7F40"},
+}
+
+func TestReadHome(t *testing.T) {
+	prompts := 0
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if len(keys) != 1 || symmetric {
+			t.Errorf("prompted for %d keys, symmetric %v", len(keys), symmetric)
+		}
+		prompts++
+		// A wrong passphrase makes ReadHome ask again.
+		if prompts == 1 {
+			return []byte("wrong"), nil
+		}
+		return []byte("test"), nil
+	}
+	el, err := ReadHome("testdata", prompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(el) != len(testKeygrips) {
+		t.Fatalf("got %d entities, want %d", len(el), len(testKeygrips))
+	}
+	// Four protected keys, and one wrong passphrase.
+	if prompts != 5 {
+		t.Errorf("prompted %d times, want 5", prompts)
+	}
+
+	for _, e := range el {
+		var name string
+		for name = range e.Identities {
+		}
+		grips, ok := testKeygrips[name]
+		if !ok {
+			t.Errorf("unexpected identity %q", name)
+			continue
+		}
+		if len(e.Subkeys) != 1 {
+			t.Fatalf("%s: got %d subkeys, want 1", name, len(e.Subkeys))
+		}
+		for i, pk := range []*packet.PublicKey{e.PrimaryKey, e.Subkeys[0].PublicKey} {
+			grip, err := pk.Keygrip()
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			if got := strings.ToUpper(hex.EncodeToString(grip)); got != grips[i] {
+				t.Errorf("%s: key %d has keygrip %s, want %s", name, i, got, grips[i])
+			}
+		}
+		if e.PrivateKey == nil || e.Subkeys[0].PrivateKey == nil {
+			t.Fatalf("%s: private keys not read", name)
+		}
+
+		// The private keys work with the public keys.
+		var buf bytes.Buffer
+		w, err := openpgp.Encrypt(&buf, []*openpgp.Entity{e}, e, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		w.Write([]byte("hello " + name))
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		md, err := openpgp.ReadMessage(&buf, openpgp.EntityList{e}, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		contents, err := ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if string(contents) != "hello "+name {
+			t.Errorf("%s: got %q", name, contents)
+		}
+		if md.SignatureError != nil || md.SignedBy == nil {
+			t.Errorf("%s: signature not verified: %v", name, md.SignatureError)
+		}
+	}
+
+	// Without a prompt, protected keys are skipped.
+	el, err = ReadHome("testdata", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range el {
+		_, carol := e.Identities["Carol <carol@example.org>"]
+		if got := e.PrivateKey != nil; got != carol {
+			t.Errorf("%v: private key read %v, want %v", e.PrimaryKey.KeyIdString(), got, carol)
+		}
+	}
+}
+
+func TestReadPrivateKeysMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gnupg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join("testdata", "private-keys-v1.d")
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range files {
+		data, err := ioutil.ReadFile(filepath.Join(src, fi.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Carol's primary key file claims to hold a DSA key.
+		if fi.Name() == testKeygrips["Carol <carol@example.org>"][0]+".key" {
+			data = bytes.Replace(data, []byte("(ecc "), []byte("(dsa "), 1)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, fi.Name()), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(filepath.Join("testdata", "pubring.kbx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	el, err := ReadKeybox(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ReadPrivateKeys(el, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range el {
+		if _, carol := e.Identities["Carol <carol@example.org>"]; carol {
+			if e.PrivateKey != nil {
+				t.Error("private key read from a file for a different algorithm")
+			}
+			if e.Subkeys[0].PrivateKey == nil {
+				t.Error("private subkey not read")
+			}
+		}
+	}
+}
+
+func TestReadKeybox(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "pubring.kbx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	el, err := ReadKeybox(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(el) != 3 {
+		t.Errorf("got %d entities, want 3", len(el))
+	}
+
+	// Flip a bit in the keyblock of the first key.
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)/4] ^= 1
+	if _, err := ReadKeybox(bytes.NewReader(corrupt)); err == nil {
+		t.Error("corrupt keybox read without error")
+	}
+	if _, err := ReadKeybox(bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Error("truncated keybox read without error")
+	}
+	if _, err := ReadKeybox(strings.NewReader("")); err == nil {
+		t.Error("empty keybox read without error")
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "pubring.kbx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	el, err := ReadKeybox(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alice *openpgp.Entity
+	for _, e := range el {
+		if _, ok := e.Identities["Alice <alice@example.org>"]; ok {
+			alice = e
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "private-keys-v1.d", testKeygrips["Alice <alice@example.org>"][0]+".key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if protected, err := IsProtected(data); err != nil || !protected {
+		t.Errorf("IsProtected: %v, %v", protected, err)
+	}
+	if _, err := ParsePrivateKey(data, alice.PrimaryKey, []byte("wrong")); err != errors.ErrKeyIncorrect {
+		t.Errorf("wrong passphrase: got %v, want ErrKeyIncorrect", err)
+	}
+	if _, err := ParsePrivateKey(data, alice.Subkeys[0].PublicKey, []byte("test")); err == nil {
+		t.Error("private key accepted for a different public key")
+	}
+	priv, err := ParsePrivateKey(data, alice.PrimaryKey, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if priv.Encrypted || priv.KeyId != alice.PrimaryKey.KeyId {
+		t.Error("bad private key")
+	}
+}
+
+func TestParseSexp(t *testing.T) {
+	for _, test := range []struct {
+		in, canonical string
+	}{
+		{"(3:abc)", "(3:abc)"},
+		{"(abc (d #0102#) |AwQ=|)", "(3:abc(1:d2:\x01\x02)2:\x03\x04)"},
+		{"(a \"b\\x41\\n\\101\\\"\")", "(1:a5:bA\nA\")"},
+		{"(a #01\n 02#)", "(1:a2:\x01\x02)"},
+		{"(a [text/plain] 2:bc)", "(1:a2:bc)"},
+		{"(a 2:\x00))", "(1:a2:\x00))"},
+		{"(a ())", "(1:a())"},
+	} {
+		s, _, err := parseSexp([]byte(test.in))
+		if err != nil {
+			t.Errorf("%q: %s", test.in, err)
+			continue
+		}
+		if got := string(s.canonical()); got != test.canonical {
+			t.Errorf("%q: got %q, want %q", test.in, got, test.canonical)
+		}
+	}
+	for _, in := range []string{"", "abc", "(abc", "(3:ab)", "(#01)", "(\"a)", "(a \\)", strings.Repeat("(", 100)} {
+		if _, _, err := parseSexp([]byte(in)); err == nil {
+			t.Errorf("%q parsed without error", in)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gnupg
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/errors"
+)
+
+// Keybox blob types. See keybox/keybox-blob.c in GnuPG.
+const (
+	blobTypeEmpty   = 0
+	blobTypeHeader  = 1
+	blobTypeOpenPGP = 2
+	blobTypeX509    = 3
+)
+
+// maxBlobSize limits the size of a keybox blob, as GnuPG does.
+const maxBlobSize = 10 << 20
+
+// ReadKeybox reads the OpenPGP keys from a keybox file, such as GnuPG's
+// pubring.kbx. X.509 certificates and unsupported keys are skipped.
+func ReadKeybox(r io.Reader) (el openpgp.EntityList, err error) {
+	var lastUnsupportedError error
+	first := true
+	for {
+		blob, err := readBlob(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			if blob[4] != blobTypeHeader || !bytes.Equal(blob[8:12], []byte("KBXf")) {
+				return nil, errors.StructuralError("not a keybox file")
+			}
+			first = false
+			continue
+		}
+		if blob[4] != blobTypeOpenPGP {
+			continue
+		}
+		keyblock, err := openPGPKeyblock(blob)
+		if err != nil {
+			return nil, err
+		}
+		entities, err := openpgp.ReadKeyRing(bytes.NewReader(keyblock))
+		if err != nil {
+			if _, ok := err.(errors.UnsupportedError); ok {
+				lastUnsupportedError = err
+				continue
+			}
+			return nil, err
+		}
+		el = append(el, entities...)
+	}
+	if first {
+		return nil, errors.StructuralError("empty keybox file")
+	}
+	if len(el) == 0 && lastUnsupportedError != nil {
+		return nil, lastUnsupportedError
+	}
+	return el, nil
+}
+
+// readBlob reads a blob, which starts with its length and type.
+func readBlob(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errors.StructuralError("truncated keybox blob")
+		}
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(header[:4])
+	if n < 32 || n > maxBlobSize {
+		return nil, errors.StructuralError("bad keybox blob length")
+	}
+	blob := make([]byte, n)
+	copy(blob, header[:])
+	if _, err := io.ReadFull(r, blob[len(header):]); err != nil {
+		return nil, errors.StructuralError("truncated keybox blob")
+	}
+	return blob, nil
+}
+
+// openPGPKeyblock checks the checksum of an OpenPGP blob and returns the
+// keyblock it contains.
+func openPGPKeyblock(blob []byte) ([]byte, error) {
+	if len(blob) < 40 || blob[5] != 1 {
+		return nil, errors.UnsupportedError("keybox blob version")
+	}
+	offset := binary.BigEndian.Uint32(blob[8:12])
+	length := binary.BigEndian.Uint32(blob[12:16])
+	end := uint64(offset) + uint64(length)
+	if end > uint64(len(blob)-20) {
+		return nil, errors.StructuralError("keyblock outside of keybox blob")
+	}
+
+	// The blob ends with a SHA-1 checksum. Older versions of GnuPG
+	// wrote an MD5 checksum or none at all.
+	data, sum := blob[:len(blob)-20], blob[len(blob)-20:]
+	sha1Sum := sha1.Sum(data)
+	md5Sum := md5.Sum(data)
+	switch {
+	case bytes.Equal(sum, sha1Sum[:]):
+	case bytes.Equal(sum[:16], md5Sum[:]) && bytes.Equal(sum[16:], make([]byte, 4)):
+	case bytes.Equal(sum, make([]byte, 20)):
+	default:
+		return nil, errors.StructuralError("keybox blob checksum mismatch")
+	}
+	return blob[offset:end], nil
+}
@@ -0,0 +1,302 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gnupg
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ocb"
+	"golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/internal/encoding"
+	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/crypto/openpgp/s2k"
+)
+
+// Protection modes of private keys. See agent/keyformat.txt in GnuPG.
+const (
+	protectionCBC = "openpgp-s2k3-sha1-aes-cbc"
+	protectionOCB = "openpgp-s2k3-ocb-aes"
+)
+
+// A keyFile is a parsed private key file.
+type keyFile struct {
+	// key is the private-key or protected-private-key expression.
+	key *sexp
+	// algo is the algorithm list of key, such as (rsa (n ...) ...).
+	algo *sexp
+}
+
+// IsProtected reports whether a private key file is protected with a
+// passphrase.
+func IsProtected(data []byte) (bool, error) {
+	kf, err := parseKeyFile(data)
+	if err != nil {
+		return false, err
+	}
+	return kf.key.name() == "protected-private-key", nil
+}
+
+// ParsePrivateKey parses a private key file from GnuPG's private-keys-v1.d
+// directory, which holds the private part of pub. If the file is protected,
+// it is decrypted with passphrase and errors.ErrKeyIncorrect is returned if
+// the passphrase is wrong.
+func ParsePrivateKey(data []byte, pub *packet.PublicKey, passphrase []byte) (*packet.PrivateKey, error) {
+	kf, err := parseKeyFile(data)
+	if err != nil {
+		return nil, err
+	}
+	params := kf.algo.list[1:]
+	if kf.key.name() == "protected-private-key" {
+		if params, err = kf.unprotect(passphrase); err != nil {
+			return nil, err
+		}
+	}
+	return newPrivateKey(pub, kf.algo.name(), params)
+}
+
+// parseKeyFile parses a key file, which is either an S-expression or, since
+// GnuPG 2.1.12, a list of name-value pairs with the S-expression in the Key
+// item.
+func parseKeyFile(data []byte) (*keyFile, error) {
+	if s := skipSpace(data); len(s) == 0 || s[0] != '(' {
+		var ok bool
+		if data, ok = keyItem(data); !ok {
+			return nil, errors.StructuralError("no key in private key file")
+		}
+	}
+	key, _, err := parseSexp(data)
+	if err != nil {
+		return nil, err
+	}
+	switch key.name() {
+	case "private-key", "protected-private-key":
+	case "shadowed-private-key":
+		return nil, errors.UnsupportedError("private key stored on a smart card")
+	default:
+		return nil, errors.StructuralError("not a private key: " + key.name())
+	}
+	if len(key.list) < 2 || !key.list[1].isList || key.list[1].name() == "" {
+		return nil, errors.StructuralError("private key without algorithm")
+	}
+	return &keyFile{key: key, algo: key.list[1]}, nil
+}
+
+// keyItem returns the value of the Key item of an extended key file.
+// Continuation lines start with white space.
+func keyItem(data []byte) ([]byte, bool) {
+	var value []byte
+	found := false
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			if found {
+				value = append(value, '\n')
+				value = append(value, line[1:]...)
+			}
+			continue
+		}
+		if found {
+			break
+		}
+		i := bytes.IndexByte(line, ':')
+		if i > 0 && strings.EqualFold(string(line[:i]), "Key") {
+			found = true
+			value = append(value, line[i+1:]...)
+		}
+	}
+	return value, found
+}
+
+// unprotect decrypts the protected parameters of the key and returns all of
+// its parameters, in the order of the unprotected key.
+func (kf *keyFile) unprotect(passphrase []byte) ([]*sexp, error) {
+	var prot *sexp
+	var before, after []*sexp
+	for _, e := range kf.algo.list[1:] {
+		switch {
+		case e.name() == "protected":
+			prot = e
+		case prot == nil:
+			before = append(before, e)
+		default:
+			after = append(after, e)
+		}
+	}
+	if prot == nil {
+		return nil, errors.StructuralError("protected private key without protected parameters")
+	}
+
+	// (protected mode ((sha1 salt count) iv) ciphertext)
+	if len(prot.list) != 4 || prot.list[1].isList || !prot.list[2].isList || prot.list[3].isList {
+		return nil, errors.StructuralError("bad protected parameters")
+	}
+	mode, params, ciphertext := string(prot.list[1].atom), prot.list[2], prot.list[3].atom
+	if len(params.list) != 2 || !params.list[0].isList || params.list[1].isList {
+		return nil, errors.StructuralError("bad protection parameters")
+	}
+	s2kParams, iv := params.list[0], params.list[1].atom
+	if len(s2kParams.list) != 3 || s2kParams.name() != "sha1" || s2kParams.list[1].isList || s2kParams.list[2].isList {
+		return nil, errors.UnsupportedError("private key protection S2K")
+	}
+	salt := s2kParams.list[1].atom
+	count, err := strconv.Atoi(string(s2kParams.list[2].atom))
+	if err != nil || len(salt) != 8 || count <= 0 {
+		return nil, errors.StructuralError("bad private key protection S2K")
+	}
+	key := make([]byte, 16)
+	s2k.Iterated(key, sha1.New(), passphrase, salt, count)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var secret *sexp
+	switch mode {
+	case protectionCBC:
+		if len(iv) != block.BlockSize() || len(ciphertext) == 0 || len(ciphertext)%block.BlockSize() != 0 {
+			return nil, errors.StructuralError("bad private key ciphertext")
+		}
+		plaintext := make([]byte, len(ciphertext))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+		// The plaintext is ((params...)(hash sha1 mic)) followed by
+		// padding. Anything else means that the passphrase is wrong.
+		s, _, err := parseSexp(plaintext)
+		if err != nil || !bytes.HasPrefix(plaintext, []byte("((")) || len(s.list) != 2 || s.list[1].name() != "hash" {
+			return nil, errors.ErrKeyIncorrect
+		}
+		secret = s.list[0]
+		mic := sha1.Sum(unprotectedAlgo(kf.algo.name(), before, secret.list, after).canonical())
+		hashList := s.list[1]
+		if len(hashList.list) != 3 || string(hashList.list[1].atom) != "sha1" ||
+			subtle.ConstantTimeCompare(hashList.list[2].atom, mic[:]) != 1 {
+			return nil, errors.ErrKeyIncorrect
+		}
+	case protectionOCB:
+		aead, err := ocb.NewOCBWithNonceAndTagSize(block, len(iv), 16)
+		if err != nil {
+			return nil, errors.StructuralError("bad private key nonce")
+		}
+		// The associated data is the key without the protected
+		// parameters.
+		ad := unprotectedAlgo(kf.algo.name(), before, nil, after).canonical()
+		plaintext, err := aead.Open(nil, iv, ciphertext, ad)
+		if err != nil {
+			return nil, errors.ErrKeyIncorrect
+		}
+		// The plaintext is ((params...)).
+		s, _, err := parseSexp(plaintext)
+		if err != nil || len(s.list) != 1 || !s.list[0].isList {
+			return nil, errors.StructuralError("bad protected parameters")
+		}
+		secret = s.list[0]
+	default:
+		return nil, errors.UnsupportedError("private key protection " + strconv.Quote(mode))
+	}
+	for _, e := range secret.list {
+		if !e.isList {
+			return nil, errors.StructuralError("bad protected parameters")
+		}
+	}
+
+	all := append(before, secret.list...)
+	return append(all, after...), nil
+}
+
+// unprotectedAlgo builds the algorithm list of the unprotected key.
+func unprotectedAlgo(name string, before, secret, after []*sexp) *sexp {
+	algo := &sexp{isList: true, list: []*sexp{{atom: []byte(name)}}}
+	algo.list = append(algo.list, before...)
+	algo.list = append(algo.list, secret...)
+	algo.list = append(algo.list, after...)
+	return algo
+}
+
+// newPrivateKey returns the private key for pub with the secret parameters
+// of a key file. The key is serialized as an unencrypted secret key packet
+// so that it is validated like a key read from an OpenPGP keyring.
+func newPrivateKey(pub *packet.PublicKey, algo string, params []*sexp) (*packet.PrivateKey, error) {
+	param := func(name string) []byte {
+		for _, p := range params {
+			if p.name() == name {
+				return p.value()
+			}
+		}
+		return nil
+	}
+
+	var names []string
+	switch pub.PubKeyAlgo {
+	case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSAEncryptOnly, packet.PubKeyAlgoRSASignOnly:
+		algo, names = algo+"/rsa", []string{"d", "p", "q", "u"}
+	case packet.PubKeyAlgoDSA:
+		algo, names = algo+"/dsa", []string{"x"}
+	case packet.PubKeyAlgoElGamal:
+		algo, names = algo+"/elg", []string{"x"}
+	case packet.PubKeyAlgoECDSA, packet.PubKeyAlgoECDH, packet.PubKeyAlgoEdDSA:
+		algo, names = algo+"/ecc", []string{"d"}
+	default:
+		return nil, errors.UnsupportedError("public key type: " + strconv.Itoa(int(pub.PubKeyAlgo)))
+	}
+	// The algorithm of the key file must match the public key. ECDSA
+	// keys may be stored as "ecdsa" by old versions of GnuPG.
+	switch algo {
+	case "rsa/rsa", "dsa/dsa", "elg/elg", "ecc/ecc", "ecdsa/ecc", "ecdh/ecc":
+	default:
+		return nil, errors.KeyInvalidError("private key file for a different algorithm: " + algo)
+	}
+
+	var secret bytes.Buffer
+	for _, name := range names {
+		value := param(name)
+		if value == nil {
+			return nil, errors.StructuralError("private key without parameter " + name)
+		}
+		secret.Write(encoding.NewMPI(value).EncodedBytes())
+	}
+
+	var buf bytes.Buffer
+	if err := pub.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	op, err := packet.NewOpaqueReader(&buf).Next()
+	if err != nil {
+		return nil, err
+	}
+	contents := append([]byte(nil), op.Contents...)
+	contents = append(contents, 0) // unencrypted
+	if pub.Version == 5 {
+		var count [5]byte
+		binary.BigEndian.PutUint32(count[1:], uint32(secret.Len()))
+		contents = append(contents, count[:]...)
+	}
+	var checksum uint16
+	for _, b := range secret.Bytes() {
+		checksum += uint16(b)
+	}
+	contents = append(contents, secret.Bytes()...)
+	contents = append(contents, byte(checksum>>8), byte(checksum))
+
+	op.Tag = 5 // secret key
+	if pub.IsSubkey {
+		op.Tag = 7 // secret subkey
+	}
+	op.Contents = contents
+	p, err := op.Parse()
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := p.(*packet.PrivateKey)
+	if !ok {
+		return nil, errors.StructuralError("private key file does not match the public key")
+	}
+	return priv, nil
+}
@@ -0,0 +1,259 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gnupg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+
+	"golang.org/x/crypto/openpgp/errors"
+)
+
+// An sexp is a node of an S-expression, as used by libgcrypt: either a list
+// or an atom.
+type sexp struct {
+	list []*sexp
+	atom []byte
+	// isList distinguishes the empty list from the empty atom.
+	isList bool
+}
+
+// name returns the first element of a list if it is an atom.
+func (s *sexp) name() string {
+	if !s.isList || len(s.list) == 0 || s.list[0].isList {
+		return ""
+	}
+	return string(s.list[0].atom)
+}
+
+// find returns the first sublist of s named name, or nil.
+func (s *sexp) find(name string) *sexp {
+	for _, e := range s.list {
+		if e.isList && e.name() == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// value returns the atom following the name of a list such as (n #00...#),
+// or nil.
+func (s *sexp) value() []byte {
+	if s == nil || len(s.list) < 2 || s.list[1].isList {
+		return nil
+	}
+	return s.list[1].atom
+}
+
+// canonical returns the canonical encoding of s.
+func (s *sexp) canonical() []byte {
+	var buf bytes.Buffer
+	s.writeCanonical(&buf)
+	return buf.Bytes()
+}
+
+func (s *sexp) writeCanonical(buf *bytes.Buffer) {
+	if !s.isList {
+		buf.WriteString(strconv.Itoa(len(s.atom)))
+		buf.WriteByte(':')
+		buf.Write(s.atom)
+		return
+	}
+	buf.WriteByte('(')
+	for _, e := range s.list {
+		e.writeCanonical(buf)
+	}
+	buf.WriteByte(')')
+}
+
+// parseSexp parses an S-expression in either the canonical or the advanced
+// format and returns it with the remaining input.
+func parseSexp(data []byte) (*sexp, []byte, error) {
+	data = skipSpace(data)
+	if len(data) == 0 || data[0] != '(' {
+		return nil, nil, errors.StructuralError("S-expression is not a list")
+	}
+	return parseSexpElement(data, 0)
+}
+
+// maxSexpDepth limits the nesting of lists, which is shallow in key files.
+const maxSexpDepth = 16
+
+func parseSexpElement(data []byte, depth int) (*sexp, []byte, error) {
+	data = skipSpace(data)
+	if len(data) == 0 {
+		return nil, nil, errors.StructuralError("truncated S-expression")
+	}
+	c := data[0]
+	switch {
+	case c == '(':
+		if depth >= maxSexpDepth {
+			return nil, nil, errors.StructuralError("S-expression nested too deeply")
+		}
+		s := &sexp{isList: true}
+		data = data[1:]
+		for {
+			data = skipSpace(data)
+			if len(data) == 0 {
+				return nil, nil, errors.StructuralError("truncated S-expression")
+			}
+			if data[0] == ')' {
+				return s, data[1:], nil
+			}
+			e, rest, err := parseSexpElement(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			s.list = append(s.list, e)
+			data = rest
+		}
+	case c >= '0' && c <= '9':
+		// A verbatim atom, 3:abc, or a length prefix of one of the
+		// other encodings, which is redundant.
+		i := 0
+		for i < len(data) && data[i] >= '0' && data[i] <= '9' {
+			i++
+		}
+		if i == len(data) {
+			return nil, nil, errors.StructuralError("truncated S-expression")
+		}
+		if data[i] != ':' {
+			return parseSexpElement(data[i:], depth)
+		}
+		n, err := strconv.Atoi(string(data[:i]))
+		if err != nil || n > len(data)-i-1 {
+			return nil, nil, errors.StructuralError("bad S-expression atom length")
+		}
+		data = data[i+1:]
+		return &sexp{atom: data[:n]}, data[n:], nil
+	case c == '#':
+		end := bytes.IndexByte(data[1:], '#')
+		if end < 0 {
+			return nil, nil, errors.StructuralError("unterminated hex string")
+		}
+		atom, err := hex.DecodeString(string(removeSpace(data[1 : end+1])))
+		if err != nil {
+			return nil, nil, errors.StructuralError("bad hex string")
+		}
+		return &sexp{atom: atom}, data[end+2:], nil
+	case c == '|':
+		end := bytes.IndexByte(data[1:], '|')
+		if end < 0 {
+			return nil, nil, errors.StructuralError("unterminated base64 string")
+		}
+		atom, err := base64.StdEncoding.DecodeString(string(removeSpace(data[1 : end+1])))
+		if err != nil {
+			return nil, nil, errors.StructuralError("bad base64 string")
+		}
+		return &sexp{atom: atom}, data[end+2:], nil
+	case c == '"':
+		return parseQuotedString(data[1:])
+	case c == '[':
+		// Display hints carry no meaning for keys; skip them.
+		end := bytes.IndexByte(data, ']')
+		if end < 0 {
+			return nil, nil, errors.StructuralError("unterminated display hint")
+		}
+		return parseSexpElement(data[end+1:], depth)
+	case isTokenChar(c):
+		i := 0
+		for i < len(data) && isTokenChar(data[i]) {
+			i++
+		}
+		return &sexp{atom: data[:i]}, data[i:], nil
+	}
+	return nil, nil, errors.StructuralError("bad character in S-expression: " + strconv.Quote(string(c)))
+}
+
+// parseQuotedString parses the rest of a quoted string, handling the C
+// escapes that libgcrypt produces.
+func parseQuotedString(data []byte) (*sexp, []byte, error) {
+	var atom []byte
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if c == '"' {
+			return &sexp{atom: atom}, data[i+1:], nil
+		}
+		if c != '\\' {
+			atom = append(atom, c)
+			continue
+		}
+		i++
+		if i == len(data) {
+			break
+		}
+		switch c = data[i]; c {
+		case 'b':
+			atom = append(atom, '\b')
+		case 't':
+			atom = append(atom, '\t')
+		case 'v':
+			atom = append(atom, '\v')
+		case 'n':
+			atom = append(atom, '\n')
+		case 'f':
+			atom = append(atom, '\f')
+		case 'r':
+			atom = append(atom, '\r')
+		case '"', '\'', '\\':
+			atom = append(atom, c)
+		case 'x':
+			if i+2 >= len(data) {
+				return nil, nil, errors.StructuralError("truncated escape in quoted string")
+			}
+			b, err := hex.DecodeString(string(data[i+1 : i+3]))
+			if err != nil {
+				return nil, nil, errors.StructuralError("bad escape in quoted string")
+			}
+			atom = append(atom, b[0])
+			i += 2
+		case '\r', '\n':
+			// A line continuation, possibly followed by the other
+			// line break character.
+			if i+1 < len(data) && (data[i+1] == '\r' || data[i+1] == '\n') && data[i+1] != c {
+				i++
+			}
+		default:
+			if c < '0' || c > '7' || i+2 >= len(data) {
+				return nil, nil, errors.StructuralError("bad escape in quoted string")
+			}
+			n, err := strconv.ParseUint(string(data[i:i+3]), 8, 8)
+			if err != nil {
+				return nil, nil, errors.StructuralError("bad escape in quoted string")
+			}
+			atom = append(atom, byte(n))
+			i += 2
+		}
+	}
+	return nil, nil, errors.StructuralError("unterminated quoted string")
+}
+
+func isTokenChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		bytes.IndexByte([]byte("-./_:*+="), c) >= 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func skipSpace(data []byte) []byte {
+	for len(data) > 0 && isSpace(data[0]) {
+		data = data[1:]
+	}
+	return data
+}
+
+func removeSpace(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for _, c := range data {
+		if !isSpace(c) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hkp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// maxResponseSize bounds the size of a response read from a keyserver.
+const maxResponseSize = 16 << 20
+
+// ErrNotFound is returned when the keyserver has no key matching a search.
+var ErrNotFound = errors.New("hkp: no key found")
+
+// A Client talks to an HKP keyserver.
+type Client struct {
+	// BaseURL is the URL of the keyserver, such as
+	// "hkps://keys.example.org". The hkp scheme stands for http on port
+	// 11371 and the hkps scheme for https; http and https URLs are
+	// used as they are.
+	BaseURL string
+
+	// HTTPClient optionally specifies an HTTP client to use
+	// instead of http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// endpoint returns the URL of the given keyserver path.
+func (c *Client) endpoint(path string) (*url.URL, error) {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "hkp":
+		u.Scheme = "http"
+		if u.Port() == "" {
+			u.Host += ":11371"
+		}
+	case "hkps":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("hkp: unsupported scheme %q", u.Scheme)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	return u, nil
+}
+
+func (c *Client) do(ctx context.Context, req *http.Request) ([]byte, error) {
+	res, err := c.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case res.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("hkp: unexpected status %s", res.Status)
+	}
+	return readAllLimit(res.Body, maxResponseSize)
+}
+
+func readAllLimit(r io.Reader, limit int64) ([]byte, error) {
+	var buf bytes.Buffer
+	n, err := buf.ReadFrom(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > limit {
+		return nil, errors.New("hkp: response too large")
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *Client) lookup(ctx context.Context, op string, q Query) ([]byte, error) {
+	u, err := c.endpoint(lookupPath)
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{
+		"op":      {op},
+		"search":  {q.String()},
+		"options": {"mr"},
+	}
+	if q.Exact {
+		v.Set("exact", "on")
+	}
+	u.RawQuery = v.Encode()
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(ctx, req)
+}
+
+// Get performs the get operation for the given search string, see
+// ParseQuery. Entities that do not match the search are dropped from the
+// response of the keyserver.
+func (c *Client) Get(ctx context.Context, search string) (openpgp.EntityList, error) {
+	q, err := ParseQuery(search, false)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.lookup(ctx, "get", q)
+	if err != nil {
+		return nil, err
+	}
+	el, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	var matching openpgp.EntityList
+	for _, e := range el {
+		if q.Matches(e) {
+			matching = append(matching, e)
+		}
+	}
+	if len(matching) == 0 {
+		return nil, ErrNotFound
+	}
+	return matching, nil
+}
+
+// Index performs the index operation for the given search string and
+// returns the keys listed by the keyserver.
+func (c *Client) Index(ctx context.Context, search string, exact bool) ([]KeyInfo, error) {
+	return c.index(ctx, "index", search, exact)
+}
+
+// VerboseIndex performs the vindex operation. Its machine readable output
+// is the same as that of the index operation.
+func (c *Client) VerboseIndex(ctx context.Context, search string, exact bool) ([]KeyInfo, error) {
+	return c.index(ctx, "vindex", search, exact)
+}
+
+func (c *Client) index(ctx context.Context, op, search string, exact bool) ([]KeyInfo, error) {
+	q, err := ParseQuery(search, exact)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.lookup(ctx, op, q)
+	if err != nil {
+		return nil, err
+	}
+	return ReadIndex(bytes.NewReader(body))
+}
+
+// Add submits the public part of the given entities to the keyserver.
+func (c *Client) Add(ctx context.Context, el openpgp.EntityList) error {
+	var keytext bytes.Buffer
+	w, err := armor.Encode(&keytext, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return err
+	}
+	for _, e := range el {
+		if err := e.Serialize(w); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	u, err := c.endpoint(addPath)
+	if err != nil {
+		return err
+	}
+	form := url.Values{"keytext": {keytext.String()}}
+	req, err := http.NewRequest("POST", u.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = c.do(ctx, req)
+	return err
+}
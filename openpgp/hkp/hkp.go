@@ -0,0 +1,349 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package hkp implements the OpenPGP HTTP Keyserver Protocol, see
+// draft-shaw-openpgp-hkp-00. It provides a Client to look up and submit keys,
+// and a Handler to run a keyserver backed by a pluggable Storage.
+//
+// Only the machine readable output of the index and vindex operations is
+// produced and understood.
+package hkp // import "golang.org/x/crypto/openpgp/hkp"
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+const (
+	lookupPath = "/pks/lookup"
+	addPath    = "/pks/add"
+)
+
+// A Query is a parsed HKP search string. Exactly one of Fingerprint, KeyId
+// or Text is meaningful, depending on the form of the search string.
+type Query struct {
+	// Fingerprint is set when searching for a full v4 or v5 fingerprint.
+	Fingerprint []byte
+	// KeyId is set when searching for a key ID. KeyIdBits is 64 for a
+	// long key ID, 32 for a short key ID and 0 otherwise.
+	KeyId     uint64
+	KeyIdBits int
+	// Text is the search string, when it doesn't denote a key.
+	Text string
+	// Exact requests that Text matches a whole user ID or email address
+	// rather than a substring of one.
+	Exact bool
+}
+
+// ParseQuery parses an HKP search string. Strings starting with "0x"
+// followed by 8, 16, 40 or 64 hexadecimal digits denote short key IDs, key
+// IDs, v4 fingerprints and v5 fingerprints respectively; anything else is
+// searched for in user IDs.
+func ParseQuery(search string, exact bool) (Query, error) {
+	q := Query{Exact: exact}
+	if !strings.HasPrefix(search, "0x") && !strings.HasPrefix(search, "0X") {
+		if search == "" {
+			return q, errors.InvalidArgumentError("empty search")
+		}
+		q.Text = search
+		return q, nil
+	}
+	raw, err := hex.DecodeString(search[2:])
+	if err != nil {
+		return q, errors.InvalidArgumentError("invalid key search: " + search)
+	}
+	switch len(raw) {
+	case 4:
+		q.KeyId = uint64(raw[0])<<24 | uint64(raw[1])<<16 | uint64(raw[2])<<8 | uint64(raw[3])
+		q.KeyIdBits = 32
+	case 8:
+		for _, b := range raw {
+			q.KeyId = q.KeyId<<8 | uint64(b)
+		}
+		q.KeyIdBits = 64
+	case 20, 32:
+		q.Fingerprint = raw
+	default:
+		return q, errors.InvalidArgumentError("invalid key search length: " + search)
+	}
+	return q, nil
+}
+
+// String returns the search string for q.
+func (q Query) String() string {
+	switch {
+	case q.Fingerprint != nil:
+		return "0x" + strings.ToUpper(hex.EncodeToString(q.Fingerprint))
+	case q.KeyIdBits == 32:
+		return fmt.Sprintf("0x%08X", uint32(q.KeyId))
+	case q.KeyIdBits == 64:
+		return fmt.Sprintf("0x%016X", q.KeyId)
+	}
+	return q.Text
+}
+
+// Matches reports whether e is a result of q. Key IDs and fingerprints match
+// the primary key and the subkeys; text matches user IDs case-insensitively.
+func (q Query) Matches(e *openpgp.Entity) bool {
+	keys := []*packet.PublicKey{e.PrimaryKey}
+	for _, subkey := range e.Subkeys {
+		keys = append(keys, subkey.PublicKey)
+	}
+	switch {
+	case q.Fingerprint != nil:
+		for _, k := range keys {
+			if bytes.Equal(k.Fingerprint, q.Fingerprint) {
+				return true
+			}
+		}
+		return false
+	case q.KeyIdBits != 0:
+		for _, k := range keys {
+			if q.KeyIdBits == 32 && uint32(k.KeyId) == uint32(q.KeyId) {
+				return true
+			}
+			if q.KeyIdBits == 64 && k.KeyId == q.KeyId {
+				return true
+			}
+		}
+		return false
+	}
+
+	text := strings.ToLower(q.Text)
+	for _, ident := range e.Identities {
+		id, email := strings.ToLower(ident.Name), strings.ToLower(ident.UserId.Email)
+		if q.Exact && (id == text || email == text) {
+			return true
+		}
+		if !q.Exact && strings.Contains(id, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyInfo is an entry of the machine readable output of the index
+// operation.
+type KeyInfo struct {
+	// Fingerprint is the fingerprint of the key, or its key ID if the
+	// server only returned a key ID.
+	Fingerprint    []byte
+	PubKeyAlgo     packet.PublicKeyAlgorithm
+	BitLength      int
+	CreationTime   time.Time
+	ExpirationTime time.Time // zero if the key doesn't expire.
+	Revoked        bool
+	Disabled       bool
+	Expired        bool
+	Identities     []IdentityInfo
+}
+
+// IdentityInfo describes a user ID in the output of the index operation.
+type IdentityInfo struct {
+	Name           string
+	CreationTime   time.Time
+	ExpirationTime time.Time
+	Revoked        bool
+	Disabled       bool
+	Expired        bool
+}
+
+// NewKeyInfo returns the index entry describing e at the given time.
+func NewKeyInfo(e *openpgp.Entity, now time.Time) KeyInfo {
+	info := KeyInfo{
+		Fingerprint:  e.PrimaryKey.Fingerprint,
+		PubKeyAlgo:   e.PrimaryKey.PubKeyAlgo,
+		CreationTime: e.PrimaryKey.CreationTime,
+		Revoked:      len(e.Revocations) > 0,
+	}
+	if bits, err := e.PrimaryKey.BitLength(); err == nil {
+		info.BitLength = int(bits)
+	}
+	if ident := e.PrimaryIdentity(); ident != nil {
+		sig := ident.SelfSignature
+		if sig.KeyLifetimeSecs != nil && *sig.KeyLifetimeSecs != 0 {
+			info.ExpirationTime = e.PrimaryKey.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second)
+		}
+		info.Expired = e.PrimaryKey.KeyExpired(sig, now)
+	}
+	for _, ident := range e.Identities {
+		sig := ident.SelfSignature
+		identInfo := IdentityInfo{
+			Name:         ident.Name,
+			CreationTime: sig.CreationTime,
+			Revoked:      sig.RevocationReason != nil,
+			Expired:      sig.SigExpired(now),
+		}
+		if sig.SigLifetimeSecs != nil && *sig.SigLifetimeSecs != 0 {
+			identInfo.ExpirationTime = sig.CreationTime.Add(time.Duration(*sig.SigLifetimeSecs) * time.Second)
+		}
+		info.Identities = append(info.Identities, identInfo)
+	}
+	return info
+}
+
+// formatTime formats t as seconds since the epoch, or the empty string for
+// the zero time.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	secs, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(secs, 0), nil
+}
+
+func formatFlags(revoked, disabled, expired bool) string {
+	var flags string
+	if revoked {
+		flags += "r"
+	}
+	if disabled {
+		flags += "d"
+	}
+	if expired {
+		flags += "e"
+	}
+	return flags
+}
+
+// escapeUserId escapes the characters of a user ID that are not allowed in
+// the machine readable index: the field separator, the escape character and
+// non-printable characters.
+func escapeUserId(id string) string {
+	var b strings.Builder
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if c == ':' || c == '%' || c < 0x20 || c == 0x7f {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// WriteIndex writes the machine readable index for infos to w, see section
+// 5.2 of the HKP draft.
+func WriteIndex(w io.Writer, infos []KeyInfo) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "info:1:%d\n", len(infos))
+	for _, info := range infos {
+		fmt.Fprintf(bw, "pub:%X:%d:%d:%s:%s:%s\n", info.Fingerprint, info.PubKeyAlgo, info.BitLength,
+			formatTime(info.CreationTime), formatTime(info.ExpirationTime),
+			formatFlags(info.Revoked, info.Disabled, info.Expired))
+		for _, ident := range info.Identities {
+			fmt.Fprintf(bw, "uid:%s:%s:%s:%s\n", escapeUserId(ident.Name),
+				formatTime(ident.CreationTime), formatTime(ident.ExpirationTime),
+				formatFlags(ident.Revoked, ident.Disabled, ident.Expired))
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadIndex parses a machine readable index. Unknown record types are
+// ignored, as required by the HKP draft.
+func ReadIndex(r io.Reader) ([]KeyInfo, error) {
+	var infos []KeyInfo
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		fields := strings.Split(line, ":")
+		switch fields[0] {
+		case "pub":
+			if len(fields) < 2 {
+				return nil, errors.StructuralError("short pub record in index")
+			}
+			for len(fields) < 7 {
+				fields = append(fields, "")
+			}
+			info, err := parsePub(fields)
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, info)
+		case "uid":
+			if len(infos) == 0 {
+				return nil, errors.StructuralError("uid record before pub record in index")
+			}
+			for len(fields) < 5 {
+				fields = append(fields, "")
+			}
+			ident, err := parseUid(fields)
+			if err != nil {
+				return nil, err
+			}
+			last := &infos[len(infos)-1]
+			last.Identities = append(last.Identities, ident)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+func parsePub(fields []string) (info KeyInfo, err error) {
+	if info.Fingerprint, err = hex.DecodeString(fields[1]); err != nil {
+		return info, errors.StructuralError("invalid key in index: " + fields[1])
+	}
+	if fields[2] != "" {
+		algo, err := strconv.ParseUint(fields[2], 10, 8)
+		if err != nil {
+			return info, errors.StructuralError("invalid algorithm in index: " + fields[2])
+		}
+		info.PubKeyAlgo = packet.PublicKeyAlgorithm(algo)
+	}
+	if fields[3] != "" {
+		if info.BitLength, err = strconv.Atoi(fields[3]); err != nil {
+			return info, errors.StructuralError("invalid key length in index: " + fields[3])
+		}
+	}
+	if info.CreationTime, err = parseTime(fields[4]); err != nil {
+		return info, errors.StructuralError("invalid creation time in index: " + fields[4])
+	}
+	if info.ExpirationTime, err = parseTime(fields[5]); err != nil {
+		return info, errors.StructuralError("invalid expiration time in index: " + fields[5])
+	}
+	info.Revoked, info.Disabled, info.Expired = parseFlags(fields[6])
+	return info, nil
+}
+
+func parseUid(fields []string) (ident IdentityInfo, err error) {
+	if ident.Name, err = url.PathUnescape(fields[1]); err != nil {
+		return ident, errors.StructuralError("invalid user ID in index: " + fields[1])
+	}
+	if ident.CreationTime, err = parseTime(fields[2]); err != nil {
+		return ident, errors.StructuralError("invalid creation time in index: " + fields[2])
+	}
+	if ident.ExpirationTime, err = parseTime(fields[3]); err != nil {
+		return ident, errors.StructuralError("invalid expiration time in index: " + fields[3])
+	}
+	ident.Revoked, ident.Disabled, ident.Expired = parseFlags(fields[4])
+	return ident, nil
+}
+
+func parseFlags(flags string) (revoked, disabled, expired bool) {
+	return strings.Contains(flags, "r"), strings.Contains(flags, "d"), strings.Contains(flags, "e")
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hkp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		search string
+		bits   int
+		keyId  uint64
+		fpr    int
+		text   string
+	}{
+		{"0xDEADBEEF", 32, 0xdeadbeef, 0, ""},
+		{"0x0123456789abcdef", 64, 0x0123456789abcdef, 0, ""},
+		{"0x0123456789ABCDEF0123456789ABCDEF01234567", 0, 0, 20, ""},
+		{"0x" + string(bytes.Repeat([]byte("ab"), 32)), 0, 0, 32, ""},
+		{"alice@example.org", 0, 0, 0, "alice@example.org"},
+	}
+	for _, test := range tests {
+		q, err := ParseQuery(test.search, false)
+		if err != nil {
+			t.Errorf("%s: %s", test.search, err)
+			continue
+		}
+		if q.KeyIdBits != test.bits || q.KeyId != test.keyId || len(q.Fingerprint) != test.fpr || q.Text != test.text {
+			t.Errorf("%s: got %+v", test.search, q)
+		}
+		if q2, _ := ParseQuery(q.String(), false); !reflect.DeepEqual(q, q2) {
+			t.Errorf("%s: String does not round-trip: %s", test.search, q.String())
+		}
+	}
+	for _, bad := range []string{"", "0x", "0x123", "0xnothex0"} {
+		if _, err := ParseQuery(bad, false); err == nil {
+			t.Errorf("ParseQuery(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestIndexRoundTrip(t *testing.T) {
+	created := time.Unix(1500000000, 0)
+	infos := []KeyInfo{{
+		Fingerprint:    []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef},
+		PubKeyAlgo:     packet.PubKeyAlgoRSA,
+		BitLength:      2048,
+		CreationTime:   created,
+		ExpirationTime: created.Add(time.Hour),
+		Revoked:        true,
+		Expired:        true,
+		Identities: []IdentityInfo{{
+			Name:         "Alice: 100% <alice@example.org>",
+			CreationTime: created,
+		}, {
+			Name:     "Old Alice",
+			Disabled: true,
+		}},
+	}, {
+		Fingerprint: []byte{0xfe, 0xdc},
+		PubKeyAlgo:  packet.PubKeyAlgoEdDSA,
+	}}
+
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, infos); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadIndex(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, infos) {
+		t.Errorf("got %+v, want %+v", got, infos)
+	}
+}
+
+func TestReadIndexIgnoresUnknownRecords(t *testing.T) {
+	index := "info:1:1\r\npub:0123456789ABCDEF:1:2048:1500000000::\r\nsig:whatever\r\nuid:Alice%3A:1500000000::r\r\n"
+	infos, err := ReadIndex(bytes.NewBufferString(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || len(infos[0].Identities) != 1 || infos[0].Identities[0].Name != "Alice:" || !infos[0].Identities[0].Revoked {
+		t.Errorf("got %+v", infos)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hkp
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// maxUploadSize bounds the size of a key submitted to a Handler.
+const maxUploadSize = 4 << 20
+
+// A Handler serves the HKP lookup and add operations from a Storage.
+// Submitted keys are merged with the stored entity of the same primary key,
+// so that new user IDs, certifications, subkeys and revocations accumulate.
+// Private key material is never stored.
+type Handler struct {
+	Storage Storage
+
+	// Time returns the current time, used to flag expired keys in
+	// indexes. If Time is nil, time.Now is used.
+	Time func() time.Time
+
+	// mu serializes the read-merge-write cycles of submissions.
+	mu sync.Mutex
+}
+
+// NewHandler returns a Handler serving the keys in s.
+func NewHandler(s Storage) *Handler {
+	return &Handler{Storage: s}
+}
+
+func (h *Handler) now() time.Time {
+	if h.Time == nil {
+		return time.Now()
+	}
+	return h.Time()
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case lookupPath:
+		if r.Method != "GET" && r.Method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.serveLookup(w, r)
+	case addPath:
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.serveAdd(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) serveLookup(w http.ResponseWriter, r *http.Request) {
+	v := r.URL.Query()
+	op := v.Get("op")
+	switch op {
+	case "get", "index", "vindex":
+	default:
+		http.Error(w, "operation not implemented", http.StatusNotImplemented)
+		return
+	}
+	q, err := ParseQuery(v.Get("search"), v.Get("exact") == "on")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	el, err := h.Storage.Search(q)
+	if err != nil {
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+	if len(el) == 0 {
+		http.Error(w, "no keys found", http.StatusNotFound)
+		return
+	}
+
+	var buf bytes.Buffer
+	if op == "get" {
+		aw, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		for _, e := range el {
+			if err := e.Serialize(aw); err != nil {
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := aw.Close(); err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pgp-keys")
+	} else {
+		infos := make([]KeyInfo, len(el))
+		for i, e := range el {
+			infos[i] = NewKeyInfo(e, h.now())
+		}
+		WriteIndex(&buf, infos)
+		w.Header().Set("Content-Type", "text/plain")
+	}
+	w.Write(buf.Bytes())
+}
+
+func (h *Handler) serveAdd(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	keytext := r.PostForm.Get("keytext")
+	if keytext == "" {
+		http.Error(w, "missing keytext", http.StatusBadRequest)
+		return
+	}
+	el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(keytext))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range el {
+		e.PrivateKey = nil
+		for i := range e.Subkeys {
+			e.Subkeys[i].PrivateKey = nil
+		}
+		// Merge into the submitted entity, which nobody else holds,
+		// rather than into the stored one, which may be in use.
+		existing, err := h.Storage.Get(e.PrimaryKey.Fingerprint)
+		if err != nil {
+			http.Error(w, "storage error", http.StatusInternalServerError)
+			return
+		}
+		if existing != nil {
+			if err := e.Merge(existing); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := h.Storage.Put(e); err != nil {
+			http.Error(w, "storage error", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("Key(s) added\n"))
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hkp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+var testConfig = &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+
+func newTestEntity(t *testing.T, name string) *openpgp.Entity {
+	e, err := openpgp.NewEntity(name, "", name+"@example.org", testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func newTestServer(t *testing.T) (*Client, *MemoryStorage, func()) {
+	storage := NewMemoryStorage()
+	srv := httptest.NewServer(NewHandler(storage))
+	return &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}, storage, srv.Close
+}
+
+func TestClientAddAndGet(t *testing.T) {
+	client, storage, done := newTestServer(t)
+	defer done()
+	ctx := context.Background()
+
+	alice, bob := newTestEntity(t, "alice"), newTestEntity(t, "bob")
+	if err := client.Add(ctx, openpgp.EntityList{alice, bob}); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := storage.Get(alice.PrimaryKey.Fingerprint); stored == nil || stored.PrivateKey != nil {
+		t.Fatal("alice not stored, or stored with private key")
+	}
+
+	searches := []string{
+		fmt.Sprintf("0x%X", alice.PrimaryKey.Fingerprint),
+		fmt.Sprintf("0x%016X", alice.PrimaryKey.KeyId),
+		fmt.Sprintf("0x%08X", uint32(alice.Subkeys[0].PublicKey.KeyId)),
+		"ALICE@example",
+	}
+	for _, search := range searches {
+		el, err := client.Get(ctx, search)
+		if err != nil {
+			t.Errorf("%s: %s", search, err)
+			continue
+		}
+		if len(el) != 1 || el[0].PrimaryKey.KeyId != alice.PrimaryKey.KeyId {
+			t.Errorf("%s: got %d entities, want alice", search, len(el))
+		}
+	}
+	if el, err := client.Get(ctx, "example.org"); err != nil || len(el) != 2 {
+		t.Errorf("substring search: got %d entities, %v", len(el), err)
+	}
+	if _, err := client.Get(ctx, "carol"); err != ErrNotFound {
+		t.Errorf("unknown key: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestClientIndex(t *testing.T) {
+	client, _, done := newTestServer(t)
+	defer done()
+	ctx := context.Background()
+
+	alice := newTestEntity(t, "alice")
+	if err := client.Add(ctx, openpgp.EntityList{alice}); err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range []func(context.Context, string, bool) ([]KeyInfo, error){client.Index, client.VerboseIndex} {
+		infos, err := index(ctx, "alice@example.org", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(infos) != 1 || len(infos[0].Identities) != 1 {
+			t.Fatalf("got %+v", infos)
+		}
+		if fmt.Sprintf("%X", infos[0].Fingerprint) != fmt.Sprintf("%X", alice.PrimaryKey.Fingerprint) || infos[0].PubKeyAlgo != packet.PubKeyAlgoEdDSA {
+			t.Errorf("bad key info: %+v", infos[0])
+		}
+		if infos[0].Identities[0].Name != "alice <alice@example.org>" {
+			t.Errorf("bad identity: %+v", infos[0].Identities[0])
+		}
+	}
+	if _, err := client.Index(ctx, "alice", true); err != ErrNotFound {
+		t.Errorf("exact search matched a substring: %v", err)
+	}
+}
+
+func TestHandlerMergesCertifications(t *testing.T) {
+	client, storage, done := newTestServer(t)
+	defer done()
+	ctx := context.Background()
+
+	alice, bob := newTestEntity(t, "alice"), newTestEntity(t, "bob")
+	if err := client.Add(ctx, openpgp.EntityList{alice}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bob certifies a copy of alice's key that only carries the
+	// certification, and uploads it.
+	el, err := client.Get(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certified := el[0]
+	if err := certified.SignIdentity("alice <alice@example.org>", bob, testConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Add(ctx, openpgp.EntityList{certified}); err != nil {
+		t.Fatal(err)
+	}
+	// Re-uploading the original key must not drop the certification.
+	if err := client.Add(ctx, openpgp.EntityList{alice}); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, _ := storage.Get(alice.PrimaryKey.Fingerprint)
+	sigs := stored.Identities["alice <alice@example.org>"].Signatures
+	if len(sigs) != 2 {
+		t.Fatalf("got %d signatures, want self-signature and certification", len(sigs))
+	}
+	var certifiedByBob bool
+	for _, sig := range sigs {
+		if sig.IssuerKeyId != nil && *sig.IssuerKeyId == bob.PrimaryKey.KeyId {
+			certifiedByBob = true
+		}
+	}
+	if !certifiedByBob {
+		t.Error("certification by bob missing")
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	h := NewHandler(NewMemoryStorage())
+	tests := []struct {
+		method, target string
+		body           url.Values
+		status         int
+	}{
+		{"GET", "/pks/lookup?op=stats", nil, http.StatusNotImplemented},
+		{"GET", "/pks/lookup?op=get", nil, http.StatusBadRequest},
+		{"GET", "/pks/lookup?op=get&search=nobody", nil, http.StatusNotFound},
+		{"POST", "/pks/lookup?op=get&search=nobody", nil, http.StatusMethodNotAllowed},
+		{"GET", "/pks/add", nil, http.StatusMethodNotAllowed},
+		{"POST", "/pks/add", url.Values{"keytext": {"garbage"}}, http.StatusBadRequest},
+		{"GET", "/", nil, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.target, nil)
+		if test.body != nil {
+			r = httptest.NewRequest(test.method, test.target, strings.NewReader(test.body.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s %s: status %d, want %d", test.method, test.target, w.Code, test.status)
+		}
+	}
+}
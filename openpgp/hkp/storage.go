@@ -0,0 +1,68 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hkp
+
+import (
+	"sync"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// Storage holds the keys served by a Handler. Implementations must be safe
+// for concurrent use.
+type Storage interface {
+	// Get returns the entity whose primary key has the given
+	// fingerprint, or nil if there is none.
+	Get(fingerprint []byte) (*openpgp.Entity, error)
+	// Put stores e, replacing any entity with the same primary key.
+	Put(e *openpgp.Entity) error
+	// Search returns the entities matching q.
+	Search(q Query) (openpgp.EntityList, error)
+}
+
+// MemoryStorage is a Storage that keeps entities in memory.
+type MemoryStorage struct {
+	mu       sync.RWMutex
+	entities map[string]*openpgp.Entity
+	order    []string
+}
+
+// NewMemoryStorage returns an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{entities: make(map[string]*openpgp.Entity)}
+}
+
+// Get implements Storage.
+func (s *MemoryStorage) Get(fingerprint []byte) (*openpgp.Entity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.entities[string(fingerprint)], nil
+}
+
+// Put implements Storage.
+func (s *MemoryStorage) Put(e *openpgp.Entity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fpr := string(e.PrimaryKey.Fingerprint)
+	if _, ok := s.entities[fpr]; !ok {
+		s.order = append(s.order, fpr)
+	}
+	s.entities[fpr] = e
+	return nil
+}
+
+// Search implements Storage. Entities are returned in the order in which
+// they were first stored.
+func (s *MemoryStorage) Search(q Query) (openpgp.EntityList, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var el openpgp.EntityList
+	for _, fpr := range s.order {
+		if e := s.entities[fpr]; q.Matches(e) {
+			el = append(el, e)
+		}
+	}
+	return el, nil
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openpgp
+
+import (
+	"io"
+
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// InspectMessage describes the packets of a message, see packet.Inspect.
+// Public key encrypted session keys are decrypted with the private keys of
+// keyring that have already been decrypted. The other fields of opts, which
+// may be nil, apply as they do for packet.Inspect.
+func InspectMessage(r io.Reader, keyring KeyRing, opts *packet.InspectOptions) ([]*packet.PacketInfo, error) {
+	var o packet.InspectOptions
+	if opts != nil {
+		o = *opts
+	}
+	if keyring != nil && o.DecryptionKeys == nil {
+		o.DecryptionKeys = func(keyId uint64) []*packet.PrivateKey {
+			// As in ReadMessage, anonymous recipients are tried
+			// with every decryption key.
+			var keys []Key
+			if keyId == 0 {
+				keys = keyring.DecryptionKeys()
+			} else {
+				keys = keyring.KeysById(keyId)
+			}
+			var privs []*packet.PrivateKey
+			for _, k := range keys {
+				if k.PrivateKey != nil && !k.PrivateKey.Encrypted {
+					privs = append(privs, k.PrivateKey)
+				}
+			}
+			return privs
+		}
+	}
+	return packet.Inspect(r, &o)
+}
@@ -226,6 +226,48 @@ func (e *Entity) AddEncryptionSubkey(config *packet.Config) error {
 	return nil
 }
 
+// AddAuthenticationSubkey adds a keypair flagged for authentication, as used
+// by SSH, as a subkey to the Entity.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) AddAuthenticationSubkey(config *packet.Config) error {
+	creationTime := config.Now()
+	keyLifetimeSecs := config.KeyLifetime()
+
+	subPrivRaw, err := newSigner(config)
+	if err != nil {
+		return err
+	}
+	sub := packet.NewSignerPrivateKey(creationTime, subPrivRaw)
+
+	subkey := Subkey{
+		PublicKey:  &sub.PublicKey,
+		PrivateKey: sub,
+		Sig: &packet.Signature{
+			Version:          e.PrimaryKey.Version,
+			CreationTime:     creationTime,
+			KeyLifetimeSecs:  &keyLifetimeSecs,
+			SigType:          packet.SigTypeSubkeyBinding,
+			PubKeyAlgo:       e.PrimaryKey.PubKeyAlgo,
+			Hash:             config.Hash(),
+			FlagsValid:       true,
+			FlagAuthenticate: true,
+			IssuerKeyId:      &e.PrimaryKey.KeyId,
+		},
+	}
+	if config != nil && config.V5Keys {
+		subkey.PublicKey.UpgradeToV5()
+	}
+
+	subkey.PublicKey.IsSubkey = true
+	subkey.PrivateKey.IsSubkey = true
+	if err = subkey.Sig.SignKey(subkey.PublicKey, e.PrivateKey, config); err != nil {
+		return err
+	}
+
+	e.Subkeys = append(e.Subkeys, subkey)
+	return nil
+}
+
 // Generates a signing key
 func newSigner(config *packet.Config) (signer crypto.Signer, err error) {
 	switch config.PublicKeyAlgorithm() {
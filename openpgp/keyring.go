@@ -0,0 +1,428 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openpgp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/openpgp/errors"
+)
+
+// keyFileExt is the extension of the files written by IndexedKeyRing.Save.
+const keyFileExt = ".gpg"
+
+// An IndexedKeyRing is a KeyRing that indexes its entities by fingerprint,
+// key ID and email address. It is safe for concurrent use.
+//
+// Entities returned by an IndexedKeyRing are shared with it and must not be
+// modified; use Update to replace an entity with a modified copy.
+type IndexedKeyRing struct {
+	mu       sync.RWMutex
+	entities map[string]*Entity   // by primary key fingerprint
+	bySubkey map[string]*Entity   // by subkey fingerprint
+	byId     map[uint64][]*Entity // by primary key and subkey IDs
+	byEmail  map[string][]*Entity // by normalized email address
+}
+
+// NewIndexedKeyRing returns an IndexedKeyRing holding the entities of el.
+// Entities with the same primary key are merged.
+func NewIndexedKeyRing(el EntityList) (*IndexedKeyRing, error) {
+	kr := &IndexedKeyRing{
+		entities: make(map[string]*Entity),
+		bySubkey: make(map[string]*Entity),
+		byId:     make(map[uint64][]*Entity),
+		byEmail:  make(map[string][]*Entity),
+	}
+	for _, e := range el {
+		if err := kr.Add(e); err != nil {
+			return nil, err
+		}
+	}
+	return kr, nil
+}
+
+// NormalizeEmail returns the form of an email address used for lookups: its
+// surrounding white space removed and lower-cased.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// identityEmail returns the normalized email address of ident. User IDs made
+// of a bare address are accepted too.
+func identityEmail(ident *Identity) string {
+	email := ident.UserId.Email
+	if email == "" && strings.Contains(ident.UserId.Id, "@") && !strings.ContainsAny(ident.UserId.Id, " <>") {
+		email = ident.UserId.Id
+	}
+	return NormalizeEmail(email)
+}
+
+// Add adds e to the keyring. If the keyring already holds an entity with the
+// same primary key, that entity is merged into e, see Entity.Merge, and e
+// replaces it.
+func (kr *IndexedKeyRing) Add(e *Entity) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if existing := kr.entities[string(e.PrimaryKey.Fingerprint)]; existing != nil {
+		if existing == e {
+			return nil
+		}
+		// Merge into e rather than into the stored entity, which
+		// readers may be using.
+		if err := e.Merge(existing); err != nil {
+			return err
+		}
+		kr.unindex(existing)
+	}
+	kr.index(e)
+	return nil
+}
+
+// Update replaces the entity with the same primary key as e by e, without
+// merging them. It returns an error if there is no such entity.
+func (kr *IndexedKeyRing) Update(e *Entity) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	existing := kr.entities[string(e.PrimaryKey.Fingerprint)]
+	if existing == nil {
+		return errors.InvalidArgumentError("no entity to update in keyring")
+	}
+	kr.unindex(existing)
+	kr.index(e)
+	return nil
+}
+
+// Remove removes the entity whose primary key has the given fingerprint and
+// reports whether there was one.
+func (kr *IndexedKeyRing) Remove(fingerprint []byte) bool {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	existing := kr.entities[string(fingerprint)]
+	if existing == nil {
+		return false
+	}
+	kr.unindex(existing)
+	return true
+}
+
+func (kr *IndexedKeyRing) index(e *Entity) {
+	kr.entities[string(e.PrimaryKey.Fingerprint)] = e
+	kr.byId[e.PrimaryKey.KeyId] = appendEntity(kr.byId[e.PrimaryKey.KeyId], e)
+	for _, subkey := range e.Subkeys {
+		kr.bySubkey[string(subkey.PublicKey.Fingerprint)] = e
+		kr.byId[subkey.PublicKey.KeyId] = appendEntity(kr.byId[subkey.PublicKey.KeyId], e)
+	}
+	for _, ident := range e.Identities {
+		if email := identityEmail(ident); email != "" {
+			kr.byEmail[email] = appendEntity(kr.byEmail[email], e)
+		}
+	}
+}
+
+func (kr *IndexedKeyRing) unindex(e *Entity) {
+	delete(kr.entities, string(e.PrimaryKey.Fingerprint))
+	kr.unindexId(e.PrimaryKey.KeyId, e)
+	for _, subkey := range e.Subkeys {
+		if kr.bySubkey[string(subkey.PublicKey.Fingerprint)] == e {
+			delete(kr.bySubkey, string(subkey.PublicKey.Fingerprint))
+		}
+		kr.unindexId(subkey.PublicKey.KeyId, e)
+	}
+	for _, ident := range e.Identities {
+		if email := identityEmail(ident); email != "" {
+			kr.unindexEmail(email, e)
+		}
+	}
+}
+
+// appendEntity appends e to el unless it is already there.
+func appendEntity(el []*Entity, e *Entity) []*Entity {
+	for _, other := range el {
+		if other == e {
+			return el
+		}
+	}
+	return append(el, e)
+}
+
+// removeEntity returns a copy of el without e, or nil if nothing is left.
+// The list is copied so that slices handed out to readers are unaffected.
+func removeEntity(el []*Entity, e *Entity) []*Entity {
+	var rest []*Entity
+	for _, other := range el {
+		if other != e {
+			rest = append(rest, other)
+		}
+	}
+	return rest
+}
+
+func (kr *IndexedKeyRing) unindexId(id uint64, e *Entity) {
+	if el := removeEntity(kr.byId[id], e); el != nil {
+		kr.byId[id] = el
+	} else {
+		delete(kr.byId, id)
+	}
+}
+
+func (kr *IndexedKeyRing) unindexEmail(email string, e *Entity) {
+	if el := removeEntity(kr.byEmail[email], e); el != nil {
+		kr.byEmail[email] = el
+	} else {
+		delete(kr.byEmail, email)
+	}
+}
+
+// Len returns the number of entities in the keyring.
+func (kr *IndexedKeyRing) Len() int {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return len(kr.entities)
+}
+
+// Entities returns the entities of the keyring, sorted by fingerprint.
+func (kr *IndexedKeyRing) Entities() EntityList {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.entityList()
+}
+
+func (kr *IndexedKeyRing) entityList() EntityList {
+	el := make(EntityList, 0, len(kr.entities))
+	for _, e := range kr.entities {
+		el = append(el, e)
+	}
+	sort.Slice(el, func(i, j int) bool {
+		return bytes.Compare(el[i].PrimaryKey.Fingerprint, el[j].PrimaryKey.Fingerprint) < 0
+	})
+	return el
+}
+
+// EntityByFingerprint returns the entity having a primary key or a subkey
+// with the given v4 or v5 fingerprint, or nil if there is none.
+func (kr *IndexedKeyRing) EntityByFingerprint(fingerprint []byte) *Entity {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	if e := kr.entities[string(fingerprint)]; e != nil {
+		return e
+	}
+	return kr.bySubkey[string(fingerprint)]
+}
+
+// KeyByFingerprint returns the primary key or subkey with the given
+// fingerprint.
+func (kr *IndexedKeyRing) KeyByFingerprint(fingerprint []byte) (Key, bool) {
+	e := kr.EntityByFingerprint(fingerprint)
+	if e == nil {
+		return Key{}, false
+	}
+	if bytes.Equal(e.PrimaryKey.Fingerprint, fingerprint) {
+		return Key{e, e.PrimaryKey, e.PrivateKey, e.PrimaryIdentity().SelfSignature}, true
+	}
+	for _, subkey := range e.Subkeys {
+		if bytes.Equal(subkey.PublicKey.Fingerprint, fingerprint) {
+			return Key{e, subkey.PublicKey, subkey.PrivateKey, subkey.Sig}, true
+		}
+	}
+	return Key{}, false
+}
+
+// EntitiesByEmail returns the entities with a user ID for the given email
+// address. Addresses are compared after NormalizeEmail.
+func (kr *IndexedKeyRing) EntitiesByEmail(email string) EntityList {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return append(EntityList(nil), kr.byEmail[NormalizeEmail(email)]...)
+}
+
+// KeysById returns the set of keys that have the given key id.
+func (kr *IndexedKeyRing) KeysById(id uint64) []Key {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return EntityList(kr.byId[id]).KeysById(id)
+}
+
+// KeysByIdAndUsage returns the set of keys with the given id that also meet
+// the key usage given by requiredUsage.  The requiredUsage is expressed as
+// the bitwise-OR of packet.KeyFlag* values.
+func (kr *IndexedKeyRing) KeysByIdUsage(id uint64, requiredUsage byte) []Key {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return EntityList(kr.byId[id]).KeysByIdUsage(id, requiredUsage)
+}
+
+// DecryptionKeys returns all private keys that are valid for decryption.
+func (kr *IndexedKeyRing) DecryptionKeys() []Key {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.entityList().DecryptionKeys()
+}
+
+// keyFileName returns the name of the file holding the entity with the given
+// fingerprint.
+func keyFileName(fingerprint []byte) string {
+	return strings.ToUpper(hex.EncodeToString(fingerprint)) + keyFileExt
+}
+
+// Save writes each entity of the keyring to its own file in dir, named
+// after the hex fingerprint of its primary key. Private key material is
+// written as it is held, encrypted or not. Key files of entities that are no
+// longer in the keyring are removed.
+func (kr *IndexedKeyRing) Save(dir string) error {
+	el := kr.Entities()
+	keep := make(map[string]bool, len(el))
+	for _, e := range el {
+		name := keyFileName(e.PrimaryKey.Fingerprint)
+		keep[name] = true
+		if err := writeKeyFile(filepath.Join(dir, name), e); err != nil {
+			return err
+		}
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range files {
+		name := fi.Name()
+		if keep[name] || !fi.Mode().IsRegular() || !isKeyFileName(name) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isKeyFileName reports whether name could have been written by Save.
+func isKeyFileName(name string) bool {
+	if !strings.HasSuffix(name, keyFileExt) {
+		return false
+	}
+	raw, err := hex.DecodeString(strings.TrimSuffix(name, keyFileExt))
+	return err == nil && (len(raw) == 20 || len(raw) == 32)
+}
+
+// writeKeyFile atomically replaces the file at path by the serialization of
+// e.
+func writeKeyFile(path string, e *Entity) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-"+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := serializeKeyFile(f, e); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// serializeKeyFile writes e to w without dropping anything ReadEntity
+// keeps: private keys where present, revocations and all user ID and user
+// attribute signatures.
+// Unlike SerializePrivate, nothing is signed again.
+func serializeKeyFile(w io.Writer, e *Entity) (err error) {
+	if e.PrivateKey != nil {
+		err = e.PrivateKey.Serialize(w)
+	} else {
+		err = e.PrimaryKey.Serialize(w)
+	}
+	if err != nil {
+		return
+	}
+	for _, sig := range e.Revocations {
+		if err = sig.Serialize(w); err != nil {
+			return
+		}
+	}
+	for _, ident := range e.Identities {
+		if err = ident.UserId.Serialize(w); err != nil {
+			return
+		}
+		for _, sig := range ident.Signatures {
+			if err = sig.Serialize(w); err != nil {
+				return
+			}
+		}
+	}
+	for _, uat := range e.UserAttributes {
+		if err = uat.UserAttribute.Serialize(w); err != nil {
+			return
+		}
+		for _, sig := range uat.Signatures {
+			if err = sig.Serialize(w); err != nil {
+				return
+			}
+		}
+	}
+	for _, subkey := range e.Subkeys {
+		if subkey.PrivateKey != nil {
+			err = subkey.PrivateKey.Serialize(w)
+		} else {
+			err = subkey.PublicKey.Serialize(w)
+		}
+		if err != nil {
+			return
+		}
+		if err = subkey.Sig.Serialize(w); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+// LoadIndexedKeyRing reads the binary key files with a ".gpg" extension in
+// dir, such as those written by Save, into a new IndexedKeyRing.
+func LoadIndexedKeyRing(dir string) (*IndexedKeyRing, error) {
+	kr, _ := NewIndexedKeyRing(nil)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range files {
+		if !fi.Mode().IsRegular() || !strings.HasSuffix(fi.Name(), keyFileExt) {
+			continue
+		}
+		el, err := readKeyFile(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range el {
+			if err := kr.Add(e); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return kr, nil
+}
+
+func readKeyFile(path string) (EntityList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	el, err := ReadKeyRing(f)
+	if err != nil {
+		return nil, errors.StructuralError(filepath.Base(path) + ": " + err.Error())
+	}
+	return el, nil
+}
+
+// Ensure IndexedKeyRing implements KeyRing.
+var _ KeyRing = (*IndexedKeyRing)(nil)
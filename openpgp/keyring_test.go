@@ -0,0 +1,221 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openpgp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func newKeyRingTestEntity(t *testing.T, name, email string, v5 bool) *Entity {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA, V5Keys: v5}
+	e, err := NewEntity(name, "", email, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestIndexedKeyRingLookup(t *testing.T) {
+	alice := newKeyRingTestEntity(t, "alice", "Alice@Example.org", false)
+	bob := newKeyRingTestEntity(t, "bob", "bob@example.org", true)
+	kr, err := NewIndexedKeyRing(EntityList{alice, bob})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kr.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", kr.Len())
+	}
+	if len(bob.PrimaryKey.Fingerprint) != 32 {
+		t.Fatalf("bob has a %d byte fingerprint, want a v5 key", len(bob.PrimaryKey.Fingerprint))
+	}
+
+	for _, e := range []*Entity{alice, bob} {
+		if got := kr.EntityByFingerprint(e.PrimaryKey.Fingerprint); got != e {
+			t.Errorf("%s: lookup by fingerprint failed", e.PrimaryIdentity().Name)
+		}
+		subkey := e.Subkeys[0].PublicKey
+		if got := kr.EntityByFingerprint(subkey.Fingerprint); got != e {
+			t.Errorf("%s: lookup by subkey fingerprint failed", e.PrimaryIdentity().Name)
+		}
+		if key, ok := kr.KeyByFingerprint(subkey.Fingerprint); !ok || key.PublicKey != subkey {
+			t.Errorf("%s: KeyByFingerprint did not return the subkey", e.PrimaryIdentity().Name)
+		}
+		if keys := kr.KeysById(e.PrimaryKey.KeyId); len(keys) != 1 || keys[0].PublicKey != e.PrimaryKey {
+			t.Errorf("%s: KeysById(primary) returned %d keys", e.PrimaryIdentity().Name, len(keys))
+		}
+		if keys := kr.KeysByIdUsage(subkey.KeyId, packet.KeyFlagEncryptCommunications); len(keys) != 1 {
+			t.Errorf("%s: KeysByIdUsage(subkey) returned %d keys", e.PrimaryIdentity().Name, len(keys))
+		}
+		if keys := kr.KeysByIdUsage(subkey.KeyId, packet.KeyFlagSign); len(keys) != 0 {
+			t.Errorf("%s: KeysByIdUsage ignored the usage", e.PrimaryIdentity().Name)
+		}
+	}
+
+	if el := kr.EntitiesByEmail(" alice@EXAMPLE.org"); len(el) != 1 || el[0] != alice {
+		t.Errorf("lookup by email returned %d entities", len(el))
+	}
+	if el := kr.EntitiesByEmail("carol@example.org"); len(el) != 0 {
+		t.Errorf("lookup of unknown email returned %d entities", len(el))
+	}
+	if kr.EntityByFingerprint([]byte{1, 2, 3}) != nil {
+		t.Error("lookup of unknown fingerprint succeeded")
+	}
+	if keys := kr.DecryptionKeys(); len(keys) != 2 {
+		t.Errorf("DecryptionKeys returned %d keys, want 2", len(keys))
+	}
+}
+
+func TestIndexedKeyRingUpdate(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	alice := newKeyRingTestEntity(t, "alice", "alice@example.org", false)
+	kr, _ := NewIndexedKeyRing(EntityList{alice})
+
+	// Adding another copy of a key merges both.
+	var buf bytes.Buffer
+	if err := alice.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	el, err := ReadKeyRing(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := el[0]
+	if err := kr.Add(public); err != nil {
+		t.Fatal(err)
+	}
+	merged := kr.EntityByFingerprint(alice.PrimaryKey.Fingerprint)
+	if merged != public || merged.PrivateKey == nil {
+		t.Fatal("Add did not merge with the stored entity")
+	}
+	if err := alice.AddSigningSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := kr.Add(alice); err != nil {
+		t.Fatal(err)
+	}
+	if kr.EntityByFingerprint(alice.Subkeys[1].PublicKey.Fingerprint) == nil {
+		t.Error("new subkey not indexed after Add")
+	}
+	if kr.Len() != 1 {
+		t.Errorf("Len = %d, want 1", kr.Len())
+	}
+
+	// Update replaces without merging.
+	if err := kr.Update(public); err != nil {
+		t.Fatal(err)
+	}
+	if kr.EntityByFingerprint(alice.Subkeys[1].PublicKey.Fingerprint) != nil {
+		t.Error("subkey of the replaced entity still indexed")
+	}
+	if keys := kr.KeysById(alice.Subkeys[1].PublicKey.KeyId); len(keys) != 0 {
+		t.Error("key ID of the replaced entity still indexed")
+	}
+	if err := kr.Update(newKeyRingTestEntity(t, "bob", "bob@example.org", false)); err == nil {
+		t.Error("Update of an unknown entity succeeded")
+	}
+
+	if !kr.Remove(alice.PrimaryKey.Fingerprint) || kr.Remove(alice.PrimaryKey.Fingerprint) {
+		t.Error("Remove did not report the removal once")
+	}
+	if kr.Len() != 0 || len(kr.EntitiesByEmail("alice@example.org")) != 0 || len(kr.KeysById(alice.PrimaryKey.KeyId)) != 0 {
+		t.Error("removed entity still indexed")
+	}
+}
+
+func TestIndexedKeyRingSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	alice := newKeyRingTestEntity(t, "alice", "alice@example.org", false)
+	bob := newKeyRingTestEntity(t, "bob", "bob@example.org", true)
+	carol := newKeyRingTestEntity(t, "carol", "carol@example.org", false)
+	if err := bob.SignIdentity("bob <bob@example.org>", alice, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Strip carol's private keys.
+	carol.PrivateKey = nil
+	carol.Subkeys[0].PrivateKey = nil
+
+	kr, _ := NewIndexedKeyRing(EntityList{alice, bob, carol})
+	if err := kr.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	unrelated := filepath.Join(dir, "README")
+	if err := ioutil.WriteFile(unrelated, []byte("keys"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	kr.Remove(alice.PrimaryKey.Fingerprint)
+	if err := kr.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, keyFileName(alice.PrimaryKey.Fingerprint))); !os.IsNotExist(err) {
+		t.Error("key file of removed entity left behind")
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Error("unrelated file removed")
+	}
+
+	loaded, err := LoadIndexedKeyRing(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != 2 {
+		t.Fatalf("loaded %d entities, want 2", loaded.Len())
+	}
+	gotBob := loaded.EntityByFingerprint(bob.PrimaryKey.Fingerprint)
+	if gotBob == nil || gotBob.PrivateKey == nil || gotBob.Subkeys[0].PrivateKey == nil {
+		t.Fatal("bob not loaded with private keys")
+	}
+	if sigs := gotBob.Identities["bob <bob@example.org>"].Signatures; len(sigs) != 2 {
+		t.Errorf("bob has %d identity signatures, want self-signature and certification", len(sigs))
+	}
+	gotCarol := loaded.EntityByFingerprint(carol.PrimaryKey.Fingerprint)
+	if gotCarol == nil || gotCarol.PrivateKey != nil {
+		t.Error("carol not loaded as a public key")
+	}
+}
+
+func TestIndexedKeyRingConcurrency(t *testing.T) {
+	var entities EntityList
+	for _, name := range []string{"a", "b", "c", "d"} {
+		entities = append(entities, newKeyRingTestEntity(t, name, name+"@example.org", false))
+	}
+	kr, _ := NewIndexedKeyRing(nil)
+
+	var wg sync.WaitGroup
+	for _, e := range entities {
+		wg.Add(2)
+		go func(e *Entity) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				kr.Add(e)
+				kr.Remove(e.PrimaryKey.Fingerprint)
+			}
+			kr.Add(e)
+		}(e)
+		go func(e *Entity) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				kr.KeysById(e.PrimaryKey.KeyId)
+				kr.EntitiesByEmail("a@example.org")
+				kr.DecryptionKeys()
+			}
+		}(e)
+	}
+	wg.Wait()
+	if kr.Len() != len(entities) {
+		t.Errorf("Len = %d, want %d", kr.Len(), len(entities))
+	}
+}
@@ -5,7 +5,10 @@
 package openpgp
 
 import (
+	"bytes"
 	goerrors "errors"
+	"fmt"
+	"image"
 	"io"
 	"time"
 
@@ -29,6 +32,9 @@ type Entity struct {
 	Identities  map[string]*Identity // indexed by Identity.Name
 	Revocations []*packet.Signature
 	Subkeys     []Subkey
+	// UserAttributes holds the user attributes, such as photo IDs, that
+	// have a valid self-signature.
+	UserAttributes []*UserAttribute
 }
 
 // An Identity represents an identity claimed by an Entity and zero or more
@@ -40,6 +46,14 @@ type Identity struct {
 	Signatures    []*packet.Signature
 }
 
+// A UserAttribute represents a user attribute claimed by an Entity, usually a
+// photo ID, and zero or more assertions by other entities about that claim.
+type UserAttribute struct {
+	UserAttribute *packet.UserAttribute
+	SelfSignature *packet.Signature
+	Signatures    []*packet.Signature
+}
+
 // A Subkey is an additional public key in an Entity. Subkeys can be used for
 // encryption.
 type Subkey struct {
@@ -155,6 +169,40 @@ func (e *Entity) SigningKey(now time.Time) (Key, bool) {
 	return Key{}, false
 }
 
+// AuthenticationKey returns the best candidate Key for authenticating as this
+// Entity, for instance with SSH. Unlike for signing and encryption, a key is
+// only chosen if it is explicitly flagged for authentication.
+func (e *Entity) AuthenticationKey(now time.Time) (Key, bool) {
+	candidateSubkey := -1
+
+	// Iterate the keys to find the newest key
+	var maxTime time.Time
+	for i, subkey := range e.Subkeys {
+		if subkey.Sig.FlagsValid &&
+			subkey.Sig.FlagAuthenticate &&
+			subkey.Sig.SigType != packet.SigTypeSubkeyRevocation &&
+			subkey.PublicKey.PubKeyAlgo.CanSign() &&
+			!subkey.PublicKey.KeyExpired(subkey.Sig, now) &&
+			(maxTime.IsZero() || subkey.Sig.CreationTime.After(maxTime)) {
+			candidateSubkey = i
+			maxTime = subkey.Sig.CreationTime
+		}
+	}
+
+	if candidateSubkey != -1 {
+		subkey := e.Subkeys[candidateSubkey]
+		return Key{e, subkey.PublicKey, subkey.PrivateKey, subkey.Sig}, true
+	}
+
+	i := e.PrimaryIdentity()
+	if i.SelfSignature.FlagsValid && i.SelfSignature.FlagAuthenticate &&
+		!e.PrimaryKey.KeyExpired(i.SelfSignature, now) {
+		return Key{e, e.PrimaryKey, e.PrivateKey, i.SelfSignature}, true
+	}
+
+	return Key{}, false
+}
+
 // An EntityList contains one or more Entities.
 type EntityList []*Entity
 
@@ -210,6 +258,9 @@ func (el EntityList) KeysByIdUsage(id uint64, requiredUsage byte) (keys []Key) {
 			if key.SelfSignature.FlagEncryptStorage {
 				usage |= packet.KeyFlagEncryptStorage
 			}
+			if key.SelfSignature.FlagAuthenticate {
+				usage |= packet.KeyFlagAuthenticate
+			}
 			if usage&requiredUsage != requiredUsage {
 				continue
 			}
@@ -232,20 +283,41 @@ func (el EntityList) DecryptionKeys() (keys []Key) {
 	return
 }
 
-// ReadArmoredKeyRing reads one or more public/private keys from an armor keyring file.
+// ReadArmoredKeyRing reads one or more public/private keys from an armor keyring
+// file. All armored key blocks of the file are read; other blocks, such as
+// signatures, are skipped.
 func ReadArmoredKeyRing(r io.Reader) (EntityList, error) {
-	block, err := armor.Decode(r)
-	if err == io.EOF {
-		return nil, errors.InvalidArgumentError("no armored data found")
-	}
-	if err != nil {
-		return nil, err
-	}
-	if block.Type != PublicKeyType && block.Type != PrivateKeyType {
-		return nil, errors.InvalidArgumentError("expected public or private key block, got: " + block.Type)
+	var el EntityList
+	var otherType string
+	d := armor.NewDecoder(r, nil)
+	for {
+		block, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if block.Type != PublicKeyType && block.Type != PrivateKeyType {
+			if otherType == "" {
+				otherType = block.Type
+			}
+			continue
+		}
+		entities, err := ReadKeyRing(block.Body)
+		if err != nil {
+			return nil, err
+		}
+		el = append(el, entities...)
 	}
 
-	return ReadKeyRing(block.Body)
+	if len(el) == 0 {
+		if otherType != "" {
+			return nil, errors.InvalidArgumentError("expected public or private key block, got: " + otherType)
+		}
+		return nil, errors.InvalidArgumentError("no armored data found")
+	}
+	return el, nil
 }
 
 // ReadKeyRing reads one or more public/private keys. Unsupported keys are
@@ -348,6 +420,10 @@ EachPacket:
 			if err := addUserID(e, packets, pkt); err != nil {
 				return nil, err
 			}
+		case *packet.UserAttribute:
+			if err := addUserAttribute(e, packets, pkt); err != nil {
+				return nil, err
+			}
 		case *packet.Signature:
 			if pkt.SigType == packet.SigTypeKeyRevocation {
 				revocations = append(revocations, pkt)
@@ -437,6 +513,43 @@ func addUserID(e *Entity, packets *packet.Reader, pkt *packet.UserId) error {
 	return nil
 }
 
+func addUserAttribute(e *Entity, packets *packet.Reader, pkt *packet.UserAttribute) error {
+	// As for user IDs, the attribute is only kept if it has a valid
+	// self-signature.
+	uat := new(UserAttribute)
+	uat.UserAttribute = pkt
+
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		sig, ok := p.(*packet.Signature)
+		if !ok {
+			packets.Unread(p)
+			break
+		}
+
+		if (sig.SigType == packet.SigTypePositiveCert || sig.SigType == packet.SigTypeGenericCert) && sig.CheckKeyIdOrFingerprint(e.PrimaryKey) {
+			if err = e.PrimaryKey.VerifyUserAttributeSignature(pkt, e.PrimaryKey, sig); err != nil {
+				return errors.StructuralError("user attribute self-signature invalid: " + err.Error())
+			}
+			if uat.SelfSignature == nil || sig.CreationTime.After(uat.SelfSignature.CreationTime) {
+				uat.SelfSignature = sig
+			}
+		}
+		uat.Signatures = append(uat.Signatures, sig)
+	}
+
+	if uat.SelfSignature != nil {
+		e.UserAttributes = append(e.UserAttributes, uat)
+	}
+	return nil
+}
+
 func addSubkey(e *Entity, packets *packet.Reader, pub *packet.PublicKey, priv *packet.PrivateKey) error {
 	var subKey Subkey
 	subKey.PublicKey = pub
@@ -499,6 +612,113 @@ func shouldReplaceSubkeySig(existingSig, potentialNewSig *packet.Signature) bool
 	return potentialNewSig.CreationTime.After(existingSig.CreationTime)
 }
 
+// Merge adds to e the components of other that e lacks: identities,
+// certifications, subkeys, newer binding signatures, revocations and private
+// key material. Both entities must have the same primary key. Signatures are
+// not verified again: other is expected to have been read with ReadEntity.
+func (e *Entity) Merge(other *Entity) error {
+	if !bytes.Equal(e.PrimaryKey.Fingerprint, other.PrimaryKey.Fingerprint) {
+		return errors.InvalidArgumentError("cannot merge entities with different primary keys")
+	}
+	if e.PrivateKey == nil && other.PrivateKey != nil {
+		e.PrivateKey = other.PrivateKey
+		e.PrimaryKey = &other.PrivateKey.PublicKey
+	}
+	e.Revocations = mergeSignatures(e.Revocations, other.Revocations)
+
+	for name, ident := range other.Identities {
+		existing, ok := e.Identities[name]
+		if !ok {
+			e.Identities[name] = &Identity{
+				Name:          ident.Name,
+				UserId:        ident.UserId,
+				SelfSignature: ident.SelfSignature,
+				Signatures:    append([]*packet.Signature(nil), ident.Signatures...),
+			}
+			continue
+		}
+		existing.Signatures = mergeSignatures(existing.Signatures, ident.Signatures)
+		if ident.SelfSignature.CreationTime.After(existing.SelfSignature.CreationTime) {
+			existing.SelfSignature = ident.SelfSignature
+		}
+	}
+
+OtherAttributes:
+	for _, uat := range other.UserAttributes {
+		for _, existing := range e.UserAttributes {
+			if !sameUserAttribute(existing.UserAttribute, uat.UserAttribute) {
+				continue
+			}
+			existing.Signatures = mergeSignatures(existing.Signatures, uat.Signatures)
+			if uat.SelfSignature.CreationTime.After(existing.SelfSignature.CreationTime) {
+				existing.SelfSignature = uat.SelfSignature
+			}
+			continue OtherAttributes
+		}
+		e.UserAttributes = append(e.UserAttributes, &UserAttribute{
+			UserAttribute: uat.UserAttribute,
+			SelfSignature: uat.SelfSignature,
+			Signatures:    append([]*packet.Signature(nil), uat.Signatures...),
+		})
+	}
+
+OtherSubkeys:
+	for _, subkey := range other.Subkeys {
+		for i := range e.Subkeys {
+			existing := &e.Subkeys[i]
+			if !bytes.Equal(existing.PublicKey.Fingerprint, subkey.PublicKey.Fingerprint) {
+				continue
+			}
+			if existing.PrivateKey == nil && subkey.PrivateKey != nil {
+				existing.PrivateKey = subkey.PrivateKey
+				existing.PublicKey = &subkey.PrivateKey.PublicKey
+			}
+			if shouldReplaceSubkeySig(existing.Sig, subkey.Sig) {
+				existing.Sig = subkey.Sig
+			}
+			continue OtherSubkeys
+		}
+		e.Subkeys = append(e.Subkeys, subkey)
+	}
+	return nil
+}
+
+// mergeSignatures returns sigs extended with the signatures of others that
+// it doesn't already contain.
+func mergeSignatures(sigs, others []*packet.Signature) []*packet.Signature {
+	known := make(map[string]bool, len(sigs))
+	for _, sig := range sigs {
+		known[signatureKey(sig)] = true
+	}
+	for _, sig := range others {
+		k := signatureKey(sig)
+		if !known[k] {
+			known[k] = true
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+// sameUserAttribute reports whether a and b have the same contents.
+func sameUserAttribute(a, b *packet.UserAttribute) bool {
+	var bufA, bufB bytes.Buffer
+	if a.Serialize(&bufA) != nil || b.Serialize(&bufB) != nil {
+		return a == b
+	}
+	return bytes.Equal(bufA.Bytes(), bufB.Bytes())
+}
+
+// signatureKey returns a string identifying sig, made of its serialization.
+func signatureKey(sig *packet.Signature) string {
+	var buf bytes.Buffer
+	if err := sig.Serialize(&buf); err != nil {
+		// Unserializable signatures are distinguished by identity.
+		return fmt.Sprintf("%p", sig)
+	}
+	return buf.String()
+}
+
 // SerializePrivate serializes an Entity, including private key material, but
 // excluding signatures from other entities, to the given Writer.
 // Identities and subkeys are re-signed in case they changed since NewEntry.
@@ -543,6 +763,22 @@ func (e *Entity) serializePrivate(w io.Writer, config *packet.Config, reSign boo
 			return
 		}
 	}
+	for _, uat := range e.UserAttributes {
+		err = uat.UserAttribute.Serialize(w)
+		if err != nil {
+			return
+		}
+		if reSign {
+			err = uat.SelfSignature.SignUserAttribute(uat.UserAttribute, e.PrimaryKey, e.PrivateKey, config)
+			if err != nil {
+				return
+			}
+		}
+		err = uat.SelfSignature.Serialize(w)
+		if err != nil {
+			return
+		}
+	}
 	for _, subkey := range e.Subkeys {
 		err = subkey.PrivateKey.Serialize(w)
 		if err != nil {
@@ -588,6 +824,18 @@ func (e *Entity) Serialize(w io.Writer) error {
 			}
 		}
 	}
+	for _, uat := range e.UserAttributes {
+		err = uat.UserAttribute.Serialize(w)
+		if err != nil {
+			return err
+		}
+		for _, sig := range uat.Signatures {
+			err = sig.Serialize(w)
+			if err != nil {
+				return err
+			}
+		}
+	}
 	for _, subkey := range e.Subkeys {
 		err = subkey.PublicKey.Serialize(w)
 		if err != nil {
@@ -633,6 +881,116 @@ func (e *Entity) SignIdentity(identity string, signer *Entity, config *packet.Co
 	return nil
 }
 
+// AttestIdentity approves the given third-party certifications of identity
+// with an attestation signature, which is added to the signatures of the
+// identity. Keyservers that honour attestations only distribute the
+// approved certifications. Each attestation replaces the previous ones, so
+// certifications must contain all approved certifications. The private key
+// of e must have been decrypted if necessary.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) AttestIdentity(identity string, certifications []*packet.Signature, config *packet.Config) error {
+	if e.PrivateKey == nil {
+		return errors.InvalidArgumentError("entity must have a private key to attest certifications")
+	}
+	if e.PrivateKey.Encrypted {
+		return errors.InvalidArgumentError("entity's private key must be decrypted")
+	}
+	ident, ok := e.Identities[identity]
+	if !ok {
+		return errors.InvalidArgumentError("given identity string not found in Entity")
+	}
+
+	sig := &packet.Signature{
+		Version:      e.PrimaryKey.Version,
+		SigType:      packet.SigTypeAttestation,
+		PubKeyAlgo:   e.PrimaryKey.PubKeyAlgo,
+		Hash:         config.Hash(),
+		CreationTime: config.Now(),
+		IssuerKeyId:  &e.PrimaryKey.KeyId,
+	}
+	if err := sig.SignAttestation(identity, certifications, e.PrimaryKey, e.PrivateKey, config); err != nil {
+		return err
+	}
+	ident.Signatures = append(ident.Signatures, sig)
+	return nil
+}
+
+// AttestedCertifications returns the third-party certifications of identity
+// that are approved by its most recent valid attestation signature.
+func (e *Entity) AttestedCertifications(identity string) []*packet.Signature {
+	ident, ok := e.Identities[identity]
+	if !ok {
+		return nil
+	}
+	var attestation *packet.Signature
+	for _, sig := range ident.Signatures {
+		if sig.SigType != packet.SigTypeAttestation || !sig.CheckKeyIdOrFingerprint(e.PrimaryKey) {
+			continue
+		}
+		if attestation != nil && !sig.CreationTime.After(attestation.CreationTime) {
+			continue
+		}
+		if e.PrimaryKey.VerifyAttestation(identity, sig) == nil {
+			attestation = sig
+		}
+	}
+	if attestation == nil {
+		return nil
+	}
+
+	var certs []*packet.Signature
+	for _, sig := range ident.Signatures {
+		if sig.SigType == packet.SigTypeAttestation || sig.CheckKeyIdOrFingerprint(e.PrimaryKey) {
+			continue
+		}
+		if attestation.Attests(sig) {
+			certs = append(certs, sig)
+		}
+	}
+	return certs
+}
+
+// AddUserAttribute adds uat to e, bound by a self-signature. The private key
+// of e must have been decrypted if necessary.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) AddUserAttribute(uat *packet.UserAttribute, config *packet.Config) error {
+	if e.PrivateKey == nil {
+		return errors.InvalidArgumentError("entity must have a private key to add a user attribute")
+	}
+	if e.PrivateKey.Encrypted {
+		return errors.InvalidArgumentError("entity's private key must be decrypted")
+	}
+	sig := &packet.Signature{
+		Version:           e.PrimaryKey.Version,
+		SigType:           packet.SigTypePositiveCert,
+		PubKeyAlgo:        e.PrimaryKey.PubKeyAlgo,
+		Hash:              config.Hash(),
+		CreationTime:      config.Now(),
+		IssuerKeyId:       &e.PrimaryKey.KeyId,
+		IssuerFingerprint: e.PrimaryKey.Fingerprint,
+	}
+	if err := sig.SignUserAttribute(uat, e.PrimaryKey, e.PrivateKey, config); err != nil {
+		return err
+	}
+	e.UserAttributes = append(e.UserAttributes, &UserAttribute{
+		UserAttribute: uat,
+		SelfSignature: sig,
+		Signatures:    []*packet.Signature{sig},
+	})
+	return nil
+}
+
+// AddPhoto adds a photo ID holding the given image to e, see
+// AddUserAttribute. The image is encoded as a JPEG.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) AddPhoto(photo image.Image, config *packet.Config) error {
+	uat, err := packet.NewUserAttributePhoto(photo)
+	if err != nil {
+		return err
+	}
+	return e.AddUserAttribute(uat, config)
+}
+
 // RevokeKey generates a key revocation signature (packet.SigTypeKeyRevocation) with the
 // specified reason code and text (RFC4880 section-5.2.3.23).
 // If config is nil, sensible defaults will be used.
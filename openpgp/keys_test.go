@@ -5,6 +5,7 @@ import (
 	"crypto"
 	"crypto/dsa"
 	"crypto/ecdsa"
+	"image"
 	"math/big"
 	"strings"
 	"testing"
@@ -101,6 +102,20 @@ func TestMissingCrossSignature(t *testing.T) {
 	}
 }
 
+func TestUnknownSignatureTargetHash(t *testing.T) {
+	keys, err := ReadArmoredKeyRing(bytes.NewBufferString(unknownTargetHashKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("got %d keys, want 1", len(keys))
+	}
+	ident := keys[0].PrimaryIdentity()
+	if ident == nil || ident.SelfSignature.SignatureTarget != nil {
+		t.Error("signature target with an unknown hash function was not ignored")
+	}
+}
+
 func TestInvalidCrossSignature(t *testing.T) {
 	// This public key has a signing subkey, and the subkey has an
 	// embedded cross-signature. However, the cross-signature does
@@ -1144,3 +1159,273 @@ func TestKeyValidateOnDecrypt(t *testing.T) {
 		t.Fatal("Failed to detect invalid ElGamal key")
 	}
 }
+
+func TestEntityMerge(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	alice, err := NewEntity("alice", "", "alice@example.org", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := NewEntity("bob", "", "bob@example.org", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := alice.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	el, err := ReadKeyRing(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := el[0]
+
+	// alice gains a subkey, and bob certifies the public copy.
+	if err := alice.AddSigningSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := public.SignIdentity("alice <alice@example.org>", bob, config); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := public.Merge(alice); err != nil {
+		t.Fatal(err)
+	}
+	if public.PrivateKey == nil || public.Subkeys[0].PrivateKey == nil {
+		t.Error("private key material not merged")
+	}
+	if len(public.Subkeys) != 2 {
+		t.Errorf("got %d subkeys, want 2", len(public.Subkeys))
+	}
+	if sigs := public.Identities["alice <alice@example.org>"].Signatures; len(sigs) != 2 {
+		t.Errorf("got %d identity signatures, want 2", len(sigs))
+	}
+
+	// Merging again adds nothing.
+	if err := public.Merge(alice); err != nil {
+		t.Fatal(err)
+	}
+	if len(public.Subkeys) != 2 || len(public.Identities["alice <alice@example.org>"].Signatures) != 2 {
+		t.Error("merge is not idempotent")
+	}
+
+	if err := public.Merge(bob); err == nil {
+		t.Error("merged entities with different primary keys")
+	}
+}
+
+func TestUserAttributeRoundTrip(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	e, err := NewEntity("alice", "", "alice@example.org", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo := image.NewGray(image.Rect(0, 0, 8, 8))
+	if err := e.AddPhoto(photo, config); err != nil {
+		t.Fatal(err)
+	}
+
+	var priv bytes.Buffer
+	if err := e.SerializePrivate(&priv, config); err != nil {
+		t.Fatal(err)
+	}
+	e, err = ReadEntity(packet.NewReader(&priv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.UserAttributes) != 1 || len(e.UserAttributes[0].UserAttribute.ImageData()) != 1 {
+		t.Fatalf("got %d user attributes after SerializePrivate, want one photo", len(e.UserAttributes))
+	}
+
+	// Certifications of the photo by other keys survive Serialize.
+	bob, err := NewEntity("bob", "", "bob@example.org", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uat := e.UserAttributes[0]
+	cert := &packet.Signature{
+		Version:      bob.PrimaryKey.Version,
+		SigType:      packet.SigTypeGenericCert,
+		PubKeyAlgo:   bob.PrimaryKey.PubKeyAlgo,
+		Hash:         config.Hash(),
+		CreationTime: config.Now(),
+		IssuerKeyId:  &bob.PrimaryKey.KeyId,
+	}
+	if err := cert.SignUserAttribute(uat.UserAttribute, e.PrimaryKey, bob.PrivateKey, config); err != nil {
+		t.Fatal(err)
+	}
+	uat.Signatures = append(uat.Signatures, cert)
+
+	var pub bytes.Buffer
+	if err := e.Serialize(&pub); err != nil {
+		t.Fatal(err)
+	}
+	e, err = ReadEntity(packet.NewReader(&pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.UserAttributes) != 1 {
+		t.Fatalf("got %d user attributes after Serialize, want 1", len(e.UserAttributes))
+	}
+	uat = e.UserAttributes[0]
+	if len(uat.Signatures) != 2 {
+		t.Fatalf("got %d user attribute signatures, want 2", len(uat.Signatures))
+	}
+	if err := bob.PrimaryKey.VerifyUserAttributeSignature(uat.UserAttribute, e.PrimaryKey, uat.Signatures[1]); err != nil {
+		t.Errorf("certification does not verify: %s", err)
+	}
+	if len(e.Identities) != 1 {
+		t.Errorf("got %d identities, want 1", len(e.Identities))
+	}
+}
+
+func TestUserAttributeBadSelfSignature(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	e, err := NewEntity("alice", "", "alice@example.org", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddPhoto(image.NewGray(image.Rect(0, 0, 8, 8)), config); err != nil {
+		t.Fatal(err)
+	}
+	// Swap the photo for another one, invalidating the self-signature.
+	other, err := packet.NewUserAttributePhoto(image.NewGray(image.Rect(0, 0, 4, 4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.UserAttributes[0].UserAttribute = other
+
+	var buf bytes.Buffer
+	if err := e.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadEntity(packet.NewReader(&buf)); err == nil {
+		t.Error("entity with an invalid user attribute self-signature was accepted")
+	}
+}
+
+func TestAuthenticationKey(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	e, err := NewEntity("alice", "", "alice@example.org", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.AuthenticationKey(time.Now()); ok {
+		t.Error("entity without authentication flags has an authentication key")
+	}
+	if err := e.AddAuthenticationSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := e.SerializePrivate(&buf, config); err != nil {
+		t.Fatal(err)
+	}
+	e, err = ReadEntity(packet.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, ok := e.AuthenticationKey(time.Now())
+	if !ok || key.PublicKey != e.Subkeys[1].PublicKey || key.PrivateKey == nil {
+		t.Fatal("authentication subkey not selected")
+	}
+	el := EntityList{e}
+	if keys := el.KeysByIdUsage(key.PublicKey.KeyId, packet.KeyFlagAuthenticate); len(keys) != 1 {
+		t.Errorf("KeysByIdUsage returned %d authentication keys, want 1", len(keys))
+	}
+	if keys := el.KeysByIdUsage(e.Subkeys[0].PublicKey.KeyId, packet.KeyFlagAuthenticate); len(keys) != 0 {
+		t.Error("encryption subkey returned as an authentication key")
+	}
+}
+
+func TestAttestIdentity(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	alice, err := NewEntity("alice", "", "alice@example.org", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signers []*Entity
+	for _, name := range []string{"bob", "carol"} {
+		signer, err := NewEntity(name, "", name+"@example.org", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, signer)
+	}
+	id := alice.PrimaryIdentity().Name
+	for _, signer := range signers {
+		if err := alice.SignIdentity(id, signer, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if certs := alice.AttestedCertifications(id); len(certs) != 0 {
+		t.Errorf("%d certifications attested before attesting", len(certs))
+	}
+
+	sigs := alice.Identities[id].Signatures
+	bobCert := sigs[len(sigs)-2]
+	if err := alice.AttestIdentity(id, []*packet.Signature{bobCert}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := alice.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	el, err := ReadKeyRing(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs := el[0].AttestedCertifications(id)
+	if len(certs) != 1 || !certs[0].CheckKeyIdOrFingerprint(signers[0].PrimaryKey) {
+		t.Fatalf("got %d attested certifications, want bob's", len(certs))
+	}
+
+	// A later attestation replaces the earlier one.
+	config.Time = func() time.Time { return time.Now().Add(time.Minute) }
+	if err := alice.AttestIdentity(id, nil, config); err != nil {
+		t.Fatal(err)
+	}
+	if certs := alice.AttestedCertifications(id); len(certs) != 0 {
+		t.Errorf("%d certifications attested after withdrawing them", len(certs))
+	}
+}
+
+func TestReadArmoredKeyRingMultipleBlocks(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	var buf, sig bytes.Buffer
+	for _, name := range []string{"alice", "bob"} {
+		e, err := NewEntity(name, "", name+"@example.org", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := armor.Encode(&buf, PublicKeyType, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Serialize(w); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+		buf.WriteString("\n")
+		sig.Reset()
+		if err := ArmoredDetachSign(&sig, e, strings.NewReader("hello"), nil); err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(sig.Bytes())
+		buf.WriteString("\n")
+	}
+
+	el, err := ReadArmoredKeyRing(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(el) != 2 || el[0].PrimaryIdentity().Name != "alice <alice@example.org>" || el[1].PrimaryIdentity().Name != "bob <bob@example.org>" {
+		t.Errorf("got %d entities, want alice and bob", len(el))
+	}
+
+	if _, err := ReadArmoredKeyRing(&sig); err == nil || !strings.Contains(err.Error(), "PGP SIGNATURE") {
+		t.Errorf("got %v for a signature block", err)
+	}
+}
@@ -290,3 +290,15 @@ fss2SPMYvMrrDh42aE0OAQD8xn4G6CN8UtW9xihXOY6FpxiJ/sMc2VaneeUd34oa
 4g==
 =XZm8
 -----END PGP PRIVATE KEY BLOCK-----`
+
+// unknownTargetHashKey has a self-signature with a non-critical Signature
+// Target subpacket that uses the unknown hash function 99.
+const unknownTargetHashKey = `-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+xjMEZVPxABYJKwYBBAHaRw8BAQdA4hxj2fFLR21OkOdoLnNca3Xhy1tbAGcxhLjM
+tn1CVX7NIFRhcmdldCBUZXN0IDx0YXJnZXRAZXhhbXBsZS5vcmc+woAEExYIADIF
+AmVT8QAJEHtupRrVLfLJFiEEi9vbiUZvBtM+VtSve26lGtUt8skCGwMHHxZjAQID
+BAAAuDMA/25BQodqspQGlhy+wOPDZDXoYmpg0NVyzxTAVj+mQyJ3AP98CISlhvbl
+faAn6yJLgPYxfNj2RBkX4fz+0nYfMQg/CA==
+=/eSM
+-----END PGP PUBLIC KEY BLOCK-----`
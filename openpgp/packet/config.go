@@ -74,6 +74,13 @@ type Config struct {
 	// this is not present or has a value of zero, it never expires."
 	// https://tools.ietf.org/html/rfc4880#section-5.2.3.10
 	SigLifetimeSecs uint32
+	// MaxKeyAttempts limits the number of failed attempts to decrypt a
+	// message with keys supplied by a key provider. If zero, there is no
+	// limit.
+	MaxKeyAttempts int
+	// PaddingConfig, if not nil, makes Encrypt append a padding packet to
+	// the encrypted payload to hide the length of the message.
+	PaddingConfig *PaddingConfig
 }
 
 func (c *Config) Random() io.Reader {
@@ -120,6 +127,15 @@ func (c *Config) SigLifetime() uint32 {
 	return c.SigLifetimeSecs
 }
 
+// KeyAttempts returns the maximum number of failed attempts to decrypt a
+// message, or zero if there is no limit.
+func (c *Config) KeyAttempts() int {
+	if c == nil {
+		return 0
+	}
+	return c.MaxKeyAttempts
+}
+
 func (c *Config) Compression() CompressionAlgo {
 	if c == nil {
 		return CompressionNone
@@ -148,6 +164,13 @@ func (c *Config) PublicKeyAlgorithm() PublicKeyAlgorithm {
 	return c.Algorithm
 }
 
+func (c *Config) Padding() *PaddingConfig {
+	if c == nil {
+		return nil
+	}
+	return c.PaddingConfig
+}
+
 func (c *Config) AEAD() *AEADConfig {
 	if c == nil {
 		return nil
@@ -0,0 +1,709 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package packet
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/internal/ecc"
+	"golang.org/x/crypto/openpgp/s2k"
+)
+
+// InspectOptions configures Inspect. Encrypted data is only descended into
+// if a session key is given or can be recovered from the session key packets
+// that precede it.
+type InspectOptions struct {
+	// SessionKey and SessionKeyCipher, if set, are used to decrypt
+	// encrypted data packets.
+	SessionKey       []byte
+	SessionKeyCipher CipherFunction
+	// Passphrase, if set, is used to decrypt symmetric key encrypted
+	// session key packets.
+	Passphrase []byte
+	// DecryptionKeys, if set, returns the private keys to try on a public
+	// key encrypted session key packet for the given key ID, which is zero
+	// for anonymous recipients. Keys that are still encrypted are skipped.
+	DecryptionKeys func(keyId uint64) []*PrivateKey
+	// Config is used when decrypting session keys. It may be nil.
+	Config *Config
+}
+
+// An InspectField is a named, formatted property of an inspected packet.
+type InspectField struct {
+	Name, Value string
+}
+
+// A SubpacketInfo describes a signature or user attribute subpacket.
+type SubpacketInfo struct {
+	Type     uint8
+	Hashed   bool
+	Critical bool
+	Contents []byte
+	// Description is a human readable rendering of Contents.
+	Description string
+}
+
+// A PacketInfo describes a packet found by Inspect.
+type PacketInfo struct {
+	// Offset is the position of the packet header in the stream holding
+	// the packet: the message, or the plaintext of the enclosing
+	// compressed or encrypted packet.
+	Offset int64
+	// CTB is the first octet of the packet header.
+	CTB          uint8
+	Tag          uint8
+	NewFormat    bool
+	HeaderLength int
+	// Length is the number of octets of the packet body, not including
+	// partial length headers.
+	Length int64
+	// PartialLengths holds the length of each chunk of a body encoded
+	// with partial lengths, and is nil otherwise.
+	PartialLengths []int64
+	// Indeterminate is set for old format packets that extend to the end
+	// of the stream.
+	Indeterminate bool
+
+	// Packet is the parsed packet, if the packet could be parsed.
+	Packet     Packet
+	Fields     []InspectField
+	Subpackets []SubpacketInfo
+	// Packets holds the packets found in the body of a compressed
+	// packet, or in the plaintext of an encrypted packet.
+	Packets []*PacketInfo
+	// Err is set if the packet could not be parsed or decrypted.
+	Err error
+}
+
+// Name returns the name of the packet type, as printed by list-packets.
+func (info *PacketInfo) Name() string {
+	switch packetType(info.Tag) {
+	case packetTypeEncryptedKey:
+		return "pubkey enc"
+	case packetTypeSignature:
+		return "signature"
+	case packetTypeSymmetricKeyEncrypted:
+		return "symkey enc"
+	case packetTypeOnePassSignature:
+		return "onepass_sig"
+	case packetTypePrivateKey:
+		return "secret key"
+	case packetTypePublicKey:
+		return "public key"
+	case packetTypePrivateSubkey:
+		return "secret sub key"
+	case packetTypeCompressed:
+		return "compressed"
+	case packetTypeSymmetricallyEncrypted, packetTypeSymmetricallyEncryptedMDC:
+		return "encrypted data"
+	case 10:
+		return "marker"
+	case packetTypeLiteralData:
+		return "literal data"
+	case 12:
+		return "trust"
+	case packetTypeUserId:
+		return "user ID"
+	case packetTypePublicSubkey:
+		return "public sub key"
+	case packetTypeUserAttribute:
+		return "attribute"
+	case packetTypeAEADEncrypted:
+		return "aead encrypted data"
+	case packetTypePadding:
+		return "padding"
+	}
+	return "unknown"
+}
+
+func (info *PacketInfo) addField(name, format string, args ...interface{}) {
+	info.Fields = append(info.Fields, InspectField{name, fmt.Sprintf(format, args...)})
+}
+
+// Inspect reads the packets of an OpenPGP message, key or signature from r
+// and describes them, descending into compressed packets and, if opts allow
+// it, into encrypted packets. It is meant for debugging: every packet is
+// parsed, but nothing is verified. The returned error is only set if the
+// stream itself could not be read; errors specific to a packet are recorded
+// in its PacketInfo.
+func Inspect(r io.Reader, opts *InspectOptions) ([]*PacketInfo, error) {
+	if opts == nil {
+		opts = new(InspectOptions)
+	}
+	in := &inspector{opts: opts}
+	if opts.SessionKey != nil {
+		in.sessionKey, in.cipher = opts.SessionKey, opts.SessionKeyCipher
+	}
+	return in.inspectStream(r)
+}
+
+type inspector struct {
+	opts       *InspectOptions
+	sessionKey []byte
+	cipher     CipherFunction
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (n int, err error) {
+	n, err = cr.r.Read(p)
+	cr.n += int64(n)
+	return
+}
+
+// recordingPartialReader is a partialLengthReader that records the length
+// of each chunk.
+type recordingPartialReader struct {
+	r         io.Reader
+	remaining int64
+	isPartial bool
+	info      *PacketInfo
+}
+
+func (r *recordingPartialReader) Read(p []byte) (n int, err error) {
+	for r.remaining == 0 {
+		if !r.isPartial {
+			return 0, io.EOF
+		}
+		r.remaining, r.isPartial, err = readLength(r.r)
+		if err != nil {
+			return 0, err
+		}
+		r.info.PartialLengths = append(r.info.PartialLengths, r.remaining)
+	}
+
+	toRead := int64(len(p))
+	if toRead > r.remaining {
+		toRead = r.remaining
+	}
+
+	n, err = r.r.Read(p[:int(toRead)])
+	r.remaining -= int64(n)
+	if n < int(toRead) && err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+func (in *inspector) inspectStream(r io.Reader) ([]*PacketInfo, error) {
+	cr := &countingReader{r: r}
+	var infos []*PacketInfo
+	for {
+		info, contents, err := inspectHeader(cr)
+		if err == io.EOF {
+			return infos, nil
+		}
+		if err != nil {
+			return infos, err
+		}
+		infos = append(infos, info)
+
+		body := &countingReader{r: contents}
+		in.inspectBody(info, body)
+		_, err = consumeAll(body)
+		info.Length = body.n
+		if err != nil {
+			if info.Err == nil {
+				info.Err = err
+			}
+			return infos, err
+		}
+	}
+}
+
+// inspectHeader is like readHeader, but records the framing of the packet.
+func inspectHeader(cr *countingReader) (info *PacketInfo, contents io.Reader, err error) {
+	info = &PacketInfo{Offset: cr.n}
+	var buf [4]byte
+	if _, err = io.ReadFull(cr, buf[:1]); err != nil {
+		return
+	}
+	info.CTB = buf[0]
+	if buf[0]&0x80 == 0 {
+		err = errors.StructuralError("tag byte does not have MSB set")
+		return
+	}
+	if buf[0]&0x40 == 0 {
+		// Old format packet
+		info.Tag = (buf[0] & 0x3f) >> 2
+		lengthType := buf[0] & 3
+		if lengthType == 3 {
+			info.HeaderLength = 1
+			info.Indeterminate = true
+			contents = cr
+			return
+		}
+		lengthBytes := 1 << lengthType
+		if _, err = readFull(cr, buf[0:lengthBytes]); err != nil {
+			return
+		}
+		var length int64
+		for i := 0; i < lengthBytes; i++ {
+			length <<= 8
+			length |= int64(buf[i])
+		}
+		info.HeaderLength = 1 + lengthBytes
+		contents = &spanReader{cr, length}
+		return
+	}
+
+	// New format packet
+	info.Tag = buf[0] & 0x3f
+	info.NewFormat = true
+	length, isPartial, err := readLength(cr)
+	if err != nil {
+		return
+	}
+	info.HeaderLength = int(cr.n - info.Offset)
+	if isPartial {
+		info.PartialLengths = []int64{length}
+		contents = &recordingPartialReader{
+			r:         cr,
+			remaining: length,
+			isPartial: true,
+			info:      info,
+		}
+	} else {
+		contents = &spanReader{cr, length}
+	}
+	return
+}
+
+// parseBody reads the whole body into p.
+func parseBody(info *PacketInfo, p Packet, r io.Reader) ([]byte, bool) {
+	body, err := ioutil.ReadAll(r)
+	if err == nil {
+		err = p.parse(bytes.NewReader(body))
+	}
+	if err != nil {
+		info.Err = err
+		return body, false
+	}
+	info.Packet = p
+	return body, true
+}
+
+func (in *inspector) inspectBody(info *PacketInfo, r io.Reader) {
+	switch packetType(info.Tag) {
+	case packetTypeEncryptedKey:
+		in.inspectEncryptedKey(info, r)
+	case packetTypeSignature:
+		sig := new(Signature)
+		if _, ok := parseBody(info, sig, r); ok {
+			describeSignature(info, sig)
+		}
+	case packetTypeSymmetricKeyEncrypted:
+		in.inspectSymmetricKeyEncrypted(info, r)
+	case packetTypeOnePassSignature:
+		ops := new(OnePassSignature)
+		if _, ok := parseBody(info, ops, r); ok {
+			info.addField("version", "%d", onePassSignatureVersion)
+			info.addField("sigclass", "0x%02x", uint8(ops.SigType))
+			info.addField("digest algo", "%d", hashToHashIdOrZero(ops.Hash))
+			info.addField("pubkey algo", "%d", ops.PubKeyAlgo)
+			info.addField("keyid", "%016X", ops.KeyId)
+			info.addField("last", "%t", ops.IsLast)
+		}
+	case packetTypePrivateKey, packetTypePrivateSubkey:
+		pk := &PrivateKey{}
+		pk.IsSubkey = packetType(info.Tag) == packetTypePrivateSubkey
+		if _, ok := parseBody(info, pk, r); ok {
+			describePublicKey(info, &pk.PublicKey)
+			describePrivateKey(info, pk)
+		}
+	case packetTypePublicKey, packetTypePublicSubkey:
+		pk := &PublicKey{IsSubkey: packetType(info.Tag) == packetTypePublicSubkey}
+		if _, ok := parseBody(info, pk, r); ok {
+			describePublicKey(info, pk)
+		}
+	case packetTypeCompressed:
+		in.inspectCompressed(info, r)
+	case packetTypeSymmetricallyEncrypted, packetTypeSymmetricallyEncryptedMDC:
+		in.inspectSymmetricallyEncrypted(info, r)
+	case packetTypeLiteralData:
+		lit := new(LiteralData)
+		if err := lit.parse(r); err != nil {
+			info.Err = err
+			return
+		}
+		info.Packet = lit
+		info.addField("mode", "%c (%X)", lit.Format, lit.Format)
+		info.addField("created", "%d", lit.Time)
+		info.addField("name", "%q", lit.FileName)
+		n, err := consumeAll(lit.Body)
+		info.addField("raw data", "%d bytes", n)
+		if err != nil {
+			info.Err = err
+		}
+	case packetTypeUserId:
+		uid := new(UserId)
+		if _, ok := parseBody(info, uid, r); ok {
+			info.addField("user ID", "%q", uid.Id)
+		}
+	case packetTypeUserAttribute:
+		uat := new(UserAttribute)
+		if _, ok := parseBody(info, uat, r); ok {
+			for _, sp := range uat.Contents {
+				desc := "unknown"
+				if sp.SubType == UserAttrImageSubpacket && len(sp.Contents) > 16 {
+					desc = fmt.Sprintf("image of %d bytes", len(sp.Contents)-16)
+				}
+				info.Subpackets = append(info.Subpackets, SubpacketInfo{
+					Type:        sp.SubType,
+					Contents:    sp.Contents,
+					Description: desc,
+				})
+			}
+		}
+	case packetTypeAEADEncrypted:
+		in.inspectAEADEncrypted(info, r)
+	default:
+		n, err := consumeAll(r)
+		info.addField("data", "%d bytes", n)
+		info.Err = err
+	}
+}
+
+func (in *inspector) inspectEncryptedKey(info *PacketInfo, r io.Reader) {
+	ek := new(EncryptedKey)
+	if _, ok := parseBody(info, ek, r); !ok {
+		return
+	}
+	info.addField("version", "%d", encryptedKeyVersion)
+	info.addField("algo", "%d", ek.Algo)
+	info.addField("keyid", "%016X", ek.KeyId)
+	info.addField("data", "[%d bits]", ek.encryptedMPI1.BitLength())
+
+	if in.sessionKey != nil || in.opts.DecryptionKeys == nil {
+		return
+	}
+	for _, priv := range in.opts.DecryptionKeys(ek.KeyId) {
+		if priv.Encrypted {
+			continue
+		}
+		if err := ek.Decrypt(priv, in.opts.Config); err == nil {
+			in.sessionKey, in.cipher = ek.Key, ek.CipherFunc
+			info.addField("decrypted with", "%016X", priv.KeyId)
+			info.addField("cipher algo", "%d", ek.CipherFunc)
+			return
+		}
+	}
+}
+
+func (in *inspector) inspectSymmetricKeyEncrypted(info *PacketInfo, r io.Reader) {
+	ske := new(SymmetricKeyEncrypted)
+	body, ok := parseBody(info, ske, r)
+	if !ok {
+		return
+	}
+	info.addField("version", "%d", ske.Version)
+	info.addField("cipher algo", "%d", ske.CipherFunc)
+	s2kOffset := 2
+	if ske.Version == 5 {
+		info.addField("aead algo", "%d", ske.Mode)
+		s2kOffset = 3
+	}
+	if params, err := s2k.ParseIntoParams(bytes.NewReader(body[s2kOffset:])); err == nil {
+		describeS2K(info, params)
+	}
+	if len(ske.encryptedKey) > 0 {
+		info.addField("encrypted session key", "%d bytes", len(ske.encryptedKey))
+	}
+
+	if in.sessionKey != nil || in.opts.Passphrase == nil {
+		return
+	}
+	if key, cipherFunc, err := ske.Decrypt(in.opts.Passphrase); err == nil {
+		in.sessionKey, in.cipher = key, cipherFunc
+		info.addField("decrypted with", "passphrase")
+	}
+}
+
+func describeS2K(info *PacketInfo, params *s2k.Params) {
+	info.addField("s2k mode", "%d", params.Mode())
+	info.addField("s2k hash algo", "%d", params.HashId())
+	if salt := params.Salt(); salt != nil {
+		info.addField("s2k salt", "%X", salt)
+	}
+	if count := params.Count(); count != 0 {
+		info.addField("s2k count", "%d", count)
+	}
+}
+
+func (in *inspector) inspectCompressed(info *PacketInfo, r io.Reader) {
+	var algo [1]byte
+	if _, err := readFull(r, algo[:]); err != nil {
+		info.Err = err
+		return
+	}
+	info.addField("algo", "%d", algo[0])
+	c := new(Compressed)
+	if err := c.parse(io.MultiReader(bytes.NewReader(algo[:]), r)); err != nil {
+		info.Err = err
+		return
+	}
+	info.Packet = c
+	info.Packets, info.Err = in.inspectStream(c.Body)
+}
+
+func (in *inspector) inspectSymmetricallyEncrypted(info *PacketInfo, r io.Reader) {
+	se := &SymmetricallyEncrypted{MDC: packetType(info.Tag) == packetTypeSymmetricallyEncryptedMDC}
+	if err := se.parse(r); err != nil {
+		info.Err = err
+		return
+	}
+	info.Packet = se
+	if se.MDC {
+		info.addField("version", "%d", symmetricallyEncryptedVersion)
+		info.addField("mdc method", "2")
+	}
+	if in.sessionKey == nil {
+		info.addField("decrypted", "no, session key unavailable")
+		return
+	}
+	in.inspectPlaintext(info, func() (io.ReadCloser, error) {
+		return se.Decrypt(in.cipher, in.sessionKey)
+	})
+}
+
+func (in *inspector) inspectAEADEncrypted(info *PacketInfo, r io.Reader) {
+	var version [1]byte
+	if _, err := readFull(r, version[:]); err != nil {
+		info.Err = err
+		return
+	}
+	ae := new(AEADEncrypted)
+	if err := ae.parse(io.MultiReader(bytes.NewReader(version[:]), r)); err != nil {
+		info.Err = err
+		return
+	}
+	info.Packet = ae
+	info.addField("version", "%d", version[0])
+	info.addField("cipher algo", "%d", ae.cipher)
+	info.addField("aead algo", "%d", ae.mode)
+	info.addField("chunk size", "%d (%d bytes)", ae.chunkSizeByte, decodeAEADChunkSize(ae.chunkSizeByte))
+	if in.sessionKey == nil {
+		info.addField("decrypted", "no, session key unavailable")
+		return
+	}
+	in.inspectPlaintext(info, func() (io.ReadCloser, error) {
+		return ae.Decrypt(in.cipher, in.sessionKey)
+	})
+}
+
+// inspectPlaintext inspects the packets in the plaintext returned by
+// decrypt and checks its integrity.
+func (in *inspector) inspectPlaintext(info *PacketInfo, decrypt func() (io.ReadCloser, error)) {
+	plaintext, err := decrypt()
+	if err != nil {
+		info.Err = err
+		return
+	}
+	// The session key only applies to this packet.
+	in.sessionKey = nil
+	info.addField("decrypted", "yes")
+	info.Packets, info.Err = in.inspectStream(plaintext)
+	if info.Err == nil {
+		_, info.Err = consumeAll(plaintext)
+	}
+	if err := plaintext.Close(); err != nil && info.Err == nil {
+		info.Err = err
+	}
+}
+
+func describeSignature(info *PacketInfo, sig *Signature) {
+	info.addField("version", "%d", sig.Version)
+	info.addField("sigclass", "0x%02x", uint8(sig.SigType))
+	info.addField("pubkey algo", "%d", sig.PubKeyAlgo)
+	info.addField("digest algo", "%d", hashToHashIdOrZero(sig.Hash))
+	info.addField("created", "%d", sig.CreationTime.Unix())
+	if sig.IssuerKeyId != nil {
+		info.addField("keyid", "%016X", *sig.IssuerKeyId)
+	}
+	info.addField("begin of digest", "%02x %02x", sig.HashTag[0], sig.HashTag[1])
+	for _, sp := range sig.rawSubpackets {
+		info.Subpackets = append(info.Subpackets, SubpacketInfo{
+			Type:        uint8(sp.subpacketType),
+			Hashed:      sp.hashed,
+			Critical:    sp.isCritical,
+			Contents:    sp.contents,
+			Description: describeSubpacket(sp.subpacketType, sp.contents),
+		})
+	}
+}
+
+// describeSubpacket returns a human readable rendering of the contents of a
+// signature subpacket.
+func describeSubpacket(typ signatureSubpacketType, contents []byte) string {
+	uint32At := func() (uint32, bool) {
+		if len(contents) != 4 {
+			return 0, false
+		}
+		return binary.BigEndian.Uint32(contents), true
+	}
+	algos := func(name string) string {
+		ids := make([]string, len(contents))
+		for i, id := range contents {
+			ids[i] = strconv.Itoa(int(id))
+		}
+		return name + ": " + strings.Join(ids, " ")
+	}
+
+	switch typ {
+	case creationTimeSubpacket:
+		if t, ok := uint32At(); ok {
+			return "sig created " + time.Unix(int64(t), 0).UTC().Format(time.RFC3339)
+		}
+	case signatureExpirationSubpacket:
+		if t, ok := uint32At(); ok {
+			return fmt.Sprintf("sig expires after %ds", t)
+		}
+	case keyExpirationSubpacket:
+		if t, ok := uint32At(); ok {
+			return fmt.Sprintf("key expires after %ds", t)
+		}
+	case prefSymmetricAlgosSubpacket:
+		return algos("pref-sym-algos")
+	case issuerSubpacket:
+		if len(contents) == 8 {
+			return fmt.Sprintf("issuer key ID %016X", contents)
+		}
+	case prefHashAlgosSubpacket:
+		return algos("pref-hash-algos")
+	case prefCompressionSubpacket:
+		return algos("pref-zip-algos")
+	case primaryUserIdSubpacket:
+		return "primary user ID"
+	case keyFlagsSubpacket:
+		return fmt.Sprintf("key flags: %X", contents)
+	case reasonForRevocationSubpacket:
+		if len(contents) > 0 {
+			return fmt.Sprintf("revocation reason 0x%02x (%q)", contents[0], contents[1:])
+		}
+	case featuresSubpacket:
+		return fmt.Sprintf("features: %X", contents)
+	case embeddedSignatureSubpacket:
+		embedded := new(Signature)
+		if embedded.parse(bytes.NewReader(contents)) == nil {
+			return fmt.Sprintf("signature: v%d, class 0x%02x, algo %d, digest algo %d",
+				embedded.Version, uint8(embedded.SigType), embedded.PubKeyAlgo, hashToHashIdOrZero(embedded.Hash))
+		}
+	case issuerFingerprintSubpacket:
+		if len(contents) > 1 {
+			return fmt.Sprintf("issuer fpr v%d %X", contents[0], contents[1:])
+		}
+	case prefAeadAlgosSubpacket:
+		return algos("pref-aead-algos")
+	case signatureTargetSubpacket:
+		if len(contents) > 2 {
+			return fmt.Sprintf("signature target: algo %d, digest algo %d, digest %X", contents[0], contents[1], contents[2:])
+		}
+	case attestedCertificationsSubpacket:
+		return fmt.Sprintf("attested certifications: %X", contents)
+	default:
+		return "?"
+	}
+	return "malformed"
+}
+
+func describePublicKey(info *PacketInfo, pk *PublicKey) {
+	info.addField("version", "%d", pk.Version)
+	info.addField("algo", "%d", pk.PubKeyAlgo)
+	info.addField("created", "%d", pk.CreationTime.Unix())
+	info.addField("keyid", "%016X", pk.KeyId)
+	info.addField("fingerprint", "%X", pk.Fingerprint)
+	if bits, err := pk.BitLength(); err == nil && bits != 0 {
+		info.addField("bits", "%d", bits)
+	}
+	if len(pk.oid.Bytes()) > 0 {
+		name := "unknown"
+		if curve := ecc.FindByOid(pk.oid); curve != nil {
+			name = curve.Name
+		}
+		info.addField("curve", "%X (%s)", pk.oid.Bytes(), name)
+	}
+}
+
+func describePrivateKey(info *PacketInfo, pk *PrivateKey) {
+	info.addField("s2k usage", "%d", pk.s2kType)
+	if pk.s2kType == S2KNON {
+		return
+	}
+	info.addField("protection cipher", "%d", pk.cipher)
+	if pk.s2kParams != nil {
+		describeS2K(info, pk.s2kParams)
+	}
+	if pk.Dummy() {
+		info.addField("gnu-dummy", "secret key not available")
+	}
+}
+
+// hashToHashIdOrZero returns the OpenPGP ID of h, or zero if there is none.
+func hashToHashIdOrZero(h crypto.Hash) byte {
+	id, _ := s2k.HashToHashId(h)
+	return id
+}
+
+// WriteListPackets writes a listing of packets in the layout of
+// gpg --list-packets. Nested packets follow their container.
+func WriteListPackets(w io.Writer, packets []*PacketInfo) error {
+	bw := bufio.NewWriter(w)
+	writeListPackets(bw, packets)
+	return bw.Flush()
+}
+
+func writeListPackets(w *bufio.Writer, packets []*PacketInfo) {
+	for _, info := range packets {
+		fmt.Fprintf(w, "# off=%d ctb=%02x tag=%d hlen=%d plen=%d", info.Offset, info.CTB, info.Tag, info.HeaderLength, info.Length)
+		if info.PartialLengths != nil {
+			w.WriteString(" partial")
+		}
+		if info.Indeterminate {
+			w.WriteString(" indeterminate")
+		}
+		if info.NewFormat {
+			w.WriteString(" new-ctb")
+		}
+		fmt.Fprintf(w, "\n:%s packet:\n", info.Name())
+		if len(info.PartialLengths) > 1 {
+			lengths := make([]string, len(info.PartialLengths))
+			for i, l := range info.PartialLengths {
+				lengths[i] = strconv.FormatInt(l, 10)
+			}
+			fmt.Fprintf(w, "\tpartial lengths: %s\n", strings.Join(lengths, " "))
+		}
+		for _, f := range info.Fields {
+			fmt.Fprintf(w, "\t%s: %s\n", f.Name, f.Value)
+		}
+		for _, sp := range info.Subpackets {
+			w.WriteByte('\t')
+			if sp.Critical {
+				w.WriteString("critical ")
+			}
+			if sp.Hashed {
+				w.WriteString("hashed ")
+			}
+			fmt.Fprintf(w, "subpkt %d len %d (%s)\n", sp.Type, len(sp.Contents), sp.Description)
+		}
+		if info.Err != nil {
+			fmt.Fprintf(w, "\terror: %s\n", info.Err)
+		}
+		writeListPackets(w, info.Packets)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package packet
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// encryptedTestMessage returns a message symmetrically encrypted with
+// passphrase, holding a compressed literal data packet.
+func encryptedTestMessage(t *testing.T, passphrase []byte, contents string) []byte {
+	var buf bytes.Buffer
+	key, err := SerializeSymmetricKeyEncrypted(&buf, passphrase, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := SerializeSymmetricallyEncrypted(&buf, CipherAES128, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := SerializeCompressed(encrypted, CompressionZLIB, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	literal, err := SerializeLiteral(compressed, true, "test.txt", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	literal.Write([]byte(contents))
+	if err := literal.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func field(info *PacketInfo, name string) string {
+	for _, f := range info.Fields {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+func TestInspectEncrypted(t *testing.T) {
+	// Incompressible contents, so that the encrypted data needs partial
+	// lengths.
+	random := make([]byte, 2000)
+	rand.Read(random)
+	contents := hex.EncodeToString(random)
+	msg := encryptedTestMessage(t, []byte("password"), contents)
+
+	infos, err := Inspect(bytes.NewReader(msg), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("got %d packets, want 2", len(infos))
+	}
+	ske, se := infos[0], infos[1]
+	if ske.Tag != 3 || field(ske, "cipher algo") != "7" || field(ske, "s2k mode") != "3" || field(ske, "s2k count") == "" {
+		t.Errorf("bad symkey enc description: %+v", ske.Fields)
+	}
+	if se.Tag != 18 || se.Offset != int64(ske.HeaderLength)+ske.Length || len(se.Packets) != 0 {
+		t.Errorf("bad encrypted data description: %+v", se)
+	}
+	if se.PartialLengths == nil || !se.NewFormat {
+		t.Errorf("encrypted data not described as partial: %+v", se)
+	}
+	var total int64
+	for _, l := range se.PartialLengths {
+		total += l
+	}
+	if total != se.Length {
+		t.Errorf("partial lengths add up to %d, want %d", total, se.Length)
+	}
+
+	infos, err = Inspect(bytes.NewReader(msg), &InspectOptions{Passphrase: []byte("password")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	se = infos[1]
+	if se.Err != nil {
+		t.Fatalf("decryption failed: %s", se.Err)
+	}
+	if len(se.Packets) != 1 || se.Packets[0].Tag != 8 || field(se.Packets[0], "algo") != "2" {
+		t.Fatalf("compressed packet not found in plaintext: %+v", se.Packets)
+	}
+	compressed := se.Packets[0]
+	if len(compressed.Packets) != 1 || compressed.Packets[0].Tag != 11 {
+		t.Fatalf("literal data packet not found: %+v", compressed.Packets)
+	}
+	literal := compressed.Packets[0]
+	if field(literal, "name") != `"test.txt"` || field(literal, "raw data") != "4000 bytes" {
+		t.Errorf("bad literal data description: %+v", literal.Fields)
+	}
+
+	// A wrong passphrase leaves the data encrypted.
+	infos, err = Inspect(bytes.NewReader(msg), &InspectOptions{Passphrase: []byte("wrong")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos[1].Packets) != 0 || field(infos[1], "decrypted") == "yes" {
+		t.Error("data decrypted with the wrong passphrase")
+	}
+}
+
+func TestInspectSignature(t *testing.T) {
+	sig, _ := hex.DecodeString(signatureDataHex)
+	infos, err := Inspect(bytes.NewReader(sig), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Err != nil {
+		t.Fatalf("got %+v", infos)
+	}
+	info := infos[0]
+	if _, ok := info.Packet.(*Signature); !ok {
+		t.Errorf("Packet is a %T", info.Packet)
+	}
+	if info.HeaderLength != 3 || info.NewFormat != true {
+		t.Errorf("bad framing: hlen %d, new format %t", info.HeaderLength, info.NewFormat)
+	}
+	if field(info, "keyid") != "AB105C91AF38FB15" || field(info, "sigclass") != "0x00" {
+		t.Errorf("bad fields: %+v", info.Fields)
+	}
+	var hashed, unhashed bool
+	for _, sp := range info.Subpackets {
+		if sp.Type == 2 && sp.Hashed && strings.HasPrefix(sp.Description, "sig created 2010-") {
+			hashed = true
+		}
+		if sp.Type == 16 && !sp.Hashed && sp.Description == "issuer key ID AB105C91AF38FB15" {
+			unhashed = true
+		}
+	}
+	if !hashed || !unhashed {
+		t.Errorf("bad subpackets: %+v", info.Subpackets)
+	}
+}
+
+func TestInspectPublicKey(t *testing.T) {
+	pk, _ := hex.DecodeString(ecdsaPkDataHex)
+	pk = pk[:2+int(pk[1])] // drop the trailing garbage
+	infos, err := Inspect(bytes.NewReader(pk), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := infos[0]
+	if info.NewFormat || info.HeaderLength != 2 || info.Length != int64(len(pk)-2) {
+		t.Errorf("bad old format framing: %+v", info)
+	}
+	if field(info, "fingerprint") != strings.ToUpper(ecdsaFingerprintHex) || !strings.Contains(field(info, "curve"), "P-521") {
+		t.Errorf("bad fields: %+v", info.Fields)
+	}
+}
+
+func TestWriteListPackets(t *testing.T) {
+	msg := encryptedTestMessage(t, []byte("password"), "hello")
+	infos, err := Inspect(bytes.NewReader(msg), &InspectOptions{Passphrase: []byte("password")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteListPackets(&buf, infos); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# off=0 ctb=c3 tag=3 ",
+		":symkey enc packet:\n\tversion: 4\n",
+		"tag=18 ",
+		" new-ctb\n:encrypted data packet:\n",
+		":compressed packet:\n\talgo: 2\n",
+		":literal data packet:\n\tmode: b (62)\n",
+		"\traw data: 5 bytes\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestInspectTruncated(t *testing.T) {
+	sig, _ := hex.DecodeString(signatureDataHex)
+	infos, err := Inspect(bytes.NewReader(sig[:len(sig)-10]), nil)
+	if err == nil {
+		t.Fatal("no error for a truncated packet")
+	}
+	if len(infos) != 1 || infos[0].Err == nil {
+		t.Errorf("truncated packet not reported: %+v", infos)
+	}
+}
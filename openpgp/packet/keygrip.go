@@ -0,0 +1,191 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package packet
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"hash"
+	"math/big"
+	"strconv"
+
+	"golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/internal/ecc"
+)
+
+// Keygrip returns the keygrip of the key, the 20 byte identifier that
+// libgcrypt computes from the public key parameters. GnuPG uses it to name
+// the files in which it stores private keys, and smart cards and agents use
+// it to refer to keys.
+func (pk *PublicKey) Keygrip() ([]byte, error) {
+	h := sha1.New()
+	switch pk.PubKeyAlgo {
+	case PubKeyAlgoRSA, PubKeyAlgoRSAEncryptOnly, PubKeyAlgoRSASignOnly:
+		// Only the modulus is hashed, without any framing.
+		h.Write(signedMPIBytes(pk.n.Bytes()))
+	case PubKeyAlgoDSA:
+		writeKeygripParam(h, 'p', signedMPIBytes(pk.p.Bytes()))
+		writeKeygripParam(h, 'q', signedMPIBytes(pk.q.Bytes()))
+		writeKeygripParam(h, 'g', signedMPIBytes(pk.g.Bytes()))
+		writeKeygripParam(h, 'y', signedMPIBytes(pk.y.Bytes()))
+	case PubKeyAlgoElGamal:
+		writeKeygripParam(h, 'p', signedMPIBytes(pk.p.Bytes()))
+		writeKeygripParam(h, 'g', signedMPIBytes(pk.g.Bytes()))
+		writeKeygripParam(h, 'y', signedMPIBytes(pk.y.Bytes()))
+	case PubKeyAlgoECDSA, PubKeyAlgoECDH, PubKeyAlgoEdDSA:
+		curveInfo := ecc.FindByOid(pk.oid)
+		if curveInfo == nil {
+			return nil, errors.UnsupportedError(fmt.Sprintf("unsupported oid: %x", pk.oid))
+		}
+		params, err := keygripCurveParams(curveInfo)
+		if err != nil {
+			return nil, err
+		}
+		writeKeygripParam(h, 'p', params.p.Bytes())
+		writeKeygripParam(h, 'a', params.a.Bytes())
+		writeKeygripParam(h, 'b', params.b.Bytes())
+		writeKeygripParam(h, 'g', params.g)
+		writeKeygripParam(h, 'n', params.n.Bytes())
+		q := pk.p.Bytes()
+		if params.native {
+			// Strip the prefix of the native point format.
+			if len(q) == 0 || q[0] != 0x40 {
+				return nil, errors.StructuralError("point not in native format")
+			}
+			q = q[1:]
+		}
+		writeKeygripParam(h, 'q', q)
+	default:
+		return nil, errors.UnsupportedError("public key type: " + strconv.Itoa(int(pk.PubKeyAlgo)))
+	}
+	return h.Sum(nil), nil
+}
+
+// writeKeygripParam writes a named parameter to h in the canonical
+// S-expression format.
+func writeKeygripParam(h hash.Hash, name byte, value []byte) {
+	fmt.Fprintf(h, "(1:%c%d:", name, len(value))
+	h.Write(value)
+	h.Write([]byte{')'})
+}
+
+// signedMPIBytes returns the big-endian two's complement encoding of the
+// non-negative integer b, as GnuPG passes it to libgcrypt.
+func signedMPIBytes(b []byte) []byte {
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		return append([]byte{0}, b...)
+	}
+	return b
+}
+
+// keygripParams holds the domain parameters of a curve as libgcrypt defines
+// them. Negative parameters are hashed by their absolute value.
+type keygripParams struct {
+	p, a, b, n *big.Int
+	// g is the uncompressed base point.
+	g []byte
+	// native is set for curves whose points are hashed in the native
+	// format of RFC 7748 and RFC 8032.
+	native bool
+}
+
+func hexInt(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("openpgp: bad curve parameter " + s)
+	}
+	return n
+}
+
+func uncompressedPoint(byteLen int, x, y *big.Int) []byte {
+	g := make([]byte, 1+2*byteLen)
+	g[0] = 4
+	xBytes, yBytes := x.Bytes(), y.Bytes()
+	copy(g[1+byteLen-len(xBytes):], xBytes)
+	copy(g[1+2*byteLen-len(yBytes):], yBytes)
+	return g
+}
+
+var (
+	p25519 = hexInt("7FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFED")
+	n25519 = hexInt("1000000000000000000000000000000014DEF9DEA2F79CD65812631A5CF5D3ED")
+
+	ed25519KeygripParams = &keygripParams{
+		p: p25519,
+		// a is -1 and b is -d, see RFC 8032, section 5.1.
+		a: big.NewInt(1),
+		b: hexInt("2DFC9311D490018C7338BF8688861767FF8FF5B2BEBE27548A14B235ECA6874A"),
+		n: n25519,
+		g: uncompressedPoint(32,
+			hexInt("216936D3CD6E53FEC0A4E231FDD6DC5C692CC7609525A7B2C9562D608F25D51A"),
+			hexInt("6666666666666666666666666666666666666666666666666666666666666658")),
+		native: true,
+	}
+	curve25519KeygripParams = &keygripParams{
+		p: p25519,
+		// a is (A - 2) / 4, see RFC 7748, section 4.1.
+		a: big.NewInt(0x01DB41),
+		b: big.NewInt(1),
+		n: n25519,
+		g: uncompressedPoint(32,
+			big.NewInt(9),
+			hexInt("20AE19A1B8A086B4E01EDD2C7748D14C923D4D7E6D7C61B229E9C5A27ECED3D9")),
+		native: true,
+	}
+)
+
+// brainpoolCoefficients holds the coefficients a and b of the Brainpool
+// curves, which elliptic.CurveParams lacks. See RFC 5639, section 3.
+var brainpoolCoefficients = map[string][2]string{
+	"brainpoolP256r1": {
+		"7D5A0975FC2C3057EEF67530417AFFE7FB8055C126DC5C6CE94A4B44F330B5D9",
+		"26DC5C6CE94A4B44F330B5D9BBD77CBF958416295CF7E1CE6BCCDC18FF8C07B6",
+	},
+	"brainpoolP384r1": {
+		"7BC382C63D8C150C3C72080ACE05AFA0C2BEA28E4FB22787139165EFBA91F90F8AA5814A503AD4EB04A8C7DD22CE2826",
+		"04A8C7DD22CE28268B39B55416F0447C2FB77DE107DCD2A62E880EA53EEB62D57CB4390295DBC9943AB78696FA504C11",
+	},
+	"brainpoolP512r1": {
+		"7830A3318B603B89E2327145AC234CC594CBDD8D3DF91610A83441CAEA9863BC2DED5D5AA8253AA10A2EF1C98B9AC8B57F1117A72BF2C7B9E7C1AC4D77FC94CA",
+		"3DF91610A83441CAEA9863BC2DED5D5AA8253AA10A2EF1C98B9AC8B57F1117A72BF2C7B9E7C1AC4D77FC94CADC083E67984050B75EBAE5DD2809BD638016F723",
+	},
+}
+
+func keygripCurveParams(curveInfo *ecc.CurveInfo) (*keygripParams, error) {
+	switch curveInfo.Name {
+	case "Ed25519":
+		return ed25519KeygripParams, nil
+	case "Curve25519":
+		return curve25519KeygripParams, nil
+	}
+	params := curveInfo.Curve.Params()
+	var a, b *big.Int
+	switch curveInfo.CurveType {
+	case ecc.NISTCurve:
+		// The NIST curves have a = -3.
+		a, b = new(big.Int).Sub(params.P, big.NewInt(3)), params.B
+	case ecc.BitCurve:
+		// secp256k1 is y² = x³ + 7.
+		a, b = new(big.Int), big.NewInt(7)
+	case ecc.BrainpoolCurve:
+		coefficients, ok := brainpoolCoefficients[params.Name]
+		if !ok {
+			return nil, errors.UnsupportedError("keygrip of curve " + curveInfo.Name)
+		}
+		a, b = hexInt(coefficients[0]), hexInt(coefficients[1])
+	default:
+		return nil, errors.UnsupportedError("keygrip of curve " + curveInfo.Name)
+	}
+	return &keygripParams{
+		p: params.P,
+		a: a,
+		b: b,
+		n: params.N,
+		g: uncompressedPoint((params.BitSize+7)/8, params.Gx, params.Gy),
+	}, nil
+}
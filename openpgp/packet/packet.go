@@ -317,6 +317,7 @@ const (
 	packetTypeUserAttribute             packetType = 17
 	packetTypeSymmetricallyEncryptedMDC packetType = 18
 	packetTypeAEADEncrypted             packetType = 20
+	packetTypePadding                   packetType = 21
 )
 
 // EncryptedDataPacket holds encrypted data. It is currently implemented by
@@ -367,6 +368,8 @@ func Read(r io.Reader) (p Packet, err error) {
 		p = se
 	case packetTypeAEADEncrypted:
 		p = new(AEADEncrypted)
+	case packetTypePadding:
+		p = new(Padding)
 	default:
 		err = errors.UnknownPacketTypeError(tag)
 	}
@@ -384,17 +387,21 @@ func Read(r io.Reader) (p Packet, err error) {
 type SignatureType uint8
 
 const (
-	SigTypeBinary            SignatureType = 0x00
-	SigTypeText                            = 0x01
-	SigTypeGenericCert                     = 0x10
-	SigTypePersonaCert                     = 0x11
-	SigTypeCasualCert                      = 0x12
-	SigTypePositiveCert                    = 0x13
-	SigTypeSubkeyBinding                   = 0x18
-	SigTypePrimaryKeyBinding               = 0x19
-	SigTypeDirectSignature                 = 0x1F
-	SigTypeKeyRevocation                   = 0x20
-	SigTypeSubkeyRevocation                = 0x28
+	SigTypeBinary                 SignatureType = 0x00
+	SigTypeText                                 = 0x01
+	SigTypeStandalone                           = 0x02
+	SigTypeGenericCert                          = 0x10
+	SigTypePersonaCert                          = 0x11
+	SigTypeCasualCert                           = 0x12
+	SigTypePositiveCert                         = 0x13
+	SigTypeAttestation                          = 0x16
+	SigTypeSubkeyBinding                        = 0x18
+	SigTypePrimaryKeyBinding                    = 0x19
+	SigTypeDirectSignature                      = 0x1F
+	SigTypeKeyRevocation                        = 0x20
+	SigTypeSubkeyRevocation                     = 0x28
+	SigTypeTimestamp                            = 0x40
+	SigTypeThirdPartyConfirmation               = 0x50
 )
 
 // PublicKeyAlgorithm represents the different public key system specified for
@@ -6,6 +6,7 @@ package packet
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -290,3 +291,92 @@ func TestPartialLengthsShortWrite(t *testing.T) {
 		t.Errorf("got %q want %q", buf.Bytes(), data)
 	}
 }
+
+func TestPadding(t *testing.T) {
+	// Each length needs a different form of the length header, and some
+	// can't be encoded exactly with the shortest form.
+	for _, length := range []int{2, 100, 193, 194, 195, 8386, 8387, 9000} {
+		buf := new(bytes.Buffer)
+		if err := SerializePadding(buf, length, rand.Reader); err != nil {
+			t.Fatalf("length %d: %s", length, err)
+		}
+		if buf.Len() != length {
+			t.Errorf("length %d: wrote %d bytes", length, buf.Len())
+		}
+		p, err := Read(buf)
+		if err != nil {
+			t.Fatalf("length %d: %s", length, err)
+		}
+		if _, ok := p.(*Padding); !ok {
+			t.Fatalf("length %d: got %T, want *Padding", length, p)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("length %d: %d bytes left over", length, buf.Len())
+		}
+	}
+	if err := SerializePadding(ioutil.Discard, 1, rand.Reader); err == nil {
+		t.Error("serialized a one byte padding packet")
+	}
+
+	// Padding packets between other packets are skipped by Reader.
+	buf := new(bytes.Buffer)
+	SerializePadding(buf, 10, rand.Reader)
+	uid := NewUserId("Test", "", "test@example.org")
+	if err := uid.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	SerializePadding(buf, 300, rand.Reader)
+	SerializePadding(buf, 20, rand.Reader)
+	r := NewReader(buf)
+	p, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := p.(*UserId); !ok || got.Id != uid.Id {
+		t.Errorf("got %#v, want the user ID", p)
+	}
+	if p, err := r.Next(); err != io.EOF {
+		t.Errorf("got %#v, %v, want EOF", p, err)
+	}
+}
+
+func TestPaddingConfig(t *testing.T) {
+	buckets := &PaddingConfig{BucketSizes: []int{1024, 256, 4096}}
+	for _, test := range []struct {
+		n    int64
+		want int
+	}{
+		{0, 256},
+		{100, 156},
+		{255, 769},
+		{256, 0},
+		{1000, 24},
+		{4096, 0},
+		{5000, 3192},
+		{8191, 4097},
+	} {
+		got, err := buckets.Length(test.n, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("%d bytes: got %d bytes of padding, want %d", test.n, got, test.want)
+		}
+	}
+
+	random := &PaddingConfig{MaxRandom: 100}
+	for i := 0; i < 100; i++ {
+		got, err := random.Length(1000, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == 1 || got < 0 || got > 100 {
+			t.Errorf("got %d bytes of padding", got)
+		}
+	}
+
+	var none *PaddingConfig
+	if got, _ := none.Length(1000, rand.Reader); got != 0 {
+		t.Errorf("nil config added %d bytes of padding", got)
+	}
+}
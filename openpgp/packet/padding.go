@@ -0,0 +1,132 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package packet
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"math/big"
+
+	"golang.org/x/crypto/openpgp/errors"
+)
+
+// Padding represents a padding packet, which carries random data that hides
+// the length of a message. Its contents carry no meaning and are discarded
+// when parsing. See the crypto-refresh of RFC 4880, section 5.15.
+type Padding struct {
+	// Length is the number of bytes in the body of the packet.
+	Length int64
+}
+
+func (p *Padding) parse(r io.Reader) (err error) {
+	p.Length, err = consumeAll(r)
+	return
+}
+
+// SerializePadding writes a padding packet to w, filled with random bytes
+// from random. length is the total size of the packet, including its header,
+// and must be at least two.
+func SerializePadding(w io.Writer, length int, random io.Reader) (err error) {
+	if length < 2 {
+		return errors.InvalidArgumentError("padding packet too short")
+	}
+	if err = serializeType(w, packetTypePadding); err != nil {
+		return
+	}
+	// Lengths that can't be encoded exactly with the shortest form of the
+	// length header use the five octet form instead.
+	body := length - 2
+	if body >= 192 {
+		body = length - 3
+		if body < 192 || body >= 8384 {
+			body = length - 6
+			var buf [5]byte
+			buf[0] = 255
+			binary.BigEndian.PutUint32(buf[1:], uint32(body))
+			if _, err = w.Write(buf[:]); err != nil {
+				return
+			}
+			return writeRandom(w, body, random)
+		}
+	}
+	if err = serializeLength(w, body); err != nil {
+		return
+	}
+	return writeRandom(w, body, random)
+}
+
+func writeRandom(w io.Writer, n int, random io.Reader) error {
+	_, err := io.CopyN(w, random, int64(n))
+	return err
+}
+
+// PaddingConfig selects how much padding is added to encrypted messages.
+// Either BucketSizes or MaxRandom should be set. A nil *PaddingConfig
+// disables padding.
+type PaddingConfig struct {
+	// BucketSizes pads a message to the smallest of these sizes, in
+	// bytes, that is large enough to hold it. Messages larger than the
+	// largest bucket are padded to a multiple of it.
+	BucketSizes []int
+	// MaxRandom, if BucketSizes is empty, adds a random amount of
+	// padding between zero and MaxRandom bytes.
+	MaxRandom int
+}
+
+// Length returns the total size of the padding packet to append to a message
+// of n bytes, or zero if no padding is needed.
+func (conf *PaddingConfig) Length(n int64, random io.Reader) (int, error) {
+	if conf == nil {
+		return 0, nil
+	}
+	if len(conf.BucketSizes) == 0 {
+		if conf.MaxRandom <= 0 {
+			return 0, nil
+		}
+		b, err := rand.Int(random, big.NewInt(int64(conf.MaxRandom)+1))
+		if err != nil {
+			return 0, err
+		}
+		r := int(b.Int64())
+		if r == 0 {
+			return 0, nil
+		}
+		// A padding packet has at least a tag and a length octet.
+		if r < 2 {
+			r = 2
+		}
+		return r, nil
+	}
+
+	var largest int64
+	for _, size := range conf.BucketSizes {
+		if int64(size) > largest {
+			largest = int64(size)
+		}
+	}
+	if largest <= 0 {
+		return 0, errors.InvalidArgumentError("invalid padding bucket size")
+	}
+	// Pick the smallest bucket leaving either no room at all or room for
+	// a padding packet.
+	fits := func(size int64) bool {
+		return size == n || size >= n+2
+	}
+	best := int64(-1)
+	for _, size := range conf.BucketSizes {
+		s := int64(size)
+		if fits(s) && (best < 0 || s < best) {
+			best = s
+		}
+	}
+	if best < 0 {
+		best = (n + largest - 1) / largest * largest
+		if !fits(best) {
+			best += largest
+		}
+	}
+	return int(best - n), nil
+}
@@ -5,6 +5,7 @@
 package packet
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/dsa"
 	"crypto/ecdsa"
@@ -778,6 +779,139 @@ func (pk *PublicKey) VerifyUserIdSignature(id string, pub *PublicKey, sig *Signa
 	return pk.VerifySignature(h, sig)
 }
 
+// userAttributeSignatureHash returns a Hash of the message that needs to be
+// signed to assert that pk is a valid key for uat.
+func userAttributeSignatureHash(uat *UserAttribute, pk *PublicKey, hashFunc crypto.Hash) (h hash.Hash, err error) {
+	if !hashFunc.Available() {
+		return nil, errors.UnsupportedError("hash function")
+	}
+	h = hashFunc.New()
+
+	// RFC 4880, section 5.2.4
+	pk.SerializeSignaturePrefix(h)
+	pk.serializeWithoutHeaders(h)
+
+	data, err := uat.contents()
+	if err != nil {
+		return nil, err
+	}
+	var buf [5]byte
+	buf[0] = 0xd1
+	buf[1] = byte(len(data) >> 24)
+	buf[2] = byte(len(data) >> 16)
+	buf[3] = byte(len(data) >> 8)
+	buf[4] = byte(len(data))
+	h.Write(buf[:])
+	h.Write(data)
+
+	return
+}
+
+// VerifyUserAttributeSignature returns nil iff sig is a valid signature, made
+// by this public key, that uat is an attribute of pub.
+func (pk *PublicKey) VerifyUserAttributeSignature(uat *UserAttribute, pub *PublicKey, sig *Signature) (err error) {
+	h, err := userAttributeSignatureHash(uat, pub, sig.Hash)
+	if err != nil {
+		return err
+	}
+	return pk.VerifySignature(h, sig)
+}
+
+// emptySignatureHash returns a Hash of the message that is signed by
+// standalone and timestamp signatures, which only sign their own subpackets.
+func emptySignatureHash(hashFunc crypto.Hash) (h hash.Hash, err error) {
+	if !hashFunc.Available() {
+		return nil, errors.UnsupportedError("hash function")
+	}
+	return hashFunc.New(), nil
+}
+
+// signatureSignatureHash returns a Hash of the message that needs to be
+// signed to confirm sig. See RFC 4880, section 5.2.4: the signature packet
+// is hashed with an old-style header and without its unhashed subpackets.
+func signatureSignatureHash(sig *Signature, hashFunc crypto.Hash) (h hash.Hash, err error) {
+	if !hashFunc.Available() {
+		return nil, errors.UnsupportedError("hash function")
+	}
+	if len(sig.HashSuffix) < 6 || (sig.RSASignature == nil && sig.DSASigR == nil && sig.ECDSASigR == nil && sig.EdDSASigR == nil) {
+		return nil, errors.InvalidArgumentError("target signature has not been signed")
+	}
+	hashedOnly := *sig
+	hashedOnly.outSubpackets = nil
+	var body bytes.Buffer
+	if err = hashedOnly.serializeBody(&body); err != nil {
+		return nil, err
+	}
+
+	h = hashFunc.New()
+	var buf [5]byte
+	buf[0] = 0x88
+	binary.BigEndian.PutUint32(buf[1:], uint32(body.Len()))
+	h.Write(buf[:])
+	h.Write(body.Bytes())
+	return
+}
+
+// VerifyStandaloneSignature returns nil iff sig is a valid standalone
+// signature made by this public key.
+func (pk *PublicKey) VerifyStandaloneSignature(sig *Signature) (err error) {
+	if sig.SigType != SigTypeStandalone {
+		return errors.SignatureError("not a standalone signature")
+	}
+	h, err := emptySignatureHash(sig.Hash)
+	if err != nil {
+		return err
+	}
+	return pk.VerifySignature(h, sig)
+}
+
+// VerifyTimestampSignature returns nil iff sig is a valid timestamp signature
+// made by this public key. If target is not nil, sig must also identify
+// target in its signature target subpacket.
+func (pk *PublicKey) VerifyTimestampSignature(sig *Signature, target *Signature) (err error) {
+	if sig.SigType != SigTypeTimestamp {
+		return errors.SignatureError("not a timestamp signature")
+	}
+	if target != nil && (sig.SignatureTarget == nil || !sig.SignatureTarget.Matches(target)) {
+		return errors.SignatureError("timestamp signature doesn't refer to the target signature")
+	}
+	h, err := emptySignatureHash(sig.Hash)
+	if err != nil {
+		return err
+	}
+	return pk.VerifySignature(h, sig)
+}
+
+// VerifyThirdPartyConfirmation returns nil iff sig is a valid third-party
+// confirmation of target made by this public key.
+func (pk *PublicKey) VerifyThirdPartyConfirmation(sig *Signature, target *Signature) (err error) {
+	if sig.SigType != SigTypeThirdPartyConfirmation {
+		return errors.SignatureError("not a third-party confirmation signature")
+	}
+	if sig.SignatureTarget != nil && !sig.SignatureTarget.Matches(target) {
+		return errors.SignatureError("confirmation signature doesn't refer to the target signature")
+	}
+	h, err := signatureSignatureHash(target, sig.Hash)
+	if err != nil {
+		return err
+	}
+	return pk.VerifySignature(h, sig)
+}
+
+// VerifyAttestation returns nil iff sig is a valid attestation signature,
+// made by this public key, of third-party certifications of its identity id.
+// Use sig.Attests to check which certifications are approved.
+func (pk *PublicKey) VerifyAttestation(id string, sig *Signature) (err error) {
+	if sig.SigType != SigTypeAttestation {
+		return errors.SignatureError("not an attestation signature")
+	}
+	h, err := userIdSignatureHash(id, pk, sig.Hash)
+	if err != nil {
+		return err
+	}
+	return pk.VerifySignature(h, sig)
+}
+
 // KeyIdString returns the public key's fingerprint in capital hex
 // (e.g. "6C7EE1B8621CC013").
 func (pk *PublicKey) KeyIdString() string {
@@ -790,6 +924,42 @@ func (pk *PublicKey) KeyIdShortString() string {
 	return fmt.Sprintf("%X", pk.Fingerprint[16:20])
 }
 
+// FingerprintString returns the public key's fingerprint in capital hex, as
+// shown by gpg --with-colons.
+func (pk *PublicKey) FingerprintString() string {
+	return fmt.Sprintf("%X", pk.Fingerprint)
+}
+
+// FormatFingerprint formats a fingerprint in capital hex for display, in the
+// groups that gpg --fingerprint uses. A v4 fingerprint is split into groups
+// of four digits with an extra space in the middle
+// (e.g. "5B4C 7F3A ... 9E1D  0A6C ... 621C C013"). A v5 fingerprint is
+// truncated to 25 bytes and split into groups of five digits. Fingerprints
+// of other lengths are returned as a single group.
+func FormatFingerprint(fingerprint []byte) string {
+	s := fmt.Sprintf("%X", fingerprint)
+	var group int
+	switch len(fingerprint) {
+	case 20:
+		group = 4
+	case 32:
+		s, group = s[:50], 5
+	default:
+		return s
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i += group {
+		if i > 0 {
+			buf.WriteByte(' ')
+			if len(fingerprint) == 20 && i == len(s)/2 {
+				buf.WriteByte(' ')
+			}
+		}
+		buf.WriteString(s[i : i+group])
+	}
+	return buf.String()
+}
+
 // BitLength returns the bit length for the given public key.
 func (pk *PublicKey) BitLength() (bitLength uint16, err error) {
 	switch pk.PubKeyAlgo {
@@ -817,7 +987,8 @@ func (pk *PublicKey) KeyExpired(sig *Signature, currentTime time.Time) bool {
 	if pk.CreationTime.After(currentTime) {
 		return true
 	}
-	if sig.KeyLifetimeSecs == nil {
+	if sig.KeyLifetimeSecs == nil || *sig.KeyLifetimeSecs == 0 {
+		// RFC 4880, section 5.2.3.6: a zero lifetime never expires.
 		return false
 	}
 	expiry := pk.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second)
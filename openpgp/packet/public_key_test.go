@@ -9,9 +9,13 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"encoding/hex"
+	"fmt"
 	"math/big"
 	"testing"
 	"time"
+
+	"golang.org/x/crypto/bitcurves"
+	"golang.org/x/crypto/brainpool"
 )
 
 var pubKeyTests = []struct {
@@ -210,3 +214,88 @@ func fromHex(hex string) *big.Int {
 	}
 	return n
 }
+
+func TestKeygrip(t *testing.T) {
+	// The expected keygrips were computed by libgcrypt.
+	keygrips := []string{
+		"548890A8367CCA831CFB70227B35207D6150D09A",
+		"FC8E40C181AC2989ACD7B474E8F41925F267C018",
+		"03CC61CCA31DA065D83151B510D6028FAC3CC1FA",
+		"303ACC892C2D786C8A789677C0BE54DA8538F903",
+		"B860D9DAE29DF1036CA42C8814D419441E0CCB5A",
+	}
+	for i, test := range pubKeyTests {
+		p, err := Read(readerFromHex(test.hexData))
+		if err != nil {
+			t.Fatalf("#%d: Read error: %s", i, err)
+		}
+		grip, err := p.(*PublicKey).Keygrip()
+		if err != nil {
+			t.Errorf("#%d: Keygrip error: %s", i, err)
+			continue
+		}
+		if got := fmt.Sprintf("%X", grip); got != keygrips[i] {
+			t.Errorf("#%d: bad keygrip got:%s want:%s", i, got, keygrips[i])
+		}
+	}
+
+	p, err := Read(readerFromHex(privKeyElGamalHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	grip, err := p.(*PrivateKey).PublicKey.Keygrip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprintf("%X", grip), "FBAC5A3F0F644A9236DB2ADED913DA8FC204B0DE"; got != want {
+		t.Errorf("ElGamal: bad keygrip got:%s want:%s", got, want)
+	}
+
+	// Keys whose point is the base point of their curve.
+	for _, test := range []struct {
+		curve   elliptic.Curve
+		keygrip string
+	}{
+		{elliptic.P256(), "95852E917FE2C39152BA998192B5791DB15CDCF0"},
+		{elliptic.P384(), "CACDC8B39C5DAD77B9EE85F9B99805111BBFFA34"},
+		{elliptic.P521(), "B5A5C8618B1F318B75F2ABAC1398167B1BF489B7"},
+		{bitcurves.S256(), "D8575FD3F140878C64ED70EABB65B739EAED33B9"},
+		{brainpool.P256r1(), "344C4CABAEFB2DE04442034EEB71DE83CA25733F"},
+		{brainpool.P384r1(), "5AADAF5F53DF42583A4C118216E5492FEFFC18EF"},
+		{brainpool.P512r1(), "2C553DA19664A4E078E63C7900AB9CFD5AD87718"},
+	} {
+		params := test.curve.Params()
+		pub := NewECDSAPublicKey(time.Unix(0, 0), &ecdsa.PublicKey{Curve: test.curve, X: params.Gx, Y: params.Gy})
+		grip, err := pub.Keygrip()
+		if err != nil {
+			t.Errorf("%s: Keygrip error: %s", params.Name, err)
+			continue
+		}
+		if got := fmt.Sprintf("%X", grip); got != test.keygrip {
+			t.Errorf("%s: bad keygrip got:%s want:%s", params.Name, got, test.keygrip)
+		}
+	}
+}
+
+func TestFormatFingerprint(t *testing.T) {
+	for _, test := range []struct {
+		hexFingerprint, want string
+	}{
+		{rsaFingerprintHex, "5FB7 4B1D 03B1 E3CB 31BC  2F8A A34D 7E18 C20C 31BB"},
+		{"19347BC9872464025F99DF3EC2E0000ED9884892E1F7B3EA4C94009159569B54", "19347 BC987 24640 25F99 DF3EC 2E000 0ED98 84892 E1F7B 3EA4C"},
+		{"0102", "0102"},
+	} {
+		fingerprint, _ := hex.DecodeString(test.hexFingerprint)
+		if got := FormatFingerprint(fingerprint); got != test.want {
+			t.Errorf("FormatFingerprint(%s) = %q, want %q", test.hexFingerprint, got, test.want)
+		}
+	}
+
+	p, err := Read(readerFromHex(rsaPkDataHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.(*PublicKey).FingerprintString(), "5FB74B1D03B1E3CB31BC2F8AA34D7E18C20C31BB"; got != want {
+		t.Errorf("FingerprintString() = %q, want %q", got, want)
+	}
+}
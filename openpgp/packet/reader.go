@@ -26,7 +26,8 @@ type Reader struct {
 const maxReaders = 32
 
 // Next returns the most recently unread Packet, or reads another packet from
-// the top-most io.Reader. Unknown packet types are skipped.
+// the top-most io.Reader. Unknown packet types and padding packets are
+// skipped.
 func (r *Reader) Next() (p Packet, err error) {
 	if len(r.q) > 0 {
 		p = r.q[len(r.q)-1]
@@ -37,6 +38,9 @@ func (r *Reader) Next() (p Packet, err error) {
 	for len(r.readers) > 0 {
 		p, err = Read(r.readers[len(r.readers)-1])
 		if err == nil {
+			if _, ok := p.(*Padding); ok {
+				continue
+			}
 			return
 		}
 		if err == io.EOF {
@@ -9,6 +9,7 @@ import (
 	"crypto"
 	"crypto/dsa"
 	"crypto/ecdsa"
+	"crypto/hmac"
 	"encoding/asn1"
 	"encoding/binary"
 	"hash"
@@ -28,6 +29,8 @@ const (
 	KeyFlagSign
 	KeyFlagEncryptCommunications
 	KeyFlagEncryptStorage
+	KeyFlagSplitKey
+	KeyFlagAuthenticate
 )
 
 // Signature represents a signature. See RFC 4880, section 5.2.
@@ -72,6 +75,7 @@ type Signature struct {
 	// 5.2.3.21 for details.
 	FlagsValid                                                           bool
 	FlagCertify, FlagSign, FlagEncryptCommunications, FlagEncryptStorage bool
+	FlagAuthenticate                                                     bool
 
 	// RevocationReason is set if this signature has been revoked.
 	// See RFC 4880, section 5.2.3.23 for details.
@@ -88,9 +92,54 @@ type Signature struct {
 	// subkey as their own.
 	EmbeddedSignature *Signature
 
+	// SignatureTarget, if non-nil, identifies the signature that a
+	// timestamp or third-party confirmation signature refers to. See RFC
+	// 4880, section 5.2.3.25.
+	SignatureTarget *SignatureTarget
+
+	// AttestedCertifications holds, in an attestation signature, the
+	// digests of the third-party certifications that the key holder
+	// approves. See AttestationDigest.
+	AttestedCertifications [][]byte
+
 	outSubpackets []outputSubpacket
 }
 
+// SignatureTarget identifies a signature by the hash of its contents. See
+// RFC 4880, section 5.2.3.25.
+type SignatureTarget struct {
+	PubKeyAlgo PublicKeyAlgorithm
+	Hash       crypto.Hash
+	Digest     []byte
+}
+
+// NewSignatureTarget returns a SignatureTarget that identifies target. The
+// digest is computed with the hash function of target, over the same data
+// that a third-party confirmation signature of target signs.
+func NewSignatureTarget(target *Signature) (*SignatureTarget, error) {
+	h, err := signatureSignatureHash(target, target.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return &SignatureTarget{
+		PubKeyAlgo: target.PubKeyAlgo,
+		Hash:       target.Hash,
+		Digest:     h.Sum(nil),
+	}, nil
+}
+
+// Matches returns whether t identifies sig.
+func (t *SignatureTarget) Matches(sig *Signature) bool {
+	if t.PubKeyAlgo != sig.PubKeyAlgo || t.Hash != sig.Hash {
+		return false
+	}
+	other, err := NewSignatureTarget(sig)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(t.Digest, other.Digest)
+}
+
 func (sig *Signature) parse(r io.Reader) (err error) {
 	// RFC 4880, section 5.2.3
 	var buf [5]byte
@@ -210,20 +259,22 @@ func parseSignatureSubpackets(sig *Signature, subpackets []byte, isHashed bool)
 type signatureSubpacketType uint8
 
 const (
-	creationTimeSubpacket        signatureSubpacketType = 2
-	signatureExpirationSubpacket signatureSubpacketType = 3
-	keyExpirationSubpacket       signatureSubpacketType = 9
-	prefSymmetricAlgosSubpacket  signatureSubpacketType = 11
-	issuerSubpacket              signatureSubpacketType = 16
-	prefHashAlgosSubpacket       signatureSubpacketType = 21
-	prefCompressionSubpacket     signatureSubpacketType = 22
-	primaryUserIdSubpacket       signatureSubpacketType = 25
-	keyFlagsSubpacket            signatureSubpacketType = 27
-	reasonForRevocationSubpacket signatureSubpacketType = 29
-	featuresSubpacket            signatureSubpacketType = 30
-	embeddedSignatureSubpacket   signatureSubpacketType = 32
-	issuerFingerprintSubpacket   signatureSubpacketType = 33
-	prefAeadAlgosSubpacket       signatureSubpacketType = 34
+	creationTimeSubpacket           signatureSubpacketType = 2
+	signatureExpirationSubpacket    signatureSubpacketType = 3
+	keyExpirationSubpacket          signatureSubpacketType = 9
+	prefSymmetricAlgosSubpacket     signatureSubpacketType = 11
+	issuerSubpacket                 signatureSubpacketType = 16
+	prefHashAlgosSubpacket          signatureSubpacketType = 21
+	prefCompressionSubpacket        signatureSubpacketType = 22
+	primaryUserIdSubpacket          signatureSubpacketType = 25
+	keyFlagsSubpacket               signatureSubpacketType = 27
+	reasonForRevocationSubpacket    signatureSubpacketType = 29
+	featuresSubpacket               signatureSubpacketType = 30
+	signatureTargetSubpacket        signatureSubpacketType = 31
+	embeddedSignatureSubpacket      signatureSubpacketType = 32
+	issuerFingerprintSubpacket      signatureSubpacketType = 33
+	prefAeadAlgosSubpacket          signatureSubpacketType = 34
+	attestedCertificationsSubpacket signatureSubpacketType = 37
 )
 
 // parseSignatureSubpacket parses a single subpacket. len(subpacket) is >= 1.
@@ -368,6 +419,9 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 		if subpacket[0]&KeyFlagEncryptStorage != 0 {
 			sig.FlagEncryptStorage = true
 		}
+		if subpacket[0]&KeyFlagAuthenticate != 0 {
+			sig.FlagAuthenticate = true
+		}
 	case reasonForRevocationSubpacket:
 		// Reason For Revocation, section 5.2.3.23
 		if !isHashed {
@@ -436,6 +490,42 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 		}
 		sig.PreferredAEAD = make([]byte, len(subpacket))
 		copy(sig.PreferredAEAD, subpacket)
+	case signatureTargetSubpacket:
+		// Signature Target, section 5.2.3.25
+		if !isHashed {
+			return
+		}
+		// A target with an unknown hash function or a bad digest length
+		// is ignored, unless the subpacket is critical.
+		var hashFunc crypto.Hash
+		if len(subpacket) >= 2 {
+			hashFunc, _ = s2k.HashIdToHash(subpacket[1])
+		}
+		if hashFunc == 0 || len(subpacket[2:]) != hashFunc.Size() {
+			if isCritical {
+				err = errors.UnsupportedError("critical signature target subpacket with unknown hash function or bad length")
+			}
+			return
+		}
+		sig.SignatureTarget = &SignatureTarget{
+			PubKeyAlgo: PublicKeyAlgorithm(subpacket[0]),
+			Hash:       hashFunc,
+			Digest:     append([]byte(nil), subpacket[2:]...),
+		}
+	case attestedCertificationsSubpacket:
+		// Attested Certifications, a list of digests of the same size
+		// as the hash function of the signature.
+		if !isHashed {
+			return
+		}
+		size := sig.Hash.Size()
+		if len(subpacket)%size != 0 {
+			err = errors.StructuralError("attested certifications subpacket with bad length")
+			return
+		}
+		for i := 0; i < len(subpacket); i += size {
+			sig.AttestedCertifications = append(sig.AttestedCertifications, append([]byte(nil), subpacket[i:i+size]...))
+		}
 	default:
 		if isCritical {
 			err = errors.UnsupportedError("unknown critical signature subpacket type " + strconv.Itoa(int(packetType)))
@@ -677,6 +767,21 @@ func (sig *Signature) SignUserId(id string, pub *PublicKey, priv *PrivateKey, co
 	return sig.Sign(h, priv, config)
 }
 
+// SignUserAttribute computes a signature from priv, asserting that pub is a
+// valid key for the user attribute uat. On success, the signature is stored
+// in sig. Call Serialize to write it out.
+// If config is nil, sensible defaults will be used.
+func (sig *Signature) SignUserAttribute(uat *UserAttribute, pub *PublicKey, priv *PrivateKey, config *Config) error {
+	if priv.Dummy() {
+		return errors.ErrDummyPrivateKey("dummy key found")
+	}
+	h, err := userAttributeSignatureHash(uat, pub, sig.Hash)
+	if err != nil {
+		return err
+	}
+	return sig.Sign(h, priv, config)
+}
+
 // CrossSignKey computes a signature from signingKey on pub hashed using hashKey. On success,
 // the signature is stored in sig. Call Serialize to write it out.
 // If config is nil, sensible defaults will be used.
@@ -714,6 +819,102 @@ func (sig *Signature) RevokeKey(pub *PublicKey, priv *PrivateKey, config *Config
 	return sig.Sign(h, priv, config)
 }
 
+// SignStandalone computes a standalone signature, that only signs its own
+// subpackets, using priv. On success, the signature is stored in sig. Call
+// Serialize to write it out.
+// If config is nil, sensible defaults will be used.
+func (sig *Signature) SignStandalone(priv *PrivateKey, config *Config) error {
+	h, err := emptySignatureHash(sig.Hash)
+	if err != nil {
+		return err
+	}
+	return sig.Sign(h, priv, config)
+}
+
+// SignTimestamp computes a timestamp signature using priv, asserting that
+// target, which may be nil, existed at the creation time of sig. target is
+// identified by a signature target subpacket. On success, the signature is
+// stored in sig. Call Serialize to write it out.
+// If config is nil, sensible defaults will be used.
+func (sig *Signature) SignTimestamp(target *Signature, priv *PrivateKey, config *Config) (err error) {
+	if target != nil {
+		if sig.SignatureTarget, err = NewSignatureTarget(target); err != nil {
+			return err
+		}
+	}
+	h, err := emptySignatureHash(sig.Hash)
+	if err != nil {
+		return err
+	}
+	return sig.Sign(h, priv, config)
+}
+
+// SignThirdPartyConfirmation computes a third-party confirmation of target
+// using priv. The signature also identifies target by a signature target
+// subpacket. On success, the signature is stored in sig. Call Serialize to
+// write it out.
+// If config is nil, sensible defaults will be used.
+func (sig *Signature) SignThirdPartyConfirmation(target *Signature, priv *PrivateKey, config *Config) (err error) {
+	if sig.SignatureTarget, err = NewSignatureTarget(target); err != nil {
+		return err
+	}
+	h, err := signatureSignatureHash(target, sig.Hash)
+	if err != nil {
+		return err
+	}
+	return sig.Sign(h, priv, config)
+}
+
+// SignAttestation computes an attestation signature by priv, the private key
+// of pub, approving the third-party certifications of the identity id of pub.
+// It replaces any certifications previously attested by the same key and
+// identity; an attestation without certifications withdraws them all. On
+// success, the signature is stored in sig. Call Serialize to write it out.
+// If config is nil, sensible defaults will be used.
+func (sig *Signature) SignAttestation(id string, certifications []*Signature, pub *PublicKey, priv *PrivateKey, config *Config) error {
+	if priv.Dummy() {
+		return errors.ErrDummyPrivateKey("dummy key found")
+	}
+	sig.AttestedCertifications = nil
+	for _, cert := range certifications {
+		digest, err := sig.AttestationDigest(cert)
+		if err != nil {
+			return err
+		}
+		sig.AttestedCertifications = append(sig.AttestedCertifications, digest)
+	}
+	h, err := userIdSignatureHash(id, pub, sig.Hash)
+	if err != nil {
+		return err
+	}
+	return sig.Sign(h, priv, config)
+}
+
+// AttestationDigest returns the digest that identifies cert in the attested
+// certifications of the attestation signature sig.
+func (sig *Signature) AttestationDigest(cert *Signature) ([]byte, error) {
+	h, err := signatureSignatureHash(cert, sig.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// Attests returns whether the attestation signature sig approves cert. The
+// attestation must have been verified separately.
+func (sig *Signature) Attests(cert *Signature) bool {
+	digest, err := sig.AttestationDigest(cert)
+	if err != nil {
+		return false
+	}
+	for _, attested := range sig.AttestedCertifications {
+		if hmac.Equal(attested, digest) {
+			return true
+		}
+	}
+	return false
+}
+
 // Serialize marshals sig to w. Sign, SignUserId or SignKey must have been
 // called first.
 func (sig *Signature) Serialize(w io.Writer) (err error) {
@@ -850,6 +1051,9 @@ func (sig *Signature) buildSubpackets(issuer PublicKey) (subpackets []outputSubp
 		if sig.FlagEncryptStorage {
 			flags |= KeyFlagEncryptStorage
 		}
+		if sig.FlagAuthenticate {
+			flags |= KeyFlagAuthenticate
+		}
 		subpackets = append(subpackets, outputSubpacket{true, keyFlagsSubpacket, false, []byte{flags}})
 	}
 
@@ -902,6 +1106,24 @@ func (sig *Signature) buildSubpackets(issuer PublicKey) (subpackets []outputSubp
 			append([]uint8{*sig.RevocationReason}, []uint8(sig.RevocationReasonText)...)})
 	}
 
+	if sig.SignatureTarget != nil {
+		hashId, ok := s2k.HashToHashId(sig.SignatureTarget.Hash)
+		if !ok {
+			return nil, errors.InvalidArgumentError("signature target hash cannot be represented in OpenPGP: " + strconv.Itoa(int(sig.SignatureTarget.Hash)))
+		}
+		contents := append([]byte{uint8(sig.SignatureTarget.PubKeyAlgo), hashId}, sig.SignatureTarget.Digest...)
+		subpackets = append(subpackets, outputSubpacket{true, signatureTargetSubpacket, false, contents})
+	}
+
+	// AttestedCertifications appears only in attestation signatures.
+	if len(sig.AttestedCertifications) > 0 {
+		var contents []byte
+		for _, digest := range sig.AttestedCertifications {
+			contents = append(contents, digest...)
+		}
+		subpackets = append(subpackets, outputSubpacket{true, attestedCertificationsSubpacket, false, contents})
+	}
+
 	// EmbeddedSignature appears only in subkeys capable of signing and is serialized as per section 5.2.3.26.
 	if sig.EmbeddedSignature != nil {
 		var buf bytes.Buffer
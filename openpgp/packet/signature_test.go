@@ -7,8 +7,12 @@ package packet
 import (
 	"bytes"
 	"crypto"
+	"crypto/rand"
 	"encoding/hex"
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
 )
 
 func TestSignatureRead(t *testing.T) {
@@ -39,6 +43,127 @@ func TestSignatureReserialize(t *testing.T) {
 	}
 }
 
+// newTestSignature signs a fresh signature of sigType with sign and returns
+// it after a serialization round trip.
+func newTestSignature(t *testing.T, sigType SignatureType, priv *PrivateKey, sign func(*Signature) error) *Signature {
+	sig := &Signature{
+		SigType:      sigType,
+		PubKeyAlgo:   priv.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &priv.KeyId,
+	}
+	if err := sign(sig); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := sig.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.(*Signature)
+}
+
+func TestSignatureOfSignature(t *testing.T) {
+	var keys []*PrivateKey
+	for i := 0; i < 2; i++ {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, NewEdDSAPrivateKey(time.Now(), &priv))
+	}
+	alice, notary := keys[0], keys[1]
+
+	standalone := newTestSignature(t, SigTypeStandalone, alice, func(sig *Signature) error {
+		return sig.SignStandalone(alice, nil)
+	})
+	if err := alice.VerifyStandaloneSignature(standalone); err != nil {
+		t.Errorf("standalone signature: %s", err)
+	}
+	if err := notary.VerifyStandaloneSignature(standalone); err == nil {
+		t.Error("standalone signature verified with the wrong key")
+	}
+
+	timestamp := newTestSignature(t, SigTypeTimestamp, notary, func(sig *Signature) error {
+		return sig.SignTimestamp(standalone, notary, nil)
+	})
+	if timestamp.SignatureTarget == nil || !timestamp.SignatureTarget.Matches(standalone) {
+		t.Fatal("timestamp signature target not parsed")
+	}
+	if err := notary.VerifyTimestampSignature(timestamp, standalone); err != nil {
+		t.Errorf("timestamp signature: %s", err)
+	}
+	if err := notary.VerifyTimestampSignature(timestamp, timestamp); err == nil {
+		t.Error("timestamp signature verified for the wrong target")
+	}
+	if err := notary.VerifyStandaloneSignature(timestamp); err == nil {
+		t.Error("timestamp signature verified as standalone signature")
+	}
+
+	confirmation := newTestSignature(t, SigTypeThirdPartyConfirmation, notary, func(sig *Signature) error {
+		return sig.SignThirdPartyConfirmation(standalone, notary, nil)
+	})
+	if err := notary.VerifyThirdPartyConfirmation(confirmation, standalone); err != nil {
+		t.Errorf("third-party confirmation: %s", err)
+	}
+	if err := notary.VerifyThirdPartyConfirmation(confirmation, timestamp); err == nil {
+		t.Error("third-party confirmation verified for the wrong target")
+	}
+
+	// Unhashed subpackets of the target don't affect confirmations.
+	standalone.rawSubpackets = append(standalone.rawSubpackets, outputSubpacket{false, signatureSubpacketType(20), false, []byte{1}})
+	standalone.outSubpackets = standalone.rawSubpackets
+	if err := notary.VerifyThirdPartyConfirmation(confirmation, standalone); err != nil {
+		t.Errorf("third-party confirmation depends on unhashed subpackets: %s", err)
+	}
+
+	id := "alice <alice@example.org>"
+	cert := newTestSignature(t, SigTypeGenericCert, notary, func(sig *Signature) error {
+		return sig.SignUserId(id, &alice.PublicKey, notary, nil)
+	})
+	attestation := newTestSignature(t, SigTypeAttestation, alice, func(sig *Signature) error {
+		return sig.SignAttestation(id, []*Signature{cert}, &alice.PublicKey, alice, nil)
+	})
+	if err := alice.VerifyAttestation(id, attestation); err != nil {
+		t.Errorf("attestation: %s", err)
+	}
+	if len(attestation.AttestedCertifications) != 1 || !attestation.Attests(cert) {
+		t.Error("attested certification not found")
+	}
+	if attestation.Attests(confirmation) {
+		t.Error("unrelated signature attested")
+	}
+}
+
+func TestSignatureTargetUnknownHash(t *testing.T) {
+	// A target with the unknown hash function 99 is ignored, unless the
+	// subpacket is critical.
+	for _, critical := range []bool{false, true} {
+		subpacket := []byte{6, byte(signatureTargetSubpacket), byte(PubKeyAlgoEdDSA), 99, 1, 2, 3}
+		if critical {
+			subpacket[1] |= 0x80
+		}
+		sig := new(Signature)
+		_, err := parseSignatureSubpacket(sig, subpacket, true)
+		if critical {
+			if err == nil {
+				t.Error("critical signature target with an unknown hash function parsed")
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("signature target with an unknown hash function: %s", err)
+		}
+		if sig.SignatureTarget != nil {
+			t.Error("signature target with an unknown hash function was not ignored")
+		}
+	}
+}
+
 func TestSignUserId(t *testing.T) {
 	sig := &Signature{
 		Version:    4,
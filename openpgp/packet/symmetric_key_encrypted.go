@@ -24,6 +24,7 @@ type SymmetricKeyEncrypted struct {
 	Version      int
 	CipherFunc   CipherFunction
 	Mode         AEADMode
+	S2KParams    *s2k.Params // the parameters of the passphrase derivation.
 	s2k          func(out, in []byte)
 	aeadNonce    []byte
 	encryptedKey []byte
@@ -53,7 +54,10 @@ func (ske *SymmetricKeyEncrypted) parse(r io.Reader) error {
 	}
 
 	var err error
-	if ske.s2k, err = s2k.Parse(r); err != nil {
+	if ske.S2KParams, err = s2k.ParseIntoParams(r); err != nil {
+		return err
+	}
+	if ske.s2k, err = ske.S2KParams.Function(); err != nil {
 		if _, ok := err.(errors.ErrDummyPrivateKey); ok {
 			return errors.UnsupportedError("missing key GNU extension in session key")
 		}
@@ -67,20 +67,29 @@ func (uat *UserAttribute) parse(r io.Reader) (err error) {
 // Serialize marshals the user attribute to w in the form of an OpenPGP packet, including
 // header.
 func (uat *UserAttribute) Serialize(w io.Writer) (err error) {
-	var buf bytes.Buffer
-	for _, sp := range uat.Contents {
-		err = sp.Serialize(&buf)
-		if err != nil {
-			return err
-		}
+	contents, err := uat.contents()
+	if err != nil {
+		return err
 	}
-	if err = serializeHeader(w, packetTypeUserAttribute, buf.Len()); err != nil {
+	if err = serializeHeader(w, packetTypeUserAttribute, len(contents)); err != nil {
 		return err
 	}
-	_, err = w.Write(buf.Bytes())
+	_, err = w.Write(contents)
 	return
 }
 
+// contents returns the body of the user attribute packet: its serialized
+// subpackets.
+func (uat *UserAttribute) contents() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, sp := range uat.Contents {
+		if err := sp.Serialize(&buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
 // ImageData returns zero or more byte slices, each containing
 // JPEG File Interchange Format (JFIF), for each photo in the
 // user attribute packet.
@@ -0,0 +1,131 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pgpmime implements the MIME security multiparts for OpenPGP, as
+// specified in RFC 3156.
+//
+// Signed messages are carried in a multipart/signed entity whose first part
+// is the signed MIME entity and whose second part is an armored detached
+// signature. Encrypted messages are carried in a multipart/encrypted entity
+// whose second part is an armored OpenPGP message. Signed and encrypted
+// messages may either nest a multipart/signed entity inside the encrypted
+// payload (RFC 3156, section 6.1) or carry the signature inside the OpenPGP
+// message itself (RFC 3156, section 6.2); both forms are understood when
+// decoding.
+package pgpmime // import "golang.org/x/crypto/openpgp/pgpmime"
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+const (
+	// SignedProtocol is the value of the protocol parameter of a
+	// multipart/signed entity, and the media type of its signature part.
+	SignedProtocol = "application/pgp-signature"
+	// EncryptedProtocol is the value of the protocol parameter of a
+	// multipart/encrypted entity, and the media type of its control part.
+	EncryptedProtocol = "application/pgp-encrypted"
+)
+
+// MicAlg returns the value of the micalg parameter of a multipart/signed
+// entity whose signature was made with the given hash. See RFC 3156, section
+// 5.
+func MicAlg(h crypto.Hash) (string, error) {
+	switch h {
+	case crypto.MD5:
+		return "pgp-md5", nil
+	case crypto.SHA1:
+		return "pgp-sha1", nil
+	case crypto.RIPEMD160:
+		return "pgp-ripemd160", nil
+	case crypto.SHA224:
+		return "pgp-sha224", nil
+	case crypto.SHA256:
+		return "pgp-sha256", nil
+	case crypto.SHA384:
+		return "pgp-sha384", nil
+	case crypto.SHA512:
+		return "pgp-sha512", nil
+	}
+	return "", errors.UnsupportedError("no micalg for hash " + h.String())
+}
+
+// HashForMicAlg returns the hash named by the micalg parameter of a
+// multipart/signed entity, or 0 if the name isn't known. The comparison is
+// case-insensitive.
+func HashForMicAlg(micalg string) crypto.Hash {
+	switch strings.ToLower(micalg) {
+	case "pgp-md5":
+		return crypto.MD5
+	case "pgp-sha1":
+		return crypto.SHA1
+	case "pgp-ripemd160":
+		return crypto.RIPEMD160
+	case "pgp-sha224":
+		return crypto.SHA224
+	case "pgp-sha256":
+		return crypto.SHA256
+	case "pgp-sha384":
+		return crypto.SHA384
+	case "pgp-sha512":
+		return crypto.SHA512
+	}
+	return crypto.Hash(0)
+}
+
+// newBoundary returns a fresh multipart boundary drawn from the random source
+// of config.
+func newBoundary(config *packet.Config) (string, error) {
+	var buf [24]byte
+	if _, err := io.ReadFull(config.Random(), buf[:]); err != nil {
+		return "", err
+	}
+	return "pgpmime-" + hex.EncodeToString(buf[:]), nil
+}
+
+// crlfWriter converts the line endings of the text written to it to the
+// canonical CRLF form required of MIME entities, see RFC 3156, section 5.
+// Existing CRLF pairs are left untouched.
+type crlfWriter struct {
+	w      io.Writer
+	prevCR bool
+}
+
+var crlf = []byte("\r\n")
+
+func (c *crlfWriter) Write(buf []byte) (n int, err error) {
+	start := 0
+	for i, b := range buf {
+		if b == '\n' && !c.prevCR {
+			if _, err = c.w.Write(buf[start:i]); err != nil {
+				return
+			}
+			if _, err = c.w.Write(crlf); err != nil {
+				return
+			}
+			start = i + 1
+		}
+		c.prevCR = b == '\r'
+	}
+	if _, err = c.w.Write(buf[start:]); err != nil {
+		return
+	}
+	return len(buf), nil
+}
+
+// canonicalize returns a copy of data with all line endings converted to
+// CRLF.
+func canonicalize(data []byte) []byte {
+	var out bytes.Buffer
+	cw := &crlfWriter{w: &out}
+	cw.Write(data)
+	return out.Bytes()
+}
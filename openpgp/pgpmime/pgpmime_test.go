@@ -0,0 +1,245 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgpmime
+
+import (
+	"bytes"
+	"crypto"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+const testEntity = "Content-Type: text/plain; charset=utf-8\n" +
+	"Content-Transfer-Encoding: 7bit\n" +
+	"\n" +
+	"Hello,\n" +
+	"this is a PGP/MIME test.\n"
+
+var testConfig = &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+
+func newTestEntity(t *testing.T, name string) *openpgp.Entity {
+	e, err := openpgp.NewEntity(name, "", name+"@example.com", testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestMicAlg(t *testing.T) {
+	for _, h := range []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512, crypto.RIPEMD160} {
+		micalg, err := MicAlg(h)
+		if err != nil {
+			t.Fatalf("MicAlg(%s): %s", h, err)
+		}
+		if got := HashForMicAlg(strings.ToUpper(micalg)); got != h {
+			t.Errorf("HashForMicAlg(%s) = %s, want %s", micalg, got, h)
+		}
+	}
+	if _, err := MicAlg(crypto.SHA3_256); err == nil {
+		t.Error("MicAlg accepted a hash without an OpenPGP name")
+	}
+}
+
+func TestSignRoundTrip(t *testing.T) {
+	signer := newTestEntity(t, "alice")
+	var buf bytes.Buffer
+	w, err := Sign(&buf, signer, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(testEntity)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "micalg=pgp-sha256") || !strings.Contains(out, `protocol="application/pgp-signature"`) {
+		t.Errorf("missing multipart/signed parameters: %s", out)
+	}
+	if strings.Contains(strings.Replace(out, "\r\n", "", -1), "\n") {
+		t.Error("output contains bare LF line endings")
+	}
+
+	md, err := Decode(strings.NewReader(out), openpgp.EntityList{signer}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !md.IsSigned || md.IsEncrypted {
+		t.Errorf("IsSigned = %v, IsEncrypted = %v", md.IsSigned, md.IsEncrypted)
+	}
+	if md.SignatureError != nil {
+		t.Errorf("signature error: %s", md.SignatureError)
+	}
+	if md.SignedBy != signer {
+		t.Errorf("wrong signer")
+	}
+	if want := string(canonicalize([]byte(testEntity))); string(md.Entity) != want {
+		t.Errorf("signed entity = %q, want %q", md.Entity, want)
+	}
+	if got := md.Header.Get("Content-Transfer-Encoding"); got != "7bit" {
+		t.Errorf("bad inner header: %q", got)
+	}
+
+	// The signature covers the exact part bytes.
+	tampered := strings.Replace(out, "this is", "this was", 1)
+	md, err = Decode(strings.NewReader(tampered), openpgp.EntityList{signer}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := md.SignatureError.(errors.SignatureError); !ok {
+		t.Errorf("tampered entity: got %v, want SignatureError", md.SignatureError)
+	}
+
+	// The micalg parameter must agree with the signature.
+	mismatched := strings.Replace(out, "micalg=pgp-sha256", "micalg=pgp-sha512", 1)
+	md, err = Decode(strings.NewReader(mismatched), openpgp.EntityList{signer}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.SignatureError == nil {
+		t.Error("micalg mismatch was not detected")
+	}
+}
+
+// TestSignHashPreferences checks that micalg matches the signature when the
+// configured hash is not among the preferences of the signer.
+func TestSignHashPreferences(t *testing.T) {
+	signer := newTestEntity(t, "alice")
+	signer.PrimaryIdentity().SelfSignature.PreferredHash = []uint8{8} // SHA-256
+	config := &packet.Config{DefaultHash: crypto.SHA512}
+
+	var buf bytes.Buffer
+	w, err := Sign(&buf, signer, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(testEntity)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "micalg=pgp-sha512") {
+		t.Errorf("micalg is not the configured hash: %s", buf.String())
+	}
+
+	md, err := Decode(&buf, openpgp.EntityList{signer}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.SignatureError != nil {
+		t.Errorf("signature error: %s", md.SignatureError)
+	}
+	if md.SignedBy != signer {
+		t.Errorf("wrong signer")
+	}
+}
+
+func encryptTestEntity(t *testing.T, to []*openpgp.Entity, signer *openpgp.Entity, entity string) string {
+	var buf bytes.Buffer
+	w, err := Encrypt(&buf, to, signer, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(entity)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	recipient := newTestEntity(t, "bob")
+	out := encryptTestEntity(t, []*openpgp.Entity{recipient}, nil, testEntity)
+	if !strings.Contains(out, "Version: 1\r\n") {
+		t.Errorf("missing version part: %s", out)
+	}
+
+	md, err := Decode(strings.NewReader(out), openpgp.EntityList{recipient}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !md.IsEncrypted || md.IsSigned {
+		t.Errorf("IsEncrypted = %v, IsSigned = %v", md.IsEncrypted, md.IsSigned)
+	}
+	if want := "Hello,\r\nthis is a PGP/MIME test.\r\n"; string(md.Body) != want {
+		t.Errorf("body = %q, want %q", md.Body, want)
+	}
+}
+
+func TestEncryptAndSignCombined(t *testing.T) {
+	signer := newTestEntity(t, "alice")
+	recipient := newTestEntity(t, "bob")
+	keyring := openpgp.EntityList{signer, recipient}
+
+	out := encryptTestEntity(t, []*openpgp.Entity{recipient}, signer, testEntity)
+	md, err := Decode(strings.NewReader(out), keyring, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !md.IsEncrypted || !md.IsSigned || md.SignatureError != nil || md.SignedBy != signer {
+		t.Errorf("IsEncrypted = %v, IsSigned = %v, SignatureError = %v", md.IsEncrypted, md.IsSigned, md.SignatureError)
+	}
+}
+
+func TestEncryptAndSignNested(t *testing.T) {
+	signer := newTestEntity(t, "alice")
+	recipient := newTestEntity(t, "bob")
+	keyring := openpgp.EntityList{signer, recipient}
+
+	var signed bytes.Buffer
+	w, err := Sign(&signed, signer, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(testEntity))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := encryptTestEntity(t, []*openpgp.Entity{recipient}, nil, signed.String())
+	md, err := Decode(strings.NewReader(out), keyring, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !md.IsEncrypted || !md.IsSigned || md.SignatureError != nil || md.SignedBy != signer {
+		t.Errorf("IsEncrypted = %v, IsSigned = %v, SignatureError = %v", md.IsEncrypted, md.IsSigned, md.SignatureError)
+	}
+	if got := md.Header.Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("inner Content-Type = %q", got)
+	}
+}
+
+func TestDecodePlainEntity(t *testing.T) {
+	md, err := Decode(strings.NewReader(testEntity), openpgp.EntityList{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.IsSigned || md.IsEncrypted {
+		t.Error("plain entity reported as signed or encrypted")
+	}
+}
+
+func TestSplitMultipart(t *testing.T) {
+	body := "preamble\r\n--b \r\npart one\r\n--b\r\n\r\npart two\r\n\r\n--b--\r\nepilogue"
+	parts, err := splitMultipart([]byte(body), "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 2 || string(parts[0]) != "part one" || string(parts[1]) != "\r\npart two\r\n" {
+		t.Errorf("bad parts: %q", parts)
+	}
+	if _, err := splitMultipart([]byte("--b\r\nunterminated"), "b"); err == nil {
+		t.Error("unterminated multipart accepted")
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgpmime
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/textproto"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// Message contains the result of decoding a PGP/MIME entity.
+type Message struct {
+	// Entity is the innermost cleartext MIME entity, in canonical form.
+	// For a multipart/signed entity, these are the exact bytes that
+	// were signed.
+	Entity []byte
+	// Header and Body are the header and the body of Entity.
+	Header textproto.MIMEHeader
+	Body   []byte
+
+	IsEncrypted bool                    // true if the entity was multipart/encrypted.
+	Details     *openpgp.MessageDetails // the details of the OpenPGP message, if encrypted.
+
+	IsSigned bool // true if the entity was signed.
+	// SignedBy is the entity that made the signature, if it is known.
+	SignedBy *openpgp.Entity
+	// SignatureError is nil if IsSigned is true and the signature is
+	// good.
+	SignatureError error
+}
+
+// Decode reads a MIME entity, including its headers, from r. A
+// multipart/signed entity has its signature checked against keyring; a
+// multipart/encrypted entity is decrypted using the private keys in keyring
+// or prompt, as in openpgp.ReadMessage, and the decrypted entity is decoded
+// in turn. Other entities are returned as they are. Signature failures are
+// reported in Message.SignatureError rather than as an error.
+// If config is nil, sensible defaults will be used.
+func Decode(r io.Reader, keyring openpgp.KeyRing, prompt openpgp.PromptFunction, config *packet.Config) (*Message, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return decode(canonicalize(data), keyring, prompt, config, true)
+}
+
+func decode(entity []byte, keyring openpgp.KeyRing, prompt openpgp.PromptFunction, config *packet.Config, allowEncrypted bool) (*Message, error) {
+	header, body, err := splitEntity(entity)
+	if err != nil {
+		return nil, err
+	}
+	mediaType, params, err := parseContentType(header)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case mediaType == "multipart/signed" && strings.EqualFold(params["protocol"], SignedProtocol):
+		return decodeSigned(body, params, keyring, config)
+	case mediaType == "multipart/encrypted" && strings.EqualFold(params["protocol"], EncryptedProtocol) && allowEncrypted:
+		return decodeEncrypted(body, params, keyring, prompt, config)
+	}
+	return &Message{Entity: entity, Header: header, Body: body}, nil
+}
+
+func decodeSigned(body []byte, params map[string]string, keyring openpgp.KeyRing, config *packet.Config) (*Message, error) {
+	parts, err := splitMultipart(body, params["boundary"])
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) != 2 {
+		return nil, errors.StructuralError("multipart/signed entity must have two parts")
+	}
+	signed := parts[0]
+	sigHeader, sigBody, err := splitEntity(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	if mediaType, _, err := parseContentType(sigHeader); err != nil {
+		return nil, err
+	} else if mediaType != SignedProtocol {
+		return nil, errors.StructuralError("unexpected signature part of type " + mediaType)
+	}
+
+	header, inner, err := splitEntity(signed)
+	if err != nil {
+		return nil, err
+	}
+	md := &Message{
+		Entity:   signed,
+		Header:   header,
+		Body:     inner,
+		IsSigned: true,
+	}
+
+	block, err := armor.Decode(bytes.NewReader(sigBody))
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != openpgp.SignatureType {
+		return nil, errors.StructuralError("expected '" + openpgp.SignatureType + "', got: " + block.Type)
+	}
+	micalg := HashForMicAlg(params["micalg"])
+	if micalg == 0 {
+		md.SignatureError = errors.UnsupportedError("unknown micalg " + params["micalg"])
+		return md, nil
+	}
+	md.SignedBy, md.SignatureError = openpgp.CheckDetachedSignatureAndHash(keyring, bytes.NewReader(signed), block.Body, []crypto.Hash{micalg}, config)
+	return md, nil
+}
+
+func decodeEncrypted(body []byte, params map[string]string, keyring openpgp.KeyRing, prompt openpgp.PromptFunction, config *packet.Config) (*Message, error) {
+	parts, err := splitMultipart(body, params["boundary"])
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) != 2 {
+		return nil, errors.StructuralError("multipart/encrypted entity must have two parts")
+	}
+	controlHeader, control, err := splitEntity(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if mediaType, _, err := parseContentType(controlHeader); err != nil {
+		return nil, err
+	} else if mediaType != EncryptedProtocol {
+		return nil, errors.StructuralError("unexpected control part of type " + mediaType)
+	}
+	if !bytes.Contains(control, []byte("Version: 1")) {
+		return nil, errors.UnsupportedError("PGP/MIME control part without Version: 1")
+	}
+	_, encrypted, err := splitEntity(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := armor.Decode(bytes.NewReader(encrypted))
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != openpgp.MessageType {
+		return nil, errors.StructuralError("expected '" + openpgp.MessageType + "', got: " + block.Type)
+	}
+	details, err := openpgp.ReadMessage(block.Body, keyring, prompt, config)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := ioutil.ReadAll(details.UnverifiedBody)
+	if err != nil {
+		return nil, err
+	}
+
+	md, err := decode(canonicalize(plaintext), keyring, prompt, config, false)
+	if err != nil {
+		return nil, err
+	}
+	md.IsEncrypted = true
+	md.Details = details
+	if details.IsSigned && !md.IsSigned {
+		// The signature was carried inside the OpenPGP message, see
+		// RFC 3156, section 6.2.
+		md.IsSigned = true
+		md.SignatureError = details.SignatureError
+		if details.SignedBy != nil {
+			md.SignedBy = details.SignedBy.Entity
+		} else if md.SignatureError == nil {
+			md.SignatureError = errors.ErrUnknownIssuer
+		}
+	}
+	return md, nil
+}
+
+// parseContentType returns the media type and parameters of the given header.
+// An entity without a Content-Type is text/plain, see RFC 2045, section 5.2.
+func parseContentType(header textproto.MIMEHeader) (string, map[string]string, error) {
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		return "text/plain", nil, nil
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", nil, errors.StructuralError("invalid Content-Type: " + err.Error())
+	}
+	return mediaType, params, nil
+}
+
+var headerEnd = []byte("\r\n\r\n")
+
+// splitEntity splits a canonical MIME entity into its header and its body.
+func splitEntity(entity []byte) (textproto.MIMEHeader, []byte, error) {
+	var rawHeader, body []byte
+	if bytes.HasPrefix(entity, crlf) {
+		body = entity[len(crlf):]
+	} else if i := bytes.Index(entity, headerEnd); i >= 0 {
+		rawHeader = entity[:i+len(crlf)]
+		body = entity[i+len(headerEnd):]
+	} else {
+		rawHeader = entity
+	}
+
+	rawHeader = append(rawHeader[:len(rawHeader):len(rawHeader)], crlf...)
+	header, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(rawHeader))).ReadMIMEHeader()
+	if err != nil {
+		return nil, nil, errors.StructuralError("invalid MIME header: " + err.Error())
+	}
+	return header, body, nil
+}
+
+// splitMultipart returns the raw contents of the body parts of a canonical
+// multipart body. The CRLF preceding each boundary delimiter belongs to the
+// delimiter, see RFC 2046, section 5.1.1.
+func splitMultipart(body []byte, boundary string) (parts [][]byte, err error) {
+	if boundary == "" {
+		return nil, errors.StructuralError("multipart entity without boundary")
+	}
+	delimiter := []byte("\r\n--" + boundary)
+	data := append(append([]byte(nil), crlf...), body...)
+
+	i := bytes.Index(data, delimiter)
+	if i < 0 {
+		return nil, errors.StructuralError("multipart boundary not found")
+	}
+	data = data[i+len(delimiter):]
+	for {
+		if bytes.HasPrefix(data, []byte("--")) {
+			return parts, nil
+		}
+		eol := bytes.Index(data, crlf)
+		if eol < 0 || len(bytes.TrimRight(data[:eol], " \t")) != 0 {
+			return nil, errors.StructuralError("malformed multipart boundary")
+		}
+		data = data[eol+len(crlf):]
+		j := bytes.Index(data, delimiter)
+		if j < 0 {
+			return nil, errors.StructuralError("multipart entity not terminated")
+		}
+		parts = append(parts, data[:j])
+		data = data[j+len(delimiter):]
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgpmime
+
+import (
+	"bytes"
+	"io"
+	"mime"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// signatureHeader is the header of the signature part of a multipart/signed
+// entity.
+const signatureHeader = "Content-Type: " + SignedProtocol + "; name=\"signature.asc\"\r\n" +
+	"Content-Description: OpenPGP digital signature\r\n" +
+	"Content-Disposition: attachment; filename=\"signature.asc\"\r\n\r\n"
+
+// versionPart is the control part of a multipart/encrypted entity.
+const versionPart = "Content-Type: " + EncryptedProtocol + "\r\n" +
+	"Content-Description: PGP/MIME version identification\r\n\r\n" +
+	"Version: 1\r\n"
+
+// encryptedHeader is the header of the part of a multipart/encrypted entity
+// that holds the OpenPGP message.
+const encryptedHeader = "Content-Type: application/octet-stream; name=\"encrypted.asc\"\r\n" +
+	"Content-Description: OpenPGP encrypted message\r\n" +
+	"Content-Disposition: inline; filename=\"encrypted.asc\"\r\n\r\n"
+
+// Sign returns a WriteCloser which will sign a MIME entity with signer and
+// write it to w as a multipart/signed entity, beginning with its Content-Type
+// header. Data written to the WriteCloser must be a complete MIME entity
+// (headers, a blank line and the body); its line endings are converted to
+// CRLF. Other headers of the enclosing entity, such as From or Subject, may be
+// written to w before calling Sign. The signature is written when the
+// WriteCloser is closed. The private key of signer must have been decrypted.
+// If config is nil, sensible defaults will be used.
+func Sign(w io.Writer, signer *openpgp.Entity, config *packet.Config) (plaintext io.WriteCloser, err error) {
+	if signer == nil {
+		return nil, errors.InvalidArgumentError("no signer provided")
+	}
+	micalg, err := MicAlg(config.Hash())
+	if err != nil {
+		return
+	}
+	boundary, err := newBoundary(config)
+	if err != nil {
+		return
+	}
+	contentType := mime.FormatMediaType("multipart/signed", map[string]string{
+		"boundary": boundary,
+		"micalg":   micalg,
+		"protocol": SignedProtocol,
+	})
+	if err = writeStrings(w, "Content-Type: ", contentType, "\r\n\r\n--", boundary, "\r\n"); err != nil {
+		return
+	}
+	sw := &signedWriter{
+		w:        w,
+		signer:   signer,
+		boundary: boundary,
+		config:   config,
+	}
+	sw.cw = &crlfWriter{w: &sw.part}
+	return sw, nil
+}
+
+// signedWriter buffers the entity to sign, since the signature can only be
+// made once the whole of it is known.
+type signedWriter struct {
+	w        io.Writer
+	cw       *crlfWriter
+	part     bytes.Buffer
+	signer   *openpgp.Entity
+	boundary string
+	config   *packet.Config
+}
+
+func (s *signedWriter) Write(data []byte) (int, error) {
+	return s.cw.Write(data)
+}
+
+func (s *signedWriter) Close() (err error) {
+	signed := s.part.Bytes()
+	if _, err = s.w.Write(signed); err != nil {
+		return
+	}
+	if err = writeStrings(s.w, "\r\n--", s.boundary, "\r\n", signatureHeader); err != nil {
+		return
+	}
+	sigWriter := &crlfWriter{w: s.w}
+	if err = openpgp.ArmoredDetachSign(sigWriter, s.signer, bytes.NewReader(signed), s.config); err != nil {
+		return
+	}
+	return writeStrings(s.w, "\r\n--", s.boundary, "--\r\n")
+}
+
+// Encrypt returns a WriteCloser which will encrypt a MIME entity to the given
+// recipients and write it to w as a multipart/encrypted entity, beginning with
+// its Content-Type header. Data written to the WriteCloser must be a complete
+// MIME entity; its line endings are converted to CRLF. If signed is non-nil,
+// the entity is also signed, with the signature carried inside the OpenPGP
+// message as described in RFC 3156, section 6.2. The WriteCloser must be
+// closed after the entity has been written.
+// If config is nil, sensible defaults will be used.
+func Encrypt(w io.Writer, to []*openpgp.Entity, signed *openpgp.Entity, config *packet.Config) (plaintext io.WriteCloser, err error) {
+	boundary, err := newBoundary(config)
+	if err != nil {
+		return
+	}
+	contentType := mime.FormatMediaType("multipart/encrypted", map[string]string{
+		"boundary": boundary,
+		"protocol": EncryptedProtocol,
+	})
+	err = writeStrings(w, "Content-Type: ", contentType, "\r\n\r\n",
+		"--", boundary, "\r\n", versionPart,
+		"\r\n--", boundary, "\r\n", encryptedHeader)
+	if err != nil {
+		return
+	}
+
+	armored, err := armor.Encode(&crlfWriter{w: w}, openpgp.MessageType, nil)
+	if err != nil {
+		return
+	}
+	hints := &openpgp.FileHints{IsBinary: true}
+	encrypted, err := openpgp.Encrypt(armored, to, signed, hints, config)
+	if err != nil {
+		return
+	}
+	ew := &encryptedWriter{
+		w:         w,
+		armored:   armored,
+		encrypted: encrypted,
+		boundary:  boundary,
+	}
+	ew.cw = &crlfWriter{w: encrypted}
+	return ew, nil
+}
+
+// encryptedWriter canonicalizes the entity written to it before handing it
+// to the OpenPGP encryption, and closes the enclosing multipart/encrypted
+// entity once done.
+type encryptedWriter struct {
+	w         io.Writer
+	cw        *crlfWriter
+	armored   io.WriteCloser
+	encrypted io.WriteCloser
+	boundary  string
+}
+
+func (e *encryptedWriter) Write(data []byte) (int, error) {
+	return e.cw.Write(data)
+}
+
+func (e *encryptedWriter) Close() (err error) {
+	if err = e.encrypted.Close(); err != nil {
+		return
+	}
+	if err = e.armored.Close(); err != nil {
+		return
+	}
+	return writeStrings(e.w, "\r\n--", e.boundary, "--\r\n")
+}
+
+// writeStrings writes its arguments to the given Writer.
+func writeStrings(w io.Writer, strs ...string) error {
+	for _, s := range strs {
+		if _, err := io.WriteString(w, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -6,6 +6,7 @@
 package openpgp // import "golang.org/x/crypto/openpgp"
 
 import (
+	"context"
 	"crypto"
 	_ "crypto/sha256"
 	"hash"
@@ -20,6 +21,9 @@ import (
 // SignatureType is the armor type for a PGP signature.
 var SignatureType = "PGP SIGNATURE"
 
+// MessageType is the armor type for a PGP message.
+var MessageType = "PGP MESSAGE"
+
 // readArmored reads an armored block with the given type.
 func readArmored(r io.Reader, expectedType string) (body io.Reader, err error) {
 	block, err := armor.Decode(r)
@@ -59,9 +63,31 @@ type MessageDetails struct {
 	SignatureError error             // nil if the signature is good.
 	Signature      *packet.Signature // the signature packet itself, if v4 (default)
 
+	// Signatures describes every signature of the message, in the order
+	// of its one-pass signature packets. A message may be signed by more
+	// than one key; the fields above then describe the first signature
+	// whose key is in the keyring, or the first signature if there is no
+	// such key. The same rules as above apply to the SignatureError and
+	// Signature fields of each element.
+	Signatures []*MessageSignature
+
 	decrypted io.ReadCloser
 }
 
+// MessageSignature contains the result of checking one of the signatures of
+// an OpenPGP message.
+type MessageSignature struct {
+	SignedByKeyId  uint64            // the key id of the signer.
+	SignedBy       *Key              // the key of the signer, if available.
+	SignatureError error             // nil if the signature is good, ErrUnknownIssuer if SignedBy is nil.
+	Signature      *packet.Signature // the signature packet itself.
+
+	// hashFunc, sigType and h come from the one-pass signature packet.
+	hashFunc       crypto.Hash
+	sigType        packet.SignatureType
+	h, wrappedHash hash.Hash
+}
+
 // A PromptFunction is used as a callback by functions that may need to decrypt
 // a private key, or prompt for a passphrase. It is called with a list of
 // acceptable, encrypted private keys and a boolean that indicates whether a
@@ -71,6 +97,73 @@ type MessageDetails struct {
 // be passed up.
 type PromptFunction func(keys []Key, symmetric bool) ([]byte, error)
 
+// A KeyRequest describes the keys that could decrypt a message. See
+// KeyProvider.
+type KeyRequest struct {
+	// Keys are the private keys in the keyring that could decrypt the
+	// message, but that are themselves encrypted.
+	Keys []Key
+	// EncryptedToKeyIds are the key ids of all recipients of the message,
+	// including those that aren't in the keyring.
+	EncryptedToKeyIds []uint64
+	// SymmetricKeys are the passphrase protected session keys of the
+	// message. Their S2KParams describe how passphrases are stretched.
+	SymmetricKeys []*packet.SymmetricKeyEncrypted
+	// Attempt is the number of previous failed attempts.
+	Attempt int
+	// LastError is the reason why the previous attempt failed, or nil on
+	// the first attempt.
+	LastError error
+}
+
+// A KeyResponse contains the keys supplied by a KeyProvider. All fields are
+// optional and all given keys are tried.
+type KeyResponse struct {
+	// Passphrase is tried on the symmetric keys of the message and then
+	// on the encrypted private keys of the request. Private keys that it
+	// decrypts stay decrypted.
+	Passphrase []byte
+	// PrivateKeys are decrypted private keys, which need not be in the
+	// keyring. They are tried on the session keys encrypted to them.
+	PrivateKeys []*packet.PrivateKey
+	// SessionKey, if not nil, decrypts the message directly with the
+	// cipher CipherFunc.
+	SessionKey []byte
+	CipherFunc packet.CipherFunction
+}
+
+// A KeyProvider supplies the keys that decrypt a message.
+type KeyProvider interface {
+	// ProvideKey is called by ReadMessageWithContext until the message has
+	// been decrypted, ProvideKey returns an error or ctx is done, or
+	// until the number of failed attempts configured by
+	// packet.Config.MaxKeyAttempts is reached.
+	ProvideKey(ctx context.Context, req *KeyRequest) (*KeyResponse, error)
+}
+
+// The KeyProviderFunc type is an adapter to allow the use of ordinary
+// functions as key providers.
+type KeyProviderFunc func(ctx context.Context, req *KeyRequest) (*KeyResponse, error)
+
+// ProvideKey calls f(ctx, req).
+func (f KeyProviderFunc) ProvideKey(ctx context.Context, req *KeyRequest) (*KeyResponse, error) {
+	return f(ctx, req)
+}
+
+// promptKeyProvider adapts a PromptFunction to a KeyProvider.
+func promptKeyProvider(prompt PromptFunction) KeyProvider {
+	return KeyProviderFunc(func(ctx context.Context, req *KeyRequest) (*KeyResponse, error) {
+		if len(req.Keys) == 0 && len(req.SymmetricKeys) == 0 {
+			return nil, errors.ErrKeyIncorrect
+		}
+		passphrase, err := prompt(req.Keys, len(req.SymmetricKeys) != 0)
+		if err != nil {
+			return nil, err
+		}
+		return &KeyResponse{Passphrase: passphrase}, nil
+	})
+}
+
 // A keyEnvelopePair is used to store a private key with the envelope that
 // contains a symmetric key, encrypted with that key.
 type keyEnvelopePair struct {
@@ -83,10 +176,23 @@ type keyEnvelopePair struct {
 // verification) and, possibly encrypted, private keys for decrypting.
 // If config is nil, sensible defaults will be used.
 func ReadMessage(r io.Reader, keyring KeyRing, prompt PromptFunction, config *packet.Config) (md *MessageDetails, err error) {
+	var provider KeyProvider
+	if prompt != nil {
+		provider = promptKeyProvider(prompt)
+	}
+	return ReadMessageWithContext(context.Background(), r, keyring, provider, config)
+}
+
+// ReadMessageWithContext is like ReadMessage, but obtains missing decryption
+// keys from provider, which may be nil. It gives up when ctx is done, in which
+// case it returns ctx.Err(), or after the number of failed attempts configured
+// by config, in which case it returns the error of the last attempt.
+func ReadMessageWithContext(ctx context.Context, r io.Reader, keyring KeyRing, provider KeyProvider, config *packet.Config) (md *MessageDetails, err error) {
 	var p packet.Packet
 
 	var symKeys []*packet.SymmetricKeyEncrypted
 	var pubKeys []keyEnvelopePair
+	var encryptedKeys []*packet.EncryptedKey
 	// Integrity protected encrypted packet: SymmetricallyEncrypted or AEADEncrypted
 	var edp packet.EncryptedDataPacket
 
@@ -118,6 +224,7 @@ ParsePackets:
 			default:
 				continue
 			}
+			encryptedKeys = append(encryptedKeys, p)
 			var keys []Key
 			if p.KeyId == 0 {
 				keys = keyring.DecryptionKeys()
@@ -142,12 +249,13 @@ ParsePackets:
 
 	var candidates []Key
 	var decrypted io.ReadCloser
+	var lastErr error
 
 	// Now that we have the list of encrypted keys we need to decrypt at
-	// least one of them or, if we cannot, we need to call the prompt
-	// function so that it can decrypt a key or give us a passphrase.
+	// least one of them or, if we cannot, we need to ask the key provider
+	// for a decrypted key, a passphrase or the session key.
 FindKey:
-	for {
+	for attempt := 0; ; attempt++ {
 		// See if any of the keys already have a private key available
 		candidates = candidates[:0]
 		candidateFingerprints := make(map[string]bool)
@@ -182,23 +290,49 @@ FindKey:
 			}
 		}
 
-		if len(candidates) == 0 && len(symKeys) == 0 {
+		if provider == nil {
 			return nil, errors.ErrKeyIncorrect
 		}
-
-		if prompt == nil {
-			return nil, errors.ErrKeyIncorrect
+		if limit := config.KeyAttempts(); limit > 0 && attempt >= limit {
+			return nil, lastErr
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
 
-		passphrase, err := prompt(candidates, len(symKeys) != 0)
+		resp, err := provider.ProvideKey(ctx, &KeyRequest{
+			Keys:              candidates,
+			EncryptedToKeyIds: md.EncryptedToKeyIds,
+			SymmetricKeys:     symKeys,
+			Attempt:           attempt,
+			LastError:         lastErr,
+		})
 		if err != nil {
 			return nil, err
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		lastErr = errors.ErrKeyIncorrect
+		if resp == nil {
+			continue
+		}
+
+		// Try the session key first
+		if resp.SessionKey != nil {
+			decrypted, err = edp.Decrypt(resp.CipherFunc, resp.SessionKey)
+			if err != nil && err != errors.ErrKeyIncorrect {
+				return nil, err
+			}
+			if decrypted != nil {
+				break FindKey
+			}
+		}
 
-		// Try the symmetric passphrase first
-		if len(symKeys) != 0 && passphrase != nil {
+		// Then the symmetric passphrase
+		if len(symKeys) != 0 && resp.Passphrase != nil {
 			for _, s := range symKeys {
-				key, cipherFunc, err := s.Decrypt(passphrase)
+				key, cipherFunc, err := s.Decrypt(resp.Passphrase)
 				if err == nil {
 					decrypted, err = edp.Decrypt(cipherFunc, key)
 					if err != nil && err != errors.ErrKeyIncorrect {
@@ -211,6 +345,48 @@ FindKey:
 
 			}
 		}
+
+		// The passphrase may also unlock private keys, which are tried
+		// on the next iteration.
+		if resp.Passphrase != nil {
+			for _, k := range candidates {
+				if err := k.PrivateKey.Decrypt(resp.Passphrase); err != nil {
+					lastErr = err
+				}
+			}
+		}
+
+		for _, priv := range resp.PrivateKeys {
+			if priv.Dummy() {
+				lastErr = errors.ErrDummyPrivateKey("cannot decrypt a message")
+				continue
+			}
+			if priv.Encrypted {
+				lastErr = errors.InvalidArgumentError("provided private key is encrypted")
+				continue
+			}
+			for _, ek := range encryptedKeys {
+				if ek.KeyId != 0 && ek.KeyId != priv.KeyId {
+					continue
+				}
+				if err := ek.Decrypt(priv, config); err != nil {
+					lastErr = err
+					continue
+				}
+				decrypted, err = edp.Decrypt(ek.CipherFunc, ek.Key)
+				if err != nil && err != errors.ErrKeyIncorrect {
+					return nil, err
+				}
+				if decrypted != nil {
+					md.DecryptedWith = Key{PublicKey: &priv.PublicKey, PrivateKey: priv}
+					if keys := keyring.KeysById(priv.KeyId); len(keys) > 0 {
+						md.DecryptedWith.Entity = keys[0].Entity
+						md.DecryptedWith.SelfSignature = keys[0].SelfSignature
+					}
+					break FindKey
+				}
+			}
+		}
 	}
 
 	md.decrypted = decrypted
@@ -230,8 +406,6 @@ func readSignedMessage(packets *packet.Reader, mdin *MessageDetails, keyring Key
 	md = mdin
 
 	var p packet.Packet
-	var h hash.Hash
-	var wrappedHash hash.Hash
 FindLiteralData:
 	for {
 		p, err = packets.Next()
@@ -244,29 +418,41 @@ FindLiteralData:
 				return nil, err
 			}
 		case *packet.OnePassSignature:
-			if !p.IsLast {
-				return nil, errors.UnsupportedError("nested signatures")
-			}
-
-			h, wrappedHash, err = hashForSignature(p.Hash, p.SigType)
-			if err != nil {
-				md.SignatureError = err
-			}
-
-			md.IsSigned = true
-			md.SignedByKeyId = p.KeyId
+			// Nested one-pass signatures are all computed over the
+			// same literal data.
+			ms := &MessageSignature{SignedByKeyId: p.KeyId, hashFunc: p.Hash, sigType: p.SigType}
+			ms.h, ms.wrappedHash, ms.SignatureError = hashForSignature(p.Hash, p.SigType)
 			keys := keyring.KeysByIdUsage(p.KeyId, packet.KeyFlagSign)
 			if len(keys) > 0 {
-				md.SignedBy = &keys[0]
+				ms.SignedBy = &keys[0]
 			}
+			md.IsSigned = true
+			md.Signatures = append(md.Signatures, ms)
 		case *packet.LiteralData:
 			md.LiteralData = p
 			break FindLiteralData
 		}
 	}
 
-	if md.SignedBy != nil && md.SignatureError == nil {
-		md.UnverifiedBody = &signatureCheckReader{packets, h, wrappedHash, md, config}
+	verifiable := false
+	for _, ms := range md.Signatures {
+		if ms.SignedBy != nil && ms.SignatureError == nil {
+			verifiable = true
+		}
+	}
+	if primary := md.primarySignature(); primary != nil {
+		md.SignedByKeyId = primary.SignedByKeyId
+		md.SignedBy = primary.SignedBy
+		md.SignatureError = primary.SignatureError
+	}
+	for _, ms := range md.Signatures {
+		if ms.SignedBy == nil && ms.SignatureError == nil {
+			ms.SignatureError = errors.ErrUnknownIssuer
+		}
+	}
+
+	if verifiable {
+		md.UnverifiedBody = &signatureCheckReader{packets, md, config}
 	} else if md.decrypted != nil {
 		md.UnverifiedBody = checkReader{md}
 	} else {
@@ -276,6 +462,20 @@ FindLiteralData:
 	return md, nil
 }
 
+// primarySignature returns the signature that the top-level fields of md
+// describe: the first one whose key is known, or the first one.
+func (md *MessageDetails) primarySignature() *MessageSignature {
+	for _, ms := range md.Signatures {
+		if ms.SignedBy != nil {
+			return ms
+		}
+	}
+	if len(md.Signatures) > 0 {
+		return md.Signatures[0]
+	}
+	return nil
+}
+
 // hashForSignature returns a pair of hashes that can be used to verify a
 // signature. The signature may specify that the contents of the signed message
 // should be preprocessed (i.e. to normalize line endings). Thus this function
@@ -320,38 +520,58 @@ func (cr checkReader) Read(buf []byte) (n int, err error) {
 
 // signatureCheckReader wraps an io.Reader from a LiteralData packet and hashes
 // the data as it is read. When it sees an EOF from the underlying io.Reader
-// it parses and checks a trailing Signature packet and triggers any MDC checks.
+// it parses and checks the trailing Signature packets and triggers any MDC
+// checks.
 type signatureCheckReader struct {
-	packets        *packet.Reader
-	h, wrappedHash hash.Hash
-	md             *MessageDetails
-	config         *packet.Config
+	packets *packet.Reader
+	md      *MessageDetails
+	config  *packet.Config
 }
 
 func (scr *signatureCheckReader) Read(buf []byte) (n int, err error) {
 	n, err = scr.md.LiteralData.Body.Read(buf)
-	scr.wrappedHash.Write(buf[:n])
-	if err == io.EOF {
-		var p packet.Packet
-		p, scr.md.SignatureError = scr.packets.Next()
-		if scr.md.SignatureError != nil {
-			return
+	for _, ms := range scr.md.Signatures {
+		if ms.wrappedHash != nil {
+			ms.wrappedHash.Write(buf[:n])
 		}
+	}
+	if err == io.EOF {
+		// The signature packets follow the literal data in the
+		// reverse order of their one-pass signature packets.
+		for i := len(scr.md.Signatures) - 1; i >= 0; i-- {
+			ms := scr.md.Signatures[i]
+			var p packet.Packet
+			p, scr.md.SignatureError = scr.packets.Next()
+			if scr.md.SignatureError != nil {
+				ms.SignatureError = scr.md.SignatureError
+				return
+			}
 
-		var ok bool
-		if scr.md.Signature, ok = p.(*packet.Signature); ok {
-			sig := scr.md.Signature
+			var ok bool
+			if ms.Signature, ok = p.(*packet.Signature); !ok {
+				scr.md.SignatureError = errors.StructuralError("LiteralData not followed by Signature")
+				ms.SignatureError = scr.md.SignatureError
+				return
+			}
+			sig := ms.Signature
 			if sig.Version == 5 && (sig.SigType == 0x00 || sig.SigType == 0x01) {
 				sig.Metadata = scr.md.LiteralData
 			}
-			scr.md.SignatureError = scr.md.SignedBy.PublicKey.VerifySignature(scr.h, scr.md.Signature)
-			if scr.md.SignatureError == nil && scr.md.Signature.SigExpired(scr.config.Now()) {
-				scr.md.SignatureError = errors.ErrSignatureExpired
+			if !ms.matches(sig) {
+				ms.SignatureError = errors.StructuralError("signature does not match its one-pass signature packet")
+				continue
+			}
+			if ms.SignatureError != nil {
+				continue
+			}
+			ms.SignatureError = ms.SignedBy.PublicKey.VerifySignature(ms.h, sig)
+			if ms.SignatureError == nil && sig.SigExpired(scr.config.Now()) {
+				ms.SignatureError = errors.ErrSignatureExpired
 			}
-		} else {
-			scr.md.SignatureError = errors.StructuralError("LiteralData not followed by Signature")
-			return
 		}
+		primary := scr.md.primarySignature()
+		scr.md.Signature = primary.Signature
+		scr.md.SignatureError = primary.SignatureError
 
 		// The SymmetricallyEncrypted packet, if any, might have an
 		// unsigned hash of its own. In order to check this we need to
@@ -366,6 +586,15 @@ func (scr *signatureCheckReader) Read(buf []byte) (n int, err error) {
 	return
 }
 
+// matches reports whether sig is the signature announced by the one-pass
+// signature packet of ms. A one-pass key ID of zero matches any issuer.
+func (ms *MessageSignature) matches(sig *packet.Signature) bool {
+	if sig.Hash != ms.hashFunc || sig.SigType != ms.sigType {
+		return false
+	}
+	return ms.SignedByKeyId == 0 || sig.IssuerKeyId == nil || *sig.IssuerKeyId == ms.SignedByKeyId
+}
+
 // CheckDetachedSignature takes a signed file and a detached signature and
 // returns the signer if the signature is valid. If the signer isn't known,
 // ErrUnknownIssuer is returned.
@@ -462,3 +691,74 @@ func CheckArmoredDetachedSignature(keyring KeyRing, signed, signature io.Reader,
 
 	return CheckDetachedSignature(keyring, signed, body, config)
 }
+
+// CheckStandaloneSignature reads a standalone signature, which only signs
+// its own subpackets, and returns the signer and the signature if it is
+// valid. If the signer isn't known, ErrUnknownIssuer is returned.
+func CheckStandaloneSignature(keyring KeyRing, signature io.Reader, config *packet.Config) (signer *Entity, sig *packet.Signature, err error) {
+	return checkSignatureByKey(keyring, signature, config, func(pk *packet.PublicKey, sig *packet.Signature) error {
+		return pk.VerifyStandaloneSignature(sig)
+	})
+}
+
+// CheckTimestampSignature reads a timestamp signature and returns the
+// signer and the signature if it is valid. If target is not nil, the
+// signature must refer to it. The time asserted by the signer is the
+// CreationTime of the signature. If the signer isn't known,
+// ErrUnknownIssuer is returned.
+func CheckTimestampSignature(keyring KeyRing, signature io.Reader, target *packet.Signature, config *packet.Config) (signer *Entity, sig *packet.Signature, err error) {
+	return checkSignatureByKey(keyring, signature, config, func(pk *packet.PublicKey, sig *packet.Signature) error {
+		return pk.VerifyTimestampSignature(sig, target)
+	})
+}
+
+// CheckThirdPartyConfirmation reads a third-party confirmation signature of
+// target and returns the signer and the signature if it is valid. If the
+// signer isn't known, ErrUnknownIssuer is returned.
+func CheckThirdPartyConfirmation(keyring KeyRing, signature io.Reader, target *packet.Signature, config *packet.Config) (signer *Entity, sig *packet.Signature, err error) {
+	return checkSignatureByKey(keyring, signature, config, func(pk *packet.PublicKey, sig *packet.Signature) error {
+		return pk.VerifyThirdPartyConfirmation(sig, target)
+	})
+}
+
+// checkSignatureByKey reads signature packets until one is found whose
+// issuer is in keyring and checks it with verify, which should return nil if
+// sig is a valid signature by pk.
+func checkSignatureByKey(keyring KeyRing, signature io.Reader, config *packet.Config, verify func(pk *packet.PublicKey, sig *packet.Signature) error) (signer *Entity, sig *packet.Signature, err error) {
+	var keys []Key
+	packets := packet.NewReader(signature)
+	for len(keys) == 0 {
+		p, err := packets.Next()
+		if err == io.EOF {
+			return nil, nil, errors.ErrUnknownIssuer
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var ok bool
+		sig, ok = p.(*packet.Signature)
+		if !ok {
+			return nil, nil, errors.StructuralError("non signature packet found")
+		}
+		if sig.IssuerKeyId == nil {
+			return nil, nil, errors.StructuralError("signature doesn't have an issuer")
+		}
+		keys = keyring.KeysByIdUsage(*sig.IssuerKeyId, packet.KeyFlagSign)
+	}
+
+	for _, key := range keys {
+		err = verify(key.PublicKey, sig)
+		if err == nil {
+			now := config.Now()
+			if sig.SigExpired(now) {
+				return key.Entity, sig, errors.ErrSignatureExpired
+			}
+			if key.PublicKey.KeyExpired(key.SelfSignature, now) {
+				return key.Entity, sig, errors.ErrKeyExpired
+			}
+			return key.Entity, sig, nil
+		}
+	}
+	return nil, nil, err
+}
@@ -6,6 +6,7 @@ package openpgp
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha512"
 	"encoding/base64"
 	"encoding/hex"
@@ -342,6 +343,67 @@ func TestMultipleSignaturePacketsDSA(t *testing.T) {
 	testDetachedSignature(t, kring, readerFromHex(missingHashFunctionHex+detachedSignatureDSAHex), signedInput, "binary", testKey3KeyId)
 }
 
+func TestSwappedTrailingSignatures(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	var signers []*Entity
+	for _, name := range []string{"signer1", "signer2"} {
+		e, err := NewEntity(name, "", name+"@example.org", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, e)
+	}
+	buf := new(bytes.Buffer)
+	w, err := SignMultiple(buf, signers, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("hello world\n"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Find the two trailing signature packets and swap them.
+	r := bytes.NewReader(buf.Bytes())
+	var ends []int
+	for {
+		p, err := packet.Read(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lit, ok := p.(*packet.LiteralData); ok {
+			ioutil.ReadAll(lit.Body)
+		}
+		ends = append(ends, buf.Len()-r.Len())
+	}
+	if len(ends) != 5 {
+		t.Fatalf("got %d packets, want 5", len(ends))
+	}
+	msg := buf.Bytes()
+	swapped := append([]byte{}, msg[:ends[2]]...)
+	swapped = append(swapped, msg[ends[3]:]...)
+	swapped = append(swapped, msg[ends[2]:ends[3]]...)
+
+	md, err := ReadMessage(bytes.NewReader(swapped), EntityList(signers), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(md.UnverifiedBody); err != nil {
+		t.Fatal(err)
+	}
+	for i, ms := range md.Signatures {
+		if _, ok := ms.SignatureError.(errors.StructuralError); !ok {
+			t.Errorf("signature %d: got error %v, want a StructuralError", i, ms.SignatureError)
+		}
+	}
+	if _, ok := md.SignatureError.(errors.StructuralError); !ok {
+		t.Errorf("got error %v, want a StructuralError", md.SignatureError)
+	}
+}
+
 func TestDetachedSignatureP256(t *testing.T) {
 	kring, _ := ReadKeyRing(readerFromHex(p256TestKeyHex))
 	testDetachedSignature(t, kring, readerFromHex(detachedSignatureP256Hex), signedInput, "binary", testKeyP256KeyId)
@@ -621,3 +683,168 @@ func TestSymmetricAeadEaxOpenPGPJsMessage(t *testing.T) {
 		t.Fatal("Did not decrypt OpenPGPjs message correctly")
 	}
 }
+
+func TestInspectMessage(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	to, err := NewEntity("alice", "", "alice@example.org", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, err := Encrypt(&buf, []*Entity{to}, nil, nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("hello"))
+	w.Close()
+
+	infos, err := InspectMessage(bytes.NewReader(buf.Bytes()), EntityList{to}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Tag != 1 || infos[1].Tag != 18 {
+		t.Fatalf("unexpected packets: %+v", infos)
+	}
+	var literal *packet.PacketInfo
+	queue := infos[1].Packets
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = append(queue[1:], p.Packets...)
+		if p.Err != nil {
+			t.Errorf("%s: %s", p.Name(), p.Err)
+		}
+		if p.Tag == 11 {
+			literal = p
+		}
+	}
+	if literal == nil {
+		t.Error("literal data not found after decryption")
+	}
+}
+
+func TestReadMessageWithContext(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	newMessage := func() (*Entity, []byte) {
+		to, err := NewEntity("alice", "", "alice@example.org", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		w, err := EncryptWithParams(&buf, []*Entity{to}, &EncryptParams{Passwords: [][]byte{[]byte("password")}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("hello"))
+		w.Close()
+		return to, buf.Bytes()
+	}
+	readAll := func(md *MessageDetails) {
+		contents, err := ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil || string(contents) != "hello" {
+			t.Errorf("got %q, %v", contents, err)
+		}
+	}
+
+	// A limited number of wrong passphrases.
+	to, msg := newMessage()
+	if err := to.Subkeys[0].PrivateKey.Encrypt([]byte("key passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	var requests []KeyRequest
+	provider := KeyProviderFunc(func(ctx context.Context, req *KeyRequest) (*KeyResponse, error) {
+		requests = append(requests, *req)
+		return &KeyResponse{Passphrase: []byte("wrong")}, nil
+	})
+	_, err := ReadMessageWithContext(context.Background(), bytes.NewReader(msg), EntityList{to}, provider, &packet.Config{MaxKeyAttempts: 3})
+	if err == nil {
+		t.Fatal("wrong passphrases decrypted the message")
+	}
+	if len(requests) != 3 {
+		t.Fatalf("key provider called %d times, want 3", len(requests))
+	}
+	for i, req := range requests {
+		if req.Attempt != i || (i == 0) != (req.LastError == nil) {
+			t.Errorf("request %d: attempt %d, last error %v", i, req.Attempt, req.LastError)
+		}
+		if len(req.Keys) != 1 || len(req.SymmetricKeys) != 1 || req.SymmetricKeys[0].S2KParams == nil {
+			t.Errorf("request %d: %d keys and %d symmetric keys", i, len(req.Keys), len(req.SymmetricKeys))
+		}
+	}
+
+	// The passphrase of a private key.
+	provider = KeyProviderFunc(func(ctx context.Context, req *KeyRequest) (*KeyResponse, error) {
+		return &KeyResponse{Passphrase: []byte("key passphrase")}, nil
+	})
+	md, err := ReadMessageWithContext(context.Background(), bytes.NewReader(msg), EntityList{to}, provider, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.DecryptedWith.PrivateKey != to.Subkeys[0].PrivateKey {
+		t.Error("message not decrypted with the unlocked key")
+	}
+	readAll(md)
+
+	// An unlocked key that isn't in the keyring.
+	to, msg = newMessage()
+	provider = KeyProviderFunc(func(ctx context.Context, req *KeyRequest) (*KeyResponse, error) {
+		return &KeyResponse{PrivateKeys: []*packet.PrivateKey{to.Subkeys[0].PrivateKey}}, nil
+	})
+	md, err = ReadMessageWithContext(context.Background(), bytes.NewReader(msg), EntityList{}, provider, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAll(md)
+
+	// A locked key is skipped, and the error passed to the next request.
+	locked, lockedMsg := newMessage()
+	if err := locked.Subkeys[0].PrivateKey.Encrypt([]byte("key passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	requests = nil
+	provider = KeyProviderFunc(func(ctx context.Context, req *KeyRequest) (*KeyResponse, error) {
+		requests = append(requests, *req)
+		return &KeyResponse{PrivateKeys: []*packet.PrivateKey{locked.Subkeys[0].PrivateKey}}, nil
+	})
+	if _, err := ReadMessageWithContext(context.Background(), bytes.NewReader(lockedMsg), EntityList{}, provider, &packet.Config{MaxKeyAttempts: 2}); err == nil {
+		t.Fatal("a locked key decrypted the message")
+	}
+	if len(requests) != 2 {
+		t.Fatalf("key provider called %d times, want 2", len(requests))
+	}
+	if _, ok := requests[1].LastError.(errors.InvalidArgumentError); !ok {
+		t.Errorf("got last error %v, want an InvalidArgumentError", requests[1].LastError)
+	}
+
+	// The session key.
+	p, err := packet.Read(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek := p.(*packet.EncryptedKey)
+	if err := ek.Decrypt(to.Subkeys[0].PrivateKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	provider = KeyProviderFunc(func(ctx context.Context, req *KeyRequest) (*KeyResponse, error) {
+		return &KeyResponse{SessionKey: ek.Key, CipherFunc: ek.CipherFunc}, nil
+	})
+	md, err = ReadMessageWithContext(context.Background(), bytes.NewReader(msg), EntityList{}, provider, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAll(md)
+
+	// Cancellation.
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	provider = KeyProviderFunc(func(ctx context.Context, req *KeyRequest) (*KeyResponse, error) {
+		calls++
+		cancel()
+		return &KeyResponse{Passphrase: []byte("wrong")}, nil
+	})
+	if _, err := ReadMessageWithContext(ctx, bytes.NewReader(msg), EntityList{}, provider, nil); err != context.Canceled {
+		t.Errorf("got %v after cancellation, want context.Canceled", err)
+	}
+	if calls != 1 {
+		t.Errorf("key provider called %d times after cancellation", calls)
+	}
+}
@@ -254,6 +254,31 @@ func ParseIntoParams(r io.Reader) (params *Params, err error) {
 	return nil, errors.UnsupportedError("S2K function")
 }
 
+// Mode returns the S2K mode: 0 (simple), 1 (salted), 3 (iterated and
+// salted) or 101 (GNU extension).
+func (params *Params) Mode() uint8 {
+	return params.mode
+}
+
+// HashId returns the OpenPGP ID of the hash function.
+func (params *Params) HashId() byte {
+	return params.hashId
+}
+
+// Salt returns the salt, or nil if the mode is not salted.
+func (params *Params) Salt() []byte {
+	return params.salt
+}
+
+// Count returns the number of bytes hashed in iterated mode, or zero in the
+// other modes.
+func (params *Params) Count() int {
+	if params.mode != 3 {
+		return 0
+	}
+	return decodeCount(params.countByte)
+}
+
 func (params *Params) Dummy() bool {
 	return params != nil && params.mode == 101
 }
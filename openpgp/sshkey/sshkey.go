@@ -0,0 +1,96 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sshkey converts OpenPGP keys to SSH keys, so that an OpenPGP
+// authentication key can be used with the ssh package.
+package sshkey // import "golang.org/x/crypto/openpgp/sshkey"
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+	xrsa "golang.org/x/crypto/rsa"
+	"golang.org/x/crypto/ssh"
+)
+
+// NewPublicKey returns the SSH public key for pk. RSA, ECDSA and EdDSA keys
+// are supported.
+func NewPublicKey(pk *packet.PublicKey) (ssh.PublicKey, error) {
+	switch pub := pk.PublicKey.(type) {
+	case *xrsa.PublicKey:
+		return ssh.NewPublicKey(&rsa.PublicKey{N: pub.N, E: pub.E})
+	case *ecdsa.PublicKey:
+		return ssh.NewPublicKey(pub)
+	case *ed25519.PublicKey:
+		return ssh.NewPublicKey(*pub)
+	}
+	return nil, errors.UnsupportedError("public key algorithm for SSH: " + algorithmName(pk.PubKeyAlgo))
+}
+
+// NewSigner returns an SSH signer using priv, which must have been decrypted
+// if necessary. RSA, ECDSA and EdDSA keys are supported.
+func NewSigner(priv *packet.PrivateKey) (ssh.Signer, error) {
+	if priv.Encrypted {
+		return nil, errors.InvalidArgumentError("private key must be decrypted")
+	}
+	if priv.Dummy() {
+		return nil, errors.ErrDummyPrivateKey("dummy key found")
+	}
+	switch key := priv.PrivateKey.(type) {
+	case *xrsa.PrivateKey:
+		rsaKey := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: key.N, E: key.E},
+			D:         key.D,
+			Primes:    key.Primes,
+		}
+		rsaKey.Precompute()
+		return ssh.NewSignerFromKey(rsaKey)
+	case *ecdsa.PrivateKey:
+		return ssh.NewSignerFromKey(key)
+	case *ed25519.PrivateKey:
+		return ssh.NewSignerFromKey(*key)
+	}
+	return nil, errors.UnsupportedError("private key algorithm for SSH: " + algorithmName(priv.PubKeyAlgo))
+}
+
+// AuthenticationSigner returns an SSH signer using the authentication key of
+// e, see Entity.AuthenticationKey.
+func AuthenticationSigner(e *openpgp.Entity, now time.Time) (ssh.Signer, error) {
+	key, ok := e.AuthenticationKey(now)
+	if !ok {
+		return nil, errors.InvalidArgumentError("entity has no authentication key")
+	}
+	if key.PrivateKey == nil {
+		return nil, errors.InvalidArgumentError("authentication key has no private key")
+	}
+	return NewSigner(key.PrivateKey)
+}
+
+// AuthenticationPublicKey returns the SSH public key of the authentication
+// key of e, see Entity.AuthenticationKey.
+func AuthenticationPublicKey(e *openpgp.Entity, now time.Time) (ssh.PublicKey, error) {
+	key, ok := e.AuthenticationKey(now)
+	if !ok {
+		return nil, errors.InvalidArgumentError("entity has no authentication key")
+	}
+	return NewPublicKey(key.PublicKey)
+}
+
+func algorithmName(algo packet.PublicKeyAlgorithm) string {
+	switch algo {
+	case packet.PubKeyAlgoDSA:
+		return "DSA"
+	case packet.PubKeyAlgoElGamal:
+		return "ElGamal"
+	case packet.PubKeyAlgoECDH:
+		return "ECDH"
+	}
+	return strconv.Itoa(int(algo))
+}
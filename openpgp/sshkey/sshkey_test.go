@@ -0,0 +1,103 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshkey
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/crypto/ssh"
+)
+
+func checkSigner(t *testing.T, signer ssh.Signer, pub ssh.PublicKey, wantType string) {
+	t.Helper()
+	if got := pub.Type(); got != wantType {
+		t.Errorf("public key type %s, want %s", got, wantType)
+	}
+	if !bytes.Equal(signer.PublicKey().Marshal(), pub.Marshal()) {
+		t.Error("signer and public key differ")
+	}
+	data := []byte("sign me")
+	sig, err := signer.Sign(rand.Reader, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.Verify(data, sig); err != nil {
+		t.Errorf("signature does not verify: %s", err)
+	}
+}
+
+func TestEntityAuthenticationKey(t *testing.T) {
+	for _, config := range []*packet.Config{
+		{Algorithm: packet.PubKeyAlgoEdDSA},
+		{Algorithm: packet.PubKeyAlgoRSA, RSABits: 1024},
+	} {
+		e, err := openpgp.NewEntity("alice", "", "alice@example.org", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := AuthenticationSigner(e, time.Now()); err == nil {
+			t.Error("entity without an authentication key returned a signer")
+		}
+		if err := e.AddAuthenticationSubkey(config); err != nil {
+			t.Fatal(err)
+		}
+
+		signer, err := AuthenticationSigner(e, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := AuthenticationPublicKey(e, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantType := ssh.KeyAlgoED25519
+		if config.Algorithm == packet.PubKeyAlgoRSA {
+			wantType = ssh.KeyAlgoRSA
+		}
+		checkSigner(t, signer, pub, wantType)
+	}
+}
+
+func TestECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := packet.NewSignerPrivateKey(time.Now(), key)
+	signer, err := NewSigner(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := NewPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSigner(t, signer, pub, ssh.KeyAlgoECDSA256)
+}
+
+func TestEncryptedKey(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	e, err := openpgp.NewEntity("alice", "", "alice@example.org", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.PrivateKey.Encrypt([]byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSigner(e.PrivateKey); err == nil {
+		t.Error("NewSigner accepted an encrypted key")
+	}
+	// The public key remains usable.
+	if _, err := NewPublicKey(e.PrimaryKey); err != nil {
+		t.Error(err)
+	}
+}
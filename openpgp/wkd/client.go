@@ -0,0 +1,95 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wkd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// maxKeySize bounds the size of a key returned by a server.
+const maxKeySize = 1 << 20
+
+// ErrNotFound is returned by Lookup when neither method yields a key for the
+// requested address.
+var ErrNotFound = errors.New("wkd: no key found")
+
+// A Client looks up keys in Web Key Directories.
+type Client struct {
+	// HTTPClient optionally specifies an HTTP client to use
+	// instead of http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Lookup returns the keys published for email. The advanced method is tried
+// first and the direct method is used if it fails. Only the entities with a
+// user ID for email are returned; if there are none, ErrNotFound is
+// returned.
+func (c *Client) Lookup(ctx context.Context, email string) (openpgp.EntityList, error) {
+	advanced, err := AdvancedURL(email)
+	if err != nil {
+		return nil, err
+	}
+	el, err := c.fetch(ctx, advanced, email)
+	if err == nil {
+		return el, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	direct, err := DirectURL(email)
+	if err != nil {
+		return nil, err
+	}
+	return c.fetch(ctx, direct, email)
+}
+
+// fetch retrieves the keys at url and filters them to those with a user ID
+// for email.
+func (c *Client) fetch(ctx context.Context, url, email string) (openpgp.EntityList, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case res.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("wkd: unexpected status %s from %s", res.Status, url)
+	}
+
+	el, err := openpgp.ReadKeyRing(io.LimitReader(res.Body, maxKeySize))
+	if err != nil {
+		return nil, err
+	}
+	var matching openpgp.EntityList
+	for _, e := range el {
+		if hasAddress(e, email) {
+			matching = append(matching, e)
+		}
+	}
+	if len(matching) == 0 {
+		return nil, ErrNotFound
+	}
+	return matching, nil
+}
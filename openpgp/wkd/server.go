@@ -0,0 +1,130 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wkd
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// A Handler serves a Web Key Directory from a fixed set of entities. It
+// answers both the advanced method, where the domain is part of the path,
+// and the direct method, where the domain is taken from the Host of the
+// request; a single Handler may therefore serve several domains. Each
+// response only contains the user ID that was asked for.
+type Handler struct {
+	// keys maps a domain and a hashed local part to the published keys.
+	keys map[string]map[string][]published
+	// domains lists the domains for which a policy file is served.
+	domains map[string]bool
+}
+
+// published is an entity reduced to the user ID it is published for.
+type published struct {
+	entity *openpgp.Entity
+	local  string
+}
+
+// NewHandler returns a Handler that publishes the public part of every
+// entity in el under each of its email addresses.
+func NewHandler(el openpgp.EntityList) *Handler {
+	h := &Handler{
+		keys:    make(map[string]map[string][]published),
+		domains: make(map[string]bool),
+	}
+	for _, e := range el {
+		for name, ident := range e.Identities {
+			local, domain, err := splitAddress(ident.UserId.Email)
+			if err != nil {
+				continue
+			}
+			single := &openpgp.Entity{
+				PrimaryKey:  e.PrimaryKey,
+				Identities:  map[string]*openpgp.Identity{name: ident},
+				Revocations: e.Revocations,
+				Subkeys:     make([]openpgp.Subkey, len(e.Subkeys)),
+			}
+			for i, subkey := range e.Subkeys {
+				single.Subkeys[i] = openpgp.Subkey{PublicKey: subkey.PublicKey, Sig: subkey.Sig}
+			}
+			if h.keys[domain] == nil {
+				h.keys[domain] = make(map[string][]published)
+			}
+			hash := HashLocalPart(local)
+			h.keys[domain][hash] = append(h.keys[domain][hash], published{single, local})
+			h.domains[domain] = true
+		}
+	}
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, wellKnownPath) {
+		http.NotFound(w, r)
+		return
+	}
+
+	var domain string
+	rest := strings.Split(strings.TrimPrefix(r.URL.Path, wellKnownPath), "/")
+	if len(rest) == 1 || len(rest) == 2 && rest[0] == "hu" {
+		// Direct method.
+		domain = r.Host
+		if host, _, err := net.SplitHostPort(domain); err == nil {
+			domain = host
+		}
+		domain = strings.ToLower(domain)
+	} else {
+		// Advanced method.
+		domain = strings.ToLower(rest[0])
+		rest = rest[1:]
+	}
+	if !h.domains[domain] {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(rest) == 1 && rest[0] == "policy":
+		// The policy file may be empty, but must exist.
+		w.Header().Set("Content-Type", "text/plain")
+	case len(rest) == 2 && rest[0] == "hu":
+		h.serveKeys(w, r, domain, rest[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) serveKeys(w http.ResponseWriter, r *http.Request, domain, hash string) {
+	// The local part, when given, disambiguates hash collisions and
+	// addresses that only differ in case.
+	local := r.URL.Query().Get("l")
+	var buf bytes.Buffer
+	for _, p := range h.keys[domain][hash] {
+		if local != "" && !strings.EqualFold(local, p.local) {
+			continue
+		}
+		if err := p.entity.Serialize(&buf); err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if buf.Len() == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write(buf.Bytes())
+}
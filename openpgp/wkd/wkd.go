@@ -0,0 +1,105 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package wkd implements the key discovery part of the OpenPGP Web Key
+// Directory, see draft-koch-openpgp-webkey-service. Keys are looked up by
+// email address over HTTPS, using either the advanced method, served from
+// the openpgpkey subdomain, or the direct method, served from the domain
+// itself.
+package wkd // import "golang.org/x/crypto/openpgp/wkd"
+
+import (
+	"crypto/sha1"
+	"net/url"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/errors"
+)
+
+// wellKnownPath is the path prefix of every Web Key Directory resource.
+const wellKnownPath = "/.well-known/openpgpkey/"
+
+// zbase32Alphabet is the alphabet of the human-oriented base-32 encoding,
+// see https://philzimmermann.com/docs/human-oriented-base-32-encoding.txt.
+const zbase32Alphabet = "ybndrfg8ejkmcpqxot1uwisza345h769"
+
+// encodeZBase32 returns the z-base-32 encoding of b.
+func encodeZBase32(b []byte) string {
+	var out strings.Builder
+	var acc uint
+	var bits uint
+	for _, c := range b {
+		acc = acc<<8 | uint(c)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out.WriteByte(zbase32Alphabet[(acc>>bits)&0x1f])
+		}
+	}
+	if bits > 0 {
+		out.WriteByte(zbase32Alphabet[(acc<<(5-bits))&0x1f])
+	}
+	return out.String()
+}
+
+// HashLocalPart returns the hashed form of the local part of an address
+// used in Web Key Directory URLs: the z-base-32 encoding of the SHA-1 hash of
+// the local part, mapped to lower case.
+func HashLocalPart(local string) string {
+	h := sha1.Sum([]byte(strings.ToLower(local)))
+	return encodeZBase32(h[:])
+}
+
+// splitAddress splits an email address into its local part and its domain.
+// The domain is mapped to lower case.
+func splitAddress(email string) (local, domain string, err error) {
+	i := strings.LastIndexByte(email, '@')
+	if i <= 0 || i == len(email)-1 {
+		return "", "", errors.InvalidArgumentError("invalid email address: " + email)
+	}
+	return email[:i], strings.ToLower(email[i+1:]), nil
+}
+
+// AdvancedURL returns the URL of the keys for email under the advanced
+// method.
+func AdvancedURL(email string) (string, error) {
+	local, domain, err := splitAddress(email)
+	if err != nil {
+		return "", err
+	}
+	u := url.URL{
+		Scheme:   "https",
+		Host:     "openpgpkey." + domain,
+		Path:     wellKnownPath + domain + "/hu/" + HashLocalPart(local),
+		RawQuery: url.Values{"l": {local}}.Encode(),
+	}
+	return u.String(), nil
+}
+
+// DirectURL returns the URL of the keys for email under the direct method.
+func DirectURL(email string) (string, error) {
+	local, domain, err := splitAddress(email)
+	if err != nil {
+		return "", err
+	}
+	u := url.URL{
+		Scheme:   "https",
+		Host:     domain,
+		Path:     wellKnownPath + "hu/" + HashLocalPart(local),
+		RawQuery: url.Values{"l": {local}}.Encode(),
+	}
+	return u.String(), nil
+}
+
+// hasAddress reports whether one of the identities of e has the given email
+// address.
+func hasAddress(e *openpgp.Entity, email string) bool {
+	for _, ident := range e.Identities {
+		if strings.EqualFold(ident.UserId.Email, email) {
+			return true
+		}
+	}
+	return false
+}
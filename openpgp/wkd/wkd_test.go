@@ -0,0 +1,195 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wkd
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestHashLocalPart(t *testing.T) {
+	// Test vector from draft-koch-openpgp-webkey-service, section 3.1.
+	if got, want := HashLocalPart("Joe.Doe"), "iy9q119eutrkn8s1mk4r39qejnbu3n5q"; got != want {
+		t.Errorf("HashLocalPart = %s, want %s", got, want)
+	}
+}
+
+func TestURLs(t *testing.T) {
+	advanced, err := AdvancedURL("Joe.Doe@Example.ORG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://openpgpkey.example.org/.well-known/openpgpkey/example.org/hu/iy9q119eutrkn8s1mk4r39qejnbu3n5q?l=Joe.Doe"; advanced != want {
+		t.Errorf("AdvancedURL = %s, want %s", advanced, want)
+	}
+	direct, err := DirectURL("Joe.Doe@Example.ORG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://example.org/.well-known/openpgpkey/hu/iy9q119eutrkn8s1mk4r39qejnbu3n5q?l=Joe.Doe"; direct != want {
+		t.Errorf("DirectURL = %s, want %s", direct, want)
+	}
+	for _, bad := range []string{"example.org", "@example.org", "joe@"} {
+		if _, err := DirectURL(bad); err == nil {
+			t.Errorf("DirectURL(%q) succeeded", bad)
+		}
+	}
+}
+
+var testConfig = &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+
+func newTestEntity(t *testing.T, name, email string) *openpgp.Entity {
+	e, err := openpgp.NewEntity(name, "", email, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// newTestClient starts a TLS server for h and returns a client that connects
+// to it whatever the requested host, together with the hosts it was asked
+// for.
+func newTestClient(t *testing.T, h http.Handler) (*Client, *[]string, func()) {
+	var mu sync.Mutex
+	var hosts []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hosts = append(hosts, r.Host)
+		mu.Unlock()
+		h.ServeHTTP(w, r)
+	}))
+	client := &Client{HTTPClient: &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "tcp", srv.Listener.Addr().String())
+			},
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}}
+	return client, &hosts, srv.Close
+}
+
+func TestLookupAdvanced(t *testing.T) {
+	alice := newTestEntity(t, "Alice", "alice@example.org")
+	bob := newTestEntity(t, "Bob", "bob@example.org")
+	client, hosts, done := newTestClient(t, NewHandler(openpgp.EntityList{alice, bob}))
+	defer done()
+
+	el, err := client.Lookup(context.Background(), "Alice@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(el) != 1 || el[0].PrimaryKey.KeyId != alice.PrimaryKey.KeyId {
+		t.Fatalf("got %d entities, want alice", len(el))
+	}
+	if el[0].PrivateKey != nil {
+		t.Error("private key was published")
+	}
+	if len(*hosts) != 1 || (*hosts)[0] != "openpgpkey.example.org" {
+		t.Errorf("requested hosts %v, want the advanced method only", *hosts)
+	}
+
+	if _, err := client.Lookup(context.Background(), "carol@example.org"); err != ErrNotFound {
+		t.Errorf("unknown address: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestLookupDirectFallback(t *testing.T) {
+	alice := newTestEntity(t, "Alice", "alice@example.org")
+	h := NewHandler(openpgp.EntityList{alice})
+	noSubdomain := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Host, "openpgpkey.") {
+			http.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+	client, hosts, done := newTestClient(t, noSubdomain)
+	defer done()
+
+	el, err := client.Lookup(context.Background(), "alice@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(el) != 1 || el[0].PrimaryKey.KeyId != alice.PrimaryKey.KeyId {
+		t.Fatalf("got %d entities, want alice", len(el))
+	}
+	if len(*hosts) != 2 || (*hosts)[1] != "example.org" {
+		t.Errorf("requested hosts %v, want a direct fallback", *hosts)
+	}
+}
+
+func TestLookupFiltersIdentities(t *testing.T) {
+	// A server returning an unrelated key for the hash must not be
+	// trusted.
+	mallory := newTestEntity(t, "Mallory", "mallory@example.org")
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mallory.Serialize(w)
+	})
+	client, _, done := newTestClient(t, h)
+	defer done()
+
+	if _, err := client.Lookup(context.Background(), "alice@example.org"); err != ErrNotFound {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	alice := newTestEntity(t, "Alice", "alice@example.org")
+	// Only the requested user ID is served.
+	alice.Identities["Alice <alice@example.net>"] = newTestEntity(t, "Alice", "alice@example.net").Identities["Alice <alice@example.net>"]
+	h := NewHandler(openpgp.EntityList{alice})
+	hash := HashLocalPart("alice")
+
+	tests := []struct {
+		host, path string
+		status     int
+	}{
+		{"example.org", "/.well-known/openpgpkey/policy", http.StatusOK},
+		{"openpgpkey.example.org", "/.well-known/openpgpkey/example.org/policy", http.StatusOK},
+		{"example.org:443", "/.well-known/openpgpkey/hu/" + hash, http.StatusOK},
+		{"other", "/.well-known/openpgpkey/example.org/hu/" + hash, http.StatusOK},
+		{"example.org", "/.well-known/openpgpkey/hu/" + hash + "?l=bob", http.StatusNotFound},
+		{"example.com", "/.well-known/openpgpkey/hu/" + hash, http.StatusNotFound},
+		{"example.org", "/.well-known/openpgpkey/hu/" + HashLocalPart("bob"), http.StatusNotFound},
+		{"example.org", "/index.html", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "https://"+test.host+test.path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s%s: status %d, want %d", test.host, test.path, w.Code, test.status)
+			continue
+		}
+		if w.Code != http.StatusOK || !strings.Contains(test.path, "/hu/") {
+			continue
+		}
+		el, err := openpgp.ReadKeyRing(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(el) != 1 || len(el[0].Identities) != 1 {
+			t.Errorf("%s%s: got %d entities, want one entity with one identity", test.host, test.path, len(el))
+		}
+	}
+
+	r := httptest.NewRequest("POST", "https://example.org/.well-known/openpgpkey/policy", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d", w.Code)
+	}
+}
@@ -18,17 +18,18 @@ import (
 )
 
 // DetachSign signs message with the private key from signer (which must
-// already have been decrypted) and writes the signature to w.
+// already have been decrypted) and writes the signature to w. The signature
+// uses the hash function of config, whatever the preferences of signer.
 // If config is nil, sensible defaults will be used.
 func DetachSign(w io.Writer, signer *Entity, message io.Reader, config *packet.Config) error {
-	return detachSign(w, signer, message, packet.SigTypeBinary, config)
+	return detachSign(w, []*Entity{signer}, message, packet.SigTypeBinary, config.Hash(), config)
 }
 
 // ArmoredDetachSign signs message with the private key from signer (which
 // must already have been decrypted) and writes an armored signature to w.
 // If config is nil, sensible defaults will be used.
 func ArmoredDetachSign(w io.Writer, signer *Entity, message io.Reader, config *packet.Config) (err error) {
-	return armoredDetachSign(w, signer, message, packet.SigTypeBinary, config)
+	return armoredDetachSign(w, []*Entity{signer}, message, packet.SigTypeBinary, config.Hash(), config)
 }
 
 // DetachSignText signs message (after canonicalising the line endings) with
@@ -36,7 +37,7 @@ func ArmoredDetachSign(w io.Writer, signer *Entity, message io.Reader, config *p
 // writes the signature to w.
 // If config is nil, sensible defaults will be used.
 func DetachSignText(w io.Writer, signer *Entity, message io.Reader, config *packet.Config) error {
-	return detachSign(w, signer, message, packet.SigTypeText, config)
+	return detachSign(w, []*Entity{signer}, message, packet.SigTypeText, config.Hash(), config)
 }
 
 // ArmoredDetachSignText signs message (after canonicalising the line endings)
@@ -44,58 +45,182 @@ func DetachSignText(w io.Writer, signer *Entity, message io.Reader, config *pack
 // and writes an armored signature to w.
 // If config is nil, sensible defaults will be used.
 func ArmoredDetachSignText(w io.Writer, signer *Entity, message io.Reader, config *packet.Config) error {
-	return armoredDetachSign(w, signer, message, packet.SigTypeText, config)
+	return armoredDetachSign(w, []*Entity{signer}, message, packet.SigTypeText, config.Hash(), config)
 }
 
-func armoredDetachSign(w io.Writer, signer *Entity, message io.Reader, sigType packet.SignatureType, config *packet.Config) (err error) {
+// DetachSignMultiple is like DetachSign, but writes one signature for each of
+// signers. All signatures use the same hash function, which is chosen from
+// the preferences of the signers.
+func DetachSignMultiple(w io.Writer, signers []*Entity, message io.Reader, config *packet.Config) error {
+	return detachSign(w, signers, message, packet.SigTypeBinary, signersHash(signers, config), config)
+}
+
+// ArmoredDetachSignMultiple is like ArmoredDetachSign, but writes one
+// signature for each of signers, see DetachSignMultiple.
+func ArmoredDetachSignMultiple(w io.Writer, signers []*Entity, message io.Reader, config *packet.Config) error {
+	return armoredDetachSign(w, signers, message, packet.SigTypeBinary, signersHash(signers, config), config)
+}
+
+// DetachSignTextMultiple is like DetachSignText, but writes one signature for
+// each of signers, see DetachSignMultiple.
+func DetachSignTextMultiple(w io.Writer, signers []*Entity, message io.Reader, config *packet.Config) error {
+	return detachSign(w, signers, message, packet.SigTypeText, signersHash(signers, config), config)
+}
+
+// ArmoredDetachSignTextMultiple is like ArmoredDetachSignText, but writes one
+// signature for each of signers, see DetachSignMultiple.
+func ArmoredDetachSignTextMultiple(w io.Writer, signers []*Entity, message io.Reader, config *packet.Config) error {
+	return armoredDetachSign(w, signers, message, packet.SigTypeText, signersHash(signers, config), config)
+}
+
+func armoredDetachSign(w io.Writer, signers []*Entity, message io.Reader, sigType packet.SignatureType, hashFunc crypto.Hash, config *packet.Config) (err error) {
 	out, err := armor.Encode(w, SignatureType, nil)
 	if err != nil {
 		return
 	}
-	err = detachSign(out, signer, message, sigType, config)
+	err = detachSign(out, signers, message, sigType, hashFunc, config)
 	if err != nil {
 		return
 	}
 	return out.Close()
 }
 
-func detachSign(w io.Writer, signer *Entity, message io.Reader, sigType packet.SignatureType, config *packet.Config) (err error) {
-	signingKey, ok := signer.SigningKey(config.Now())
-	if !ok {
-		return errors.InvalidArgumentError("no valid signing keys")
+func detachSign(w io.Writer, signers []*Entity, message io.Reader, sigType packet.SignatureType, hashFunc crypto.Hash, config *packet.Config) (err error) {
+	signingKeys, err := signingKeys(signers, config)
+	if err != nil {
+		return err
+	}
+	if len(signingKeys) == 0 {
+		return errors.InvalidArgumentError("no signer provided")
 	}
-	if signingKey.PrivateKey == nil {
-		return errors.InvalidArgumentError("signing key doesn't have a private key")
+
+	hashes := make([]hash.Hash, len(signingKeys))
+	wrappedHashes := make([]io.Writer, len(signingKeys))
+	for i := range signingKeys {
+		hashes[i], wrappedHashes[i], err = hashForSignature(hashFunc, sigType)
+		if err != nil {
+			return
+		}
 	}
-	if signingKey.PrivateKey.Encrypted {
-		return errors.InvalidArgumentError("signing key is encrypted")
+	if _, err = io.Copy(io.MultiWriter(wrappedHashes...), message); err != nil {
+		return err
 	}
 
-	sig := new(packet.Signature)
-	sig.SigType = sigType
-	sig.PubKeyAlgo = signingKey.PrivateKey.PubKeyAlgo
-	sig.Hash = config.Hash()
-	sig.CreationTime = config.Now()
-	sigLifetimeSecs := config.SigLifetime()
-	sig.SigLifetimeSecs = &sigLifetimeSecs
-	sig.IssuerKeyId = &signingKey.PrivateKey.KeyId
+	for i, signingKey := range signingKeys {
+		sig := new(packet.Signature)
+		sig.SigType = sigType
+		sig.PubKeyAlgo = signingKey.PubKeyAlgo
+		sig.Hash = hashFunc
+		sig.CreationTime = config.Now()
+		sigLifetimeSecs := config.SigLifetime()
+		sig.SigLifetimeSecs = &sigLifetimeSecs
+		sig.IssuerKeyId = &signingKey.KeyId
+
+		err = sig.Sign(hashes[i], signingKey, config)
+		if err != nil {
+			return
+		}
+		if err = sig.Serialize(w); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+// signersHash returns the hash function of signatures made by all of signers:
+// the configured one, unless a signer doesn't want it.
+func signersHash(signers []*Entity, config *packet.Config) crypto.Hash {
+	hashFunc := config.Hash()
+	candidateHashes := signerHashes(allCandidateHashes(), signers)
+	if !hashIsCandidate(hashFunc, candidateHashes) {
+		if h, err := selectHash(candidateHashes, config); err == nil {
+			hashFunc = h
+		}
+	}
+	return hashFunc
+}
 
-	h, wrappedHash, err := hashForSignature(sig.Hash, sig.SigType)
+// SignStandalone writes to w a standalone signature by signer, which only
+// signs its own subpackets.
+// If config is nil, sensible defaults will be used.
+func SignStandalone(w io.Writer, signer *Entity, config *packet.Config) error {
+	sig, priv, err := newSignature(signer, packet.SigTypeStandalone, config)
 	if err != nil {
-		return
+		return err
 	}
-	if _, err = io.Copy(wrappedHash, message); err != nil {
+	if err := sig.SignStandalone(priv, config); err != nil {
 		return err
 	}
+	return sig.Serialize(w)
+}
 
-	err = sig.Sign(h, signingKey.PrivateKey, config)
+// SignTimestamp writes to w a timestamp signature by signer, asserting that
+// target existed at the current time. target may be nil to only sign the
+// time.
+// If config is nil, sensible defaults will be used.
+func SignTimestamp(w io.Writer, signer *Entity, target *packet.Signature, config *packet.Config) error {
+	sig, priv, err := newSignature(signer, packet.SigTypeTimestamp, config)
 	if err != nil {
-		return
+		return err
 	}
+	if err := sig.SignTimestamp(target, priv, config); err != nil {
+		return err
+	}
+	return sig.Serialize(w)
+}
 
+// ConfirmSignature writes to w a third-party confirmation of target by
+// signer.
+// If config is nil, sensible defaults will be used.
+func ConfirmSignature(w io.Writer, signer *Entity, target *packet.Signature, config *packet.Config) error {
+	sig, priv, err := newSignature(signer, packet.SigTypeThirdPartyConfirmation, config)
+	if err != nil {
+		return err
+	}
+	if err := sig.SignThirdPartyConfirmation(target, priv, config); err != nil {
+		return err
+	}
 	return sig.Serialize(w)
 }
 
+// newSignature returns a signature of the given type, to be made by the
+// signing key of signer.
+func newSignature(signer *Entity, sigType packet.SignatureType, config *packet.Config) (*packet.Signature, *packet.PrivateKey, error) {
+	keys, err := signingKeys([]*Entity{signer}, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	priv := keys[0]
+	sigLifetimeSecs := config.SigLifetime()
+	return &packet.Signature{
+		SigType:         sigType,
+		PubKeyAlgo:      priv.PubKeyAlgo,
+		Hash:            config.Hash(),
+		CreationTime:    config.Now(),
+		SigLifetimeSecs: &sigLifetimeSecs,
+		IssuerKeyId:     &priv.KeyId,
+	}, priv, nil
+}
+
+// signingKeys returns the decrypted private signing keys of signers.
+func signingKeys(signers []*Entity, config *packet.Config) ([]*packet.PrivateKey, error) {
+	var keys []*packet.PrivateKey
+	for _, signer := range signers {
+		signingKey, ok := signer.SigningKey(config.Now())
+		if !ok {
+			return nil, errors.InvalidArgumentError("no valid signing keys for key id " + strconv.FormatUint(signer.PrimaryKey.KeyId, 16))
+		}
+		if signingKey.PrivateKey == nil {
+			return nil, errors.InvalidArgumentError("signing key " + strconv.FormatUint(signingKey.PublicKey.KeyId, 16) + " doesn't have a private key")
+		}
+		if signingKey.PrivateKey.Encrypted {
+			return nil, errors.InvalidArgumentError("signing key " + strconv.FormatUint(signingKey.PublicKey.KeyId, 16) + " is encrypted")
+		}
+		keys = append(keys, signingKey.PrivateKey)
+	}
+	return keys, nil
+}
+
 // FileHints contains metadata about encrypted files. This metadata is, itself,
 // encrypted.
 type FileHints struct {
@@ -187,7 +312,7 @@ func hashToHashId(h crypto.Hash) uint8 {
 // must be closed after the contents of the file have been written. If config
 // is nil, sensible defaults will be used. The signing is done in text mode.
 func EncryptText(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
-	return encrypt(ciphertext, to, signed, hints, packet.SigTypeText, config)
+	return encrypt(ciphertext, to, nil, entitySlice(signed), hints, packet.SigTypeText, config)
 }
 
 // Encrypt encrypts a message to a number of recipients and, optionally, signs
@@ -196,30 +321,97 @@ func EncryptText(ciphertext io.Writer, to []*Entity, signed *Entity, hints *File
 // be closed after the contents of the file have been written.
 // If config is nil, sensible defaults will be used.
 func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
-	return encrypt(ciphertext, to, signed, hints, packet.SigTypeBinary, config)
+	return encrypt(ciphertext, to, nil, entitySlice(signed), hints, packet.SigTypeBinary, config)
 }
 
-// writeAndSign writes the data as a payload package and, optionally, signs
-// it. hints contains optional information, that is also encrypted,
-// that aids the recipients in processing the message. The resulting
-// WriteCloser must be closed after the contents of the file have been
-// written. If config is nil, sensible defaults will be used.
-func writeAndSign(payload io.WriteCloser, candidateHashes []uint8, signed *Entity, hints *FileHints, sigType packet.SignatureType, config *packet.Config) (plaintext io.WriteCloser, err error) {
-	var signer *packet.PrivateKey
-	if signed != nil {
-		signKey, ok := signed.SigningKey(config.Now())
-		if !ok {
-			return nil, errors.InvalidArgumentError("no valid signing keys")
-		}
-		signer = signKey.PrivateKey
-		if signer == nil {
-			return nil, errors.InvalidArgumentError("no private key in signing key")
+// EncryptParams contains the optional parameters of EncryptWithParams.
+type EncryptParams struct {
+	// Passwords are passphrases that can decrypt the message in addition
+	// to the private keys of the recipients. Each one is stored in its own
+	// symmetric-key encrypted session key packet.
+	Passwords [][]byte
+	// Signers are the entities that sign the message. Their one-pass
+	// signatures are nested in the given order. The signing keys must
+	// have been decrypted.
+	Signers []*Entity
+	// Hints contains optional information, that is also encrypted, that
+	// aids the recipients in processing the message.
+	Hints *FileHints
+	// TextSig selects signing in text mode.
+	TextSig bool
+	// Config is used for all other parameters. If nil, sensible defaults
+	// will be used.
+	Config *packet.Config
+}
+
+// EncryptWithParams encrypts a message to a number of recipients and
+// passwords, at least one of which must be given, and signs it by any number
+// of signers. The session key is shared by all recipients and passwords. The
+// resulting WriteCloser must be closed after the contents of the file have
+// been written. If params is nil, the message is encrypted to the recipients
+// without signing it.
+func EncryptWithParams(ciphertext io.Writer, to []*Entity, params *EncryptParams) (plaintext io.WriteCloser, err error) {
+	if params == nil {
+		params = &EncryptParams{}
+	}
+	sigType := packet.SigTypeBinary
+	if params.TextSig {
+		sigType = packet.SigTypeText
+	}
+	return encrypt(ciphertext, to, params.Passwords, params.Signers, params.Hints, sigType, params.Config)
+}
+
+// entitySlice returns a slice containing e, or nil if e is nil.
+func entitySlice(e *Entity) []*Entity {
+	if e == nil {
+		return nil
+	}
+	return []*Entity{e}
+}
+
+// allCandidateHashes returns the hash functions that may be used for
+// signatures, most preferred first.
+func allCandidateHashes() []uint8 {
+	return []uint8{
+		hashToHashId(crypto.SHA256),
+		hashToHashId(crypto.SHA384),
+		hashToHashId(crypto.SHA512),
+		hashToHashId(crypto.SHA1),
+		hashToHashId(crypto.RIPEMD160),
+	}
+}
+
+// signerHashes returns the elements of candidateHashes that all signers
+// prefer. Signers without hash preferences accept every candidate. If the
+// signers share no preferred hash, their preferences are ignored. The
+// candidateHashes slice is not modified.
+func signerHashes(candidateHashes []uint8, signers []*Entity) []uint8 {
+	hashes := append([]uint8(nil), candidateHashes...)
+	for _, signer := range signers {
+		ident := signer.PrimaryIdentity()
+		if ident == nil || len(ident.SelfSignature.PreferredHash) == 0 {
+			continue
 		}
-		if signer.Encrypted {
-			return nil, errors.InvalidArgumentError("signing key must be decrypted")
+		hashes = intersectPreferences(hashes, ident.SelfSignature.PreferredHash)
+	}
+	if len(hashes) == 0 {
+		return candidateHashes
+	}
+	return hashes
+}
+
+func hashIsCandidate(h crypto.Hash, candidateHashes []uint8) bool {
+	for _, hashId := range candidateHashes {
+		if candidate, ok := s2k.HashIdToHash(hashId); ok && candidate == h {
+			return true
 		}
 	}
+	return false
+}
 
+// selectHash returns the hash function configured by config if it is a
+// candidate, or else the first available candidate.
+func selectHash(candidateHashes []uint8, config *packet.Config) (crypto.Hash, error) {
 	var hash crypto.Hash
 	for _, hashId := range candidateHashes {
 		if h, ok := s2k.HashIdToHash(hashId); ok && h.Available() {
@@ -229,13 +421,8 @@ func writeAndSign(payload io.WriteCloser, candidateHashes []uint8, signed *Entit
 	}
 
 	// If the hash specified by config is a candidate, we'll use that.
-	if configuredHash := config.Hash(); configuredHash.Available() {
-		for _, hashId := range candidateHashes {
-			if h, ok := s2k.HashIdToHash(hashId); ok && h == configuredHash {
-				hash = h
-				break
-			}
-		}
+	if configuredHash := config.Hash(); configuredHash.Available() && hashIsCandidate(configuredHash, candidateHashes) {
+		hash = configuredHash
 	}
 
 	if hash == 0 {
@@ -244,16 +431,36 @@ func writeAndSign(payload io.WriteCloser, candidateHashes []uint8, signed *Entit
 		if !ok {
 			name = "#" + strconv.Itoa(int(hashId))
 		}
-		return nil, errors.InvalidArgumentError("cannot encrypt because no candidate hash functions are compiled in. (Wanted " + name + " in this case.)")
+		return 0, errors.InvalidArgumentError("cannot encrypt because no candidate hash functions are compiled in. (Wanted " + name + " in this case.)")
 	}
+	return hash, nil
+}
 
-	if signer != nil {
+// writeAndSign writes the data as a payload package and, optionally, signs
+// it. hints contains optional information, that is also encrypted,
+// that aids the recipients in processing the message. The resulting
+// WriteCloser must be closed after the contents of the file have been
+// written. If config is nil, sensible defaults will be used.
+func writeAndSign(payload io.WriteCloser, candidateHashes []uint8, signers []*Entity, hints *FileHints, sigType packet.SignatureType, config *packet.Config) (plaintext io.WriteCloser, err error) {
+	signingKeys, err := signingKeys(signers, config)
+	if err != nil {
+		return nil, err
+	}
+
+	hashFunc, err := selectHash(candidateHashes, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// The one-pass signatures are nested: all but the last one announce
+	// that another one-pass signature follows.
+	for i, signer := range signingKeys {
 		ops := &packet.OnePassSignature{
 			SigType:    sigType,
-			Hash:       hash,
+			Hash:       hashFunc,
 			PubKeyAlgo: signer.PubKeyAlgo,
 			KeyId:      signer.KeyId,
-			IsLast:     true,
+			IsLast:     i == len(signingKeys)-1,
 		}
 		if err := ops.Serialize(payload); err != nil {
 			return nil, err
@@ -265,7 +472,7 @@ func writeAndSign(payload io.WriteCloser, candidateHashes []uint8, signed *Entit
 	}
 
 	w := payload
-	if signer != nil {
+	if len(signingKeys) > 0 {
 		// If we need to write a signature packet after the literal
 		// data then we need to stop literalData from closing
 		// encryptedData.
@@ -281,10 +488,16 @@ func writeAndSign(payload io.WriteCloser, candidateHashes []uint8, signed *Entit
 		return nil, err
 	}
 
-	if signer != nil {
-		h, wrappedHash, err := hashForSignature(hash, sigType)
-		if err != nil {
-			return nil, err
+	if len(signingKeys) > 0 {
+		hashes := make([]hash.Hash, len(signingKeys))
+		wrappedHashes := make([]io.Writer, len(signingKeys))
+		for i := range signingKeys {
+			var wrappedHash hash.Hash
+			hashes[i], wrappedHash, err = hashForSignature(hashFunc, sigType)
+			if err != nil {
+				return nil, err
+			}
+			wrappedHashes[i] = wrappedHash
 		}
 		metadata := &packet.LiteralData{
 			Format:   't',
@@ -294,18 +507,19 @@ func writeAndSign(payload io.WriteCloser, candidateHashes []uint8, signed *Entit
 		if hints.IsBinary {
 			metadata.Format = 'b'
 		}
-		return signatureWriter{payload, literalData, hash, wrappedHash, h, signer, sigType, config, metadata}, nil
+		return signatureWriter{payload, literalData, hashFunc, io.MultiWriter(wrappedHashes...), hashes, signingKeys, sigType, config, metadata}, nil
 	}
 	return literalData, nil
 }
 
-// encrypt encrypts a message to a number of recipients and, optionally, signs
-// it. hints contains optional information, that is also encrypted, that aids
-// the recipients in processing the message. The resulting WriteCloser must
-// be closed after the contents of the file have been written.
+// encrypt encrypts a message to a number of recipients and passwords and,
+// optionally, signs it. hints contains optional information, that is also
+// encrypted, that aids the recipients in processing the message. The
+// resulting WriteCloser must be closed after the contents of the file have
+// been written.
 // If config is nil, sensible defaults will be used.
-func encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHints, sigType packet.SignatureType, config *packet.Config) (plaintext io.WriteCloser, err error) {
-	if len(to) == 0 {
+func encrypt(ciphertext io.Writer, to []*Entity, passwords [][]byte, signers []*Entity, hints *FileHints, sigType packet.SignatureType, config *packet.Config) (plaintext io.WriteCloser, err error) {
+	if len(to) == 0 && len(passwords) == 0 {
 		return nil, errors.InvalidArgumentError("no encryption recipient provided")
 	}
 
@@ -316,13 +530,7 @@ func encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 		uint8(packet.CipherCAST5),
 	}
 	// These are the possible hash functions that we'll use for the signature.
-	candidateHashes := []uint8{
-		hashToHashId(crypto.SHA256),
-		hashToHashId(crypto.SHA384),
-		hashToHashId(crypto.SHA512),
-		hashToHashId(crypto.SHA1),
-		hashToHashId(crypto.RIPEMD160),
-	}
+	candidateHashes := allCandidateHashes()
 	candidateAeadModes := []uint8{
 		uint8(packet.AEADModeEAX),
 		uint8(packet.AEADModeOCB),
@@ -342,8 +550,9 @@ func encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 	defaultCompression := candidateCompression[0:1]
 
 	encryptKeys := make([]Key, len(to))
-	// AEAD is used only if every key supports it.
-	aeadSupported := true
+	// AEAD is used only if every key supports it. Password recipients
+	// have no preferences, so with passwords the configuration decides.
+	aeadSupported := len(passwords) == 0 || config.AEAD() != nil
 
 	for i := range to {
 		var ok bool
@@ -382,6 +591,7 @@ func encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 	if len(candidateCiphers) == 0 || len(candidateHashes) == 0 || len(candidateAeadModes) == 0 {
 		return nil, errors.InvalidArgumentError("cannot encrypt because recipient set shares no common algorithms")
 	}
+	candidateHashes = signerHashes(candidateHashes, signers)
 
 	cipher := packet.CipherFunction(candidateCiphers[0])
 	mode := packet.AEADMode(candidateAeadModes[0])
@@ -394,6 +604,10 @@ func encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 			break
 		}
 	}
+	// A password-only message uses the configured AEAD mode.
+	if len(to) == 0 && config.AEAD() != nil {
+		mode = config.AEAD().Mode()
+	}
 
 	symKey := make([]byte, cipher.KeySize())
 	if _, err := io.ReadFull(config.Random(), symKey); err != nil {
@@ -406,6 +620,28 @@ func encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 		}
 	}
 
+	if len(passwords) > 0 {
+		// The symmetric-key encrypted session key packets must agree
+		// with the algorithms chosen above.
+		skConfig := new(packet.Config)
+		if config != nil {
+			*skConfig = *config
+		}
+		skConfig.DefaultCipher = cipher
+		skConfig.AEADConfig = nil
+		if aeadSupported {
+			skConfig.AEADConfig = &packet.AEADConfig{DefaultMode: mode}
+			if config.AEAD() != nil {
+				skConfig.AEADConfig.ChunkSize = config.AEAD().ChunkSize
+			}
+		}
+		for _, password := range passwords {
+			if err := packet.SerializeSymmetricKeyEncryptedReuseKey(ciphertext, symKey, password, skConfig); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	var payload io.WriteCloser
 	if aeadSupported {
 		payload, err = packet.SerializeAEADEncrypted(ciphertext, symKey, cipher, mode, config)
@@ -418,12 +654,15 @@ func encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 			return
 		}
 	}
+	if config.Padding() != nil {
+		payload = &paddingWriter{w: payload, config: config}
+	}
 	payload, err = handleCompression(payload, candidateCompression, config)
 	if err != nil {
 		return nil, err
 	}
 
-	return writeAndSign(payload, candidateHashes, signed, hints, sigType, config)
+	return writeAndSign(payload, candidateHashes, signers, hints, sigType, config)
 }
 
 // Sign signs a message. The resulting WriteCloser must be closed after the
@@ -434,34 +673,29 @@ func Sign(output io.Writer, signed *Entity, hints *FileHints, config *packet.Con
 	if signed == nil {
 		return nil, errors.InvalidArgumentError("no signer provided")
 	}
+	return SignMultiple(output, []*Entity{signed}, hints, config)
+}
 
-	// These are the possible hash functions that we'll use for the signature.
-	candidateHashes := []uint8{
-		hashToHashId(crypto.SHA256),
-		hashToHashId(crypto.SHA384),
-		hashToHashId(crypto.SHA512),
-		hashToHashId(crypto.SHA1),
-		hashToHashId(crypto.RIPEMD160),
-	}
-	defaultHashes := candidateHashes[len(candidateHashes)-1:]
-	preferredHashes := signed.PrimaryIdentity().SelfSignature.PreferredHash
-	if len(preferredHashes) == 0 {
-		preferredHashes = defaultHashes
+// SignMultiple is like Sign, but signs the message by all of signers, using
+// nested one-pass signatures.
+func SignMultiple(output io.Writer, signers []*Entity, hints *FileHints, config *packet.Config) (input io.WriteCloser, err error) {
+	if len(signers) == 0 {
+		return nil, errors.InvalidArgumentError("no signer provided")
 	}
-	candidateHashes = intersectPreferences(candidateHashes, preferredHashes)
-	return writeAndSign(noOpCloser{output}, candidateHashes, signed, hints, packet.SigTypeBinary, config)
+	candidateHashes := signerHashes(allCandidateHashes(), signers)
+	return writeAndSign(noOpCloser{output}, candidateHashes, signers, hints, packet.SigTypeBinary, config)
 }
 
 // signatureWriter hashes the contents of a message while passing it along to
 // literalData. When closed, it closes literalData, writes a signature packet
-// to encryptedData and then also closes encryptedData.
+// for each signer to encryptedData and then also closes encryptedData.
 type signatureWriter struct {
 	encryptedData io.WriteCloser
 	literalData   io.WriteCloser
 	hashType      crypto.Hash
-	wrappedHash   hash.Hash
-	h             hash.Hash
-	signer        *packet.PrivateKey
+	wrappedHash   io.Writer
+	hashes        []hash.Hash
+	signers       []*packet.PrivateKey
 	sigType       packet.SignatureType
 	config        *packet.Config
 	metadata      *packet.LiteralData // V5 signatures protect document metadata
@@ -480,28 +714,60 @@ func (s signatureWriter) Write(data []byte) (int, error) {
 }
 
 func (s signatureWriter) Close() error {
-	sig := &packet.Signature{
-		Version:      s.signer.Version,
-		SigType:      s.sigType,
-		PubKeyAlgo:   s.signer.PubKeyAlgo,
-		Hash:         s.hashType,
-		CreationTime: s.config.Now(),
-		IssuerKeyId:  &s.signer.KeyId,
-		Metadata:     s.metadata,
-	}
-
-	if err := sig.Sign(s.h, s.signer, s.config); err != nil {
-		return err
-	}
 	if err := s.literalData.Close(); err != nil {
 		return err
 	}
-	if err := sig.Serialize(s.encryptedData); err != nil {
-		return err
+	// The signatures follow in the reverse order of the one-pass
+	// signatures.
+	for i := len(s.signers) - 1; i >= 0; i-- {
+		signer := s.signers[i]
+		sig := &packet.Signature{
+			Version:      signer.Version,
+			SigType:      s.sigType,
+			PubKeyAlgo:   signer.PubKeyAlgo,
+			Hash:         s.hashType,
+			CreationTime: s.config.Now(),
+			IssuerKeyId:  &signer.KeyId,
+			Metadata:     s.metadata,
+		}
+		if err := sig.Sign(s.hashes[i], signer, s.config); err != nil {
+			return err
+		}
+		if err := sig.Serialize(s.encryptedData); err != nil {
+			return err
+		}
 	}
 	return s.encryptedData.Close()
 }
 
+// paddingWriter counts the bytes written to an encrypted payload. When closed,
+// it appends a padding packet sized by the padding policy of config and then
+// closes the payload.
+type paddingWriter struct {
+	w      io.WriteCloser
+	n      int64
+	config *packet.Config
+}
+
+func (p *paddingWriter) Write(data []byte) (int, error) {
+	n, err := p.w.Write(data)
+	p.n += int64(n)
+	return n, err
+}
+
+func (p *paddingWriter) Close() error {
+	length, err := p.config.Padding().Length(p.n, p.config.Random())
+	if err != nil {
+		return err
+	}
+	if length > 0 {
+		if err := packet.SerializePadding(p.w, length, p.config.Random()); err != nil {
+			return err
+		}
+	}
+	return p.w.Close()
+}
+
 // noOpCloser is like an ioutil.NopCloser, but for an io.Writer.
 // TODO: we have two of these in OpenPGP packages alone. This probably needs
 // to be promoted somewhere more common.
@@ -6,6 +6,7 @@ package openpgp
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/rand"
 	"io"
 	"io/ioutil"
@@ -616,3 +617,251 @@ FindKey:
 	}
 	return nil
 }
+
+func TestEncryptWithParams(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	var entities []*Entity
+	for _, name := range []string{"recipient", "signer1", "signer2"} {
+		e, err := NewEntity(name, "", name+"@example.org", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entities = append(entities, e)
+	}
+	recipient, signers := entities[0], entities[1:]
+	passwords := [][]byte{[]byte("password1"), []byte("password2")}
+
+	for _, aead := range []bool{false, true} {
+		encConfig := &packet.Config{}
+		if aead {
+			encConfig.AEADConfig = &packet.AEADConfig{}
+		}
+		buf := new(bytes.Buffer)
+		w, err := EncryptWithParams(buf, []*Entity{recipient}, &EncryptParams{
+			Passwords: passwords,
+			Signers:   signers,
+			Config:    encConfig,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		message := []byte("hello world\n")
+		w.Write(message)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Every recipient and password can decrypt the message.
+		prompts := [][]byte{nil, passwords[0], passwords[1]}
+		for _, password := range prompts {
+			keyring := EntityList{signers[0], signers[1]}
+			if password == nil {
+				keyring = append(keyring, recipient)
+			}
+			prompt := func(keys []Key, symmetric bool) ([]byte, error) {
+				if password == nil {
+					return nil, errors.ErrKeyIncorrect
+				}
+				return password, nil
+			}
+			md, err := ReadMessage(bytes.NewReader(buf.Bytes()), keyring, prompt, nil)
+			if err != nil {
+				t.Fatalf("aead %v, password %q: %s", aead, password, err)
+			}
+			if !md.IsSymmetricallyEncrypted || len(md.EncryptedToKeyIds) != 1 {
+				t.Errorf("aead %v: message not encrypted to both a key and passwords", aead)
+			}
+			contents, err := ioutil.ReadAll(md.UnverifiedBody)
+			if err != nil {
+				t.Fatalf("aead %v, password %q: %s", aead, password, err)
+			}
+			if !bytes.Equal(contents, message) {
+				t.Errorf("aead %v: got %q, want %q", aead, contents, message)
+			}
+			if len(md.Signatures) != 2 {
+				t.Fatalf("aead %v: got %d signatures, want 2", aead, len(md.Signatures))
+			}
+			for i, ms := range md.Signatures {
+				if ms.SignatureError != nil {
+					t.Errorf("aead %v: signature %d: %s", aead, i, ms.SignatureError)
+				}
+				if ms.SignedBy == nil || ms.SignedBy.Entity != signers[i] {
+					t.Errorf("aead %v: signature %d not made by signer %d", aead, i, i)
+				}
+			}
+			if md.SignatureError != nil || md.SignedBy.Entity != signers[0] {
+				t.Errorf("aead %v: primary signature not reported", aead)
+			}
+		}
+	}
+
+	// A message that only has passwords needs no recipients.
+	buf := new(bytes.Buffer)
+	w, err := EncryptWithParams(buf, nil, &EncryptParams{Passwords: passwords[:1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if _, err := ReadMessage(buf, nil, func([]Key, bool) ([]byte, error) { return passwords[0], nil }, nil); err != nil {
+		t.Error(err)
+	}
+	if _, err := EncryptWithParams(buf, nil, nil); err == nil {
+		t.Error("encrypting without recipients succeeded")
+	}
+}
+
+func TestEncryptPadding(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	recipient, err := NewEntity("recipient", "", "recipient@example.org", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewEntity("signer", "", "signer@example.org", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, aead := range []bool{false, true} {
+		encConfig := &packet.Config{
+			PaddingConfig: &packet.PaddingConfig{BucketSizes: []int{1024}},
+		}
+		if aead {
+			encConfig.AEADConfig = &packet.AEADConfig{}
+		}
+		// Messages of different lengths that fall in the same bucket
+		// produce ciphertexts of the same length, give or take the
+		// partial length headers of the encrypted packet.
+		var lengths []int
+		for _, message := range [][]byte{[]byte("hi\n"), bytes.Repeat([]byte("hello world\n"), 40)} {
+			buf := new(bytes.Buffer)
+			w, err := Encrypt(buf, []*Entity{recipient}, signer, nil, encConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(message)
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			lengths = append(lengths, buf.Len())
+
+			md, err := ReadMessage(buf, EntityList{recipient, signer}, nil, nil)
+			if err != nil {
+				t.Fatalf("aead %v: %s", aead, err)
+			}
+			contents, err := ioutil.ReadAll(md.UnverifiedBody)
+			if err != nil {
+				t.Fatalf("aead %v: %s", aead, err)
+			}
+			if !bytes.Equal(contents, message) {
+				t.Errorf("aead %v: got %q, want %q", aead, contents, message)
+			}
+			if md.SignatureError != nil || md.SignedBy == nil || md.SignedBy.Entity != signer {
+				t.Errorf("aead %v: signature not verified: %v", aead, md.SignatureError)
+			}
+		}
+		if diff := lengths[0] - lengths[1]; lengths[0] < 1024 || diff < -8 || diff > 8 {
+			t.Errorf("aead %v: padded ciphertexts have lengths %d and %d", aead, lengths[0], lengths[1])
+		}
+	}
+}
+
+func TestDetachSignMultiple(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	var signers []*Entity
+	for _, name := range []string{"signer1", "signer2"} {
+		e, err := NewEntity(name, "", name+"@example.org", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.PrimaryIdentity().SelfSignature.PreferredHash = []uint8{hashToHashId(crypto.SHA512)}
+		signers = append(signers, e)
+	}
+	message := []byte("hello world\n")
+
+	sigs := new(bytes.Buffer)
+	if err := DetachSignMultiple(sigs, signers, bytes.NewReader(message), nil); err != nil {
+		t.Fatal(err)
+	}
+	packets := packet.NewReader(bytes.NewReader(sigs.Bytes()))
+	for i := range signers {
+		p, err := packets.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, ok := p.(*packet.Signature)
+		if !ok {
+			t.Fatalf("packet %d is a %T", i, p)
+		}
+		if sig.Hash != crypto.SHA512 {
+			t.Errorf("signature %d uses hash %d, want the preferred SHA-512", i, sig.Hash)
+		}
+	}
+	for _, signer := range signers {
+		got, err := CheckDetachedSignature(EntityList{signer}, bytes.NewReader(message), bytes.NewReader(sigs.Bytes()), nil)
+		if err != nil || got != signer {
+			t.Errorf("%s: signature not verified: %v", signer.PrimaryIdentity().Name, err)
+		}
+	}
+
+	// Signers without a common preference get the configured hash.
+	signers[1].PrimaryIdentity().SelfSignature.PreferredHash = []uint8{hashToHashId(crypto.SHA384)}
+	sigs.Reset()
+	if err := DetachSignMultiple(sigs, signers, bytes.NewReader(message), nil); err != nil {
+		t.Fatal(err)
+	}
+	p, err := packet.Read(sigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig := p.(*packet.Signature); sig.Hash != crypto.SHA256 {
+		t.Errorf("signature uses hash %d, want the default SHA-256", sig.Hash)
+	}
+}
+
+func TestSignatureOfSignature(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	alice, err := NewEntity("alice", "", "alice@example.org", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notary, err := NewEntity("notary", "", "notary@example.org", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := EntityList{alice, notary}
+
+	var buf bytes.Buffer
+	if err := SignStandalone(&buf, alice, nil); err != nil {
+		t.Fatal(err)
+	}
+	signer, target, err := CheckStandaloneSignature(keyring, bytes.NewReader(buf.Bytes()), nil)
+	if err != nil || signer != alice {
+		t.Fatalf("standalone signature not verified: %v", err)
+	}
+
+	buf.Reset()
+	if err := SignTimestamp(&buf, notary, target, nil); err != nil {
+		t.Fatal(err)
+	}
+	signer, timestamp, err := CheckTimestampSignature(keyring, bytes.NewReader(buf.Bytes()), target, nil)
+	if err != nil || signer != notary {
+		t.Fatalf("timestamp signature not verified: %v", err)
+	}
+	if timestamp.SigType != packet.SigTypeTimestamp || timestamp.SignatureTarget == nil {
+		t.Error("timestamp signature does not identify its target")
+	}
+	if _, _, err := CheckTimestampSignature(keyring, bytes.NewReader(buf.Bytes()), timestamp, nil); err == nil {
+		t.Error("timestamp signature verified for the wrong target")
+	}
+	if _, _, err := CheckTimestampSignature(EntityList{alice}, bytes.NewReader(buf.Bytes()), target, nil); err != errors.ErrUnknownIssuer {
+		t.Errorf("got %v for an unknown notary, want ErrUnknownIssuer", err)
+	}
+
+	buf.Reset()
+	if err := ConfirmSignature(&buf, notary, target, nil); err != nil {
+		t.Fatal(err)
+	}
+	if signer, _, err := CheckThirdPartyConfirmation(keyring, bytes.NewReader(buf.Bytes()), target, nil); err != nil || signer != notary {
+		t.Errorf("third-party confirmation not verified: %v", err)
+	}
+}
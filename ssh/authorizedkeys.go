@@ -0,0 +1,512 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Extensions set in Permissions by AuthorizedKeysChecker for the options of
+// authorized_keys files that have no certificate equivalent.
+const (
+	// AuthorizedKeysExtensionPermitOpen holds the comma-separated
+	// "host:port" destinations of the permitopen options, to which
+	// local port forwarding is limited.
+	AuthorizedKeysExtensionPermitOpen = "permitopen"
+
+	// AuthorizedKeysExtensionPermitListen holds the comma-separated
+	// "[host:]port" addresses of the permitlisten options, on which
+	// remote port forwarding is limited.
+	AuthorizedKeysExtensionPermitListen = "permitlisten"
+
+	// AuthorizedKeysExtensionEnvironmentPrefix is followed by the name
+	// of each environment variable set by the environment options, and
+	// maps to its value.
+	AuthorizedKeysExtensionEnvironmentPrefix = "environment:"
+)
+
+// permitExtensions are the extensions that the restrict option and the
+// no-* options remove.
+var permitExtensions = []string{
+	CertExtensionPermitX11Forwarding,
+	CertExtensionPermitAgentForwarding,
+	CertExtensionPermitPortForwarding,
+	CertExtensionPermitPTY,
+	CertExtensionPermitUserRC,
+}
+
+// authorizedKey is an entry of an authorized_keys file.
+type authorizedKey struct {
+	key           PublicKey
+	certAuthority bool
+	principals    []string
+	from          []string
+	expiry        time.Time
+
+	command    string
+	hasCommand bool
+
+	// denied holds the permitExtensions removed by the options.
+	denied          map[string]bool
+	environment     map[string]string
+	permitOpen      []string
+	permitListen    []string
+	noTouchRequired bool
+	verifyRequired  bool
+}
+
+// AuthorizedKeysChecker authenticates users with the keys of an
+// authorized_keys file, enforcing their options like sshd(8) does. Its
+// Authenticate method can be used as ServerConfig.PublicKeyCallback.
+//
+// The from, expiry-time and principals options are enforced by
+// Authenticate, which only accepts certificates for the keys with the
+// cert-authority option. The other options are returned in Permissions,
+// using the critical options and extensions of certificates where they
+// exist: command sets "force-command", and the no-* and restrict options
+// remove the permit-* extensions, which are all set otherwise. The server
+// enforces "verify-required", see Permissions; the server application
+// must honour the rest.
+type AuthorizedKeysChecker struct {
+	// Clock is used to check expiry-time options and certificates. If
+	// nil, time.Now is used.
+	Clock func() time.Time
+
+	// LookupAddr, if set, returns the host names of the IP address of
+	// the client, which are matched against the host name patterns of
+	// from options. As the owner of an address controls its reverse DNS,
+	// a name is only used if LookupHost returns the address of the client
+	// for it. If LookupAddr is nil, only the IP address is matched, like
+	// when the UseDNS option of sshd is disabled.
+	LookupAddr func(addr string) (names []string, err error)
+
+	// LookupHost returns the addresses of a host name returned by
+	// LookupAddr. If nil, net.LookupHost is used.
+	LookupHost func(host string) (addrs []string, err error)
+
+	keys []authorizedKey
+}
+
+// NewAuthorizedKeysChecker returns an AuthorizedKeysChecker for the keys of
+// an authorized_keys file. Unlike sshd, it returns an error for the lines
+// it cannot parse, including the ones with unsupported options.
+func NewAuthorizedKeysChecker(authorizedKeys []byte) (*AuthorizedKeysChecker, error) {
+	c := new(AuthorizedKeysChecker)
+	for i, line := range bytes.Split(authorizedKeys, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		key, _, options, _, err := ParseAuthorizedKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("ssh: authorized_keys line %d: %v", i+1, err)
+		}
+		entry, err := parseAuthorizedKeyOptions(key, options)
+		if err != nil {
+			return nil, fmt.Errorf("ssh: authorized_keys line %d: %v", i+1, err)
+		}
+		c.keys = append(c.keys, *entry)
+	}
+	return c, nil
+}
+
+// unquoteOption returns the value of an option, which must be quoted and
+// in which only double quotes can be escaped.
+func unquoteOption(name, value string) (string, error) {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return "", fmt.Errorf("option %q must have a quoted value", name)
+	}
+	return strings.Replace(value[1:len(value)-1], `\"`, `"`, -1), nil
+}
+
+func parseAuthorizedKeyOptions(key PublicKey, options []string) (*authorizedKey, error) {
+	entry := &authorizedKey{
+		key:         key,
+		denied:      make(map[string]bool),
+		environment: make(map[string]string),
+	}
+	for _, opt := range options {
+		name, value, hasValue := opt, "", false
+		if i := strings.IndexByte(opt, '='); i >= 0 {
+			var err error
+			name, hasValue = opt[:i], true
+			if value, err = unquoteOption(name, opt[i+1:]); err != nil {
+				return nil, err
+			}
+		}
+		name = strings.ToLower(name)
+
+		switch name {
+		case "cert-authority", "restrict", "no-agent-forwarding", "no-port-forwarding", "no-pty",
+			"no-user-rc", "no-x11-forwarding", "agent-forwarding", "port-forwarding", "pty",
+			"user-rc", "x11-forwarding", "no-touch-required", "verify-required":
+			if hasValue {
+				return nil, fmt.Errorf("option %q does not take a value", name)
+			}
+		case "command", "environment", "expiry-time", "from", "principals", "permitopen", "permitlisten":
+			if !hasValue {
+				return nil, fmt.Errorf("option %q requires a value", name)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported option %q", name)
+		}
+
+		switch name {
+		case "cert-authority":
+			entry.certAuthority = true
+		case "restrict":
+			for _, ext := range permitExtensions {
+				entry.denied[ext] = true
+			}
+		case "no-agent-forwarding":
+			entry.denied[CertExtensionPermitAgentForwarding] = true
+		case "no-port-forwarding":
+			entry.denied[CertExtensionPermitPortForwarding] = true
+		case "no-pty":
+			entry.denied[CertExtensionPermitPTY] = true
+		case "no-user-rc":
+			entry.denied[CertExtensionPermitUserRC] = true
+		case "no-x11-forwarding":
+			entry.denied[CertExtensionPermitX11Forwarding] = true
+		case "agent-forwarding":
+			delete(entry.denied, CertExtensionPermitAgentForwarding)
+		case "port-forwarding":
+			delete(entry.denied, CertExtensionPermitPortForwarding)
+		case "pty":
+			delete(entry.denied, CertExtensionPermitPTY)
+		case "user-rc":
+			delete(entry.denied, CertExtensionPermitUserRC)
+		case "x11-forwarding":
+			delete(entry.denied, CertExtensionPermitX11Forwarding)
+		case "no-touch-required":
+			entry.noTouchRequired = true
+		case "verify-required":
+			entry.verifyRequired = true
+		case "command":
+			if entry.hasCommand {
+				return nil, errors.New("duplicate command option")
+			}
+			entry.command, entry.hasCommand = value, true
+		case "environment":
+			i := strings.IndexByte(value, '=')
+			if i <= 0 {
+				return nil, fmt.Errorf("invalid environment %q", value)
+			}
+			// Like sshd, the first value of a variable wins.
+			if _, ok := entry.environment[value[:i]]; !ok {
+				entry.environment[value[:i]] = value[i+1:]
+			}
+		case "expiry-time":
+			if !entry.expiry.IsZero() {
+				return nil, errors.New("duplicate expiry-time option")
+			}
+			t, err := parseExpiryTime(value)
+			if err != nil {
+				return nil, err
+			}
+			entry.expiry = t
+		case "from":
+			if entry.from != nil {
+				return nil, errors.New("duplicate from option")
+			}
+			entry.from = strings.Split(value, ",")
+			for _, p := range entry.from {
+				if strings.Contains(p, "/") {
+					if _, _, err := net.ParseCIDR(strings.TrimPrefix(p, "!")); err != nil {
+						return nil, fmt.Errorf("invalid from pattern %q", p)
+					}
+				}
+			}
+		case "principals":
+			if entry.principals != nil {
+				return nil, errors.New("duplicate principals option")
+			}
+			entry.principals = strings.Split(value, ",")
+		case "permitopen":
+			if _, port, err := net.SplitHostPort(value); err != nil || !validForwardPort(port) {
+				return nil, fmt.Errorf("invalid permitopen %q", value)
+			}
+			entry.permitOpen = append(entry.permitOpen, value)
+		case "permitlisten":
+			port := value
+			if strings.Contains(value, ":") {
+				var err error
+				if _, port, err = net.SplitHostPort(value); err != nil {
+					return nil, fmt.Errorf("invalid permitlisten %q", value)
+				}
+			}
+			if !validForwardPort(port) {
+				return nil, fmt.Errorf("invalid permitlisten %q", value)
+			}
+			entry.permitListen = append(entry.permitListen, value)
+		}
+	}
+	if entry.principals != nil && !entry.certAuthority {
+		return nil, errors.New("principals option requires cert-authority")
+	}
+	return entry, nil
+}
+
+// validForwardPort reports whether port is a port number or "*".
+func validForwardPort(port string) bool {
+	if port == "*" {
+		return true
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	return err == nil && n > 0
+}
+
+// parseExpiryTime parses a time in the YYYYMMDD[HHMM[SS]] format of sshd. It
+// is in the local time zone, unless it has a "Z" suffix.
+func parseExpiryTime(s string) (time.Time, error) {
+	loc := time.Local
+	if strings.HasSuffix(s, "Z") {
+		s, loc = s[:len(s)-1], time.UTC
+	}
+	var layout string
+	switch len(s) {
+	case 8:
+		layout = "20060102"
+	case 12:
+		layout = "200601021504"
+	case 14:
+		layout = "20060102150405"
+	default:
+		return time.Time{}, fmt.Errorf("invalid expiry-time %q", s)
+	}
+	t, err := time.ParseInLocation(layout, s, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry-time %q", s)
+	}
+	return t, nil
+}
+
+// matchWildcard reports whether s matches pattern, in which '*' matches any
+// sequence of characters and '?' matches any single character.
+func matchWildcard(pattern, s string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == '*' {
+			for i := len(s); i >= 0; i-- {
+				if matchWildcard(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(s) == 0 || (pattern[0] != '?' && pattern[0] != s[0]) {
+			return false
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+// matchFrom reports whether the client at addr matches the patterns of a
+// from option. IP addresses and CIDR ranges are matched like the
+// source-address critical option, and the other patterns are matched
+// against the IP address and host names of the client. A match of a
+// pattern prefixed with '!' rejects the client.
+func (c *AuthorizedKeysChecker) matchFrom(patterns []string, addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	ip := tcpAddr.IP.String()
+	var names []string
+	lookedUp := false
+
+	found := false
+	for _, p := range patterns {
+		negated := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+
+		var matched bool
+		if net.ParseIP(p) != nil || strings.Contains(p, "/") {
+			matched = checkSourceAddress(addr, p) == nil
+		} else {
+			p = strings.ToLower(p)
+			matched = matchWildcard(p, ip)
+			if !matched && c.LookupAddr != nil {
+				if !lookedUp {
+					names = c.verifiedNames(tcpAddr.IP)
+					lookedUp = true
+				}
+				for _, name := range names {
+					if matchWildcard(p, strings.ToLower(strings.TrimSuffix(name, "."))) {
+						matched = true
+						break
+					}
+				}
+			}
+		}
+		if matched && negated {
+			return false
+		}
+		found = found || matched
+	}
+	return found
+}
+
+// verifiedNames returns the host names of ip whose addresses include ip.
+func (c *AuthorizedKeysChecker) verifiedNames(ip net.IP) []string {
+	lookupHost := c.LookupHost
+	if lookupHost == nil {
+		lookupHost = net.LookupHost
+	}
+	names, _ := c.LookupAddr(ip.String())
+	var verified []string
+	for _, name := range names {
+		addrs, err := lookupHost(name)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ip.Equal(net.ParseIP(addr)) {
+				verified = append(verified, name)
+				break
+			}
+		}
+	}
+	return verified
+}
+
+// errKeyMismatch is returned by check for the entries that are not about
+// the key being authenticated.
+var errKeyMismatch = errors.New("ssh: key mismatch")
+
+// Authenticate checks that pubKey, which may be a certificate, is
+// authorized for the user of conn, and returns the Permissions given by the
+// options of its entry. It can be used as ServerConfig.PublicKeyCallback.
+func (c *AuthorizedKeysChecker) Authenticate(conn ConnMetadata, pubKey PublicKey) (*Permissions, error) {
+	clock := c.Clock
+	if clock == nil {
+		clock = time.Now
+	}
+	now := clock()
+
+	var firstErr error
+	for i := range c.keys {
+		perms, err := c.check(&c.keys[i], conn, pubKey, now)
+		if err == nil {
+			return perms, nil
+		}
+		if err != errKeyMismatch && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return nil, fmt.Errorf("ssh: %s key %s is not authorized", pubKey.Type(), FingerprintSHA256(pubKey))
+}
+
+func (c *AuthorizedKeysChecker) check(entry *authorizedKey, conn ConnMetadata, pubKey PublicKey, now time.Time) (*Permissions, error) {
+	cert, isCert := pubKey.(*Certificate)
+	if isCert {
+		if !entry.certAuthority || !bytes.Equal(cert.SignatureKey.Marshal(), entry.key.Marshal()) {
+			return nil, errKeyMismatch
+		}
+	} else if entry.certAuthority || !bytes.Equal(pubKey.Marshal(), entry.key.Marshal()) {
+		return nil, errKeyMismatch
+	}
+
+	if !entry.expiry.IsZero() && now.After(entry.expiry) {
+		return nil, errors.New("ssh: authorized key has expired")
+	}
+	if entry.from != nil && !c.matchFrom(entry.from, conn.RemoteAddr()) {
+		return nil, fmt.Errorf("ssh: remote address %v is not allowed by from option", conn.RemoteAddr())
+	}
+
+	perms := &Permissions{
+		CriticalOptions: make(map[string]string),
+		Extensions:      make(map[string]string),
+	}
+	if isCert {
+		if err := checkAuthorizedCert(entry, conn.User(), cert, now); err != nil {
+			return nil, err
+		}
+		for name, value := range cert.CriticalOptions {
+			perms.CriticalOptions[name] = value
+		}
+		for name, value := range cert.Extensions {
+			if name == AuthorizedKeysExtensionPermitOpen || name == AuthorizedKeysExtensionPermitListen ||
+				strings.HasPrefix(name, AuthorizedKeysExtensionEnvironmentPrefix) {
+				continue
+			}
+			perms.Extensions[name] = value
+		}
+		// Touch is only optional if both the certificate and the
+		// key allow it.
+		if !entry.noTouchRequired {
+			delete(perms.Extensions, CertExtensionNoTouchRequired)
+		}
+	} else {
+		for _, ext := range permitExtensions {
+			perms.Extensions[ext] = ""
+		}
+		if entry.noTouchRequired {
+			perms.Extensions[CertExtensionNoTouchRequired] = ""
+		}
+	}
+
+	for ext := range entry.denied {
+		delete(perms.Extensions, ext)
+	}
+	if entry.hasCommand {
+		if command, ok := perms.CriticalOptions[CertCriticalOptionForceCommand]; ok && command != entry.command {
+			return nil, errors.New("ssh: certificate and authorized_keys force different commands")
+		}
+		perms.CriticalOptions[CertCriticalOptionForceCommand] = entry.command
+	}
+	if entry.verifyRequired {
+		perms.CriticalOptions[CertCriticalOptionVerifyRequired] = ""
+	}
+	if len(entry.permitOpen) > 0 {
+		perms.Extensions[AuthorizedKeysExtensionPermitOpen] = strings.Join(entry.permitOpen, ",")
+	}
+	if len(entry.permitListen) > 0 {
+		perms.Extensions[AuthorizedKeysExtensionPermitListen] = strings.Join(entry.permitListen, ",")
+	}
+	for name, value := range entry.environment {
+		perms.Extensions[AuthorizedKeysExtensionEnvironmentPrefix+name] = value
+	}
+	return perms, nil
+}
+
+// checkAuthorizedCert checks a certificate signed by the certificate
+// authority of entry. Without principals option, the certificate must be
+// valid for user; with it, one of its principals must be listed.
+func checkAuthorizedCert(entry *authorizedKey, user string, cert *Certificate, now time.Time) error {
+	if cert.CertType != UserCert {
+		return fmt.Errorf("ssh: cert has type %d", cert.CertType)
+	}
+	if len(cert.ValidPrincipals) == 0 {
+		return errors.New("ssh: certificate has no principals")
+	}
+	principal := user
+	if entry.principals != nil {
+		principal = ""
+		for _, p := range cert.ValidPrincipals {
+			if contains(entry.principals, p) {
+				principal = p
+				break
+			}
+		}
+		if principal == "" {
+			return fmt.Errorf("ssh: none of the certificate principals %q are allowed by the principals option", cert.ValidPrincipals)
+		}
+	}
+	checker := &CertChecker{
+		Clock:                          func() time.Time { return now },
+		SupportStandardCriticalOptions: true,
+	}
+	return checker.CheckCert(principal, cert)
+}
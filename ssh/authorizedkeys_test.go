@@ -0,0 +1,308 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"crypto/rand"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// authConnMetadata is the ConnMetadata of a user connecting from an
+// address.
+type authConnMetadata struct {
+	user string
+	addr net.Addr
+}
+
+func (c *authConnMetadata) User() string          { return c.user }
+func (c *authConnMetadata) SessionID() []byte     { return nil }
+func (c *authConnMetadata) ClientVersion() []byte { return nil }
+func (c *authConnMetadata) ServerVersion() []byte { return nil }
+func (c *authConnMetadata) RemoteAddr() net.Addr  { return c.addr }
+func (c *authConnMetadata) LocalAddr() net.Addr   { return nil }
+
+func connFrom(user, ip string) ConnMetadata {
+	return &authConnMetadata{user, &net.TCPAddr{IP: net.ParseIP(ip), Port: 22}}
+}
+
+func authorizedKeysLine(options string, key PublicKey) string {
+	line := string(MarshalAuthorizedKey(key))
+	if options != "" {
+		line = options + " " + line
+	}
+	return line
+}
+
+func TestAuthorizedKeysChecker(t *testing.T) {
+	authorizedKeys := "# Comment.\n\n" +
+		authorizedKeysLine(`no-pty,command="echo \"hi\"",environment="LANG=C",environment="LANG=fr",`+
+			`permitopen="localhost:80",permitopen="[::1]:*",permitlisten="8080",`+
+			`from="192.0.2.*,198.51.100.0/24,!192.0.2.66"`, testPublicKeys["rsa"]) +
+		authorizedKeysLine(`restrict,pty,expiry-time="20300101Z"`, testPublicKeys["ecdsa"]) +
+		authorizedKeysLine("", testPublicKeys["dsa"])
+	checker, err := NewAuthorizedKeysChecker([]byte(authorizedKeys))
+	if err != nil {
+		t.Fatalf("NewAuthorizedKeysChecker: %v", err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	checker.Clock = func() time.Time { return now }
+
+	allPermits := map[string]string{
+		CertExtensionPermitX11Forwarding:   "",
+		CertExtensionPermitAgentForwarding: "",
+		CertExtensionPermitPortForwarding:  "",
+		CertExtensionPermitPTY:             "",
+		CertExtensionPermitUserRC:          "",
+	}
+
+	optionPerms := &Permissions{
+		CriticalOptions: map[string]string{
+			CertCriticalOptionForceCommand: `echo "hi"`,
+		},
+		Extensions: map[string]string{
+			CertExtensionPermitX11Forwarding:    "",
+			CertExtensionPermitAgentForwarding:  "",
+			CertExtensionPermitPortForwarding:   "",
+			CertExtensionPermitUserRC:           "",
+			AuthorizedKeysExtensionPermitOpen:   "localhost:80,[::1]:*",
+			AuthorizedKeysExtensionPermitListen: "8080",
+			"environment:LANG":                  "C",
+		},
+	}
+
+	for _, tc := range []struct {
+		desc string
+		key  PublicKey
+		from string
+		want *Permissions
+	}{
+		{desc: "options", key: testPublicKeys["rsa"], from: "192.0.2.1", want: optionPerms},
+		{desc: "from CIDR", key: testPublicKeys["rsa"], from: "198.51.100.7", want: optionPerms},
+		{desc: "from negated", key: testPublicKeys["rsa"], from: "192.0.2.66"},
+		{desc: "from other address", key: testPublicKeys["rsa"], from: "203.0.113.1"},
+		{
+			desc: "restrict",
+			key:  testPublicKeys["ecdsa"],
+			from: "203.0.113.1",
+			want: &Permissions{
+				CriticalOptions: map[string]string{},
+				Extensions:      map[string]string{CertExtensionPermitPTY: ""},
+			},
+		},
+		{
+			desc: "no options",
+			key:  testPublicKeys["dsa"],
+			from: "203.0.113.1",
+			want: &Permissions{
+				CriticalOptions: map[string]string{},
+				Extensions:      allPermits,
+			},
+		},
+		{desc: "unknown key", key: testPublicKeys["ed25519"], from: "192.0.2.1"},
+	} {
+		perms, err := checker.Authenticate(connFrom("user", tc.from), tc.key)
+		if tc.want == nil {
+			if err == nil {
+				t.Errorf("%s: Authenticate succeeded", tc.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Authenticate: %v", tc.desc, err)
+			continue
+		}
+		if !reflect.DeepEqual(perms, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.desc, perms, tc.want)
+		}
+	}
+
+	now = time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	if _, err := checker.Authenticate(connFrom("user", "192.0.2.1"), testPublicKeys["ecdsa"]); err == nil {
+		t.Error("Authenticate succeeded for an expired key")
+	}
+}
+
+func TestAuthorizedKeysCheckerFromHostname(t *testing.T) {
+	checker, err := NewAuthorizedKeysChecker([]byte(authorizedKeysLine(`from="*.example.com,!bad.example.com"`, testPublicKeys["rsa"])))
+	if err != nil {
+		t.Fatalf("NewAuthorizedKeysChecker: %v", err)
+	}
+	conn := connFrom("user", "192.0.2.1")
+	if _, err := checker.Authenticate(conn, testPublicKeys["rsa"]); err == nil {
+		t.Error("Authenticate matched a host name without LookupAddr")
+	}
+
+	for _, tc := range []struct {
+		name  string
+		addrs []string
+		ok    bool
+	}{
+		{"Host.Example.COM.", []string{"2001:db8::1", "192.0.2.1"}, true},
+		{"bad.example.com.", []string{"192.0.2.1"}, false},
+		{"host.example.org.", []string{"192.0.2.1"}, false},
+		// The owner of 192.0.2.1 claims a name that isn't theirs.
+		{"spoofed.example.com.", []string{"198.51.100.1"}, false},
+		{"gone.example.com.", nil, false},
+	} {
+		checker.LookupAddr = func(addr string) ([]string, error) {
+			if addr != "192.0.2.1" {
+				return nil, errors.New("unknown address")
+			}
+			return []string{tc.name}, nil
+		}
+		checker.LookupHost = func(host string) ([]string, error) {
+			if host != tc.name || tc.addrs == nil {
+				return nil, errors.New("unknown host")
+			}
+			return tc.addrs, nil
+		}
+		_, err := checker.Authenticate(conn, testPublicKeys["rsa"])
+		if tc.ok && err != nil {
+			t.Errorf("%s: Authenticate: %v", tc.name, err)
+		} else if !tc.ok && err == nil {
+			t.Errorf("%s: Authenticate succeeded", tc.name)
+		}
+	}
+}
+
+func TestAuthorizedKeysCheckerCertAuthority(t *testing.T) {
+	ca := testSigners["ed25519"]
+	checker, err := NewAuthorizedKeysChecker([]byte(
+		authorizedKeysLine(`cert-authority,principals="alice,bob",verify-required,command="backup"`, ca.PublicKey())))
+	if err != nil {
+		t.Fatalf("NewAuthorizedKeysChecker: %v", err)
+	}
+
+	newCert := func(authority Signer, principal, command string) *Certificate {
+		b := &CertificateBuilder{
+			CertType:        UserCert,
+			Key:             testPublicKeys["ecdsa"],
+			KeyId:           principal,
+			ValidPrincipals: []string{principal},
+			MaxValidity:     time.Hour,
+			ForceCommand:    command,
+			PermitPTY:       true,
+		}
+		cert, err := b.Sign(rand.Reader, authority)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		return cert
+	}
+
+	perms, err := checker.Authenticate(connFrom("root", "192.0.2.1"), newCert(ca, "bob", ""))
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	want := &Permissions{
+		CriticalOptions: map[string]string{
+			CertCriticalOptionForceCommand:   "backup",
+			CertCriticalOptionVerifyRequired: "",
+		},
+		Extensions: map[string]string{CertExtensionPermitPTY: ""},
+	}
+	if !reflect.DeepEqual(perms, want) {
+		t.Errorf("got %+v, want %+v", perms, want)
+	}
+
+	for _, tc := range []struct {
+		desc string
+		key  PublicKey
+	}{
+		{"principal not allowed", newCert(ca, "carol", "")},
+		{"other authority", newCert(testSigners["rsa"], "bob", "")},
+		{"different command", newCert(ca, "bob", "rm -rf /")},
+		{"plain key of the authority", ca.PublicKey()},
+	} {
+		if _, err := checker.Authenticate(connFrom("root", "192.0.2.1"), tc.key); err == nil {
+			t.Errorf("%s: Authenticate succeeded", tc.desc)
+		}
+	}
+
+	// Without principals option, the certificate must be valid for the
+	// user.
+	checker, err = NewAuthorizedKeysChecker([]byte(authorizedKeysLine("cert-authority", ca.PublicKey())))
+	if err != nil {
+		t.Fatalf("NewAuthorizedKeysChecker: %v", err)
+	}
+	if _, err := checker.Authenticate(connFrom("bob", "192.0.2.1"), newCert(ca, "bob", "")); err != nil {
+		t.Errorf("Authenticate: %v", err)
+	}
+	if _, err := checker.Authenticate(connFrom("root", "192.0.2.1"), newCert(ca, "bob", "")); err == nil {
+		t.Error("Authenticate succeeded for a user not in the certificate")
+	}
+}
+
+func TestNewAuthorizedKeysCheckerErrors(t *testing.T) {
+	for _, options := range []string{
+		"unknown-option",
+		"command=echo",
+		`no-pty="yes"`,
+		"from",
+		`expiry-time="2030"`,
+		`from="192.0.2.0/33"`,
+		`principals="alice"`,
+		`environment="=value"`,
+		`permitopen="localhost"`,
+		`permitopen="localhost:http"`,
+		`permitlisten="0"`,
+		`command="a",command="b"`,
+	} {
+		line := authorizedKeysLine(options, testPublicKeys["rsa"])
+		if _, err := NewAuthorizedKeysChecker([]byte(line)); err == nil {
+			t.Errorf("NewAuthorizedKeysChecker(%q) succeeded", options)
+		} else if !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("NewAuthorizedKeysChecker(%q): error %q has no line number", options, err)
+		}
+	}
+}
+
+func TestAuthorizedKeysCheckerServer(t *testing.T) {
+	checker, err := NewAuthorizedKeysChecker([]byte(authorizedKeysLine(`command="uptime"`, testPublicKeys["rsa"])))
+	if err != nil {
+		t.Fatalf("NewAuthorizedKeysChecker: %v", err)
+	}
+	serverConf := &ServerConfig{
+		PublicKeyCallback: checker.Authenticate,
+	}
+	serverConf.AddHostKey(testSigners["ecdsa"])
+
+	c1, c2, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	type result struct {
+		conn *ServerConn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, _, _, err := NewServerConn(c1, serverConf)
+		done <- result{conn, err}
+	}()
+	_, _, _, err = NewClientConn(c2, "", &ClientConfig{
+		User:            "user",
+		Auth:            []AuthMethod{PublicKeys(testSigners["rsa"])},
+		HostKeyCallback: InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	r := <-done
+	if r.err != nil {
+		t.Fatalf("NewServerConn: %v", r.err)
+	}
+	if command, ok := r.conn.Permissions.ForceCommand(); !ok || command != "uptime" {
+		t.Errorf("ForceCommand() = %q, %v, want %q, true", command, ok, "uptime")
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Standard critical options and extensions of user certificates, as defined
+// in [PROTOCOL.certkeys]. Host certificates have none.
+const (
+	CertCriticalOptionForceCommand   = "force-command"
+	CertCriticalOptionSourceAddress  = "source-address"
+	CertCriticalOptionVerifyRequired = "verify-required"
+
+	CertExtensionNoTouchRequired       = "no-touch-required"
+	CertExtensionPermitX11Forwarding   = "permit-X11-forwarding"
+	CertExtensionPermitAgentForwarding = "permit-agent-forwarding"
+	CertExtensionPermitPortForwarding  = "permit-port-forwarding"
+	CertExtensionPermitPTY             = "permit-pty"
+	CertExtensionPermitUserRC          = "permit-user-rc"
+)
+
+// CertificateBuilder builds and signs certificates. Unlike a Certificate
+// passed to SignCert, it is validated before it is signed, and the
+// standard critical options and extensions are typed fields.
+type CertificateBuilder struct {
+	// CertType is either UserCert or HostCert.
+	CertType uint32
+
+	// Key is the key to certify. It must not be a certificate.
+	Key PublicKey
+
+	// KeyId identifies the certificate, for instance in logs. It must
+	// not be empty.
+	KeyId string
+
+	// Serial is the serial number of the certificate. If zero, a random
+	// serial number is used.
+	Serial uint64
+
+	// ValidPrincipals are the users or host names the certificate is
+	// valid for. It must not be empty, as a certificate without
+	// principals is valid for any user or host.
+	ValidPrincipals []string
+
+	// ValidAfter is the time from which the certificate is valid. If
+	// zero, the current time is used.
+	ValidAfter time.Time
+
+	// ValidBefore is the time at which the certificate expires. If zero,
+	// the certificate expires after MaxValidity, or never if MaxValidity
+	// is zero.
+	ValidBefore time.Time
+
+	// MaxValidity, if positive, is the longest duration the certificate
+	// may be valid for. ValidBefore is clamped to ValidAfter plus
+	// MaxValidity.
+	MaxValidity time.Duration
+
+	// ForceCommand, if set, is the only command that the user may run.
+	ForceCommand string
+
+	// SourceAddresses, if set, are the IP addresses and CIDR ranges the
+	// user may connect from.
+	SourceAddresses []string
+
+	// VerifyRequired requires signatures made with security keys to
+	// verify the user, for instance with a PIN.
+	VerifyRequired bool
+
+	// The standard extensions, which allow features that are disabled
+	// by default. NoTouchRequired allows signatures made with security
+	// keys without touching them.
+	PermitX11Forwarding   bool
+	PermitAgentForwarding bool
+	PermitPortForwarding  bool
+	PermitPTY             bool
+	PermitUserRC          bool
+	NoTouchRequired       bool
+
+	// CriticalOptions and Extensions hold additional, non-standard
+	// critical options and extensions.
+	CriticalOptions map[string]string
+	Extensions      map[string]string
+
+	// Clock is used to default ValidAfter. If nil, time.Now is used.
+	Clock func() time.Time
+}
+
+// Sign validates the certificate described by b, and returns it signed by
+// authority with a random nonce. RSA authorities sign with SHA-512 if they
+// implement AlgorithmSigner.
+func (b *CertificateBuilder) Sign(rand io.Reader, authority Signer) (*Certificate, error) {
+	if b.CertType != UserCert && b.CertType != HostCert {
+		return nil, fmt.Errorf("ssh: invalid certificate type %d", b.CertType)
+	}
+	if b.Key == nil {
+		return nil, errors.New("ssh: certificate has no key")
+	}
+	if _, ok := b.Key.(*Certificate); ok {
+		return nil, errors.New("ssh: cannot certify a certificate")
+	}
+	if b.KeyId == "" {
+		return nil, errors.New("ssh: certificate has no key ID")
+	}
+	if err := checkPrincipals(b.ValidPrincipals); err != nil {
+		return nil, err
+	}
+	validAfter, validBefore, err := b.validity()
+	if err != nil {
+		return nil, err
+	}
+	options, extensions, err := b.options()
+	if err != nil {
+		return nil, err
+	}
+
+	serial := b.Serial
+	for serial == 0 {
+		var buf [8]byte
+		if _, err := io.ReadFull(rand, buf[:]); err != nil {
+			return nil, err
+		}
+		serial = binary.BigEndian.Uint64(buf[:])
+	}
+
+	cert := &Certificate{
+		Key:             b.Key,
+		Serial:          serial,
+		CertType:        b.CertType,
+		KeyId:           b.KeyId,
+		ValidPrincipals: append([]string(nil), b.ValidPrincipals...),
+		ValidAfter:      validAfter,
+		ValidBefore:     validBefore,
+		Permissions: Permissions{
+			CriticalOptions: options,
+			Extensions:      extensions,
+		},
+		Nonce:        make([]byte, 32),
+		SignatureKey: authority.PublicKey(),
+	}
+	if _, err := io.ReadFull(rand, cert.Nonce); err != nil {
+		return nil, err
+	}
+	// SHA-1 signatures of RSA certificates are rejected by OpenSSH.
+	if algSigner, ok := authority.(AlgorithmSigner); ok && authority.PublicKey().Type() == KeyAlgoRSA {
+		cert.Signature, err = algSigner.SignWithAlgorithm(rand, cert.bytesForSigning(), SigAlgoRSASHA2512)
+	} else {
+		cert.Signature, err = authority.Sign(rand, cert.bytesForSigning())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+func checkPrincipals(principals []string) error {
+	if len(principals) == 0 {
+		return errors.New("ssh: certificate has no principals")
+	}
+	seen := make(map[string]bool, len(principals))
+	for _, p := range principals {
+		if p == "" {
+			return errors.New("ssh: certificate has an empty principal")
+		}
+		if seen[p] {
+			return fmt.Errorf("ssh: certificate has duplicate principal %q", p)
+		}
+		seen[p] = true
+	}
+	return nil
+}
+
+// validity returns the validity period of the certificate, in the format
+// of Certificate.
+func (b *CertificateBuilder) validity() (after, before uint64, err error) {
+	clock := b.Clock
+	if clock == nil {
+		clock = time.Now
+	}
+	now := clock()
+
+	validAfter := b.ValidAfter
+	if validAfter.IsZero() {
+		validAfter = now
+	}
+	validBefore := b.ValidBefore
+	if b.MaxValidity > 0 {
+		limit := validAfter.Add(b.MaxValidity)
+		if validBefore.IsZero() || validBefore.After(limit) {
+			validBefore = limit
+		}
+	}
+
+	if validAfter.Unix() > 0 {
+		after = uint64(validAfter.Unix())
+	}
+	if validBefore.IsZero() {
+		return after, CertTimeInfinity, nil
+	}
+	if !validBefore.After(validAfter) {
+		return 0, 0, errors.New("ssh: certificate expires before it is valid")
+	}
+	if !validBefore.After(now) {
+		return 0, 0, errors.New("ssh: certificate is already expired")
+	}
+	return after, uint64(validBefore.Unix()), nil
+}
+
+// options returns the critical options and extensions of the certificate.
+func (b *CertificateBuilder) options() (options, extensions map[string]string, err error) {
+	options = make(map[string]string)
+	extensions = make(map[string]string)
+	if b.ForceCommand != "" {
+		options[CertCriticalOptionForceCommand] = b.ForceCommand
+	}
+	if len(b.SourceAddresses) > 0 {
+		for _, addr := range b.SourceAddresses {
+			if net.ParseIP(addr) != nil {
+				continue
+			}
+			if _, _, err := net.ParseCIDR(addr); err != nil {
+				return nil, nil, fmt.Errorf("ssh: invalid source address %q", addr)
+			}
+		}
+		options[CertCriticalOptionSourceAddress] = strings.Join(b.SourceAddresses, ",")
+	}
+	if b.VerifyRequired {
+		options[CertCriticalOptionVerifyRequired] = ""
+	}
+
+	for name, set := range map[string]bool{
+		CertExtensionPermitX11Forwarding:   b.PermitX11Forwarding,
+		CertExtensionPermitAgentForwarding: b.PermitAgentForwarding,
+		CertExtensionPermitPortForwarding:  b.PermitPortForwarding,
+		CertExtensionPermitPTY:             b.PermitPTY,
+		CertExtensionPermitUserRC:          b.PermitUserRC,
+		CertExtensionNoTouchRequired:       b.NoTouchRequired,
+	} {
+		if set {
+			extensions[name] = ""
+		}
+	}
+
+	for name, value := range b.CriticalOptions {
+		if isStandardCriticalOption(name) {
+			return nil, nil, fmt.Errorf("ssh: critical option %q must be set with its CertificateBuilder field", name)
+		}
+		options[name] = value
+	}
+	for name, value := range b.Extensions {
+		if isStandardExtension(name) {
+			return nil, nil, fmt.Errorf("ssh: extension %q must be set with its CertificateBuilder field", name)
+		}
+		extensions[name] = value
+	}
+
+	if b.CertType == HostCert && (len(options) > 0 || len(extensions) > 0) {
+		return nil, nil, errors.New("ssh: host certificates cannot have critical options or extensions")
+	}
+	return options, extensions, nil
+}
+
+func isStandardCriticalOption(name string) bool {
+	switch name {
+	case CertCriticalOptionForceCommand, CertCriticalOptionSourceAddress, CertCriticalOptionVerifyRequired:
+		return true
+	}
+	return false
+}
+
+func isStandardExtension(name string) bool {
+	switch name {
+	case CertExtensionNoTouchRequired, CertExtensionPermitX11Forwarding, CertExtensionPermitAgentForwarding,
+		CertExtensionPermitPortForwarding, CertExtensionPermitPTY, CertExtensionPermitUserRC:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,286 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestCertificateBuilder(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := &CertificateBuilder{
+		CertType:             UserCert,
+		Key:                  testPublicKeys["ecdsa"],
+		KeyId:                "alice@example.com",
+		ValidPrincipals:      []string{"alice", "admin"},
+		MaxValidity:          time.Hour,
+		ForceCommand:         "/usr/bin/backup",
+		SourceAddresses:      []string{"192.0.2.1", "198.51.100.0/24"},
+		VerifyRequired:       true,
+		PermitPTY:            true,
+		PermitPortForwarding: true,
+		Extensions:           map[string]string{"login@example.com": "alice"},
+		Clock:                func() time.Time { return now },
+	}
+	cert, err := b.Sign(rand.Reader, testSigners["rsa"])
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	if cert.Serial == 0 {
+		t.Error("got serial 0, want a random serial")
+	}
+	if len(cert.Nonce) != 32 {
+		t.Errorf("got a nonce of %d bytes, want 32", len(cert.Nonce))
+	}
+	if cert.Signature.Format != SigAlgoRSASHA2512 {
+		t.Errorf("got signature format %q, want %q", cert.Signature.Format, SigAlgoRSASHA2512)
+	}
+	if cert.ValidAfter != uint64(now.Unix()) || cert.ValidBefore != uint64(now.Add(time.Hour).Unix()) {
+		t.Errorf("got validity %d-%d, want %d-%d", cert.ValidAfter, cert.ValidBefore, now.Unix(), now.Add(time.Hour).Unix())
+	}
+	wantOptions := map[string]string{
+		CertCriticalOptionForceCommand:   "/usr/bin/backup",
+		CertCriticalOptionSourceAddress:  "192.0.2.1,198.51.100.0/24",
+		CertCriticalOptionVerifyRequired: "",
+	}
+	if !reflect.DeepEqual(cert.CriticalOptions, wantOptions) {
+		t.Errorf("got critical options %v, want %v", cert.CriticalOptions, wantOptions)
+	}
+	wantExtensions := map[string]string{
+		CertExtensionPermitPTY:            "",
+		CertExtensionPermitPortForwarding: "",
+		"login@example.com":               "alice",
+	}
+	if !reflect.DeepEqual(cert.Extensions, wantExtensions) {
+		t.Errorf("got extensions %v, want %v", cert.Extensions, wantExtensions)
+	}
+
+	// The certificate survives a round trip through the wire format.
+	parsed, err := ParsePublicKey(cert.Marshal())
+	if err != nil {
+		t.Fatalf("ParsePublicKey: %v", err)
+	}
+	checker := &CertChecker{
+		Clock: func() time.Time { return now.Add(time.Minute) },
+	}
+	if err := checker.CheckCert("alice", parsed.(*Certificate)); err == nil {
+		t.Error("CheckCert accepted force-command and verify-required without SupportStandardCriticalOptions")
+	}
+	checker.SupportStandardCriticalOptions = true
+	if err := checker.CheckCert("alice", parsed.(*Certificate)); err != nil {
+		t.Errorf("CheckCert: %v", err)
+	}
+	if err := checker.CheckCert("bob", parsed.(*Certificate)); err == nil {
+		t.Error("CheckCert accepted a principal not in the certificate")
+	}
+
+	command, ok := cert.Permissions.ForceCommand()
+	if !ok || command != "/usr/bin/backup" {
+		t.Errorf("ForceCommand() = %q, %v, want %q, true", command, ok, "/usr/bin/backup")
+	}
+}
+
+func TestCertificateBuilderValidity(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	for _, tc := range []struct {
+		desc        string
+		validAfter  time.Time
+		validBefore time.Time
+		maxValidity time.Duration
+		wantAfter   uint64
+		wantBefore  uint64
+	}{
+		{"default", time.Time{}, time.Time{}, 0, uint64(now.Unix()), CertTimeInfinity},
+		{"explicit", now.Add(-time.Hour), now.Add(time.Hour), 0, uint64(now.Add(-time.Hour).Unix()), uint64(now.Add(time.Hour).Unix())},
+		{"clamped", now, now.Add(48 * time.Hour), 24 * time.Hour, uint64(now.Unix()), uint64(now.Add(24 * time.Hour).Unix())},
+		{"not clamped", now, now.Add(time.Hour), 24 * time.Hour, uint64(now.Unix()), uint64(now.Add(time.Hour).Unix())},
+		{"before epoch", time.Unix(-100, 0), time.Time{}, 0, 0, CertTimeInfinity},
+	} {
+		b := &CertificateBuilder{
+			CertType:        HostCert,
+			Key:             testPublicKeys["ecdsa"],
+			KeyId:           "host",
+			ValidPrincipals: []string{"host.example.com"},
+			ValidAfter:      tc.validAfter,
+			ValidBefore:     tc.validBefore,
+			MaxValidity:     tc.maxValidity,
+			Clock:           func() time.Time { return now },
+		}
+		cert, err := b.Sign(rand.Reader, testSigners["ed25519"])
+		if err != nil {
+			t.Errorf("%s: Sign: %v", tc.desc, err)
+			continue
+		}
+		if cert.ValidAfter != tc.wantAfter || cert.ValidBefore != tc.wantBefore {
+			t.Errorf("%s: got validity %d-%d, want %d-%d", tc.desc, cert.ValidAfter, cert.ValidBefore, tc.wantAfter, tc.wantBefore)
+		}
+	}
+}
+
+func TestCertificateBuilderErrors(t *testing.T) {
+	now := time.Now()
+	valid := func() *CertificateBuilder {
+		return &CertificateBuilder{
+			CertType:        UserCert,
+			Key:             testPublicKeys["ecdsa"],
+			KeyId:           "alice",
+			ValidPrincipals: []string{"alice"},
+		}
+	}
+	if _, err := valid().Sign(rand.Reader, testSigners["ed25519"]); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	for _, tc := range []struct {
+		desc   string
+		modify func(b *CertificateBuilder)
+	}{
+		{"invalid type", func(b *CertificateBuilder) { b.CertType = 3 }},
+		{"no key", func(b *CertificateBuilder) { b.Key = nil }},
+		{"certificate key", func(b *CertificateBuilder) { b.Key = testSigners["cert"].PublicKey() }},
+		{"no key ID", func(b *CertificateBuilder) { b.KeyId = "" }},
+		{"no principals", func(b *CertificateBuilder) { b.ValidPrincipals = nil }},
+		{"empty principal", func(b *CertificateBuilder) { b.ValidPrincipals = []string{"alice", ""} }},
+		{"duplicate principal", func(b *CertificateBuilder) { b.ValidPrincipals = []string{"alice", "alice"} }},
+		{"empty validity", func(b *CertificateBuilder) { b.ValidAfter, b.ValidBefore = now, now }},
+		{"expired", func(b *CertificateBuilder) { b.ValidAfter, b.ValidBefore = now.Add(-2*time.Hour), now.Add(-time.Hour) }},
+		{"invalid source address", func(b *CertificateBuilder) { b.SourceAddresses = []string{"example.com"} }},
+		{"standard option in map", func(b *CertificateBuilder) {
+			b.CriticalOptions = map[string]string{CertCriticalOptionForceCommand: "true"}
+		}},
+		{"standard extension in map", func(b *CertificateBuilder) {
+			b.Extensions = map[string]string{CertExtensionPermitPTY: ""}
+		}},
+		{"host certificate with options", func(b *CertificateBuilder) {
+			b.CertType = HostCert
+			b.PermitPTY = true
+		}},
+	} {
+		b := valid()
+		tc.modify(b)
+		if _, err := b.Sign(rand.Reader, testSigners["ed25519"]); err == nil {
+			t.Errorf("%s: Sign succeeded", tc.desc)
+		}
+	}
+}
+
+// skEd25519Signer signs like a security key holding an Ed25519 key, with
+// the given flags.
+type skEd25519Signer struct {
+	priv  ed25519.PrivateKey
+	flags byte
+}
+
+func (s *skEd25519Signer) PublicKey() PublicKey {
+	return &skEd25519PublicKey{
+		application: "ssh:",
+		PublicKey:   s.priv.Public().(ed25519.PublicKey),
+	}
+}
+
+func (s *skEd25519Signer) Sign(rand io.Reader, data []byte) (*Signature, error) {
+	appDigest := sha256.Sum256([]byte("ssh:"))
+	dataDigest := sha256.Sum256(data)
+	skf := skFields{Flags: s.flags, Counter: 1}
+	blob := Marshal(struct {
+		ApplicationDigest []byte `ssh:"rest"`
+		Flags             byte
+		Counter           uint32
+		MessageDigest     []byte `ssh:"rest"`
+	}{appDigest[:], skf.Flags, skf.Counter, dataDigest[:]})
+	return &Signature{
+		Format: KeyAlgoSKED25519,
+		Blob:   ed25519.Sign(s.priv, blob),
+		Rest:   Marshal(&skf),
+	}, nil
+}
+
+func TestVerifyRequired(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const userPresent = 0x01
+
+	for _, tc := range []struct {
+		desc   string
+		signer Signer
+		ok     bool
+	}{
+		{"user verified", &skEd25519Signer{priv, userPresent | skFlagUserVerified}, true},
+		{"user not verified", &skEd25519Signer{priv, userPresent}, false},
+		{"not a security key", testSigners["ed25519"], false},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			caSigner := testSigners["ecdsa"]
+			checker := &CertChecker{
+				IsUserAuthority: func(auth PublicKey) bool {
+					return reflect.DeepEqual(auth.Marshal(), caSigner.PublicKey().Marshal())
+				},
+				SupportStandardCriticalOptions: true,
+			}
+			serverConf := &ServerConfig{
+				PublicKeyCallback: checker.Authenticate,
+			}
+			serverConf.AddHostKey(testSigners["rsa"])
+
+			b := &CertificateBuilder{
+				CertType:        UserCert,
+				Key:             tc.signer.PublicKey(),
+				KeyId:           "testuser",
+				ValidPrincipals: []string{"testuser"},
+				VerifyRequired:  true,
+			}
+			cert, err := b.Sign(rand.Reader, caSigner)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			certSigner, err := NewCertSigner(cert, tc.signer)
+			if err != nil {
+				t.Fatalf("NewCertSigner: %v", err)
+			}
+
+			c1, c2, err := netPipe()
+			if err != nil {
+				t.Fatalf("netPipe: %v", err)
+			}
+			defer c1.Close()
+			defer c2.Close()
+
+			serverErr := make(chan error, 1)
+			go func() {
+				_, _, _, err := NewServerConn(c1, serverConf)
+				serverErr <- err
+			}()
+			_, _, _, err = NewClientConn(c2, "", &ClientConfig{
+				User:            "testuser",
+				Auth:            []AuthMethod{PublicKeys(certSigner)},
+				HostKeyCallback: InsecureIgnoreHostKey(),
+			})
+			if tc.ok && err != nil {
+				t.Fatalf("NewClientConn: %v", err)
+			}
+			if !tc.ok {
+				if err == nil {
+					t.Fatal("NewClientConn succeeded")
+				}
+				var authErr *ServerAuthError
+				if err := <-serverErr; !errors.As(err, &authErr) || !strings.Contains(authErr.Error(), "verif") {
+					t.Errorf("got server error %v, want a verify-required error", err)
+				}
+			}
+		})
+	}
+}
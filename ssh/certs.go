@@ -25,6 +25,13 @@ const (
 	CertAlgoSKECDSA256v01 = "sk-ecdsa-sha2-nistp256-cert-v01@openssh.com"
 	CertAlgoED25519v01    = "ssh-ed25519-cert-v01@openssh.com"
 	CertAlgoSKED25519v01  = "sk-ssh-ed25519-cert-v01@openssh.com"
+
+	// CertAlgoRSASHA256v01 and CertAlgoRSASHA512v01 can't appear as a
+	// Certificate.Type (or PublicKey.Type), but only in
+	// ClientConfig.HostKeyAlgorithms and in the negotiation of user
+	// authentication. The corresponding Certificate.Type is CertAlgoRSAv01.
+	CertAlgoRSASHA256v01 = "rsa-sha2-256-cert-v01@openssh.com"
+	CertAlgoRSASHA512v01 = "rsa-sha2-512-cert-v01@openssh.com"
 )
 
 // Certificate types distinguish between host and user
@@ -270,6 +277,14 @@ type CertChecker struct {
 	// for user certificates.
 	SupportedCriticalOptions []string
 
+	// SupportStandardCriticalOptions adds the "force-command" and
+	// "verify-required" critical options to SupportedCriticalOptions.
+	// The server enforces "verify-required" during user
+	// authentication. "force-command" is returned in Permissions, see
+	// Permissions.ForceCommand, and the server application must run
+	// that command instead of the ones requested by the client.
+	SupportStandardCriticalOptions bool
+
 	// IsUserAuthority should return true if the key is recognized as an
 	// authority for the given user certificate. This allows for
 	// certificates to be signed by other certificates. This must be set
@@ -368,6 +383,9 @@ func (c *CertChecker) CheckCert(principal string, cert *Certificate) error {
 		if opt == sourceAddressCriticalOption {
 			continue
 		}
+		if c.SupportStandardCriticalOptions && (opt == CertCriticalOptionForceCommand || opt == CertCriticalOptionVerifyRequired) {
+			continue
+		}
 
 		found := false
 		for _, supp := range c.SupportedCriticalOptions {
@@ -453,6 +471,41 @@ func certToPrivAlgo(algo string) string {
 	panic("unknown cert algorithm")
 }
 
+// certKeyAlgoNames maps the certificate algorithms to the signature
+// algorithms of their underlying keys.
+var certKeyAlgoNames = map[string]string{
+	CertAlgoRSAv01:        KeyAlgoRSA,
+	CertAlgoRSASHA256v01:  KeyAlgoRSASHA256,
+	CertAlgoRSASHA512v01:  KeyAlgoRSASHA512,
+	CertAlgoDSAv01:        KeyAlgoDSA,
+	CertAlgoECDSA256v01:   KeyAlgoECDSA256,
+	CertAlgoECDSA384v01:   KeyAlgoECDSA384,
+	CertAlgoECDSA521v01:   KeyAlgoECDSA521,
+	CertAlgoSKECDSA256v01: KeyAlgoSKECDSA256,
+	CertAlgoED25519v01:    KeyAlgoED25519,
+	CertAlgoSKED25519v01:  KeyAlgoSKED25519,
+}
+
+// underlyingAlgo returns the signature algorithm of algo, a public key or
+// host key algorithm. They are the same, except for certificates.
+func underlyingAlgo(algo string) string {
+	if a, ok := certKeyAlgoNames[algo]; ok {
+		return a
+	}
+	return algo
+}
+
+// certificateAlgo returns the certificate algorithm whose signatures use the
+// signature algorithm algo.
+func certificateAlgo(algo string) (certAlgo string, ok bool) {
+	for certName, algoName := range certKeyAlgoNames {
+		if algoName == algo {
+			return certName, true
+		}
+	}
+	return "", false
+}
+
 func (cert *Certificate) bytesForSigning() []byte {
 	c2 := *cert
 	c2.Signature = nil
@@ -184,10 +184,14 @@ func TestHostKeyCert(t *testing.T) {
 	}
 
 	for _, test := range []struct {
-		addr    string
-		succeed bool
+		addr              string
+		hostKeyAlgorithms []string
+		succeed           bool
 	}{
 		{addr: "hostname:22", succeed: true},
+		{addr: "hostname:22", hostKeyAlgorithms: []string{CertAlgoRSAv01}, succeed: true},
+		{addr: "hostname:22", hostKeyAlgorithms: []string{CertAlgoRSASHA256v01}, succeed: true},
+		{addr: "hostname:22", hostKeyAlgorithms: []string{CertAlgoRSASHA512v01}, succeed: true},
 		{addr: "otherhost:22", succeed: false}, // The certificate is valid for 'otherhost' as hostname, but we only recognize the authority of the signer for the address 'hostname:22'
 		{addr: "lasthost:22", succeed: false},
 	} {
@@ -210,8 +214,9 @@ func TestHostKeyCert(t *testing.T) {
 		}()
 
 		config := &ClientConfig{
-			User:            "user",
-			HostKeyCallback: checker.CheckHostKey,
+			User:              "user",
+			HostKeyCallback:   checker.CheckHostKey,
+			HostKeyAlgorithms: test.hostKeyAlgorithms,
 		}
 		_, _, _, err = NewClientConn(c2, test.addr, config)
 
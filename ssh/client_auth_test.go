@@ -896,3 +896,63 @@ func TestAuthMethodGSSAPIWithMIC(t *testing.T) {
 		}
 	}
 }
+
+// algorithmRecorder records the algorithms it is asked to sign with.
+type algorithmRecorder struct {
+	AlgorithmSigner
+	algorithms []string
+}
+
+func (s *algorithmRecorder) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*Signature, error) {
+	s.algorithms = append(s.algorithms, algorithm)
+	return s.AlgorithmSigner.SignWithAlgorithm(rand, data, algorithm)
+}
+
+func TestClientAuthRSASHA2(t *testing.T) {
+	signer := &algorithmRecorder{AlgorithmSigner: testSigners["rsa"].(AlgorithmSigner)}
+	config := &ClientConfig{
+		User: "testuser",
+		Auth: []AuthMethod{
+			PublicKeys(signer),
+		},
+		HostKeyCallback: InsecureIgnoreHostKey(),
+	}
+	if err := tryAuth(t, config); err != nil {
+		t.Fatalf("unable to dial remote side: %s", err)
+	}
+	// The server lists rsa-sha2-256 in server-sig-algs.
+	if len(signer.algorithms) != 1 || signer.algorithms[0] != KeyAlgoRSASHA256 {
+		t.Errorf("signed with %q, want %q", signer.algorithms, KeyAlgoRSASHA256)
+	}
+}
+
+func TestPickSignatureAlgorithm(t *testing.T) {
+	rsaCertSigner, err := NewCertSigner(&Certificate{Key: testPublicKeys["rsa"]}, testSigners["rsa"])
+	if err != nil {
+		t.Fatalf("NewCertSigner: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name       string
+		signer     Signer
+		serverAlgs string // server-sig-algs, or none if empty
+		want       string
+	}{
+		{"rsa without extension", testSigners["rsa"], "", KeyAlgoRSA},
+		{"rsa", testSigners["rsa"], "rsa-sha2-512,rsa-sha2-256,ssh-rsa", KeyAlgoRSASHA256},
+		{"rsa sha512 only", testSigners["rsa"], "ssh-ed25519,rsa-sha2-512", KeyAlgoRSASHA512},
+		{"rsa no overlap", testSigners["rsa"], "ssh-ed25519", KeyAlgoRSA},
+		{"rsa not an AlgorithmSigner", &invalidAlgSigner{testSigners["rsa"]}, "rsa-sha2-256", KeyAlgoRSA},
+		{"rsa certificate", rsaCertSigner, "rsa-sha2-512", CertAlgoRSASHA512v01},
+		{"ecdsa", testSigners["ecdsa"], "rsa-sha2-256,ecdsa-sha2-nistp256", KeyAlgoECDSA256},
+	} {
+		extensions := make(map[string][]byte)
+		if tt.serverAlgs != "" {
+			extensions[extServerSigAlgs] = []byte(tt.serverAlgs)
+		}
+		_, algo := pickSignatureAlgorithm(tt.signer, extensions)
+		if algo != tt.want {
+			t.Errorf("%s: got algorithm %q, want %q", tt.name, algo, tt.want)
+		}
+	}
+}
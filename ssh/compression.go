@@ -0,0 +1,535 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// compressionZlib compresses packets as soon as the key exchange
+	// that negotiated it completes, see RFC 4253, section 6.2.
+	compressionZlib = "zlib"
+
+	// compressionZlibOpenSSH is the delayed variant of zlib, which
+	// only starts compressing once user authentication succeeded, so
+	// that unauthenticated peers cannot reach the decompressor.
+	compressionZlibOpenSSH = "zlib@openssh.com"
+)
+
+// compressionLevel is the zlib compression level, the same as OpenSSH uses.
+const compressionLevel = 6
+
+// compressedPacketCipher compresses the payload of packets before they are
+// encrypted by the underlying packetCipher, and decompresses them after
+// they were decrypted. Like any packetCipher, a single instance should be
+// used for one direction only, and each key change starts a new zlib
+// stream.
+type compressedPacketCipher struct {
+	packetCipher
+
+	// delayed is set for zlib@openssh.com, which is only enabled once
+	// authenticated, which is shared with the transport, is non-zero.
+	delayed       bool
+	authenticated *uint32
+
+	compressor   *zlibCompressor
+	decompressor *zlibDecompressor
+}
+
+func newCompressedPacketCipher(c packetCipher, algo string, authenticated *uint32) packetCipher {
+	return &compressedPacketCipher{
+		packetCipher:  c,
+		delayed:       algo == compressionZlibOpenSSH,
+		authenticated: authenticated,
+	}
+}
+
+func (c *compressedPacketCipher) enabled() bool {
+	return !c.delayed || atomic.LoadUint32(c.authenticated) != 0
+}
+
+func (c *compressedPacketCipher) writeCipherPacket(seqNum uint32, w io.Writer, rand io.Reader, packet []byte) error {
+	if c.compressor == nil && c.enabled() {
+		c.compressor = newZlibCompressor()
+	}
+	if c.compressor != nil {
+		var err error
+		if packet, err = c.compressor.compress(packet); err != nil {
+			return err
+		}
+	}
+	return c.packetCipher.writeCipherPacket(seqNum, w, rand, packet)
+}
+
+func (c *compressedPacketCipher) readCipherPacket(seqNum uint32, r io.Reader) ([]byte, error) {
+	packet, err := c.packetCipher.readCipherPacket(seqNum, r)
+	if err != nil {
+		return nil, err
+	}
+	if c.decompressor == nil && c.enabled() {
+		c.decompressor = new(zlibDecompressor)
+	}
+	if c.decompressor != nil {
+		return c.decompressor.decompress(packet)
+	}
+	return packet, nil
+}
+
+// zlibCompressor compresses packets into a single zlib stream, flushing
+// it at the end of every packet.
+type zlibCompressor struct {
+	buf bytes.Buffer
+	w   *zlib.Writer
+}
+
+func newZlibCompressor() *zlibCompressor {
+	c := new(zlibCompressor)
+	// NewWriterLevel only fails for invalid levels.
+	c.w, _ = zlib.NewWriterLevel(&c.buf, compressionLevel)
+	return c
+}
+
+// compress returns the compressed packet. The result is only valid until
+// the next call.
+func (c *zlibCompressor) compress(packet []byte) ([]byte, error) {
+	c.buf.Reset()
+	if _, err := c.w.Write(packet); err != nil {
+		return nil, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	return c.buf.Bytes(), nil
+}
+
+// The sizes of the deflate format, see RFC 1951.
+const (
+	deflateWindowSize = 32 * 1024
+	deflateMaxBits    = 15
+	deflateMaxLitLen  = 286
+	deflateMaxDist    = 30
+)
+
+// zlibDecompressor decompresses packets from a single zlib stream.
+//
+// The sender flushes the stream at the end of every packet, so that all of
+// its data can be decompressed, but OpenSSH uses a partial flush, which
+// need not end on a byte boundary nor emit the data buffered by
+// compress/flate. Therefore the stream is decompressed here, one symbol at
+// a time, keeping the input that is left over at the end of a packet
+// until the next one arrives.
+type zlibDecompressor struct {
+	// in is the input that has not been consumed yet, starting with the
+	// byte at bit offset bit.
+	in  []byte
+	bit int
+
+	err        error
+	headerDone bool
+
+	// state is the deflate block being decompressed.
+	state  int
+	final  bool
+	stored int
+	lit    *huffman
+	dist   *huffman
+
+	// window is the last deflateWindowSize bytes of output, followed by
+	// the output of the current packet.
+	window []byte
+}
+
+const (
+	deflateBlockHeader = iota
+	deflateStoredBlock
+	deflateHuffmanBlock
+)
+
+var (
+	errCompressedPacketTooLarge = errors.New("ssh: decompressed packet too large")
+	errCorruptCompressedData    = errors.New("ssh: corrupt compressed data")
+)
+
+// decompress returns the decompressed packet. It fails if the packet
+// decompresses to more than maxPacket bytes.
+func (d *zlibDecompressor) decompress(packet []byte) ([]byte, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	r := bitReader{in: append(d.in, packet...), pos: d.bit}
+	start := len(d.window)
+	for {
+		ok, err := d.step(&r)
+		if err == nil && len(d.window)-start > maxPacket {
+			err = errCompressedPacketTooLarge
+		}
+		if err != nil {
+			d.err = err
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+	}
+	d.in = append(d.in[:0], r.in[r.pos/8:]...)
+	d.bit = r.pos % 8
+
+	out := append([]byte(nil), d.window[start:]...)
+	if len(out) == 0 {
+		d.err = errors.New("ssh: zero length compressed packet")
+		return nil, d.err
+	}
+	if n := len(d.window) - deflateWindowSize; n > 0 {
+		d.window = d.window[:copy(d.window, d.window[n:])]
+	}
+	return out, nil
+}
+
+// step decompresses a symbol, or reads a header. It reports false if r does
+// not have enough input for it, in which case r is left where it was.
+func (d *zlibDecompressor) step(r *bitReader) (bool, error) {
+	start := r.pos
+	ok, err := d.readSymbol(r)
+	if !ok {
+		r.pos = start
+	}
+	return ok, err
+}
+
+func (d *zlibDecompressor) readSymbol(r *bitReader) (bool, error) {
+	if !d.headerDone {
+		// See RFC 1950, section 2.2.
+		header, ok := r.bits(16)
+		if !ok {
+			return false, nil
+		}
+		cmf, flg := header&0xff, header>>8
+		if cmf&0x0f != 8 || cmf>>4 > 7 || (cmf<<8|flg)%31 != 0 || flg&0x20 != 0 {
+			return false, errors.New("ssh: invalid zlib header")
+		}
+		d.headerDone = true
+		return true, nil
+	}
+
+	switch d.state {
+	case deflateBlockHeader:
+		if d.final {
+			return false, errors.New("ssh: unexpected end of compressed stream")
+		}
+		header, ok := r.bits(3)
+		if !ok {
+			return false, nil
+		}
+		final := header&1 != 0
+		switch header >> 1 {
+		case 0:
+			r.pos = (r.pos + 7) &^ 7
+			lengths, ok := r.bits(32)
+			if !ok {
+				return false, nil
+			}
+			if lengths&0xffff != ^lengths>>16 {
+				return false, errCorruptCompressedData
+			}
+			d.stored = int(lengths & 0xffff)
+			d.state = deflateStoredBlock
+		case 1:
+			fixedHuffmanOnce.Do(initFixedHuffman)
+			d.lit, d.dist = fixedLitHuffman, fixedDistHuffman
+			d.state = deflateHuffmanBlock
+		case 2:
+			lit, dist, ok, err := readDynamicHuffman(r)
+			if !ok || err != nil {
+				return false, err
+			}
+			d.lit, d.dist = lit, dist
+			d.state = deflateHuffmanBlock
+		default:
+			return false, errCorruptCompressedData
+		}
+		d.final = final
+		return true, nil
+
+	case deflateStoredBlock:
+		if d.stored == 0 {
+			d.state = deflateBlockHeader
+			return true, nil
+		}
+		avail := r.in[r.pos/8:]
+		if len(avail) == 0 {
+			return false, nil
+		}
+		if len(avail) > d.stored {
+			avail = avail[:d.stored]
+		}
+		d.window = append(d.window, avail...)
+		d.stored -= len(avail)
+		r.pos += 8 * len(avail)
+		return true, nil
+
+	case deflateHuffmanBlock:
+		sym, ok, err := d.lit.decode(r)
+		if !ok || err != nil {
+			return false, err
+		}
+		if sym < 256 {
+			d.window = append(d.window, byte(sym))
+			return true, nil
+		}
+		if sym == 256 {
+			d.state = deflateBlockHeader
+			return true, nil
+		}
+		sym -= 257
+		if sym >= len(lengthBase) {
+			return false, errCorruptCompressedData
+		}
+		extra, ok := r.bits(uint(lengthExtra[sym]))
+		if !ok {
+			return false, nil
+		}
+		length := int(lengthBase[sym]) + int(extra)
+
+		sym, ok, err = d.dist.decode(r)
+		if !ok || err != nil {
+			return false, err
+		}
+		if sym >= len(distBase) {
+			return false, errCorruptCompressedData
+		}
+		if extra, ok = r.bits(uint(distExtra[sym])); !ok {
+			return false, nil
+		}
+		dist := int(distBase[sym]) + int(extra)
+		if dist > len(d.window) {
+			return false, errCorruptCompressedData
+		}
+		// The copy may overlap the bytes it produces.
+		for i := 0; i < length; i++ {
+			d.window = append(d.window, d.window[len(d.window)-dist])
+		}
+		return true, nil
+	}
+	panic("unreachable")
+}
+
+// bitReader reads the bits of in, least significant bit first.
+type bitReader struct {
+	in  []byte
+	pos int
+}
+
+// bits returns the next n bits, or false if in is too short.
+func (r *bitReader) bits(n uint) (uint32, bool) {
+	if r.pos+int(n) > 8*len(r.in) {
+		return 0, false
+	}
+	var v uint32
+	for i := uint(0); i < n; i++ {
+		v |= uint32(r.in[r.pos/8]>>uint(r.pos%8)&1) << i
+		r.pos++
+	}
+	return v, true
+}
+
+// huffman is a canonical Huffman code, see RFC 1951, section 3.2.2.
+type huffman struct {
+	// count is the number of codes of each length.
+	count [deflateMaxBits + 1]int
+	// symbols are the symbols ordered by their codes.
+	symbols []int
+}
+
+// newHuffman builds the code for the given code lengths. Incomplete codes
+// are only accepted if they have at most one code, of length one, like zlib
+// does.
+func newHuffman(lengths []uint8) (*huffman, error) {
+	h := new(huffman)
+	for _, l := range lengths {
+		h.count[l]++
+	}
+	left := 1
+	for l := 1; l <= deflateMaxBits; l++ {
+		left = left<<1 - h.count[l]
+		if left < 0 {
+			return nil, errCorruptCompressedData
+		}
+	}
+	if left > 0 && len(lengths)-h.count[0]-h.count[1] != 0 {
+		return nil, errCorruptCompressedData
+	}
+
+	var offsets [deflateMaxBits + 1]int
+	for l := 1; l < deflateMaxBits; l++ {
+		offsets[l+1] = offsets[l] + h.count[l]
+	}
+	h.symbols = make([]int, len(lengths)-h.count[0])
+	for sym, l := range lengths {
+		if l != 0 {
+			h.symbols[offsets[l]] = sym
+			offsets[l]++
+		}
+	}
+	return h, nil
+}
+
+// decode reads a symbol. It reports false if r does not have enough input.
+func (h *huffman) decode(r *bitReader) (int, bool, error) {
+	code, first, index := 0, 0, 0
+	for l := 1; l <= deflateMaxBits; l++ {
+		bit, ok := r.bits(1)
+		if !ok {
+			return 0, false, nil
+		}
+		code |= int(bit)
+		count := h.count[l]
+		if code-first < count {
+			return h.symbols[index+code-first], true, nil
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	return 0, false, errCorruptCompressedData
+}
+
+// readDynamicHuffman reads the codes of a dynamic Huffman block, see
+// RFC 1951, section 3.2.7.
+func readDynamicHuffman(r *bitReader) (lit, dist *huffman, ok bool, err error) {
+	counts, ok := r.bits(14)
+	if !ok {
+		return nil, nil, false, nil
+	}
+	nlen := int(counts&0x1f) + 257
+	ndist := int(counts>>5&0x1f) + 1
+	ncode := int(counts>>10) + 4
+	if nlen > deflateMaxLitLen || ndist > deflateMaxDist {
+		return nil, nil, false, errCorruptCompressedData
+	}
+
+	var codeLengths [19]uint8
+	for i := 0; i < ncode; i++ {
+		l, ok := r.bits(3)
+		if !ok {
+			return nil, nil, false, nil
+		}
+		codeLengths[codeLengthOrder[i]] = uint8(l)
+	}
+	code, err := newHuffman(codeLengths[:])
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	lengths := make([]uint8, 0, nlen+ndist)
+	for len(lengths) < nlen+ndist {
+		sym, ok, err := code.decode(r)
+		if !ok || err != nil {
+			return nil, nil, false, err
+		}
+		if sym < 16 {
+			lengths = append(lengths, uint8(sym))
+			continue
+		}
+		var repeat uint32
+		var l uint8
+		switch sym {
+		case 16:
+			if len(lengths) == 0 {
+				return nil, nil, false, errCorruptCompressedData
+			}
+			l = lengths[len(lengths)-1]
+			repeat, ok = r.bits(2)
+			repeat += 3
+		case 17:
+			repeat, ok = r.bits(3)
+			repeat += 3
+		default:
+			repeat, ok = r.bits(7)
+			repeat += 11
+		}
+		if !ok {
+			return nil, nil, false, nil
+		}
+		if len(lengths)+int(repeat) > nlen+ndist {
+			return nil, nil, false, errCorruptCompressedData
+		}
+		for ; repeat > 0; repeat-- {
+			lengths = append(lengths, l)
+		}
+	}
+	// The end of block code is required.
+	if lengths[256] == 0 {
+		return nil, nil, false, errCorruptCompressedData
+	}
+
+	if lit, err = newHuffman(lengths[:nlen]); err != nil {
+		return nil, nil, false, err
+	}
+	if dist, err = newHuffman(lengths[nlen:]); err != nil {
+		return nil, nil, false, err
+	}
+	return lit, dist, true, nil
+}
+
+var codeLengthOrder = [19]int{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+var (
+	lengthBase = [29]uint16{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31,
+		35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258}
+	lengthExtra = [29]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2,
+		3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+	distBase = [30]uint16{
+		1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193,
+		257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145,
+		8193, 12289, 16385, 24577}
+	distExtra = [30]uint8{
+		0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6,
+		7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+)
+
+var (
+	fixedHuffmanOnce sync.Once
+	fixedLitHuffman  *huffman
+	fixedDistHuffman *huffman
+)
+
+// initFixedHuffman builds the fixed codes of RFC 1951, section 3.2.6.
+func initFixedHuffman() {
+	var lengths [288]uint8
+	for i := range lengths {
+		switch {
+		case i < 144:
+			lengths[i] = 8
+		case i < 256:
+			lengths[i] = 9
+		case i < 280:
+			lengths[i] = 7
+		default:
+			lengths[i] = 8
+		}
+	}
+	fixedLitHuffman, _ = newHuffman(lengths[:])
+
+	var distLengths [30]uint8
+	for i := range distLengths {
+		distLengths[i] = 5
+	}
+	// The distance code is incomplete, as codes 30 and 31 are unused.
+	fixedDistHuffman = new(huffman)
+	fixedDistHuffman.count[5] = len(distLengths)
+	fixedDistHuffman.symbols = make([]int, len(distLengths))
+	for i := range fixedDistHuffman.symbols {
+		fixedDistHuffman.symbols[i] = i
+	}
+}
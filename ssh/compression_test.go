@@ -0,0 +1,239 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+func TestZlibRoundTrip(t *testing.T) {
+	c := newZlibCompressor()
+	d := new(zlibDecompressor)
+
+	random := make([]byte, 40000)
+	rand.Read(random)
+	for i := 1; i < 200; i++ {
+		var packet []byte
+		switch i % 3 {
+		case 0:
+			packet = bytes.Repeat([]byte{byte(i)}, i*100)
+		case 1:
+			packet = random[:i*100]
+		case 2:
+			packet = []byte{msgIgnore}
+		}
+		compressed, err := c.compress(packet)
+		if err != nil {
+			t.Fatalf("compress: %v", err)
+		}
+		got, err := d.decompress(compressed)
+		if err != nil {
+			t.Fatalf("packet %d: decompress: %v", i, err)
+		}
+		if !bytes.Equal(got, packet) {
+			t.Fatalf("packet %d: got %d bytes, want %d", i, len(got), len(packet))
+		}
+	}
+}
+
+func TestZlibDecompressTooLarge(t *testing.T) {
+	c := newZlibCompressor()
+	d := new(zlibDecompressor)
+
+	compressed, err := c.compress(make([]byte, maxPacket+1))
+	if err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	if _, err := d.decompress(compressed); err == nil {
+		t.Fatal("decompress succeeded for a packet larger than maxPacket")
+	}
+	// The error is sticky.
+	compressed, _ = c.compress([]byte{msgIgnore})
+	if _, err := d.decompress(compressed); err == nil {
+		t.Fatal("decompress succeeded after an error")
+	}
+}
+
+func TestZlibDecompressCorrupt(t *testing.T) {
+	d := new(zlibDecompressor)
+
+	if _, err := d.decompress([]byte("not a zlib stream")); err == nil {
+		t.Fatal("decompress succeeded for corrupt input")
+	}
+}
+
+// deflateBitWriter writes a deflate stream, see RFC 1951, section 3.1.1.
+type deflateBitWriter struct {
+	buf []byte
+	n   uint
+}
+
+func (w *deflateBitWriter) bits(v uint32, n uint) {
+	for i := uint(0); i < n; i++ {
+		if w.n%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		w.buf[w.n/8] |= byte(v>>i&1) << (w.n % 8)
+		w.n++
+	}
+}
+
+// code writes a Huffman code, which starts with the most significant bit.
+func (w *deflateBitWriter) code(c uint32, n uint) {
+	for i := n; i > 0; i-- {
+		w.bits(c>>(i-1)&1, 1)
+	}
+}
+
+// TestZlibPartialFlush decompresses a stream that is flushed like OpenSSH
+// does it, with Z_PARTIAL_FLUSH: each packet ends with an empty block with
+// fixed codes, whose last bits are only sent with the next packet.
+func TestZlibPartialFlush(t *testing.T) {
+	w := &deflateBitWriter{buf: []byte{0x78, 0x9c}, n: 16}
+	var packets [][]byte
+	sent := 0
+	for _, msg := range []string{"hello", "world", "!"} {
+		// A block with fixed codes, and an empty one.
+		w.bits(0x2, 3)
+		for _, c := range []byte(msg) {
+			w.code(0x30+uint32(c), 8)
+		}
+		w.code(0, 7)
+		w.bits(0x2, 3)
+		w.code(0, 7)
+
+		// Send the complete bytes.
+		packets = append(packets, w.buf[sent:w.n/8])
+		sent = int(w.n / 8)
+	}
+
+	d := new(zlibDecompressor)
+	for i, want := range []string{"hello", "world", "!"} {
+		got, err := d.decompress(packets[i])
+		if err != nil {
+			t.Fatalf("packet %d: decompress: %v", i, err)
+		}
+		if string(got) != want {
+			t.Errorf("packet %d: got %q, want %q", i, got, want)
+		}
+	}
+}
+
+// countingConn counts the bytes written to a net.Conn.
+type countingConn struct {
+	net.Conn
+	written int64
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	atomic.AddInt64(&c.written, int64(len(p)))
+	return c.Conn.Write(p)
+}
+
+func TestCompression(t *testing.T) {
+	for _, algo := range []string{compressionZlib, compressionZlibOpenSSH} {
+		t.Run(algo, func(t *testing.T) {
+			testCompression(t, algo)
+		})
+	}
+}
+
+func testCompression(t *testing.T, algo string) {
+	c1, c2, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	serverConf := &ServerConfig{
+		Config: Config{
+			Compressions: []string{compressionNone, algo},
+		},
+		PasswordCallback: func(conn ConnMetadata, pass []byte) (*Permissions, error) {
+			if string(pass) == clientPassword {
+				return nil, nil
+			}
+			return nil, errors.New("password auth failed")
+		},
+	}
+	serverConf.AddHostKey(testSigners["ecdsa"])
+
+	serverDone := make(chan error, 1)
+	go func() {
+		serverDone <- func() error {
+			_, chans, reqs, err := NewServerConn(c1, serverConf)
+			if err != nil {
+				return err
+			}
+			go DiscardRequests(reqs)
+			for newCh := range chans {
+				ch, reqs, err := newCh.Accept()
+				if err != nil {
+					return err
+				}
+				go DiscardRequests(reqs)
+				if _, err := io.Copy(ch, ch); err != nil {
+					return err
+				}
+				ch.CloseWrite()
+			}
+			return nil
+		}()
+	}()
+
+	clientConf := &ClientConfig{
+		Config: Config{
+			Compressions: []string{algo},
+			// Rekey a few times, each of which starts a new zlib
+			// stream.
+			RekeyThreshold: 256 * 1024,
+		},
+		User:            "testuser",
+		Auth:            []AuthMethod{Password(clientPassword)},
+		HostKeyCallback: InsecureIgnoreHostKey(),
+	}
+	counter := &countingConn{Conn: c2}
+	conn, chans, reqs, err := NewClientConn(counter, "", clientConf)
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	client := NewClient(conn, chans, reqs)
+	defer client.Close()
+
+	ch, chReqs, err := client.OpenChannel("echo", nil)
+	if err != nil {
+		t.Fatalf("OpenChannel: %v", err)
+	}
+	go DiscardRequests(chReqs)
+
+	data := bytes.Repeat([]byte("compressible "), 100000)
+	go func() {
+		ch.Write(data)
+		ch.CloseWrite()
+	}()
+	got, err := ioutil.ReadAll(ch)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("echoed %d bytes, want %d", len(got), len(data))
+	}
+	if written := atomic.LoadInt64(&counter.written); written > int64(len(data))/10 {
+		t.Errorf("client wrote %d bytes for %d bytes of data, want compression", written, len(data))
+	}
+
+	client.Close()
+	if err := <-serverDone; err != nil {
+		t.Errorf("server: %v", err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"strings"
 	"sync"
 )
 
@@ -24,6 +25,24 @@ const debugHandshake = false
 // quickly.
 const chanSize = 16
 
+// The pseudo key exchange algorithms that signal support for strict key
+// exchange, which OpenSSH introduced to mitigate the Terrapin attack. In
+// strict mode, sequence numbers are reset after each key exchange and
+// unexpected messages abort the initial key exchange.
+const (
+	kexStrictClient = "kex-strict-c-v00@openssh.com"
+	kexStrictServer = "kex-strict-s-v00@openssh.com"
+)
+
+// The pseudo key exchange algorithms that signal support for extension
+// negotiation, and the extensions that this package understands. See RFC
+// 8308.
+const (
+	extInfoClient    = "ext-info-c"
+	extInfoServer    = "ext-info-s"
+	extServerSigAlgs = "server-sig-algs"
+)
+
 // keyingTransport is a packet based transport that supports key
 // changes. It need not be thread-safe. It should pass through
 // msgNewKeys in both directions.
@@ -34,6 +53,16 @@ type keyingTransport interface {
 	// direction will be effected if a msgNewKeys message is sent
 	// or received.
 	prepareKeyChange(*algorithms, *kexResult) error
+
+	// setStrictMode sets the strict key exchange mode, in which
+	// sequence numbers are reset after each key exchange. It is
+	// called during the initial key exchange, right after the
+	// msgKexInit of the other side was read.
+	setStrictMode() error
+
+	// setInitialKEXDone indicates to the transport that the initial
+	// key exchange is done.
+	setInitialKEXDone()
 }
 
 // handshakeTransport implements rekeying on top of a keyingTransport
@@ -50,6 +79,10 @@ type handshakeTransport struct {
 	// connection.
 	hostKeys []Signer
 
+	// moduli are the groups offered for group exchange if we are the
+	// server.
+	moduli []Modulus
+
 	// hostKeyAlgorithms is non-empty if we are the client. In that case,
 	// we accept these key types from the server as host key.
 	hostKeyAlgorithms []string
@@ -94,6 +127,10 @@ type handshakeTransport struct {
 
 	// The session ID or nil if first kex did not complete yet.
 	sessionID []byte
+
+	// strictMode is set if both sides support strict key exchange,
+	// which mitigates prefix truncation attacks such as Terrapin.
+	strictMode bool
 }
 
 type pendingKex struct {
@@ -139,6 +176,7 @@ func newClientTransport(conn keyingTransport, clientVersion, serverVersion []byt
 func newServerTransport(conn keyingTransport, clientVersion, serverVersion []byte, config *ServerConfig) *handshakeTransport {
 	t := newHandshakeTransport(conn, &config.Config, clientVersion, serverVersion)
 	t.hostKeys = config.hostKeys
+	t.moduli = config.GroupExchangeModuli
 	go t.readLoop()
 	go t.kexLoop()
 	return t
@@ -450,19 +488,41 @@ func (t *handshakeTransport) sendKexInit() error {
 		CiphersServerClient:     t.config.Ciphers,
 		MACsClientServer:        t.config.MACs,
 		MACsServerClient:        t.config.MACs,
-		CompressionClientServer: supportedCompressions,
-		CompressionServerClient: supportedCompressions,
+		CompressionClientServer: t.config.Compressions,
+		CompressionServerClient: t.config.Compressions,
 	}
 	io.ReadFull(rand.Reader, msg.Cookie[:])
 
-	if len(t.hostKeys) > 0 {
+	isServer := len(t.hostKeys) > 0
+	if isServer {
 		for _, k := range t.hostKeys {
-			msg.ServerHostKeyAlgos = append(
-				msg.ServerHostKeyAlgos, k.PublicKey().Type())
+			// An AlgorithmSigner is assumed to support all
+			// signature algorithms of its key format. Other
+			// signers only support the default one.
+			if _, ok := k.(AlgorithmSigner); ok {
+				msg.ServerHostKeyAlgos = append(
+					msg.ServerHostKeyAlgos, algorithmsForKeyFormat(k.PublicKey().Type())...)
+			} else {
+				msg.ServerHostKeyAlgos = append(
+					msg.ServerHostKeyAlgos, k.PublicKey().Type())
+			}
 		}
 	} else {
 		msg.ServerHostKeyAlgos = t.hostKeyAlgorithms
 	}
+
+	// The extension negotiation and strict key exchange markers are only
+	// sent in the initial key exchange. They are pseudo-algorithms, so
+	// they are never agreed on.
+	if t.sessionID == nil {
+		msg.KexAlgos = make([]string, 0, len(t.config.KeyExchanges)+2)
+		msg.KexAlgos = append(msg.KexAlgos, t.config.KeyExchanges...)
+		if isServer {
+			msg.KexAlgos = append(msg.KexAlgos, extInfoServer, kexStrictServer)
+		} else {
+			msg.KexAlgos = append(msg.KexAlgos, extInfoClient, kexStrictClient)
+		}
+	}
 	packet := Marshal(msg)
 
 	// writePacket destroys the contents, so save a copy.
@@ -557,6 +617,15 @@ func (t *handshakeTransport) enterKeyExchange(otherInitPacket []byte) error {
 		return err
 	}
 
+	firstKeyExchange := t.sessionID == nil
+	if firstKeyExchange && ((isClient && contains(serverInit.KexAlgos, kexStrictServer)) ||
+		(!isClient && contains(clientInit.KexAlgos, kexStrictClient))) {
+		t.strictMode = true
+		if err := t.conn.setStrictMode(); err != nil {
+			return err
+		}
+	}
+
 	// We don't send FirstKexFollows, but we handle receiving it.
 	//
 	// RFC 4253 section 7 defines the kex and the agreement method for
@@ -608,21 +677,68 @@ func (t *handshakeTransport) enterKeyExchange(otherInitPacket []byte) error {
 		return unexpectedMessageError(msgNewKeys, packet[0])
 	}
 
+	if firstKeyExchange {
+		t.conn.setInitialKEXDone()
+	}
+
+	// The server sends its extensions right after its first msgNewKeys,
+	// if the client supports them. See RFC 8308, section 2.4.
+	if !isClient && firstKeyExchange && contains(clientInit.KexAlgos, extInfoClient) {
+		if err := t.conn.writePacket(Marshal(serverExtInfo())); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// serverExtInfo returns the extensions that the server sends to clients:
+// server-sig-algs, the algorithms that it accepts for public key
+// authentication. See RFC 8308, section 3.1.
+func serverExtInfo() *extInfoMsg {
+	return &extInfoMsg{
+		NumExtensions: 1,
+		Payload: Marshal(&struct {
+			Name  string
+			Value string
+		}{extServerSigAlgs, strings.Join(supportedPubKeyAuthAlgos, ",")}),
+	}
+}
+
 func (t *handshakeTransport) server(kex kexAlgorithm, algs *algorithms, magics *handshakeMagics) (*kexResult, error) {
-	var hostKey Signer
-	for _, k := range t.hostKeys {
-		if algs.hostKey == k.PublicKey().Type() {
-			hostKey = k
-		}
+	hostKey := pickHostKey(t.hostKeys, algs.hostKey)
+	if hostKey == nil {
+		return nil, errors.New("ssh: internal error: negotiated unsupported host key algorithm")
+	}
+
+	if gex, ok := kex.(*dhGEXSHA); ok {
+		kex = &dhGEXSHA{hashFunc: gex.hashFunc, moduli: t.moduli}
 	}
 
-	r, err := kex.Server(t.conn, t.config.Rand, magics, hostKey)
+	r, err := kex.Server(t.conn, t.config.Rand, magics, hostKey, algs.hostKey)
 	return r, err
 }
 
+// pickHostKey returns a host key that can sign with the host key algorithm
+// algo, or nil.
+func pickHostKey(hostKeys []Signer, algo string) AlgorithmSigner {
+	for _, k := range hostKeys {
+		if algo == k.PublicKey().Type() {
+			return algorithmSignerWrapper{k}
+		}
+		as, ok := k.(AlgorithmSigner)
+		if !ok {
+			continue
+		}
+		for _, a := range algorithmsForKeyFormat(k.PublicKey().Type()) {
+			if algo == a {
+				return as
+			}
+		}
+	}
+	return nil
+}
+
 func (t *handshakeTransport) client(kex kexAlgorithm, algs *algorithms, magics *handshakeMagics) (*kexResult, error) {
 	result, err := kex.Client(t.conn, t.config.Rand, magics)
 	if err != nil {
@@ -634,7 +750,7 @@ func (t *handshakeTransport) client(kex kexAlgorithm, algs *algorithms, magics *
 		return nil, err
 	}
 
-	if err := verifyHostKeySignature(hostKey, result); err != nil {
+	if err := verifyHostKeySignature(hostKey, algs.hostKey, result); err != nil {
 		return nil, err
 	}
 
@@ -63,12 +63,22 @@ func netPipe() (net.Conn, net.Conn, error) {
 }
 
 // noiseTransport inserts ignore messages to check that the read loop
-// and the key exchange filters out these messages.
+// filters out these messages. Strict key exchange doesn't allow them
+// during the initial key exchange, so they are only sent after it.
 type noiseTransport struct {
 	keyingTransport
+	initialKEXDone bool
+}
+
+func (t *noiseTransport) setInitialKEXDone() {
+	t.initialKEXDone = true
+	t.keyingTransport.setInitialKEXDone()
 }
 
 func (t *noiseTransport) writePacket(p []byte) error {
+	if !t.initialKEXDone {
+		return t.keyingTransport.writePacket(p)
+	}
 	ignore := []byte{msgIgnore}
 	if err := t.keyingTransport.writePacket(ignore); err != nil {
 		return err
@@ -82,7 +92,7 @@ func (t *noiseTransport) writePacket(p []byte) error {
 }
 
 func addNoiseTransport(t keyingTransport) keyingTransport {
-	return &noiseTransport{t}
+	return &noiseTransport{keyingTransport: t}
 }
 
 // handshakePair creates two handshakeTransports connected with each
@@ -369,6 +379,12 @@ func (n *errorKeyingTransport) prepareKeyChange(*algorithms, *kexResult) error {
 	return nil
 }
 
+func (n *errorKeyingTransport) setStrictMode() error {
+	return nil
+}
+
+func (n *errorKeyingTransport) setInitialKEXDone() {}
+
 func (n *errorKeyingTransport) getSessionID() []byte {
 	return nil
 }
@@ -560,3 +576,97 @@ func TestHandshakeRekeyDefault(t *testing.T) {
 		t.Errorf("got rekey after %dG write, want 64G", wgb)
 	}
 }
+
+// ignoreInjector writes a msgIgnore before the packet with index n.
+type ignoreInjector struct {
+	keyingTransport
+	n int
+}
+
+func (t *ignoreInjector) writePacket(p []byte) error {
+	if t.n == 0 {
+		if err := t.keyingTransport.writePacket([]byte{msgIgnore}); err != nil {
+			return err
+		}
+	}
+	t.n--
+	return t.keyingTransport.writePacket(p)
+}
+
+func TestStrictKEX(t *testing.T) {
+	checker := &testChecker{}
+	trC, trS, err := handshakePair(&ClientConfig{HostKeyCallback: checker.Check}, "addr", true)
+	if err != nil {
+		t.Fatalf("handshakePair: %v", err)
+	}
+	defer trC.Close()
+	defer trS.Close()
+
+	if !trC.strictMode || !trS.strictMode {
+		t.Fatalf("got strict mode %v (client), %v (server), want true", trC.strictMode, trS.strictMode)
+	}
+	// The sequence numbers are reset by msgNewKeys. Since then, the server
+	// has sent its msgExtInfo, preceded by the msgIgnore and msgDebug of
+	// noiseTransport, and the client has sent nothing.
+	p, err := trC.readPacket()
+	if err != nil {
+		t.Fatalf("readPacket: %v", err)
+	}
+	if p[0] != msgExtInfo {
+		t.Fatalf("got packet %v, want packet type %d", p, msgExtInfo)
+	}
+	for _, tc := range []struct {
+		tr                  *handshakeTransport
+		wantRead, wantWrite uint32
+	}{
+		{trC, 3, 0},
+		{trS, 0, 3},
+	} {
+		conn := tc.tr.conn.(*noiseTransport).keyingTransport.(*transport)
+		if conn.reader.seqNum != tc.wantRead || conn.writer.seqNum != tc.wantWrite {
+			t.Errorf("%s: got sequence numbers %d (read), %d (write), want %d, %d", tc.tr.id(), conn.reader.seqNum, conn.writer.seqNum, tc.wantRead, tc.wantWrite)
+		}
+	}
+
+	// After the initial key exchange, msgIgnore is allowed again.
+	if err := trC.writePacket([]byte{msgRequestSuccess}); err != nil {
+		t.Fatalf("writePacket: %v", err)
+	}
+	p, err = trS.readPacket()
+	if err != nil {
+		t.Fatalf("readPacket: %v", err)
+	}
+	if p[0] != msgRequestSuccess {
+		t.Errorf("got packet %v, want packet type %d", p, msgRequestSuccess)
+	}
+}
+
+func TestStrictKEXUnexpectedMsg(t *testing.T) {
+	// A msgIgnore before the msgKexInit of the client, or before its
+	// first key exchange message, aborts the initial key exchange.
+	for n := 0; n < 2; n++ {
+		a, b, err := netPipe()
+		if err != nil {
+			t.Fatalf("netPipe: %v", err)
+		}
+
+		trC := &ignoreInjector{newTransport(a, rand.Reader, true), n}
+		trS := newTransport(b, rand.Reader, false)
+
+		clientConf := &ClientConfig{HostKeyCallback: InsecureIgnoreHostKey()}
+		clientConf.SetDefaults()
+		v := []byte("version")
+		client := newClientTransport(trC, v, v, clientConf, "addr", a.RemoteAddr())
+
+		serverConf := &ServerConfig{}
+		serverConf.AddHostKey(testSigners["ecdsa"])
+		serverConf.SetDefaults()
+		server := newServerTransport(trS, v, v, serverConf)
+
+		if err := server.waitSession(); err == nil {
+			t.Errorf("%d: server accepted msgIgnore in the initial key exchange", n)
+		}
+		client.Close()
+		server.Close()
+	}
+}
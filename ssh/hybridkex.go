@@ -0,0 +1,218 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/internal/mlkem768"
+	"golang.org/x/crypto/internal/sntrup761"
+)
+
+const (
+	kexAlgoSNTRUP761X25519SHA512 = "sntrup761x25519-sha512@openssh.com"
+	kexAlgoMLKEM768X25519SHA256  = "mlkem768x25519-sha256"
+)
+
+// kem is a key encapsulation method that can be combined with X25519.
+type kem interface {
+	publicKeySize() int
+	ciphertextSize() int
+
+	// generateKey returns an encoded public key, and a private key that can
+	// be passed to decapsulate.
+	generateKey(rand io.Reader) (publicKey []byte, privateKey interface{}, err error)
+	encapsulate(rand io.Reader, publicKey []byte) (ciphertext, sharedKey []byte, err error)
+	decapsulate(privateKey interface{}, ciphertext []byte) (sharedKey []byte, err error)
+}
+
+type sntrup761KEM struct{}
+
+func (sntrup761KEM) publicKeySize() int  { return sntrup761.PublicKeySize }
+func (sntrup761KEM) ciphertextSize() int { return sntrup761.CiphertextSize }
+
+func (sntrup761KEM) generateKey(rand io.Reader) ([]byte, interface{}, error) {
+	return sntrup761.GenerateKey(rand)
+}
+
+func (sntrup761KEM) encapsulate(rand io.Reader, publicKey []byte) ([]byte, []byte, error) {
+	return sntrup761.Encapsulate(rand, publicKey)
+}
+
+func (sntrup761KEM) decapsulate(privateKey interface{}, ciphertext []byte) ([]byte, error) {
+	return sntrup761.Decapsulate(privateKey.([]byte), ciphertext)
+}
+
+type mlkem768KEM struct{}
+
+func (mlkem768KEM) publicKeySize() int  { return mlkem768.EncapsulationKeySize }
+func (mlkem768KEM) ciphertextSize() int { return mlkem768.CiphertextSize }
+
+func (mlkem768KEM) generateKey(rand io.Reader) ([]byte, interface{}, error) {
+	dk, err := mlkem768.GenerateKey(rand)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dk.EncapsulationKey(), dk, nil
+}
+
+func (mlkem768KEM) encapsulate(rand io.Reader, publicKey []byte) ([]byte, []byte, error) {
+	return mlkem768.Encapsulate(rand, publicKey)
+}
+
+func (mlkem768KEM) decapsulate(privateKey interface{}, ciphertext []byte) ([]byte, error) {
+	return mlkem768.Decapsulate(privateKey.(*mlkem768.DecapsulationKey), ciphertext)
+}
+
+// kemX25519 implements the hybrid key exchanges that combine a post-quantum
+// KEM with X25519, as described in
+// https://datatracker.ietf.org/doc/draft-josefsson-ntruprime-ssh/ and
+// https://datatracker.ietf.org/doc/draft-kampanakis-curdle-ssh-pq-ke/.
+//
+// The client sends the KEM public key followed by its X25519 public value,
+// and the server replies with the KEM ciphertext followed by its X25519
+// public value. The shared secret is the hash of the KEM shared key followed
+// by the X25519 shared secret, and is encoded as a string rather than an
+// mpint.
+type kemX25519 struct {
+	kem  kem
+	hash crypto.Hash
+}
+
+// sharedSecret combines the KEM shared key and the X25519 shared secret
+// into the encoded shared secret K.
+func (kex *kemX25519) sharedSecret(kemKey []byte, priv, theirPub *[32]byte) ([]byte, error) {
+	var secret [32]byte
+	curve25519.ScalarMult(&secret, priv, theirPub)
+	if subtle.ConstantTimeCompare(secret[:], curve25519Zeros[:]) == 1 {
+		return nil, errors.New("ssh: peer's curve25519 public value has wrong order")
+	}
+	h := kex.hash.New()
+	h.Write(kemKey)
+	h.Write(secret[:])
+	return appendString(nil, string(h.Sum(nil))), nil
+}
+
+func (kex *kemX25519) Client(c packetConn, rand io.Reader, magics *handshakeMagics) (*kexResult, error) {
+	kemPub, kemPriv, err := kex.kem.generateKey(rand)
+	if err != nil {
+		return nil, err
+	}
+	var kp curve25519KeyPair
+	if err := kp.generate(rand); err != nil {
+		return nil, err
+	}
+	clientPub := append(kemPub, kp.pub[:]...)
+	if err := c.writePacket(Marshal(&kexECDHInitMsg{clientPub})); err != nil {
+		return nil, err
+	}
+
+	packet, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	}
+
+	var reply kexECDHReplyMsg
+	if err = Unmarshal(packet, &reply); err != nil {
+		return nil, err
+	}
+	if len(reply.EphemeralPubKey) != kex.kem.ciphertextSize()+32 {
+		return nil, errors.New("ssh: peer's hybrid key exchange reply has wrong length")
+	}
+
+	ciphertext := reply.EphemeralPubKey[:kex.kem.ciphertextSize()]
+	var servPub [32]byte
+	copy(servPub[:], reply.EphemeralPubKey[kex.kem.ciphertextSize():])
+	kemKey, err := kex.kem.decapsulate(kemPriv, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	K, err := kex.sharedSecret(kemKey, &kp.priv, &servPub)
+	if err != nil {
+		return nil, err
+	}
+
+	h := kex.hash.New()
+	magics.write(h)
+	writeString(h, reply.HostKey)
+	writeString(h, clientPub)
+	writeString(h, reply.EphemeralPubKey)
+	h.Write(K)
+
+	return &kexResult{
+		H:         h.Sum(nil),
+		K:         K,
+		HostKey:   reply.HostKey,
+		Signature: reply.Signature,
+		Hash:      kex.hash,
+	}, nil
+}
+
+func (kex *kemX25519) Server(c packetConn, rand io.Reader, magics *handshakeMagics, priv AlgorithmSigner, algo string) (result *kexResult, err error) {
+	packet, err := c.readPacket()
+	if err != nil {
+		return
+	}
+	var kexInit kexECDHInitMsg
+	if err = Unmarshal(packet, &kexInit); err != nil {
+		return
+	}
+
+	if len(kexInit.ClientPubKey) != kex.kem.publicKeySize()+32 {
+		return nil, errors.New("ssh: peer's hybrid key exchange public value has wrong length")
+	}
+
+	ciphertext, kemKey, err := kex.kem.encapsulate(rand, kexInit.ClientPubKey[:kex.kem.publicKeySize()])
+	if err != nil {
+		return nil, err
+	}
+	var kp curve25519KeyPair
+	if err := kp.generate(rand); err != nil {
+		return nil, err
+	}
+	var clientPub [32]byte
+	copy(clientPub[:], kexInit.ClientPubKey[kex.kem.publicKeySize():])
+	K, err := kex.sharedSecret(kemKey, &kp.priv, &clientPub)
+	if err != nil {
+		return nil, err
+	}
+	serverPub := append(ciphertext, kp.pub[:]...)
+
+	hostKeyBytes := priv.PublicKey().Marshal()
+
+	h := kex.hash.New()
+	magics.write(h)
+	writeString(h, hostKeyBytes)
+	writeString(h, kexInit.ClientPubKey)
+	writeString(h, serverPub)
+	h.Write(K)
+
+	H := h.Sum(nil)
+
+	sig, err := signAndMarshal(priv, rand, H, algo)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := kexECDHReplyMsg{
+		EphemeralPubKey: serverPub,
+		HostKey:         hostKeyBytes,
+		Signature:       sig,
+	}
+	if err := c.writePacket(Marshal(&reply)); err != nil {
+		return nil, err
+	}
+	return &kexResult{
+		H:         H,
+		K:         K,
+		HostKey:   hostKeyBytes,
+		Signature: sig,
+		Hash:      kex.hash,
+	}, nil
+}
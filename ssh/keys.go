@@ -13,11 +13,13 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/md5"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/pem"
 	"errors"
@@ -42,6 +44,12 @@ const (
 	KeyAlgoECDSA521   = "ecdsa-sha2-nistp521"
 	KeyAlgoED25519    = "ssh-ed25519"
 	KeyAlgoSKED25519  = "sk-ssh-ed25519@openssh.com"
+
+	// KeyAlgoRSASHA256 and KeyAlgoRSASHA512 are only public key algorithms,
+	// not public key formats, so they can't appear as a PublicKey.Type. The
+	// corresponding PublicKey.Type is KeyAlgoRSA. See RFC 8332, section 2.
+	KeyAlgoRSASHA256 = "rsa-sha2-256"
+	KeyAlgoRSASHA512 = "rsa-sha2-512"
 )
 
 // These constants represent non-default signature algorithms that are supported
@@ -49,9 +57,9 @@ const (
 // [PROTOCOL.agent] section 4.5.1 and
 // https://tools.ietf.org/html/draft-ietf-curdle-rsa-sha2-10
 const (
-	SigAlgoRSA        = "ssh-rsa"
-	SigAlgoRSASHA2256 = "rsa-sha2-256"
-	SigAlgoRSASHA2512 = "rsa-sha2-512"
+	SigAlgoRSA        = KeyAlgoRSA
+	SigAlgoRSASHA2256 = KeyAlgoRSASHA256
+	SigAlgoRSASHA2512 = KeyAlgoRSASHA512
 )
 
 // parsePubKey parses a public key of the given algorithm.
@@ -334,6 +342,19 @@ type AlgorithmSigner interface {
 	SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*Signature, error)
 }
 
+// algorithmSignerWrapper is an AlgorithmSigner that only supports the
+// default algorithm of its key format.
+type algorithmSignerWrapper struct {
+	Signer
+}
+
+func (a algorithmSignerWrapper) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*Signature, error) {
+	if algorithm != "" && algorithm != underlyingAlgo(a.PublicKey().Type()) {
+		return nil, fmt.Errorf("ssh: unsupported signature algorithm %s", algorithm)
+	}
+	return a.Sign(rand, data)
+}
+
 type rsaPublicKey rsa.PublicKey
 
 func (r *rsaPublicKey) Type() string {
@@ -1116,8 +1137,10 @@ func (*PassphraseMissingError) Error() string {
 }
 
 // ParseRawPrivateKey returns a private key from a PEM encoded private key. It
-// supports RSA (PKCS#1), PKCS#8, DSA (OpenSSL), and ECDSA private keys. If the
-// private key is encrypted, it will return a PassphraseMissingError.
+// supports RSA (PKCS#1), PKCS#8, DSA (OpenSSL), and ECDSA private keys, and
+// private keys in the OpenSSH format, of which those held by security keys
+// are returned as an *SKPrivateKey. If the private key is encrypted, it will
+// return a PassphraseMissingError.
 func ParseRawPrivateKey(pemBytes []byte) (interface{}, error) {
 	block, _ := pem.Decode(pemBytes)
 	if block == nil {
@@ -1438,6 +1461,35 @@ func parseOpenSSHPrivateKey(key []byte, decrypt openSSHDecryptFunc) (crypto.Priv
 			},
 			D: key.D,
 		}, nil
+	case KeyAlgoSKECDSA256, KeyAlgoSKED25519:
+		// The key starts with the fields of the public key, without
+		// the key type.
+		pub, rest, err := parsePubKey(pk1.Rest, pk1.Keytype)
+		if err != nil {
+			return nil, err
+		}
+		key := struct {
+			Flags     byte
+			KeyHandle []byte
+			Reserved  []byte
+			Comment   string
+			Pad       []byte `ssh:"rest"`
+		}{}
+
+		if err := Unmarshal(rest, &key); err != nil {
+			return nil, err
+		}
+
+		if err := checkOpenSSHKeyPadding(key.Pad); err != nil {
+			return nil, err
+		}
+
+		return &SKPrivateKey{
+			PublicKey: pub,
+			Flags:     key.Flags,
+			KeyHandle: key.KeyHandle,
+			Reserved:  key.Reserved,
+		}, nil
 	default:
 		return nil, errors.New("ssh: unhandled key type")
 	}
@@ -1452,6 +1504,198 @@ func checkOpenSSHKeyPadding(pad []byte) error {
 	return nil
 }
 
+// SKPrivateKey is a key held by a FIDO security key, as stored in OpenSSH
+// private key files of type KeyAlgoSKECDSA256 or KeyAlgoSKED25519. The
+// private key itself never leaves the security key, so the file only holds
+// what is needed to ask the security key to sign with it. See
+// https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.u2f.
+type SKPrivateKey struct {
+	// PublicKey is the public key, of type KeyAlgoSKECDSA256 or
+	// KeyAlgoSKED25519.
+	PublicKey PublicKey
+
+	// Flags are the flags passed to the security key when signing,
+	// such as 0x01 to require user presence.
+	Flags byte
+
+	// KeyHandle identifies the private key to the security key.
+	KeyHandle []byte
+
+	// Reserved is reserved for future use, and is usually empty.
+	Reserved []byte
+}
+
+// MarshalPrivateKey returns a PEM block with the private key serialized in the
+// OpenSSH format. key must be an *rsa.PrivateKey, an *ecdsa.PrivateKey using
+// P-256, P-384 or P-521, an ed25519.PrivateKey or *ed25519.PrivateKey, or an
+// *SKPrivateKey.
+func MarshalPrivateKey(key crypto.PrivateKey, comment string) (*pem.Block, error) {
+	return marshalOpenSSHPrivateKey(key, comment, unencryptedOpenSSHMarshaler)
+}
+
+// MarshalPrivateKeyWithPassphrase returns a PEM block holding the encrypted
+// private key serialized in the OpenSSH format. The key is encrypted with
+// aes256-ctr, using a key derived from passphrase with bcrypt_pbkdf, like
+// ssh-keygen does. It supports the same keys as MarshalPrivateKey.
+func MarshalPrivateKeyWithPassphrase(key crypto.PrivateKey, comment string, passphrase []byte) (*pem.Block, error) {
+	return marshalOpenSSHPrivateKey(key, comment, passphraseProtectedOpenSSHMarshaler(passphrase))
+}
+
+// openSSHEncryptFunc pads and encrypts the private key section of an OpenSSH
+// private key, and returns the names and options of the cipher and KDF it
+// used.
+type openSSHEncryptFunc func(privKeyBlock []byte) (cipherName, kdfName, kdfOpts string, encrypted []byte, err error)
+
+func unencryptedOpenSSHMarshaler(privKeyBlock []byte) (string, string, string, []byte, error) {
+	// The private key section is padded to the cipher block size, which
+	// is 8 for "none".
+	return "none", "none", "", padOpenSSHKey(privKeyBlock, 8), nil
+}
+
+func passphraseProtectedOpenSSHMarshaler(passphrase []byte) openSSHEncryptFunc {
+	return func(privKeyBlock []byte) (string, string, string, []byte, error) {
+		// These are the defaults of ssh-keygen.
+		const rounds = 16
+		salt := make([]byte, 16)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return "", "", "", nil, err
+		}
+		opts := struct {
+			Salt   []byte
+			Rounds uint32
+		}{salt, rounds}
+
+		k, err := bcrypt_pbkdf.Key(passphrase, salt, rounds, 32+aes.BlockSize)
+		if err != nil {
+			return "", "", "", nil, err
+		}
+		key, iv := k[:32], k[32:]
+
+		c, err := aes.NewCipher(key)
+		if err != nil {
+			return "", "", "", nil, err
+		}
+		encrypted := padOpenSSHKey(privKeyBlock, aes.BlockSize)
+		cipher.NewCTR(c, iv).XORKeyStream(encrypted, encrypted)
+		return "aes256-ctr", "bcrypt", string(Marshal(&opts)), encrypted, nil
+	}
+}
+
+// padOpenSSHKey appends the padding that checkOpenSSHKeyPadding expects,
+// up to a multiple of blockSize.
+func padOpenSSHKey(privKeyBlock []byte, blockSize int) []byte {
+	for i := 1; len(privKeyBlock)%blockSize != 0; i++ {
+		privKeyBlock = append(privKeyBlock, byte(i))
+	}
+	return privKeyBlock
+}
+
+// marshalOpenSSHPrivateKey is the inverse of parseOpenSSHPrivateKey. See
+// https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.key.
+func marshalOpenSSHPrivateKey(key crypto.PrivateKey, comment string, encrypt openSSHEncryptFunc) (*pem.Block, error) {
+	var check [4]byte
+	if _, err := io.ReadFull(rand.Reader, check[:]); err != nil {
+		return nil, err
+	}
+	checkInt := binary.BigEndian.Uint32(check[:])
+
+	var pub PublicKey
+	var keyFields []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if len(k.Primes) != 2 {
+			return nil, fmt.Errorf("ssh: unsupported RSA key with %d primes", len(k.Primes))
+		}
+		pub = (*rsaPublicKey)(&k.PublicKey)
+		iqmp := new(big.Int).ModInverse(k.Primes[1], k.Primes[0])
+		if iqmp == nil {
+			return nil, errors.New("ssh: invalid RSA key")
+		}
+		keyFields = Marshal(struct {
+			N    *big.Int
+			E    *big.Int
+			D    *big.Int
+			Iqmp *big.Int
+			P    *big.Int
+			Q    *big.Int
+		}{k.N, big.NewInt(int64(k.E)), k.D, iqmp, k.Primes[0], k.Primes[1]})
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() && k.Curve != elliptic.P384() && k.Curve != elliptic.P521() {
+			return nil, errors.New("ssh: only P-256, P-384 and P-521 EC keys are supported")
+		}
+		ecPub := (*ecdsaPublicKey)(&k.PublicKey)
+		pub = ecPub
+		keyFields = Marshal(struct {
+			Curve string
+			Pub   []byte
+			D     *big.Int
+		}{ecPub.nistID(), elliptic.Marshal(k.Curve, k.X, k.Y), k.D})
+	case ed25519.PrivateKey:
+		return marshalOpenSSHPrivateKey(&k, comment, encrypt)
+	case *ed25519.PrivateKey:
+		if len(*k) != ed25519.PrivateKeySize {
+			return nil, errors.New("ssh: invalid Ed25519 private key")
+		}
+		edPub := k.Public().(ed25519.PublicKey)
+		pub = ed25519PublicKey(edPub)
+		keyFields = Marshal(struct {
+			Pub  []byte
+			Priv []byte
+		}{edPub, *k})
+	case *SKPrivateKey:
+		switch k.PublicKey.(type) {
+		case *skECDSAPublicKey, *skEd25519PublicKey:
+		default:
+			return nil, fmt.Errorf("ssh: unsupported security key public key type %T", k.PublicKey)
+		}
+		pub = k.PublicKey
+		// The key starts with the fields of the public key, without
+		// the key type.
+		var pubFields struct {
+			Type   string
+			Fields []byte `ssh:"rest"`
+		}
+		if err := Unmarshal(pub.Marshal(), &pubFields); err != nil {
+			return nil, err
+		}
+		keyFields = append(pubFields.Fields, Marshal(struct {
+			Flags     byte
+			KeyHandle []byte
+			Reserved  []byte
+		}{k.Flags, k.KeyHandle, k.Reserved})...)
+	default:
+		return nil, fmt.Errorf("ssh: unsupported key type %T", key)
+	}
+
+	privKeyBlock := Marshal(struct {
+		Check1  uint32
+		Check2  uint32
+		Keytype string
+		Rest    []byte `ssh:"rest"`
+	}{checkInt, checkInt, pub.Type(), keyFields})
+	privKeyBlock = appendString(privKeyBlock, comment)
+
+	cipherName, kdfName, kdfOpts, privKeyBlock, err := encrypt(privKeyBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	const magic = "openssh-key-v1\x00"
+	w := struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}{cipherName, kdfName, kdfOpts, 1, pub.Marshal(), privKeyBlock}
+
+	return &pem.Block{
+		Type:  "OPENSSH PRIVATE KEY",
+		Bytes: append([]byte(magic), Marshal(&w)...),
+	}, nil
+}
+
 // FingerprintLegacyMD5 returns the user presentation of the key's
 // fingerprint as described by RFC 4716 section 4.
 func FingerprintLegacyMD5(pubKey PublicKey) string {
@@ -241,6 +241,86 @@ func TestParseDSA(t *testing.T) {
 	}
 }
 
+func TestMarshalPrivateKey(t *testing.T) {
+	data := []byte("sign me")
+	for _, name := range []string{"rsa", "ecdsap256", "ecdsap384", "ecdsap521", "ed25519"} {
+		t.Run(name, func(t *testing.T) {
+			key := testPrivateKeys[name]
+			want := testSigners[name].PublicKey().Marshal()
+
+			block, err := MarshalPrivateKey(key, "user@host")
+			if err != nil {
+				t.Fatalf("MarshalPrivateKey: %v", err)
+			}
+			s, err := ParsePrivateKey(pem.EncodeToMemory(block))
+			if err != nil {
+				t.Fatalf("ParsePrivateKey: %v", err)
+			}
+			if got := s.PublicKey().Marshal(); !bytes.Equal(got, want) {
+				t.Errorf("got public key %x, want %x", got, want)
+			}
+			sig, err := s.Sign(rand.Reader, data)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			if err := testPublicKeys[name].Verify(data, sig); err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+
+			block, err = MarshalPrivateKeyWithPassphrase(key, "user@host", []byte("passphrase"))
+			if err != nil {
+				t.Fatalf("MarshalPrivateKeyWithPassphrase: %v", err)
+			}
+			encrypted := pem.EncodeToMemory(block)
+			if _, err := ParsePrivateKey(encrypted); err == nil {
+				t.Fatal("ParsePrivateKey succeeded for an encrypted key")
+			} else if err, ok := err.(*PassphraseMissingError); !ok {
+				t.Errorf("got error %q, want PassphraseMissingError", err)
+			} else if err.PublicKey == nil || !bytes.Equal(err.PublicKey.Marshal(), want) {
+				t.Errorf("PassphraseMissingError.PublicKey doesn't match the key")
+			}
+			if _, err := ParsePrivateKeyWithPassphrase(encrypted, []byte("incorrect")); err != x509.IncorrectPasswordError {
+				t.Errorf("got %v, want IncorrectPasswordError", err)
+			}
+			s, err = ParsePrivateKeyWithPassphrase(encrypted, []byte("passphrase"))
+			if err != nil {
+				t.Fatalf("ParsePrivateKeyWithPassphrase: %v", err)
+			}
+			if got := s.PublicKey().Marshal(); !bytes.Equal(got, want) {
+				t.Errorf("got public key %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestMarshalSKPrivateKey(t *testing.T) {
+	for _, d := range testdata.SKData {
+		t.Run(d.Name, func(t *testing.T) {
+			pub, _, _, _, err := ParseAuthorizedKey(d.PubKey)
+			if err != nil {
+				t.Fatalf("ParseAuthorizedKey: %v", err)
+			}
+			key := &SKPrivateKey{
+				PublicKey: pub,
+				Flags:     0x01,
+				KeyHandle: []byte("key handle"),
+				Reserved:  []byte{},
+			}
+			block, err := MarshalPrivateKey(key, "user@host")
+			if err != nil {
+				t.Fatalf("MarshalPrivateKey: %v", err)
+			}
+			got, err := ParseRawPrivateKey(pem.EncodeToMemory(block))
+			if err != nil {
+				t.Fatalf("ParseRawPrivateKey: %v", err)
+			}
+			if !reflect.DeepEqual(got, key) {
+				t.Errorf("got %#v, want %#v", got, key)
+			}
+		})
+	}
+}
+
 // Tests for authorized_keys parsing.
 
 // getTestKey returns a public key, and its base64 encoding.
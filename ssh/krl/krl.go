@@ -0,0 +1,664 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package krl implements the key revocation lists of OpenSSH, which are
+// created by "ssh-keygen -k" and used by the RevokedKeys option of sshd. A
+// KRL revokes plain keys, by value or by hash, and certificates, by serial
+// number or key ID, in a compact binary format.
+//
+// See https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.krl.
+package krl
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	krlMagic         = 0x5353484b524c0a00 // "SSHKRL\n\0"
+	krlFormatVersion = 1
+)
+
+// Section types, see PROTOCOL.krl.
+const (
+	sectionCertificates      = 1
+	sectionExplicitKey       = 2
+	sectionFingerprintSHA1   = 3
+	sectionSignature         = 4
+	sectionFingerprintSHA256 = 5
+	sectionExtension         = 255
+
+	certSectionSerialList   = 0x20
+	certSectionSerialRange  = 0x21
+	certSectionSerialBitmap = 0x22
+	certSectionKeyID        = 0x23
+	certSectionExtension    = 0x39
+)
+
+// serialRange is an inclusive range of certificate serial numbers.
+type serialRange struct {
+	min, max uint64
+}
+
+// revokedCerts holds the revoked certificates of a certificate authority.
+type revokedCerts struct {
+	// caKey is the wire encoding of the certificate authority, or empty
+	// for all certificate authorities.
+	caKey []byte
+
+	// serials is sorted, and its ranges are neither adjacent nor
+	// overlapping.
+	serials []serialRange
+	keyIDs  map[string]bool
+}
+
+// addSerials revokes the serials from min to max, which must not be 0.
+func (r *revokedCerts) addSerials(min, max uint64) {
+	s := r.serials
+	// Serials are usually revoked in increasing order.
+	if n := len(s); n == 0 || min-1 > s[n-1].max {
+		r.serials = append(s, serialRange{min, max})
+		return
+	}
+	// i is the first range that overlaps or is adjacent to [min, max],
+	// or follows it, and j the first one after that which doesn't.
+	i := sort.Search(len(s), func(i int) bool { return s[i].max >= min-1 })
+	j := sort.Search(len(s), func(i int) bool { return s[i].min-1 > max })
+	if i == j {
+		s = append(s, serialRange{})
+		copy(s[i+1:], s[i:])
+		s[i] = serialRange{min, max}
+		r.serials = s
+		return
+	}
+	if s[i].min < min {
+		min = s[i].min
+	}
+	if s[j-1].max > max {
+		max = s[j-1].max
+	}
+	s[i] = serialRange{min, max}
+	r.serials = append(s[:i+1], s[j:]...)
+}
+
+// addSerialRanges revokes the serials of ranges, which must not include
+// 0. Unlike addSerials, it sorts and merges all the ranges at once.
+func (r *revokedCerts) addSerialRanges(ranges []serialRange) {
+	if len(ranges) == 0 {
+		return
+	}
+	s := append(r.serials, ranges...)
+	sort.Slice(s, func(i, j int) bool { return s[i].min < s[j].min })
+	merged := s[:1]
+	for _, sr := range s[1:] {
+		last := &merged[len(merged)-1]
+		if sr.min-1 > last.max {
+			merged = append(merged, sr)
+		} else if sr.max > last.max {
+			last.max = sr.max
+		}
+	}
+	r.serials = merged
+}
+
+func (r *revokedCerts) isRevoked(cert *ssh.Certificate) bool {
+	if r.keyIDs[cert.KeyId] {
+		return true
+	}
+	// Serial 0 is the default when the certificate authority doesn't
+	// set one, so it is never revoked.
+	if cert.Serial == 0 {
+		return false
+	}
+	s := r.serials
+	i := sort.Search(len(s), func(i int) bool { return s[i].max >= cert.Serial })
+	return i < len(s) && s[i].min <= cert.Serial
+}
+
+// KRL is a key revocation list. The methods that revoke keys must not be
+// called concurrently with IsRevoked.
+type KRL struct {
+	// Version is the version number of the KRL, which is usually
+	// increased each time it is modified.
+	Version uint64
+
+	// GeneratedDate is the time the KRL was generated. It is ignored if
+	// zero.
+	GeneratedDate time.Time
+
+	// Comment is a free-form comment.
+	Comment string
+
+	// SigningKeys are the keys that signed the KRL. They are set by
+	// ParseKRL, which verified the signatures, and ignored by Marshal.
+	SigningKeys []ssh.PublicKey
+
+	certs  []*revokedCerts
+	keys   map[string]bool
+	sha1   map[string]bool
+	sha256 map[string]bool
+}
+
+// New returns an empty KRL.
+func New() *KRL {
+	return &KRL{
+		keys:   make(map[string]bool),
+		sha1:   make(map[string]bool),
+		sha256: make(map[string]bool),
+	}
+}
+
+// plainKey returns the wire encoding of key, or of the key of a
+// certificate.
+func plainKey(key ssh.PublicKey) []byte {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		return cert.Key.Marshal()
+	}
+	return key.Marshal()
+}
+
+// RevokeKey revokes key. If key is a certificate, the key it certifies is
+// revoked, and with it all its certificates.
+func (k *KRL) RevokeKey(key ssh.PublicKey) {
+	k.keys[string(plainKey(key))] = true
+}
+
+// RevokeKeySHA1 revokes the key whose wire encoding has the given SHA-1
+// hash.
+func (k *KRL) RevokeKeySHA1(hash []byte) error {
+	if len(hash) != sha1.Size {
+		return fmt.Errorf("krl: SHA-1 hash has length %d, want %d", len(hash), sha1.Size)
+	}
+	k.sha1[string(hash)] = true
+	return nil
+}
+
+// RevokeKeySHA256 revokes the key whose wire encoding has the given SHA-256
+// hash, which is the hash of the fingerprints returned by
+// ssh.FingerprintSHA256.
+func (k *KRL) RevokeKeySHA256(hash []byte) error {
+	if len(hash) != sha256.Size {
+		return fmt.Errorf("krl: SHA-256 hash has length %d, want %d", len(hash), sha256.Size)
+	}
+	k.sha256[string(hash)] = true
+	return nil
+}
+
+// revokedCerts returns the revoked certificates of ca, adding them if
+// needed.
+func (k *KRL) revokedCerts(ca ssh.PublicKey) *revokedCerts {
+	var caKey []byte
+	if ca != nil {
+		caKey = ca.Marshal()
+	}
+	for _, r := range k.certs {
+		if bytes.Equal(r.caKey, caKey) {
+			return r
+		}
+	}
+	r := &revokedCerts{caKey: caKey, keyIDs: make(map[string]bool)}
+	k.certs = append(k.certs, r)
+	return r
+}
+
+// RevokeCertificateSerials revokes the certificates signed by ca with a
+// serial number from min to max, inclusive. If ca is nil, the certificates
+// of all certificate authorities are revoked. Serial 0 cannot be revoked.
+// Revoking serials in increasing order is fastest.
+func (k *KRL) RevokeCertificateSerials(ca ssh.PublicKey, min, max uint64) error {
+	if min == 0 || min > max {
+		return fmt.Errorf("krl: invalid serial range %d-%d", min, max)
+	}
+	k.revokedCerts(ca).addSerials(min, max)
+	return nil
+}
+
+// RevokeCertificateKeyID revokes the certificates signed by ca with the
+// given key ID. If ca is nil, the certificates of all certificate
+// authorities are revoked.
+func (k *KRL) RevokeCertificateKeyID(ca ssh.PublicKey, keyID string) {
+	k.revokedCerts(ca).keyIDs[keyID] = true
+}
+
+// IsRevoked reports whether key is revoked. If key is a certificate, it is
+// revoked if the certificate, the key it certifies or its certificate
+// authority is revoked.
+func (k *KRL) IsRevoked(key ssh.PublicKey) bool {
+	if k.isKeyRevoked(plainKey(key)) {
+		return true
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return false
+	}
+	if k.isKeyRevoked(plainKey(cert.SignatureKey)) {
+		return true
+	}
+	caKey := cert.SignatureKey.Marshal()
+	for _, r := range k.certs {
+		if (len(r.caKey) == 0 || bytes.Equal(r.caKey, caKey)) && r.isRevoked(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *KRL) isKeyRevoked(blob []byte) bool {
+	if k.keys[string(blob)] {
+		return true
+	}
+	h1 := sha1.Sum(blob)
+	if k.sha1[string(h1[:])] {
+		return true
+	}
+	h256 := sha256.Sum256(blob)
+	return k.sha256[string(h256[:])]
+}
+
+// IsCertRevoked reports whether cert is revoked. It can be used as the
+// IsRevoked callback of ssh.CertChecker.
+func (k *KRL) IsCertRevoked(cert *ssh.Certificate) bool {
+	return k.IsRevoked(cert)
+}
+
+// PublicKeyCallback returns a callback for ssh.ServerConfig.PublicKeyCallback
+// that rejects revoked keys and certificates, and passes the others to
+// callback.
+func (k *KRL) PublicKeyCallback(callback func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error)) func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	return func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		if k.IsRevoked(key) {
+			return nil, fmt.Errorf("krl: %s key %s is revoked", key.Type(), ssh.FingerprintSHA256(key))
+		}
+		return callback(conn, key)
+	}
+}
+
+func appendU64(buf []byte, n uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], n)
+	return append(buf, b[:]...)
+}
+
+func appendString(buf, s []byte) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(len(s)))
+	return append(append(buf, b[:]...), s...)
+}
+
+func appendSection(buf []byte, typ byte, data []byte) []byte {
+	return appendString(append(buf, typ), data)
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func appendStringsSection(buf []byte, typ byte, m map[string]bool) []byte {
+	if len(m) == 0 {
+		return buf
+	}
+	var data []byte
+	for _, s := range sortedKeys(m) {
+		data = appendString(data, []byte(s))
+	}
+	return appendSection(buf, typ, data)
+}
+
+// Marshal returns the binary encoding of the KRL, signed by signers. Each
+// signature covers the KRL and the previous signatures.
+func (k *KRL) Marshal(rand io.Reader, signers ...ssh.Signer) ([]byte, error) {
+	buf := appendU64(nil, krlMagic)
+	buf = append(buf, 0, 0, 0, krlFormatVersion)
+	buf = appendU64(buf, k.Version)
+	var date uint64
+	if !k.GeneratedDate.IsZero() {
+		date = uint64(k.GeneratedDate.Unix())
+	}
+	buf = appendU64(buf, date)
+	buf = appendU64(buf, 0) // flags
+	buf = appendString(buf, nil)
+	buf = appendString(buf, []byte(k.Comment))
+
+	for _, r := range k.certs {
+		data := appendString(nil, r.caKey)
+		data = appendString(data, nil)
+		// Single serials are grouped in lists, and longer runs are
+		// written as ranges.
+		var list []byte
+		for _, s := range r.serials {
+			if s.min == s.max {
+				list = appendU64(list, s.min)
+				continue
+			}
+			if len(list) > 0 {
+				data = appendSection(data, certSectionSerialList, list)
+				list = nil
+			}
+			data = appendSection(data, certSectionSerialRange, appendU64(appendU64(nil, s.min), s.max))
+		}
+		if len(list) > 0 {
+			data = appendSection(data, certSectionSerialList, list)
+		}
+		data = appendStringsSection(data, certSectionKeyID, r.keyIDs)
+		buf = appendSection(buf, sectionCertificates, data)
+	}
+	buf = appendStringsSection(buf, sectionExplicitKey, k.keys)
+	buf = appendStringsSection(buf, sectionFingerprintSHA1, k.sha1)
+	buf = appendStringsSection(buf, sectionFingerprintSHA256, k.sha256)
+
+	for _, signer := range signers {
+		buf = appendSection(buf, sectionSignature, signer.PublicKey().Marshal())
+		var sig *ssh.Signature
+		var err error
+		if algSigner, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+			sig, err = algSigner.SignWithAlgorithm(rand, buf, ssh.SigAlgoRSASHA2512)
+		} else {
+			sig, err = signer.Sign(rand, buf)
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf = appendString(buf, ssh.Marshal(sig))
+	}
+	return buf, nil
+}
+
+var errShortRead = errors.New("krl: truncated KRL")
+
+func parseString(in []byte) (out, rest []byte, err error) {
+	if len(in) < 4 {
+		return nil, nil, errShortRead
+	}
+	length := binary.BigEndian.Uint32(in)
+	in = in[4:]
+	if uint32(len(in)) < length {
+		return nil, nil, errShortRead
+	}
+	return in[:length], in[length:], nil
+}
+
+func parseU64(in []byte) (uint64, []byte, error) {
+	if len(in) < 8 {
+		return 0, nil, errShortRead
+	}
+	return binary.BigEndian.Uint64(in), in[8:], nil
+}
+
+// parseSection parses the type and the data of a section.
+func parseSection(in []byte) (typ byte, data, rest []byte, err error) {
+	if len(in) < 1 {
+		return 0, nil, nil, errShortRead
+	}
+	data, rest, err = parseString(in[1:])
+	return in[0], data, rest, err
+}
+
+// parseStrings parses a section made of strings, calling add for each.
+func parseStrings(data []byte, add func([]byte) error) error {
+	for len(data) > 0 {
+		var s []byte
+		var err error
+		if s, data, err = parseString(data); err != nil {
+			return err
+		}
+		if err := add(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseExtension parses an extension section, which is ignored unless it
+// is critical.
+func parseExtension(data []byte) error {
+	name, rest, err := parseString(data)
+	if err != nil {
+		return err
+	}
+	if len(rest) < 1 {
+		return errShortRead
+	}
+	if rest[0] != 0 {
+		return fmt.Errorf("krl: unsupported critical extension %q", name)
+	}
+	return nil
+}
+
+// ParseKRL parses a KRL in the binary format. If the KRL is signed, the
+// signatures are verified and the keys that made them are returned in
+// SigningKeys; it is up to the caller to check that they are trusted.
+func ParseKRL(in []byte) (*KRL, error) {
+	magic, rest, err := parseU64(in)
+	if err != nil {
+		return nil, err
+	}
+	if magic != krlMagic {
+		return nil, errors.New("krl: invalid KRL magic")
+	}
+	if len(rest) < 4 {
+		return nil, errShortRead
+	}
+	if version := binary.BigEndian.Uint32(rest); version != krlFormatVersion {
+		return nil, fmt.Errorf("krl: unsupported KRL format version %d", version)
+	}
+	rest = rest[4:]
+
+	k := New()
+	var date uint64
+	if k.Version, rest, err = parseU64(rest); err != nil {
+		return nil, err
+	}
+	if date, rest, err = parseU64(rest); err != nil {
+		return nil, err
+	}
+	if date != 0 {
+		k.GeneratedDate = time.Unix(int64(date), 0)
+	}
+	if _, rest, err = parseU64(rest); err != nil { // flags
+		return nil, err
+	}
+	if _, rest, err = parseString(rest); err != nil { // reserved
+		return nil, err
+	}
+	var comment []byte
+	if comment, rest, err = parseString(rest); err != nil {
+		return nil, err
+	}
+	k.Comment = string(comment)
+
+	for len(rest) > 0 {
+		typ, data, next, err := parseSection(rest)
+		if err != nil {
+			return nil, err
+		}
+		if typ == sectionSignature {
+			// The signature covers everything up to the signing key.
+			signed := in[:len(in)-len(next)]
+			if err := k.verifySignature(data, signed, &next); err != nil {
+				return nil, err
+			}
+			rest = next
+			continue
+		}
+		if len(k.SigningKeys) > 0 {
+			return nil, errors.New("krl: section after signature")
+		}
+		switch typ {
+		case sectionCertificates:
+			err = k.parseCertificates(data)
+		case sectionExplicitKey:
+			err = parseStrings(data, func(blob []byte) error {
+				key, err := ssh.ParsePublicKey(blob)
+				if err != nil {
+					return err
+				}
+				k.RevokeKey(key)
+				return nil
+			})
+		case sectionFingerprintSHA1:
+			err = parseStrings(data, k.RevokeKeySHA1)
+		case sectionFingerprintSHA256:
+			err = parseStrings(data, k.RevokeKeySHA256)
+		case sectionExtension:
+			err = parseExtension(data)
+		default:
+			err = fmt.Errorf("krl: unsupported section type %d", typ)
+		}
+		if err != nil {
+			return nil, err
+		}
+		rest = next
+	}
+	return k, nil
+}
+
+// verifySignature verifies the signature that follows a signature section
+// whose data is keyBlob, and consumes it from rest.
+func (k *KRL) verifySignature(keyBlob, signed []byte, rest *[]byte) error {
+	key, err := ssh.ParsePublicKey(keyBlob)
+	if err != nil {
+		return err
+	}
+	sigBlob, next, err := parseString(*rest)
+	if err != nil {
+		return err
+	}
+	sig := new(ssh.Signature)
+	if err := ssh.Unmarshal(sigBlob, sig); err != nil {
+		return fmt.Errorf("krl: invalid signature: %v", err)
+	}
+	if err := key.Verify(signed, sig); err != nil {
+		return fmt.Errorf("krl: invalid signature: %v", err)
+	}
+	k.SigningKeys = append(k.SigningKeys, key)
+	*rest = next
+	return nil
+}
+
+func (k *KRL) parseCertificates(data []byte) error {
+	caKey, rest, err := parseString(data)
+	if err != nil {
+		return err
+	}
+	var ca ssh.PublicKey
+	if len(caKey) > 0 {
+		if ca, err = ssh.ParsePublicKey(caKey); err != nil {
+			return err
+		}
+	}
+	if _, rest, err = parseString(rest); err != nil { // reserved
+		return err
+	}
+	r := k.revokedCerts(ca)
+
+	// The serials are merged once all sections are parsed.
+	var ranges []serialRange
+	for len(rest) > 0 {
+		typ, data, next, err := parseSection(rest)
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case certSectionSerialList:
+			for len(data) > 0 {
+				var serial uint64
+				if serial, data, err = parseU64(data); err != nil {
+					return err
+				}
+				if serial == 0 {
+					return errors.New("krl: revoked serial 0")
+				}
+				ranges = append(ranges, serialRange{serial, serial})
+			}
+		case certSectionSerialRange:
+			var min, max uint64
+			if min, data, err = parseU64(data); err != nil {
+				return err
+			}
+			if max, data, err = parseU64(data); err != nil {
+				return err
+			}
+			if len(data) > 0 {
+				return errors.New("krl: trailing data in serial range")
+			}
+			if min == 0 || min > max {
+				return fmt.Errorf("krl: invalid serial range %d-%d", min, max)
+			}
+			ranges = append(ranges, serialRange{min, max})
+		case certSectionSerialBitmap:
+			ranges, err = parseBitmap(data, ranges)
+		case certSectionKeyID:
+			err = parseStrings(data, func(id []byte) error {
+				r.keyIDs[string(id)] = true
+				return nil
+			})
+		case certSectionExtension:
+			err = parseExtension(data)
+		default:
+			err = fmt.Errorf("krl: unsupported certificate section type %d", typ)
+		}
+		if err != nil {
+			return err
+		}
+		rest = next
+	}
+	r.addSerialRanges(ranges)
+	return nil
+}
+
+// parseBitmap parses a bitmap of revoked serials, in which bit i is the
+// serial offset+i, and appends its runs of serials to ranges.
+func parseBitmap(data []byte, ranges []serialRange) ([]serialRange, error) {
+	offset, rest, err := parseU64(data)
+	if err != nil {
+		return nil, err
+	}
+	mpint, rest, err := parseString(rest)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("krl: trailing data in serial bitmap")
+	}
+	if len(mpint) > 0 && mpint[0]&0x80 != 0 {
+		return nil, errors.New("krl: negative serial bitmap")
+	}
+	bitmap := new(big.Int).SetBytes(mpint)
+	n := bitmap.BitLen()
+	if n > 0 && offset+uint64(n-1) < offset {
+		return nil, errors.New("krl: serial bitmap overflows")
+	}
+	if n > 0 && offset == 0 && bitmap.Bit(0) != 0 {
+		return nil, errors.New("krl: revoked serial 0")
+	}
+	// Add the runs of set bits as ranges.
+	for i := 0; i < n; i++ {
+		if bitmap.Bit(i) == 0 {
+			continue
+		}
+		j := i
+		for j+1 < n && bitmap.Bit(j+1) != 0 {
+			j++
+		}
+		ranges = append(ranges, serialRange{offset + uint64(i), offset + uint64(j)})
+		i = j
+	}
+	return ranges, nil
+}
@@ -0,0 +1,380 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package krl
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/testdata"
+)
+
+func testSigner(t *testing.T, name string) ssh.Signer {
+	signer, err := ssh.ParsePrivateKey(testdata.PEMBytes[name])
+	if err != nil {
+		t.Fatalf("ParsePrivateKey(%q): %v", name, err)
+	}
+	return signer
+}
+
+// testCert returns a certificate of key, signed by ca. It is not actually
+// signed, as the KRL doesn't check signatures.
+func testCert(key, ca ssh.PublicKey, serial uint64, keyID string) *ssh.Certificate {
+	return &ssh.Certificate{
+		Key:          key,
+		Serial:       serial,
+		CertType:     ssh.UserCert,
+		KeyId:        keyID,
+		SignatureKey: ca,
+	}
+}
+
+func TestAddSerials(t *testing.T) {
+	for _, tc := range []struct {
+		add  []serialRange
+		want []serialRange
+	}{
+		{[]serialRange{{5, 5}}, []serialRange{{5, 5}}},
+		{[]serialRange{{5, 5}, {3, 3}, {7, 7}}, []serialRange{{3, 3}, {5, 5}, {7, 7}}},
+		{[]serialRange{{5, 5}, {6, 6}, {4, 4}}, []serialRange{{4, 6}}},
+		{[]serialRange{{1, 2}, {10, 20}, {30, 40}, {15, 35}}, []serialRange{{1, 2}, {10, 40}}},
+		{[]serialRange{{10, 20}, {1, 100}}, []serialRange{{1, 100}}},
+		{[]serialRange{{10, 20}, {12, 13}}, []serialRange{{10, 20}}},
+		{[]serialRange{{1, 1}, {1<<64 - 1, 1<<64 - 1}, {2, 1<<64 - 2}}, []serialRange{{1, 1<<64 - 1}}},
+	} {
+		var r revokedCerts
+		for _, s := range tc.add {
+			r.addSerials(s.min, s.max)
+		}
+		if !reflect.DeepEqual(r.serials, tc.want) {
+			t.Errorf("adding %v: got %v, want %v", tc.add, r.serials, tc.want)
+		}
+
+		r = revokedCerts{}
+		r.addSerialRanges(append([]serialRange{}, tc.add...))
+		if !reflect.DeepEqual(r.serials, tc.want) {
+			t.Errorf("adding ranges %v: got %v, want %v", tc.add, r.serials, tc.want)
+		}
+	}
+}
+
+func TestManySerials(t *testing.T) {
+	const n = 100000
+	ca := testSigner(t, "ca").PublicKey()
+	user := testSigner(t, "user").PublicKey()
+
+	k := New()
+	for i := uint64(1); i <= n; i++ {
+		if err := k.RevokeCertificateSerials(ca, 2*i, 2*i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := k.Marshal(rand.Reader)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	parsed, err := ParseKRL(data)
+	if err != nil {
+		t.Fatalf("ParseKRL: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, k) {
+		t.Error("KRL changed after a round trip")
+	}
+	if !parsed.IsCertRevoked(testCert(user, ca, 2*n, "")) || parsed.IsCertRevoked(testCert(user, ca, 2*n-1, "")) {
+		t.Error("wrong serials revoked")
+	}
+
+	// A bitmap of alternating bits has as many ranges.
+	empty, err := New().Marshal(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bitmap := appendString(appendU64(nil, 1), bytes.Repeat([]byte{0x55}, n/8))
+	certs := appendString(appendString(nil, ca.Marshal()), nil)
+	certs = appendSection(certs, certSectionSerialBitmap, bitmap)
+	parsed, err = ParseKRL(appendSection(empty, sectionCertificates, certs))
+	if err != nil {
+		t.Fatalf("ParseKRL: %v", err)
+	}
+	if got := len(parsed.revokedCerts(ca).serials); got != n/2 {
+		t.Errorf("got %d serial ranges, want %d", got, n/2)
+	}
+	if !parsed.IsCertRevoked(testCert(user, ca, 1, "")) || parsed.IsCertRevoked(testCert(user, ca, 2, "")) {
+		t.Error("wrong serials revoked")
+	}
+}
+
+func TestIsRevoked(t *testing.T) {
+	ca := testSigner(t, "ca").PublicKey()
+	otherCA := testSigner(t, "ecdsa").PublicKey()
+	user := testSigner(t, "user").PublicKey()
+	revoked := testSigner(t, "ed25519").PublicKey()
+	hashed := testSigner(t, "rsa").PublicKey()
+	hashedSHA256 := testSigner(t, "p256-openssh-format").PublicKey()
+
+	k := New()
+	k.RevokeKey(revoked)
+	h1 := sha1.Sum(hashed.Marshal())
+	if err := k.RevokeKeySHA1(h1[:]); err != nil {
+		t.Fatal(err)
+	}
+	h256 := sha256.Sum256(hashedSHA256.Marshal())
+	if err := k.RevokeKeySHA256(h256[:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.RevokeCertificateSerials(ca, 10, 20); err != nil {
+		t.Fatal(err)
+	}
+	k.RevokeCertificateKeyID(ca, "mallory")
+	k.RevokeCertificateKeyID(nil, "eve")
+
+	for _, tc := range []struct {
+		desc string
+		key  ssh.PublicKey
+		want bool
+	}{
+		{"plain key", user, false},
+		{"revoked key", revoked, true},
+		{"SHA-1 hash", hashed, true},
+		{"SHA-256 hash", hashedSHA256, true},
+		{"certificate", testCert(user, ca, 9, "alice"), false},
+		{"revoked serial", testCert(user, ca, 10, "alice"), true},
+		{"revoked serial of other CA", testCert(user, otherCA, 10, "alice"), false},
+		{"serial 0", testCert(user, ca, 0, "alice"), false},
+		{"revoked key ID", testCert(user, ca, 0, "mallory"), true},
+		{"revoked key ID of other CA", testCert(user, otherCA, 0, "mallory"), false},
+		{"revoked key ID of any CA", testCert(user, otherCA, 0, "eve"), true},
+		{"certificate of revoked key", testCert(revoked, ca, 1, "alice"), true},
+		{"certificate of revoked CA", testCert(user, revoked, 1, "alice"), true},
+	} {
+		if got := k.IsRevoked(tc.key); got != tc.want {
+			t.Errorf("%s: IsRevoked = %v, want %v", tc.desc, got, tc.want)
+		}
+	}
+
+	if err := k.RevokeCertificateSerials(ca, 0, 5); err == nil {
+		t.Error("RevokeCertificateSerials succeeded for serial 0")
+	}
+	if err := k.RevokeCertificateSerials(ca, 5, 4); err == nil {
+		t.Error("RevokeCertificateSerials succeeded for an empty range")
+	}
+	if err := k.RevokeKeySHA256(h1[:]); err == nil {
+		t.Error("RevokeKeySHA256 succeeded for a SHA-1 hash")
+	}
+}
+
+func TestMarshalParse(t *testing.T) {
+	ca := testSigner(t, "ca").PublicKey()
+	user := testSigner(t, "user").PublicKey()
+
+	k := New()
+	k.Version = 3
+	k.Comment = "test KRL"
+	k.RevokeKey(testSigner(t, "ed25519").PublicKey())
+	h1 := sha1.Sum(user.Marshal())
+	k.RevokeKeySHA1(h1[:])
+	k.RevokeCertificateSerials(ca, 1, 1)
+	k.RevokeCertificateSerials(ca, 3, 3)
+	k.RevokeCertificateSerials(ca, 10, 20)
+	k.RevokeCertificateSerials(ca, 30, 30)
+	k.RevokeCertificateKeyID(nil, "eve")
+
+	signers := []ssh.Signer{testSigner(t, "rsa"), testSigner(t, "ecdsa")}
+	data, err := k.Marshal(rand.Reader, signers...)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	parsed, err := ParseKRL(data)
+	if err != nil {
+		t.Fatalf("ParseKRL: %v", err)
+	}
+	if parsed.Version != k.Version || parsed.Comment != k.Comment || !parsed.GeneratedDate.IsZero() {
+		t.Errorf("got version %d, comment %q and date %v, want %d, %q and none", parsed.Version, parsed.Comment, parsed.GeneratedDate, k.Version, k.Comment)
+	}
+	if len(parsed.SigningKeys) != len(signers) {
+		t.Fatalf("got %d signing keys, want %d", len(parsed.SigningKeys), len(signers))
+	}
+	for i, key := range parsed.SigningKeys {
+		if !reflect.DeepEqual(key.Marshal(), signers[i].PublicKey().Marshal()) {
+			t.Errorf("signing key %d: got %s, want %s", i, key.Type(), signers[i].PublicKey().Type())
+		}
+	}
+	parsed.SigningKeys = nil
+	if !reflect.DeepEqual(parsed, k) {
+		t.Errorf("got %+v, want %+v", parsed, k)
+	}
+
+	// Changing a byte breaks the signature.
+	data[len(data)-100] ^= 1
+	if _, err := ParseKRL(data); err == nil {
+		t.Error("ParseKRL succeeded for a corrupt signature")
+	}
+}
+
+// opensshKRL was made with "ssh-keygen -k -z 42" for opensshCAKey, from the
+// specification:
+//
+//	serial: 5
+//	serial: 10-20
+//	serial: 30
+//	serial: 32
+//	...
+//	serial: 52
+//	id: bob
+//
+// ssh-keygen encoded the serials as a bitmap.
+const opensshKRL = `U1NIS1JMCgAAAAABAAAAAAAAACoAAAAAatTxywAAAAAAAAAAAAAAAAAAAAABAAAAXwAAAD
+MAAAALc3NoLWVkMjU1MTkAAAAgNq3bhqI1PULWsy+S/mwIHAggkzix9CfFAKyosrCPv+AA
+AAAAIgAAABMAAAAAAAAABQAAAAcAqqqqAP/hIwAAAAcAAAADYm9i`
+
+const opensshCAKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDat24aiNT1C1rMvkv5sCBwIIJM4sfQnxQCsqLKwj7/g"
+
+func TestParseOpenSSH(t *testing.T) {
+	data, err := base64.StdEncoding.DecodeString(strings.Replace(opensshKRL, "\n", "", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := ParseKRL(data)
+	if err != nil {
+		t.Fatalf("ParseKRL: %v", err)
+	}
+	if k.Version != 42 {
+		t.Errorf("got version %d, want 42", k.Version)
+	}
+	ca, _, _, _, err := ssh.ParseAuthorizedKey([]byte(opensshCAKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := k.revokedCerts(ca)
+	want := []serialRange{{5, 5}, {10, 20}}
+	for s := uint64(30); s <= 52; s += 2 {
+		want = append(want, serialRange{s, s})
+	}
+	if !reflect.DeepEqual(r.serials, want) {
+		t.Errorf("got serials %v, want %v", r.serials, want)
+	}
+	if !reflect.DeepEqual(r.keyIDs, map[string]bool{"bob": true}) {
+		t.Errorf("got key IDs %v, want bob", r.keyIDs)
+	}
+
+	// Writing the KRL back and parsing it again doesn't change it.
+	data, err = k.Marshal(rand.Reader)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	again, err := ParseKRL(data)
+	if err != nil {
+		t.Fatalf("ParseKRL: %v", err)
+	}
+	if !reflect.DeepEqual(again, k) {
+		t.Errorf("got %+v after a round trip, want %+v", again, k)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	k := New()
+	k.RevokeKey(testSigner(t, "ed25519").PublicKey())
+	valid, err := k.Marshal(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		desc string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", valid[:len(valid)-1]},
+		{"bad magic", append([]byte("SSHKRL\n\x01"), valid[8:]...)},
+		{"bad format version", append(append([]byte{}, valid[:11]...), append([]byte{2}, valid[12:]...)...)},
+		{"unknown section", append(append([]byte{}, valid...), 6, 0, 0, 0, 0)},
+		{"critical extension", append(append([]byte{}, valid...), sectionExtension, 0, 0, 0, 6, 0, 0, 0, 1, 'x', 1)},
+	} {
+		if _, err := ParseKRL(tc.data); err == nil {
+			t.Errorf("%s: ParseKRL succeeded", tc.desc)
+		}
+	}
+
+	signed, err := k.Marshal(rand.Reader, testSigner(t, "ecdsa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed = append(signed, sectionExtension, 0, 0, 0, 6, 0, 0, 0, 1, 'x', 0)
+	if _, err := ParseKRL(signed); err == nil {
+		t.Error("ParseKRL succeeded for a section after the signature")
+	}
+
+	// Non-critical extensions are ignored.
+	data := append(append([]byte{}, valid...), sectionExtension, 0, 0, 0, 6, 0, 0, 0, 1, 'x', 0)
+	if _, err := ParseKRL(data); err != nil {
+		t.Errorf("ParseKRL with a non-critical extension: %v", err)
+	}
+}
+
+func TestPublicKeyCallback(t *testing.T) {
+	revoked := testSigner(t, "ed25519").PublicKey()
+	k := New()
+	k.RevokeKey(revoked)
+
+	errNext := errors.New("next callback")
+	callback := k.PublicKeyCallback(func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		return nil, errNext
+	})
+	if _, err := callback(nil, testSigner(t, "ecdsa").PublicKey()); err != errNext {
+		t.Errorf("got %v for a valid key, want the error of the next callback", err)
+	}
+	if _, err := callback(nil, revoked); err == nil || err == errNext {
+		t.Errorf("got %v for a revoked key, want a revocation error", err)
+	}
+}
+
+func TestCertChecker(t *testing.T) {
+	caSigner := testSigner(t, "ca")
+	user := testSigner(t, "user").PublicKey()
+	k := New()
+	k.RevokeCertificateSerials(caSigner.PublicKey(), 2, 2)
+
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return reflect.DeepEqual(auth.Marshal(), caSigner.PublicKey().Marshal())
+		},
+		IsRevoked: k.IsCertRevoked,
+	}
+	for _, serial := range []uint64{1, 2} {
+		cert := &ssh.Certificate{
+			Key:             user,
+			Serial:          serial,
+			CertType:        ssh.UserCert,
+			ValidPrincipals: []string{"user"},
+			ValidBefore:     ssh.CertTimeInfinity,
+		}
+		if err := cert.SignCert(rand.Reader, caSigner); err != nil {
+			t.Fatal(err)
+		}
+		_, err := checker.Authenticate(testConnMetadata("user"), cert)
+		if serial == 1 && err != nil {
+			t.Errorf("serial %d: %v", serial, err)
+		} else if serial == 2 && err == nil {
+			t.Errorf("serial %d: revoked certificate accepted", serial)
+		}
+	}
+}
+
+type testConnMetadata string
+
+func (c testConnMetadata) User() string        { return string(c) }
+func (testConnMetadata) SessionID() []byte     { return nil }
+func (testConnMetadata) ClientVersion() []byte { return nil }
+func (testConnMetadata) ServerVersion() []byte { return nil }
+func (testConnMetadata) RemoteAddr() net.Addr  { return nil }
+func (testConnMetadata) LocalAddr() net.Addr   { return nil }
@@ -0,0 +1,144 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Modulus is a Diffie-Hellman group that a server can offer for the
+// diffie-hellman-group-exchange key exchanges.
+type Modulus struct {
+	// Bits is the size of Prime in bits.
+	Bits int
+
+	Generator *big.Int
+
+	// Prime is a safe prime, that is (Prime-1)/2 is also prime.
+	Prime *big.Int
+}
+
+// The values of the type and tests fields of moduli files, see moduli(5).
+const (
+	moduliTypeSafe = 2
+
+	moduliTestsComposite = 0x01
+)
+
+// ParseModuli parses a list of groups in the format of the OpenSSH moduli
+// file, usually found at /etc/ssh/moduli. Entries that are not safe primes,
+// or that are not known to have passed primality tests, are skipped, like
+// OpenSSH does.
+func ParseModuli(r io.Reader) ([]Modulus, error) {
+	var moduli []Modulus
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		// The fields are: time, type, tests, tries, size, generator
+		// and modulus.
+		fields := strings.Fields(line)
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("ssh: moduli line %d: got %d fields, want 7", lineNum, len(fields))
+		}
+		typ, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("ssh: moduli line %d: invalid type: %v", lineNum, err)
+		}
+		tests, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("ssh: moduli line %d: invalid tests: %v", lineNum, err)
+		}
+		size, err := strconv.ParseUint(fields[4], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("ssh: moduli line %d: invalid size: %v", lineNum, err)
+		}
+		g, ok := new(big.Int).SetString(fields[5], 16)
+		if !ok || g.Sign() <= 0 {
+			return nil, fmt.Errorf("ssh: moduli line %d: invalid generator", lineNum)
+		}
+		p, ok := new(big.Int).SetString(fields[6], 16)
+		if !ok || p.Sign() <= 0 {
+			return nil, fmt.Errorf("ssh: moduli line %d: invalid modulus", lineNum)
+		}
+		// The size field is the number of bits minus one.
+		if p.BitLen() != int(size)+1 {
+			return nil, fmt.Errorf("ssh: moduli line %d: modulus has %d bits, want %d", lineNum, p.BitLen(), size+1)
+		}
+		if g.Cmp(bigOne) <= 0 || g.Cmp(p) >= 0 {
+			return nil, fmt.Errorf("ssh: moduli line %d: generator out of range", lineNum)
+		}
+
+		if typ != moduliTypeSafe || tests&moduliTestsComposite != 0 || tests == 0 {
+			continue
+		}
+		moduli = append(moduli, Modulus{
+			Bits:      p.BitLen(),
+			Generator: g,
+			Prime:     p,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return moduli, nil
+}
+
+// defaultModuli are the groups offered for group exchange if
+// ServerConfig.GroupExchangeModuli has no suitable group. They are the
+// groups 14, 16 and 18 of RFC 3526, and are set in the init function of
+// kex.go.
+var defaultModuli []Modulus
+
+// chooseModulus picks a group of at least minBits and at most maxBits bits
+// for a client that prefers wantBits, like OpenSSH does: it uses the
+// smallest size that is at least wantBits, or else the largest size, and
+// picks randomly among the groups of that size. It returns nil if there is
+// no suitable group.
+func chooseModulus(moduli []Modulus, randSource io.Reader, minBits, wantBits, maxBits int) (*Modulus, error) {
+	best, count := 0, 0
+	for _, m := range moduli {
+		if m.Bits < minBits || m.Bits > maxBits {
+			continue
+		}
+		if best == 0 || (best < wantBits && m.Bits > best) || (m.Bits >= wantBits && m.Bits < best) {
+			best, count = m.Bits, 0
+		}
+		if m.Bits == best {
+			count++
+		}
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	n, err := rand.Int(randSource, big.NewInt(int64(count)))
+	if err != nil {
+		return nil, err
+	}
+	which := int(n.Int64())
+	for i := range moduli {
+		if moduli[i].Bits != best {
+			continue
+		}
+		if which == 0 {
+			return &moduli[i], nil
+		}
+		which--
+	}
+	panic("unreachable")
+}
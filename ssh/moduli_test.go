@@ -0,0 +1,163 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"crypto"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// modp3072 is the 3072-bit MODP group of RFC 3526, in the format of the
+// OpenSSH moduli file.
+const modp3072 = "20240101000000 2 6 100 3071 2 " +
+	"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74" +
+	"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437" +
+	"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+	"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05" +
+	"98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB" +
+	"9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+	"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718" +
+	"3995497CEA956AE515D2261898FA051015728E5A8AAAC42DAD33170D04507A33" +
+	"A85521ABDF1CBA64ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7" +
+	"ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6BF12FFA06D98A0864" +
+	"D87602733EC86A64521F2B18177B200CBBE117577A615D6C770988C0BAD946E2" +
+	"08E24FA074E5AB3143DB5BFCE0FD108E4B82D120A93AD2CAFFFFFFFFFFFFFFFF"
+
+func TestParseModuli(t *testing.T) {
+	group14 := fmt.Sprintf("20240101000000 2 6 100 2047 2 %X", defaultModuli[0].Prime)
+	input := strings.Join([]string{
+		"# Time Type Tests Tries Size Generator Modulus",
+		"",
+		modp3072,
+		// Not a safe prime.
+		strings.Replace(group14, " 2 6 ", " 1 6 ", 1),
+		// Known to be composite.
+		strings.Replace(group14, " 2 6 ", " 2 1 ", 1),
+		// Never tested.
+		strings.Replace(group14, " 2 6 ", " 2 0 ", 1),
+		"  " + group14 + "  ",
+	}, "\n")
+
+	moduli, err := ParseModuli(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseModuli: %v", err)
+	}
+	if len(moduli) != 2 {
+		t.Fatalf("got %d moduli, want 2", len(moduli))
+	}
+	if moduli[0].Bits != 3072 || moduli[0].Generator.Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("got %d bit modulus with generator %v, want 3072 bits and generator 2", moduli[0].Bits, moduli[0].Generator)
+	}
+	if !reflect.DeepEqual(moduli[1], defaultModuli[0]) {
+		t.Errorf("got %v, want group 14", moduli[1])
+	}
+
+	for _, bad := range []string{
+		"20240101000000 2 6 100 2047 2",
+		strings.Replace(group14, " 2047 ", " 2048 ", 1),
+		strings.Replace(group14, " 2047 2 ", " 2047 1 ", 1),
+		strings.Replace(group14, " 2047 2 ", " 2047 x ", 1),
+		strings.Replace(group14, " 100 ", " 100 -1 ", 1),
+		strings.Replace(group14, "20240101000000 2 ", "20240101000000 two ", 1),
+	} {
+		if _, err := ParseModuli(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseModuli(%.40q...) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestChooseModulus(t *testing.T) {
+	moduli := []Modulus{
+		{Bits: 8192},
+		{Bits: 2048},
+		{Bits: 4096},
+		{Bits: 4096},
+	}
+	for _, tt := range []struct {
+		min, want, max int
+		bits           int
+	}{
+		{2048, 2048, 8192, 2048},
+		{2048, 3072, 8192, 4096},
+		{2048, 4096, 8192, 4096},
+		{2048, 6144, 8192, 8192},
+		{2048, 8192, 8192, 8192},
+		{2048, 8192, 6144, 4096},
+		{3072, 3072, 3072, 0},
+		{4096, 4096, 4096, 4096},
+	} {
+		m, err := chooseModulus(moduli, rand.Reader, tt.min, tt.want, tt.max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var bits int
+		if m != nil {
+			bits = m.Bits
+		}
+		if bits != tt.bits {
+			t.Errorf("chooseModulus(%d, %d, %d) chose %d bits, want %d", tt.min, tt.want, tt.max, bits, tt.bits)
+		}
+	}
+}
+
+// recordingConn records the packets read from a packetConn.
+type recordingConn struct {
+	packetConn
+	packets [][]byte
+}
+
+func (c *recordingConn) readPacket() ([]byte, error) {
+	p, err := c.packetConn.readPacket()
+	c.packets = append(c.packets, p)
+	return p, err
+}
+
+func TestGroupExchangeModuli(t *testing.T) {
+	moduli, err := ParseModuli(strings.NewReader(modp3072))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := memPipe()
+	defer a.Close()
+	defer b.Close()
+	client := &recordingConn{packetConn: a}
+
+	type kexResultErr struct {
+		result *kexResult
+		err    error
+	}
+	s := make(chan kexResultErr, 1)
+	go func() {
+		kex := &dhGEXSHA{hashFunc: crypto.SHA256, moduli: moduli}
+		r, e := kex.Server(b, rand.Reader, &handshakeMagics{}, testSigners["ecdsa"].(AlgorithmSigner), testSigners["ecdsa"].PublicKey().Type())
+		s <- kexResultErr{r, e}
+	}()
+	kex := &dhGEXSHA{hashFunc: crypto.SHA256}
+	clientRes, err := kex.Client(client, rand.Reader, &handshakeMagics{})
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	serverRes := <-s
+	if serverRes.err != nil {
+		t.Fatalf("server: %v", serverRes.err)
+	}
+	if !reflect.DeepEqual(clientRes, serverRes.result) {
+		t.Errorf("mismatch %#v, %#v", clientRes, serverRes.result)
+	}
+
+	var group kexDHGexGroupMsg
+	if err := Unmarshal(client.packets[0], &group); err != nil {
+		t.Fatal(err)
+	}
+	if group.P.Cmp(moduli[0].Prime) != 0 {
+		t.Errorf("server chose a %d bit group, want the configured 3072 bit group", group.P.BitLen())
+	}
+}
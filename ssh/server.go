@@ -25,12 +25,12 @@ type Permissions struct {
 	// defines "force-command" (only allow the given command to
 	// execute) and "source-address" (only allow connections from
 	// the given address). The SSH package currently only enforces
-	// the "source-address" critical option. It is up to server
-	// implementations to enforce other critical options, such as
-	// "force-command", by checking them after the SSH handshake
-	// is successful. In general, SSH servers should reject
-	// connections that specify critical options that are unknown
-	// or not supported.
+	// the "source-address" and "verify-required" critical options.
+	// It is up to server implementations to enforce other critical
+	// options, such as "force-command", by checking them after the
+	// SSH handshake is successful. In general, SSH servers should
+	// reject connections that specify critical options that are
+	// unknown or not supported.
 	CriticalOptions map[string]string
 
 	// Extensions are extra functionality that the server may
@@ -45,6 +45,17 @@ type Permissions struct {
 	Extensions map[string]string
 }
 
+// ForceCommand returns the command set by the "force-command" critical
+// option, if any. If set, the server must run it instead of any command,
+// shell or subsystem requested by the client, as OpenSSH does.
+func (p *Permissions) ForceCommand() (command string, ok bool) {
+	if p == nil {
+		return "", false
+	}
+	command, ok = p.CriticalOptions[CertCriticalOptionForceCommand]
+	return command, ok
+}
+
 type GSSAPIWithMICConfig struct {
 	// AllowLogin, must be set, is called when gssapi-with-mic
 	// authentication is selected (RFC 4462 section 3). The srcName is from the
@@ -117,6 +128,13 @@ type ServerConfig struct {
 	// GSSAPIWithMICConfig includes gssapi server and callback, which if both non-nil, is used
 	// when gssapi-with-mic authentication is selected (RFC 4462 section 3).
 	GSSAPIWithMICConfig *GSSAPIWithMICConfig
+
+	// GroupExchangeModuli lists the groups offered to clients that use
+	// the diffie-hellman-group-exchange-sha256 key exchange, which must be
+	// enabled in Config.KeyExchanges. See ParseModuli. If none of them
+	// has a size requested by the client, the 2048, 4096 and 8192-bit
+	// groups of RFC 3526 are used.
+	GroupExchangeModuli []Modulus
 }
 
 // AddHostKey adds a private key as a host key. If an existing host
@@ -213,8 +231,8 @@ func NewServerConn(c net.Conn, config *ServerConfig) (*ServerConn, <-chan NewCha
 
 // signAndMarshal signs the data with the appropriate algorithm,
 // and serializes the result in SSH wire format.
-func signAndMarshal(k Signer, rand io.Reader, data []byte) ([]byte, error) {
-	sig, err := k.Sign(rand, data)
+func signAndMarshal(k AlgorithmSigner, rand io.Reader, data []byte, algo string) ([]byte, error) {
+	sig, err := k.SignWithAlgorithm(rand, data, underlyingAlgo(algo))
 	if err != nil {
 		return nil, err
 	}
@@ -259,6 +277,13 @@ func (s *connection) serverHandshake(config *ServerConfig) (*Permissions, error)
 	if packet, err = s.transport.readPacket(); err != nil {
 		return nil, err
 	}
+	// The client may send its extensions before the service request. It
+	// has none that the server understands. See RFC 8308, section 2.4.
+	if packet[0] == msgExtInfo {
+		if packet, err = s.transport.readPacket(); err != nil {
+			return nil, err
+		}
+	}
 
 	var serviceRequest serviceRequestMsg
 	if err = Unmarshal(packet, &serviceRequest); err != nil {
@@ -283,12 +308,7 @@ func (s *connection) serverHandshake(config *ServerConfig) (*Permissions, error)
 }
 
 func isAcceptableAlgo(algo string) bool {
-	switch algo {
-	case KeyAlgoRSA, KeyAlgoDSA, KeyAlgoECDSA256, KeyAlgoECDSA384, KeyAlgoECDSA521, KeyAlgoSKECDSA256, KeyAlgoED25519, KeyAlgoSKED25519,
-		CertAlgoRSAv01, CertAlgoDSAv01, CertAlgoECDSA256v01, CertAlgoECDSA384v01, CertAlgoECDSA521v01, CertAlgoSKECDSA256v01, CertAlgoED25519v01, CertAlgoSKED25519v01:
-		return true
-	}
-	return false
+	return contains(supportedPubKeyAuthAlgos, underlyingAlgo(algo))
 }
 
 func checkSourceAddress(addr net.Addr, sourceAddrs string) error {
@@ -321,6 +341,23 @@ func checkSourceAddress(addr net.Addr, sourceAddrs string) error {
 	return fmt.Errorf("ssh: remote address %v is not allowed because of source-address restriction", addr)
 }
 
+// skFlagUserVerified is set in the flags of security key signatures if the
+// key verified the user, for instance with a PIN.
+const skFlagUserVerified = 0x04
+
+// checkUserVerified checks that sig was made by a security key that
+// verified the user, as required by the "verify-required" option.
+func checkUserVerified(sig *Signature) error {
+	var skf skFields
+	if (sig.Format != KeyAlgoSKECDSA256 && sig.Format != KeyAlgoSKED25519) || Unmarshal(sig.Rest, &skf) != nil {
+		return errors.New("ssh: verify-required option requires a security key")
+	}
+	if skf.Flags&skFlagUserVerified == 0 {
+		return errors.New("ssh: security key signature did not verify the user")
+	}
+	return nil
+}
+
 func gssExchangeToken(gssapiConfig *GSSAPIWithMICConfig, firstToken []byte, s *connection,
 	sessionID []byte, userAuthReq userAuthRequestMsg) (authErr error, perms *Permissions, err error) {
 	gssAPIServer := gssapiConfig.Server
@@ -515,6 +552,10 @@ userAuthLoop:
 			if err != nil {
 				return nil, err
 			}
+			if !contains(algorithmsForKeyFormat(pubKey.Type()), algo) {
+				authErr = fmt.Errorf("ssh: algorithm %q not compatible with key type %q", algo, pubKey.Type())
+				break
+			}
 
 			candidate, ok := cache.get(s.user, pubKeyData)
 			if !ok {
@@ -562,6 +603,10 @@ userAuthLoop:
 					authErr = fmt.Errorf("ssh: algorithm %q not accepted", sig.Format)
 					break
 				}
+				if underlyingAlgo(algo) != sig.Format {
+					authErr = fmt.Errorf("ssh: signature %q not compatible with selected algorithm %q", sig.Format, algo)
+					break
+				}
 				signedData := buildDataSignedForAuth(sessionID, userAuthReq, algoBytes, pubKeyData)
 
 				if err := pubKey.Verify(signedData, sig); err != nil {
@@ -570,6 +615,11 @@ userAuthLoop:
 
 				authErr = candidate.result
 				perms = candidate.perms
+				if authErr == nil && perms != nil {
+					if _, ok := perms.CriticalOptions[CertCriticalOptionVerifyRequired]; ok {
+						authErr = checkUserVerified(sig)
+					}
+				}
 			}
 		case "gssapi-with-mic":
 			gssapiConfig := config.GSSAPIWithMICConfig
@@ -760,6 +760,12 @@ func TestHostKeyAlgorithms(t *testing.T) {
 	clientConf.HostKeyAlgorithms = []string{KeyAlgoRSA}
 	connect(clientConf, KeyAlgoRSA)
 
+	// The RSA key can also be used with the SHA-2 signature algorithms.
+	for _, algo := range []string{KeyAlgoRSASHA256, KeyAlgoRSASHA512} {
+		clientConf.HostKeyAlgorithms = []string{algo}
+		connect(clientConf, KeyAlgoRSA)
+	}
+
 	c1, c2, err := netPipe()
 	if err != nil {
 		t.Fatalf("netPipe: %v", err)
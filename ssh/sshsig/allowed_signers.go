@@ -0,0 +1,278 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshsig
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// AllowedSigner is an entry of an allowed_signers file.
+type AllowedSigner struct {
+	// Principals are the patterns of the principals that may sign with
+	// Key, such as "user@example.com" or "*@example.com". Patterns
+	// starting with "!" exclude the principals they match.
+	Principals []string
+
+	// CertAuthority is set if Key is a certificate authority, in which
+	// case the principals sign with certificates signed by Key.
+	CertAuthority bool
+
+	// Namespaces are the patterns of the namespaces Key may sign for. If
+	// empty, Key may sign for any namespace.
+	Namespaces []string
+
+	// ValidAfter and ValidBefore limit the time for which Key is
+	// trusted. They are ignored if zero.
+	ValidAfter  time.Time
+	ValidBefore time.Time
+
+	// Key is the key or certificate authority of the principals.
+	Key ssh.PublicKey
+}
+
+// AllowedSigners is the list of entries of an allowed_signers file, see the
+// ALLOWED SIGNERS section of ssh-keygen(1).
+type AllowedSigners []*AllowedSigner
+
+// ParseAllowedSigners parses an allowed_signers file. Each line holds the
+// principal patterns, followed by optional options, the key type, the
+// base64 encoded key and an optional comment. Empty lines and lines
+// starting with '#' are skipped.
+func ParseAllowedSigners(r io.Reader) (AllowedSigners, error) {
+	var signers AllowedSigners
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		signer, err := parseAllowedSignerLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("sshsig: allowed_signers line %d: %v", lineNum, err)
+		}
+		signers = append(signers, signer)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return signers, nil
+}
+
+func parseAllowedSignerLine(line []byte) (*AllowedSigner, error) {
+	var principals []byte
+	if line[0] == '"' {
+		end := bytes.IndexByte(line[1:], '"')
+		if end < 0 {
+			return nil, errors.New("unterminated quoted principals")
+		}
+		principals, line = line[1:end+1], line[end+2:]
+	} else {
+		end := bytes.IndexAny(line, " \t")
+		if end < 0 {
+			return nil, errors.New("missing key")
+		}
+		principals, line = line[:end], line[end:]
+	}
+	if len(principals) == 0 {
+		return nil, errors.New("empty principals")
+	}
+
+	// The rest of the line has the format of an authorized_keys line.
+	key, _, options, _, err := ssh.ParseAuthorizedKey(line)
+	if err != nil {
+		return nil, err
+	}
+	signer := &AllowedSigner{
+		Principals: strings.Split(string(principals), ","),
+		Key:        key,
+	}
+	for _, opt := range options {
+		name, value := opt, ""
+		if i := strings.IndexByte(opt, '='); i >= 0 {
+			name, value = opt[:i], strings.Trim(opt[i+1:], `"`)
+		}
+		switch strings.ToLower(name) {
+		case "cert-authority":
+			signer.CertAuthority = true
+		case "namespaces":
+			signer.Namespaces = strings.Split(value, ",")
+		case "valid-after":
+			if signer.ValidAfter, err = parseTime(value); err != nil {
+				return nil, err
+			}
+		case "valid-before":
+			if signer.ValidBefore, err = parseTime(value); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported option %q", name)
+		}
+	}
+	return signer, nil
+}
+
+// parseTime parses a time in the YYYYMMDD[HHMM[SS]] format of ssh-keygen.
+// It is in the local time zone, unless it has a "Z" suffix.
+func parseTime(s string) (time.Time, error) {
+	loc := time.Local
+	if strings.HasSuffix(s, "Z") {
+		s, loc = s[:len(s)-1], time.UTC
+	}
+	var layout string
+	switch len(s) {
+	case 8:
+		layout = "20060102"
+	case 12:
+		layout = "200601021504"
+	case 14:
+		layout = "20060102150405"
+	default:
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	t, err := time.ParseInLocation(layout, s, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	return t, nil
+}
+
+// matchPattern reports whether s matches pattern, in which '*' matches any
+// sequence of characters and '?' matches any single character.
+func matchPattern(s, pattern string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == '*' {
+			for i := len(s); i >= 0; i-- {
+				if matchPattern(s[i:], pattern[1:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(s) == 0 || (pattern[0] != '?' && pattern[0] != s[0]) {
+			return false
+		}
+		s, pattern = s[1:], pattern[1:]
+	}
+	return len(s) == 0
+}
+
+// matchPatternList reports whether s matches one of patterns, and none of
+// the negated ones.
+func matchPatternList(s string, patterns []string) bool {
+	found := false
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!") {
+			if matchPattern(s, p[1:]) {
+				return false
+			}
+		} else if matchPattern(s, p) {
+			found = true
+		}
+	}
+	return found
+}
+
+// trusts reports whether the entry trusts key, which may be a certificate,
+// to sign for namespace at time t.
+func (s *AllowedSigner) trusts(key ssh.PublicKey, namespace string, t time.Time) bool {
+	if len(s.Namespaces) > 0 && !matchPatternList(namespace, s.Namespaces) {
+		return false
+	}
+	if !s.ValidAfter.IsZero() && t.Before(s.ValidAfter) {
+		return false
+	}
+	if !s.ValidBefore.IsZero() && t.After(s.ValidBefore) {
+		return false
+	}
+	if cert, ok := key.(*ssh.Certificate); ok {
+		return s.CertAuthority && bytes.Equal(cert.SignatureKey.Marshal(), s.Key.Marshal())
+	}
+	return !s.CertAuthority && bytes.Equal(key.Marshal(), s.Key.Marshal())
+}
+
+// checkCert checks that cert is a valid user certificate for principal at
+// time t. Critical options are not enforced, like ssh-keygen does.
+func checkCert(cert *ssh.Certificate, principal string, t time.Time) error {
+	if cert.CertType != ssh.UserCert {
+		return errors.New("sshsig: not a user certificate")
+	}
+	// Unlike for user authentication, certificates without
+	// principals are not valid for any principal.
+	if len(cert.ValidPrincipals) == 0 {
+		return errors.New("sshsig: certificate has no principals")
+	}
+	var options []string
+	for opt := range cert.CriticalOptions {
+		options = append(options, opt)
+	}
+	checker := &ssh.CertChecker{
+		SupportedCriticalOptions: options,
+		Clock:                    func() time.Time { return t },
+	}
+	return checker.CheckCert(principal, cert)
+}
+
+// FindPrincipals returns the principals that may sign with key for
+// namespace at time t, like "ssh-keygen -Y find-principals". For plain
+// keys, these are the principal patterns of the matching entries. For
+// certificates, these are the principals of the certificate that match the
+// patterns of the entries of their certificate authority.
+func (a AllowedSigners) FindPrincipals(key ssh.PublicKey, namespace string, t time.Time) []string {
+	var principals []string
+	for _, s := range a {
+		if !s.trusts(key, namespace, t) {
+			continue
+		}
+		cert, ok := key.(*ssh.Certificate)
+		if !ok {
+			principals = append(principals, s.Principals...)
+			continue
+		}
+		for _, p := range cert.ValidPrincipals {
+			if matchPatternList(p, s.Principals) && checkCert(cert, p, t) == nil {
+				principals = append(principals, p)
+			}
+		}
+	}
+	return principals
+}
+
+// Verify checks that sig is a valid signature of the message read from
+// message for namespace, made at time t by principal, like "ssh-keygen -Y
+// verify".
+func (a AllowedSigners) Verify(sig *Signature, message io.Reader, namespace, principal string, t time.Time) error {
+	trusted := false
+	var certErr error
+	for _, s := range a {
+		if !matchPatternList(principal, s.Principals) || !s.trusts(sig.PublicKey, namespace, t) {
+			continue
+		}
+		if cert, ok := sig.PublicKey.(*ssh.Certificate); ok {
+			if err := checkCert(cert, principal, t); err != nil {
+				certErr = err
+				continue
+			}
+		}
+		trusted = true
+		break
+	}
+	if !trusted {
+		if certErr != nil {
+			return certErr
+		}
+		return fmt.Errorf("sshsig: key is not trusted to sign for principal %q in namespace %q", principal, namespace)
+	}
+	return Verify(sig, message, namespace)
+}
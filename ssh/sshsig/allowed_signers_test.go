@@ -0,0 +1,222 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshsig
+
+import (
+	"bytes"
+	"crypto/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseAllowedSigners(t *testing.T) {
+	signers, err := ParseAllowedSigners(strings.NewReader(`
+# A comment.
+alice@example.com,!bob@example.com ` + opensshUserKey + ` alice's key
+"*@example.com" cert-authority,namespaces="git,file" ` + opensshCAKey + `
+carol valid-after="20200102",valid-before="202101020304Z" ` + opensshUserKey + `
+`))
+	if err != nil {
+		t.Fatalf("ParseAllowedSigners: %v", err)
+	}
+	if len(signers) != 3 {
+		t.Fatalf("got %d signers, want 3", len(signers))
+	}
+
+	if want := []string{"alice@example.com", "!bob@example.com"}; !reflect.DeepEqual(signers[0].Principals, want) {
+		t.Errorf("got principals %q, want %q", signers[0].Principals, want)
+	}
+	if signers[0].CertAuthority || signers[0].Namespaces != nil {
+		t.Errorf("got options for a line without options: %+v", signers[0])
+	}
+
+	if !signers[1].CertAuthority {
+		t.Error("cert-authority not set")
+	}
+	if want := []string{"git", "file"}; !reflect.DeepEqual(signers[1].Namespaces, want) {
+		t.Errorf("got namespaces %q, want %q", signers[1].Namespaces, want)
+	}
+
+	if want := time.Date(2020, 1, 2, 0, 0, 0, 0, time.Local); !signers[2].ValidAfter.Equal(want) {
+		t.Errorf("got valid-after %v, want %v", signers[2].ValidAfter, want)
+	}
+	if want := time.Date(2021, 1, 2, 3, 4, 0, 0, time.UTC); !signers[2].ValidBefore.Equal(want) {
+		t.Errorf("got valid-before %v, want %v", signers[2].ValidBefore, want)
+	}
+}
+
+func TestParseAllowedSignersErrors(t *testing.T) {
+	for _, line := range []string{
+		"alice@example.com",
+		`"alice@example.com ` + opensshUserKey,
+		"alice@example.com ssh-ed25519 !!!!",
+		"alice@example.com unknown-option " + opensshUserKey,
+		`alice@example.com valid-after="2020" ` + opensshUserKey,
+		`alice@example.com valid-before="20201340" ` + opensshUserKey,
+	} {
+		if _, err := ParseAllowedSigners(strings.NewReader(line)); err == nil {
+			t.Errorf("ParseAllowedSigners(%q) succeeded", line)
+		}
+	}
+}
+
+func TestMatchPatternList(t *testing.T) {
+	for _, tc := range []struct {
+		s        string
+		patterns string
+		want     bool
+	}{
+		{"alice@example.com", "alice@example.com", true},
+		{"alice@example.com", "bob@example.com", false},
+		{"alice@example.com", "*@example.com", true},
+		{"alice@example.com", "?lice@example.*", true},
+		{"alice@example.com", "a*e@*.com", true},
+		{"alice@example.com", "a*b@*.com", false},
+		{"alice@example.com", "*,!alice@*", false},
+		{"alice@example.com", "!bob@*", false},
+		{"alice@example.com", "!bob@*,*", true},
+	} {
+		if got := matchPatternList(tc.s, strings.Split(tc.patterns, ",")); got != tc.want {
+			t.Errorf("matchPatternList(%q, %q) = %v, want %v", tc.s, tc.patterns, got, tc.want)
+		}
+	}
+}
+
+func TestAllowedSignersVerify(t *testing.T) {
+	signer := testSigner(t, "ed25519")
+	message := []byte("a message to sign")
+	sig, err := Sign(rand.Reader, signer, bytes.NewReader(message), "git")
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	key := string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+	other := string(ssh.MarshalAuthorizedKey(testSigner(t, "ecdsa").PublicKey()))
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		desc           string
+		allowedSigners string
+		principal      string
+		ok             bool
+	}{
+		{"plain key", "alice " + key, "alice", true},
+		{"other principal", "alice " + key, "bob", false},
+		{"other key", "alice " + other, "alice", false},
+		{"principal pattern", "*@example.com " + key, "alice@example.com", true},
+		{"negated principal", "*@example.com,!alice@* " + key, "alice@example.com", false},
+		{"second entry", "alice " + other + "alice " + key, "alice", true},
+		{"namespace", `alice namespaces="file,g*" ` + key, "alice", true},
+		{"other namespace", `alice namespaces="file" ` + key, "alice", false},
+		{"valid", `alice valid-after="20240101Z",valid-before="20250101Z" ` + key, "alice", true},
+		{"not yet valid", `alice valid-after="20240602Z" ` + key, "alice", false},
+		{"expired", `alice valid-before="20240531Z" ` + key, "alice", false},
+		{"cert-authority for a plain key", "alice cert-authority " + key, "alice", false},
+	} {
+		signers, err := ParseAllowedSigners(strings.NewReader(tc.allowedSigners))
+		if err != nil {
+			t.Fatalf("%s: ParseAllowedSigners: %v", tc.desc, err)
+		}
+		err = signers.Verify(sig, bytes.NewReader(message), "git", tc.principal, now)
+		if tc.ok && err != nil {
+			t.Errorf("%s: Verify: %v", tc.desc, err)
+		} else if !tc.ok && err == nil {
+			t.Errorf("%s: Verify succeeded", tc.desc)
+		}
+	}
+}
+
+// opensshCertSignature was made with "ssh-keygen -Y sign -n git" for the
+// message "hello world\n", by a certificate of opensshUserKey for
+// alice@example.com signed by opensshCAKey, valid from 2020 to 2040.
+const opensshCertSignature = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAAcMAAAAgc3NoLWVkMjU1MTktY2VydC12MDFAb3BlbnNzaC5jb20AAA
+AgEcCYNl2N6Z4t+PEaMApk3/xtVVWIpM83yywS6d2a2l0AAAAgoyvfWQ05FFbiwZUMmzcJ
+B+dGkz/++xwG8e7bbGaPNSgAAAAAAAAAAAAAAAEAAAACaWQAAAAVAAAAEWFsaWNlQGV4YW
+1wbGUuY29tAAAAAF4L4QAAAAAAg6p+gAAAAAAAAACCAAAAFXBlcm1pdC1YMTEtZm9yd2Fy
+ZGluZwAAAAAAAAAXcGVybWl0LWFnZW50LWZvcndhcmRpbmcAAAAAAAAAFnBlcm1pdC1wb3
+J0LWZvcndhcmRpbmcAAAAAAAAACnBlcm1pdC1wdHkAAAAAAAAADnBlcm1pdC11c2VyLXJj
+AAAAAAAAAAAAAAAzAAAAC3NzaC1lZDI1NTE5AAAAIDat24aiNT1C1rMvkv5sCBwIIJM4sf
+QnxQCsqLKwj7/gAAAAUwAAAAtzc2gtZWQyNTUxOQAAAECkXHC9rxR8oApFitMbOlJP3Z73
+x8LeRPmgtsRzoSUu/SKFN+KUQvIGhN59bKIDZCcVWpOdVh/7r3C4zsOgDb4AAAAAA2dpdA
+AAAAAAAAAGc2hhNTEyAAAAUwAAAAtzc2gtZWQyNTUxOQAAAEA6oaielRZeIDVbTaDMDWS7
+TQB3MkIQGVB085i02UAG2J3KSA5qKs8rv0JdHWtUs6LotnVfMbhKJM27UjHdibgH
+-----END SSH SIGNATURE-----
+`
+
+const opensshCAKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDat24aiNT1C1rMvkv5sCBwIIJM4sfQnxQCsqLKwj7/g"
+
+func TestAllowedSignersCertificate(t *testing.T) {
+	sig, err := ParseSignature([]byte(opensshCertSignature))
+	if err != nil {
+		t.Fatalf("ParseSignature: %v", err)
+	}
+	message := "hello world\n"
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		desc           string
+		allowedSigners string
+		principal      string
+		time           time.Time
+		ok             bool
+	}{
+		{"cert-authority", "*@example.com cert-authority " + opensshCAKey, "alice@example.com", now, true},
+		{"not cert-authority", "*@example.com " + opensshCAKey, "alice@example.com", now, false},
+		{"user key", "alice@example.com " + opensshUserKey, "alice@example.com", now, false},
+		{"principal not in certificate", "*@example.com cert-authority " + opensshCAKey, "bob@example.com", now, false},
+		{"principal not allowed", "bob@example.com cert-authority " + opensshCAKey, "alice@example.com", now, false},
+		{"expired certificate", "*@example.com cert-authority " + opensshCAKey, "alice@example.com", now.AddDate(20, 0, 0), false},
+	} {
+		signers, err := ParseAllowedSigners(strings.NewReader(tc.allowedSigners))
+		if err != nil {
+			t.Fatalf("%s: ParseAllowedSigners: %v", tc.desc, err)
+		}
+		err = signers.Verify(sig, strings.NewReader(message), "git", tc.principal, tc.time)
+		if tc.ok && err != nil {
+			t.Errorf("%s: Verify: %v", tc.desc, err)
+		} else if !tc.ok && err == nil {
+			t.Errorf("%s: Verify succeeded", tc.desc)
+		}
+	}
+}
+
+func TestFindPrincipals(t *testing.T) {
+	signers, err := ParseAllowedSigners(strings.NewReader(`
+alice,alice@example.com ` + opensshUserKey + `
+bob ` + opensshCAKey + `
+*@example.com,!bob@example.com cert-authority ` + opensshCAKey + `
+carol namespaces="file" ` + opensshUserKey + `
+`))
+	if err != nil {
+		t.Fatalf("ParseAllowedSigners: %v", err)
+	}
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	sig, err := ParseSignature([]byte(opensshSignature))
+	if err != nil {
+		t.Fatalf("ParseSignature: %v", err)
+	}
+	if got, want := signers.FindPrincipals(sig.PublicKey, "file", now), []string{"alice", "alice@example.com", "carol"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindPrincipals(key, file) = %q, want %q", got, want)
+	}
+	if got, want := signers.FindPrincipals(sig.PublicKey, "git", now), []string{"alice", "alice@example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindPrincipals(key, git) = %q, want %q", got, want)
+	}
+
+	certSig, err := ParseSignature([]byte(opensshCertSignature))
+	if err != nil {
+		t.Fatalf("ParseSignature: %v", err)
+	}
+	if got, want := signers.FindPrincipals(certSig.PublicKey, "git", now), []string{"alice@example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindPrincipals(cert, git) = %q, want %q", got, want)
+	}
+	if got := signers.FindPrincipals(certSig.PublicKey, "git", now.AddDate(20, 0, 0)); len(got) != 0 {
+		t.Errorf("FindPrincipals(expired cert, git) = %q, want none", got)
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sshsig implements the SSHSIG signature format of OpenSSH, which is
+// created and verified by "ssh-keygen -Y sign" and "ssh-keygen -Y verify",
+// and is used among others to sign git commits. It also implements the
+// allowed_signers file, which maps principals to the keys they sign with.
+//
+// See https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig
+// and the ALLOWED SIGNERS section of ssh-keygen(1).
+package sshsig
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	magicPreamble = "SSHSIG"
+	sigVersion    = 1
+
+	armorBegin = "-----BEGIN SSH SIGNATURE-----"
+	armorEnd   = "-----END SSH SIGNATURE-----"
+)
+
+// The hash algorithms that can be used to hash the signed message.
+const (
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+)
+
+var hashFuncs = map[string]crypto.Hash{
+	HashSHA256: crypto.SHA256,
+	HashSHA512: crypto.SHA512,
+}
+
+// Signature is an SSHSIG signature.
+type Signature struct {
+	// PublicKey is the key that made the signature. It may be an
+	// *ssh.Certificate.
+	PublicKey ssh.PublicKey
+
+	// Namespace is the domain the signature is valid for, such as
+	// "git" or "file", so that a signature made for one purpose is not
+	// accepted for another.
+	Namespace string
+
+	// HashAlgorithm is the hash of the message that was signed, either
+	// HashSHA256 or HashSHA512.
+	HashAlgorithm string
+
+	// Signature is the signature over the hash of the message, the
+	// namespace and the hash algorithm.
+	Signature *ssh.Signature
+}
+
+// wireSignature is the binary encoding of a Signature, after the magic
+// preamble.
+type wireSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// signedData is the data that is actually signed, after the magic
+// preamble.
+type signedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// Sign signs the message read from message for namespace with signer, using
+// HashSHA512 like ssh-keygen does.
+func Sign(rand io.Reader, signer ssh.Signer, message io.Reader, namespace string) (*Signature, error) {
+	return SignWithHashAlgorithm(rand, signer, message, namespace, HashSHA512)
+}
+
+// SignWithHashAlgorithm is like Sign, but the message is hashed with
+// hashAlgorithm, which must be HashSHA256 or HashSHA512.
+func SignWithHashAlgorithm(rand io.Reader, signer ssh.Signer, message io.Reader, namespace, hashAlgorithm string) (*Signature, error) {
+	if namespace == "" {
+		return nil, errors.New("sshsig: namespace must not be empty")
+	}
+	data, err := hashMessage(message, namespace, hashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig *ssh.Signature
+	if underlyingType(signer.PublicKey()) == ssh.KeyAlgoRSA {
+		// RSA signatures must not use SHA-1.
+		algSigner, ok := signer.(ssh.AlgorithmSigner)
+		if !ok {
+			return nil, errors.New("sshsig: RSA keys must implement ssh.AlgorithmSigner")
+		}
+		sig, err = algSigner.SignWithAlgorithm(rand, data, ssh.SigAlgoRSASHA2512)
+	} else {
+		sig, err = signer.Sign(rand, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Signature{
+		PublicKey:     signer.PublicKey(),
+		Namespace:     namespace,
+		HashAlgorithm: hashAlgorithm,
+		Signature:     sig,
+	}, nil
+}
+
+// Verify checks that sig is a valid signature of the message read from
+// message for namespace. It does not check whether the key that made the
+// signature is trusted, see AllowedSigners for that.
+func Verify(sig *Signature, message io.Reader, namespace string) error {
+	if sig.Namespace != namespace {
+		return fmt.Errorf("sshsig: signature is for namespace %q, want %q", sig.Namespace, namespace)
+	}
+	if underlyingType(sig.PublicKey) == ssh.KeyAlgoRSA &&
+		sig.Signature.Format != ssh.SigAlgoRSASHA2256 && sig.Signature.Format != ssh.SigAlgoRSASHA2512 {
+		return fmt.Errorf("sshsig: RSA signature algorithm %q is not allowed", sig.Signature.Format)
+	}
+	data, err := hashMessage(message, sig.Namespace, sig.HashAlgorithm)
+	if err != nil {
+		return err
+	}
+	return sig.PublicKey.Verify(data, sig.Signature)
+}
+
+// hashMessage returns the data to sign for message.
+func hashMessage(message io.Reader, namespace, hashAlgorithm string) ([]byte, error) {
+	hashFunc, ok := hashFuncs[hashAlgorithm]
+	if !ok {
+		return nil, fmt.Errorf("sshsig: unsupported hash algorithm %q", hashAlgorithm)
+	}
+	h := hashFunc.New()
+	if _, err := io.Copy(h, message); err != nil {
+		return nil, err
+	}
+	return append([]byte(magicPreamble), ssh.Marshal(&signedData{
+		Namespace:     namespace,
+		HashAlgorithm: hashAlgorithm,
+		Hash:          h.Sum(nil),
+	})...), nil
+}
+
+// underlyingType returns the type of key, or of the key of a certificate.
+func underlyingType(key ssh.PublicKey) string {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		return cert.Key.Type()
+	}
+	return key.Type()
+}
+
+// Marshal returns the signature in the armored format written by
+// ssh-keygen.
+func (s *Signature) Marshal() []byte {
+	blob := append([]byte(magicPreamble), ssh.Marshal(&wireSignature{
+		Version:       sigVersion,
+		PublicKey:     s.PublicKey.Marshal(),
+		Namespace:     s.Namespace,
+		HashAlgorithm: s.HashAlgorithm,
+		Signature:     ssh.Marshal(s.Signature),
+	})...)
+	encoded := base64.StdEncoding.EncodeToString(blob)
+
+	var b bytes.Buffer
+	b.WriteString(armorBegin + "\n")
+	for len(encoded) > 0 {
+		n := 70
+		if n > len(encoded) {
+			n = len(encoded)
+		}
+		b.WriteString(encoded[:n] + "\n")
+		encoded = encoded[n:]
+	}
+	b.WriteString(armorEnd + "\n")
+	return b.Bytes()
+}
+
+// ParseSignature parses a signature in the armored format written by
+// ssh-keygen.
+func ParseSignature(armored []byte) (*Signature, error) {
+	armored = bytes.TrimSpace(armored)
+	if !bytes.HasPrefix(armored, []byte(armorBegin)) || !bytes.HasSuffix(armored, []byte(armorEnd)) {
+		return nil, errors.New("sshsig: missing SSH SIGNATURE armor")
+	}
+	encoded := armored[len(armorBegin) : len(armored)-len(armorEnd)]
+	blob, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(encoded), nil)))
+	if err != nil {
+		return nil, fmt.Errorf("sshsig: invalid signature encoding: %v", err)
+	}
+	if !bytes.HasPrefix(blob, []byte(magicPreamble)) {
+		return nil, errors.New("sshsig: invalid signature preamble")
+	}
+
+	var w wireSignature
+	if err := ssh.Unmarshal(blob[len(magicPreamble):], &w); err != nil {
+		return nil, fmt.Errorf("sshsig: invalid signature: %v", err)
+	}
+	if w.Version != sigVersion {
+		return nil, fmt.Errorf("sshsig: unsupported signature version %d", w.Version)
+	}
+	if _, ok := hashFuncs[w.HashAlgorithm]; !ok {
+		return nil, fmt.Errorf("sshsig: unsupported hash algorithm %q", w.HashAlgorithm)
+	}
+	pub, err := ssh.ParsePublicKey(w.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	sig := new(ssh.Signature)
+	if err := ssh.Unmarshal(w.Signature, sig); err != nil {
+		return nil, fmt.Errorf("sshsig: invalid signature: %v", err)
+	}
+	return &Signature{
+		PublicKey:     pub,
+		Namespace:     w.Namespace,
+		HashAlgorithm: w.HashAlgorithm,
+		Signature:     sig,
+	}, nil
+}
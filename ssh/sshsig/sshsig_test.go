@@ -0,0 +1,110 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshsig
+
+import (
+	"bytes"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/testdata"
+)
+
+func testSigner(t *testing.T, name string) ssh.Signer {
+	signer, err := ssh.ParsePrivateKey(testdata.PEMBytes[name])
+	if err != nil {
+		t.Fatalf("ParsePrivateKey(%q): %v", name, err)
+	}
+	return signer
+}
+
+func TestSignVerify(t *testing.T) {
+	message := []byte("a message to sign")
+	for _, keyName := range []string{"rsa", "ecdsa", "ed25519"} {
+		for _, hashAlgo := range []string{HashSHA256, HashSHA512} {
+			signer := testSigner(t, keyName)
+			sig, err := SignWithHashAlgorithm(rand.Reader, signer, bytes.NewReader(message), "file", hashAlgo)
+			if err != nil {
+				t.Fatalf("%s/%s: Sign: %v", keyName, hashAlgo, err)
+			}
+			if keyName == "rsa" && sig.Signature.Format != ssh.SigAlgoRSASHA2512 {
+				t.Errorf("%s/%s: signature format %q, want %q", keyName, hashAlgo, sig.Signature.Format, ssh.SigAlgoRSASHA2512)
+			}
+
+			parsed, err := ParseSignature(sig.Marshal())
+			if err != nil {
+				t.Fatalf("%s/%s: ParseSignature: %v", keyName, hashAlgo, err)
+			}
+			if err := Verify(parsed, bytes.NewReader(message), "file"); err != nil {
+				t.Errorf("%s/%s: Verify: %v", keyName, hashAlgo, err)
+			}
+			if err := Verify(parsed, strings.NewReader("another message"), "file"); err == nil {
+				t.Errorf("%s/%s: Verify succeeded for another message", keyName, hashAlgo)
+			}
+			if err := Verify(parsed, bytes.NewReader(message), "git"); err == nil {
+				t.Errorf("%s/%s: Verify succeeded for another namespace", keyName, hashAlgo)
+			}
+		}
+	}
+}
+
+func TestSignErrors(t *testing.T) {
+	signer := testSigner(t, "ed25519")
+	if _, err := Sign(rand.Reader, signer, strings.NewReader("message"), ""); err == nil {
+		t.Error("Sign succeeded with an empty namespace")
+	}
+	if _, err := SignWithHashAlgorithm(rand.Reader, signer, strings.NewReader("message"), "file", "md5"); err == nil {
+		t.Error("Sign succeeded with an unsupported hash algorithm")
+	}
+}
+
+// opensshSignature was made with "ssh-keygen -Y sign -n file" for the
+// message "hello world\n", by opensshUserKey.
+const opensshSignature = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAgoyvfWQ05FFbiwZUMmzcJB+dGkz
+/++xwG8e7bbGaPNSgAAAAEZmlsZQAAAAAAAAAGc2hhNTEyAAAAUwAAAAtzc2gtZWQyNTUx
+OQAAAEApFoFJ6ez2Sry8ARzqQdlnwW2op/6SajsUUBf5+O+t4ui8sG9CENKB1y8iNW4DYy
+ZXZw+/odkrOgTQxBSQetoD
+-----END SSH SIGNATURE-----
+`
+
+const opensshUserKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKMr31kNORRW4sGVDJs3CQfnRpM//vscBvHu22xmjzUo"
+
+func TestVerifyOpenSSH(t *testing.T) {
+	sig, err := ParseSignature([]byte(opensshSignature))
+	if err != nil {
+		t.Fatalf("ParseSignature: %v", err)
+	}
+	if sig.Namespace != "file" || sig.HashAlgorithm != HashSHA512 {
+		t.Errorf("got namespace %q and hash %q, want %q and %q", sig.Namespace, sig.HashAlgorithm, "file", HashSHA512)
+	}
+	if got := string(ssh.MarshalAuthorizedKey(sig.PublicKey)); got != opensshUserKey+"\n" {
+		t.Errorf("got key %q, want %q", got, opensshUserKey)
+	}
+	if err := Verify(sig, strings.NewReader("hello world\n"), "file"); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	// The armor is the same as the one of ssh-keygen.
+	if got := string(sig.Marshal()); got != opensshSignature {
+		t.Errorf("Marshal: got\n%s\nwant\n%s", got, opensshSignature)
+	}
+}
+
+func TestParseSignatureErrors(t *testing.T) {
+	for _, armored := range []string{
+		"",
+		"-----BEGIN SSH SIGNATURE-----\n-----END SSH SIGNATURE-----\n",
+		"-----BEGIN SSH SIGNATURE-----\n!!!!\n-----END SSH SIGNATURE-----\n",
+		"-----BEGIN SSH SIGNATURE-----\nU1NIU0lH\n-----END SSH SIGNATURE-----\n",
+		strings.Replace(opensshSignature, "U1NIU0lH", "U1NIU0lI", 1),
+	} {
+		if _, err := ParseSignature([]byte(armored)); err == nil {
+			t.Errorf("ParseSignature(%q) succeeded", armored)
+		}
+	}
+}
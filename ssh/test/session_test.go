@@ -403,6 +403,10 @@ func TestKeyExchanges(t *testing.T) {
 	// are not included in the default list of supported kex so we have to add them
 	// here manually.
 	kexOrder = append(kexOrder, "diffie-hellman-group-exchange-sha1", "diffie-hellman-group-exchange-sha256")
+	// The hybrid post-quantum key exchanges are not enabled by default either.
+	kexOrder = append(kexOrder, "sntrup761x25519-sha512@openssh.com", "mlkem768x25519-sha256")
+	// Neither is the slow 8192-bit group.
+	kexOrder = append(kexOrder, "diffie-hellman-group18-sha512")
 	for _, kex := range kexOrder {
 		t.Run(kex, func(t *testing.T) {
 			server := newServer(t)
@@ -10,6 +10,7 @@ import (
 	"errors"
 	"io"
 	"log"
+	"sync/atomic"
 )
 
 // debugTransport if set, will print packet types as they go over the
@@ -48,6 +49,16 @@ type transport struct {
 	rand      io.Reader
 	isClient  bool
 	io.Closer
+
+	// strict is set if both sides agreed on strict key exchange. See
+	// setStrictMode.
+	strict         bool
+	initialKEXDone bool
+
+	// authenticated is set to 1 once user authentication succeeded,
+	// which enables delayed compression. It is accessed atomically, as
+	// the reading and writing sides of the transport use it.
+	authenticated uint32
 }
 
 // packetCipher represents a combination of SSH encryption/MAC
@@ -81,17 +92,42 @@ func (t *transport) prepareKeyChange(algs *algorithms, kexResult *kexResult) err
 	if err != nil {
 		return err
 	}
+	if algs.r.Compression != compressionNone {
+		ciph = newCompressedPacketCipher(ciph, algs.r.Compression, &t.authenticated)
+	}
 	t.reader.pendingKeyChange <- ciph
 
 	ciph, err = newPacketCipher(t.writer.dir, algs.w, kexResult)
 	if err != nil {
 		return err
 	}
+	if algs.w.Compression != compressionNone {
+		ciph = newCompressedPacketCipher(ciph, algs.w.Compression, &t.authenticated)
+	}
 	t.writer.pendingKeyChange <- ciph
 
 	return nil
 }
 
+// setStrictMode enables strict key exchange, as defined by the
+// kex-strict-c-v00@openssh.com and kex-strict-s-v00@openssh.com
+// extensions. Sequence numbers are reset after each msgNewKeys, and
+// msgIgnore and msgDebug are passed up until the initial key exchange is
+// done, so that the key exchange can reject them. It must be called before
+// any packet other than the msgKexInit of the other side is read.
+func (t *transport) setStrictMode() error {
+	if t.reader.seqNum != 1 {
+		return errors.New("ssh: sequence number != 1 when strict KEX mode requested")
+	}
+	t.strict = true
+	return nil
+}
+
+// setInitialKEXDone records that the first key exchange completed.
+func (t *transport) setInitialKEXDone() {
+	t.initialKEXDone = true
+}
+
 func (t *transport) printPacket(p []byte, write bool) {
 	if len(p) == 0 {
 		return
@@ -111,14 +147,21 @@ func (t *transport) printPacket(p []byte, write bool) {
 // Read and decrypt next packet.
 func (t *transport) readPacket() (p []byte, err error) {
 	for {
-		p, err = t.reader.readPacket(t.bufReader)
+		p, err = t.reader.readPacket(t.bufReader, t.strict)
 		if err != nil {
 			break
 		}
-		if len(p) == 0 || (p[0] != msgIgnore && p[0] != msgDebug) {
+		// In strict mode, msgIgnore and msgDebug are not allowed
+		// during the initial key exchange, so pass them up.
+		if len(p) == 0 || (t.strict && !t.initialKEXDone) || (p[0] != msgIgnore && p[0] != msgDebug) {
 			break
 		}
 	}
+	// The server starts delayed compression right after sending
+	// msgUserAuthSuccess, so the client does so right after reading it.
+	if err == nil && t.isClient && p[0] == msgUserAuthSuccess {
+		atomic.StoreUint32(&t.authenticated, 1)
+	}
 	if debugTransport {
 		t.printPacket(p, false)
 	}
@@ -126,7 +169,7 @@ func (t *transport) readPacket() (p []byte, err error) {
 	return p, err
 }
 
-func (s *connectionState) readPacket(r *bufio.Reader) ([]byte, error) {
+func (s *connectionState) readPacket(r *bufio.Reader, strictMode bool) ([]byte, error) {
 	packet, err := s.packetCipher.readCipherPacket(s.seqNum, r)
 	s.seqNum++
 	if err == nil && len(packet) == 0 {
@@ -139,6 +182,9 @@ func (s *connectionState) readPacket(r *bufio.Reader) ([]byte, error) {
 			select {
 			case cipher := <-s.pendingKeyChange:
 				s.packetCipher = cipher
+				if strictMode {
+					s.seqNum = 0
+				}
 			default:
 				return nil, errors.New("ssh: got bogus newkeys message")
 			}
@@ -169,10 +215,16 @@ func (t *transport) writePacket(packet []byte) error {
 	if debugTransport {
 		t.printPacket(packet, true)
 	}
-	return t.writer.writePacket(t.bufWriter, t.rand, packet)
+	if err := t.writer.writePacket(t.bufWriter, t.rand, packet, t.strict); err != nil {
+		return err
+	}
+	if !t.isClient && len(packet) > 0 && packet[0] == msgUserAuthSuccess {
+		atomic.StoreUint32(&t.authenticated, 1)
+	}
+	return nil
 }
 
-func (s *connectionState) writePacket(w *bufio.Writer, rand io.Reader, packet []byte) error {
+func (s *connectionState) writePacket(w *bufio.Writer, rand io.Reader, packet []byte, strictMode bool) error {
 	changeKeys := len(packet) > 0 && packet[0] == msgNewKeys
 
 	err := s.packetCipher.writeCipherPacket(s.seqNum, w, rand, packet)
@@ -187,6 +239,9 @@ func (s *connectionState) writePacket(w *bufio.Writer, rand io.Reader, packet []
 		select {
 		case cipher := <-s.pendingKeyChange:
 			s.packetCipher = cipher
+			if strictMode {
+				s.seqNum = 0
+			}
 		default:
 			panic("ssh: no key material for msgNewKeys")
 		}